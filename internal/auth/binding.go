@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/clientinfo"
+)
+
+// BindingMode is how a session binding mismatch is handled
+type BindingMode string
+
+// Binding modes
+const (
+	// BindingWarn logs mismatches but accepts the token, to gauge the
+	// impact before enforcing
+	BindingWarn BindingMode = "warn"
+	// BindingEnforce rejects tokens used from a mismatched client
+	BindingEnforce BindingMode = "enforce"
+)
+
+// Default binding subnet sizes. Mobile clients move between addresses
+// within their carrier's range, so sessions are bound to a subnet rather
+// than a single address.
+const (
+	DefaultIPv4BindingPrefix = 24
+	DefaultIPv6BindingPrefix = 48
+)
+
+// SessionBinding configures binding sessions to the client that signed in
+type SessionBinding struct {
+	Mode BindingMode
+	// IPv4Prefix and IPv6Prefix are the subnet sizes, in bits, a session's
+	// address must stay within. Zero uses the default; a negative value
+	// disables address binding for that family.
+	IPv4Prefix int
+	IPv6Prefix int
+	// UserAgent also binds the session to the client's user agent
+	UserAgent bool
+}
+
+// Validate reports the first problem with the configuration
+func (b SessionBinding) Validate() error {
+	if b.Mode != BindingWarn && b.Mode != BindingEnforce {
+		return fmt.Errorf("unknown session binding mode %q", b.Mode)
+	}
+	if b.IPv4Prefix > 32 {
+		return errors.New("IPv4 binding prefix must be at most 32 bits")
+	}
+	if b.IPv6Prefix > 128 {
+		return errors.New("IPv6 binding prefix must be at most 128 bits")
+	}
+	return nil
+}
+
+// Binding is the client a session is bound to, carried in its tokens
+type Binding struct {
+	// Subnet is the CIDR the client's address must stay within
+	Subnet string `json:"net,omitempty"`
+	// UserAgent is the fingerprint of the client's user agent
+	UserAgent string `json:"ua,omitempty"`
+}
+
+// SetSessionBinding binds sessions issued from now on to the client's subnet
+// and, optionally, user agent. ValidateToken and the RequireMFA interceptor
+// then check tokens against the client they are used from. It requires a
+// token issuer.
+func (s *AuthService) SetSessionBinding(binding SessionBinding) error {
+	if err := binding.Validate(); err != nil {
+		return fmt.Errorf("invalid session binding config: %w", err)
+	}
+	s.binding = &binding
+	return nil
+}
+
+// bind returns the binding for a session signed in by client, or nil if
+// binding is disabled or the client is unknown
+func (b *SessionBinding) bind(client clientinfo.Info) *Binding {
+	if b == nil {
+		return nil
+	}
+
+	binding := &Binding{Subnet: b.subnet(client.IP)}
+	if b.UserAgent && client.UserAgent != "" {
+		binding.UserAgent = userAgentFingerprint(client.UserAgent)
+	}
+	if *binding == (Binding{}) {
+		return nil
+	}
+	return binding
+}
+
+// matches reports whether client is the one the session is bound to. The
+// address matches anywhere in the bound subnet.
+func (b *SessionBinding) matches(bound *Binding, client clientinfo.Info) bool {
+	if bound.Subnet != "" {
+		_, network, err := net.ParseCIDR(bound.Subnet)
+		ip := net.ParseIP(client.IP)
+		if err != nil || ip == nil || !network.Contains(ip) {
+			return false
+		}
+	}
+	if bound.UserAgent != "" && bound.UserAgent != userAgentFingerprint(client.UserAgent) {
+		return false
+	}
+	return true
+}
+
+// subnet returns the CIDR of the configured size containing ip, or "" if ip
+// is invalid or its family isn't bound
+func (b *SessionBinding) subnet(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	prefix, bits := b.IPv6Prefix, 128
+	if v4 := parsed.To4(); v4 != nil {
+		parsed, prefix, bits = v4, b.IPv4Prefix, 32
+		if prefix == 0 {
+			prefix = DefaultIPv4BindingPrefix
+		}
+	} else if prefix == 0 {
+		prefix = DefaultIPv6BindingPrefix
+	}
+	if prefix < 0 {
+		return ""
+	}
+
+	network := &net.IPNet{IP: parsed.Mask(net.CIDRMask(prefix, bits)), Mask: net.CIDRMask(prefix, bits)}
+	return network.String()
+}
+
+// userAgentVersions matches version numbers, which change with every
+// browser or OS update
+var userAgentVersions = regexp.MustCompile(`[0-9]+([._][0-9]+)*`)
+
+// userAgentFingerprint identifies the user agent's browser and platform,
+// ignoring versions so updates don't break bound sessions
+func userAgentFingerprint(userAgent string) string {
+	normalized := userAgentVersions.ReplaceAllString(strings.ToLower(userAgent), "")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:16])
+}
+
+// checkBinding reports whether a token with claims may be used by client.
+// Mismatches are logged; in warn mode they are otherwise allowed.
+func (s *AuthService) checkBinding(claims *Claims, client clientinfo.Info) bool {
+	if s.binding == nil || claims.Binding == nil || s.binding.matches(claims.Binding, client) {
+		return true
+	}
+
+	s.logger.Warn("Session used from a mismatched client",
+		zap.String("session_id", claims.SessionID),
+		zap.String("bound_subnet", claims.Binding.Subnet),
+		zap.String("client_ip", client.IP),
+		zap.String("user_agent", client.UserAgent),
+		zap.String("mode", string(s.binding.Mode)))
+
+	return s.binding.Mode != BindingEnforce
+}
+
+// validatingClient returns the client a token is being used from, which the
+// caller of ValidateToken must name when sessions are bound. The caller's
+// own address would compare the wrong client.
+func (s *AuthService) validatingClient(req *ValidateTokenRequest) (clientinfo.Info, error) {
+	if s.binding == nil {
+		return clientinfo.Info{}, nil
+	}
+	if req.ClientIp == "" {
+		return clientinfo.Info{}, status.Error(codes.InvalidArgument, "client_ip is required when sessions are bound")
+	}
+	if s.binding.UserAgent && req.UserAgent == "" {
+		return clientinfo.Info{}, status.Error(codes.InvalidArgument, "user_agent is required when sessions are bound to it")
+	}
+	return clientinfo.Info{IP: req.ClientIp, UserAgent: req.UserAgent}, nil
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/clientinfo"
+)
+
+const (
+	testUserAgent    = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 Version/17.4 Safari/605.1.15"
+	updatedUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 Version/17.5 Safari/605.1.15"
+	otherUserAgent   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Gecko/20100101 Firefox/125.0"
+)
+
+// newBindingService creates a service that binds sessions with binding,
+// logging to the returned observer
+func newBindingService(t *testing.T, binding SessionBinding) (*AuthService, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zap.WarnLevel)
+	store := newTestStore(t)
+	s := NewAuthService(zap.New(core), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+	s.SetTokenIssuer(newTestIssuer(t))
+	if err := s.SetSessionBinding(binding); err != nil {
+		t.Fatalf("SetSessionBinding: %v", err)
+	}
+	return s, logs
+}
+
+// issueBound issues an MFA token for a sign-in by client
+func issueBound(t *testing.T, s *AuthService, client clientinfo.Info) string {
+	t.Helper()
+	ctx := clientinfo.NewContext(context.Background(), client)
+	token, _, err := s.issueToken(ctx, "user-1", []string{AMRPassword, AMRMFA, AMROTP})
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+	return token
+}
+
+func TestSessionBindingValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		binding SessionBinding
+		wantErr bool
+	}{
+		{name: "warn", binding: SessionBinding{Mode: BindingWarn}},
+		{name: "enforce with prefixes", binding: SessionBinding{Mode: BindingEnforce, IPv4Prefix: 32, IPv6Prefix: -1, UserAgent: true}},
+		{name: "no mode", binding: SessionBinding{}, wantErr: true},
+		{name: "unknown mode", binding: SessionBinding{Mode: "strict"}, wantErr: true},
+		{name: "IPv4 prefix too long", binding: SessionBinding{Mode: BindingWarn, IPv4Prefix: 33}, wantErr: true},
+		{name: "IPv6 prefix too long", binding: SessionBinding{Mode: BindingWarn, IPv6Prefix: 129}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.binding.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionBindingBind(t *testing.T) {
+	tests := []struct {
+		name       string
+		binding    SessionBinding
+		client     clientinfo.Info
+		wantSubnet string
+		wantUA     bool
+	}{
+		{name: "IPv4 default subnet", binding: SessionBinding{Mode: BindingEnforce}, client: clientinfo.Info{IP: "203.0.113.77"}, wantSubnet: "203.0.113.0/24"},
+		{name: "IPv6 default subnet", binding: SessionBinding{Mode: BindingEnforce}, client: clientinfo.Info{IP: "2001:db8:1:2::5"}, wantSubnet: "2001:db8:1::/48"},
+		{name: "custom prefix", binding: SessionBinding{Mode: BindingEnforce, IPv4Prefix: 32}, client: clientinfo.Info{IP: "203.0.113.77"}, wantSubnet: "203.0.113.77/32"},
+		{name: "user agent", binding: SessionBinding{Mode: BindingEnforce, UserAgent: true}, client: clientinfo.Info{IP: "203.0.113.77", UserAgent: testUserAgent}, wantSubnet: "203.0.113.0/24", wantUA: true},
+		{name: "address binding disabled", binding: SessionBinding{Mode: BindingEnforce, IPv4Prefix: -1, UserAgent: true}, client: clientinfo.Info{IP: "203.0.113.77", UserAgent: testUserAgent}, wantUA: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.binding.bind(tt.client)
+			if got == nil {
+				t.Fatal("bind() = nil, want a binding")
+			}
+			if got.Subnet != tt.wantSubnet {
+				t.Errorf("subnet = %q, want %q", got.Subnet, tt.wantSubnet)
+			}
+			if (got.UserAgent != "") != tt.wantUA {
+				t.Errorf("user agent fingerprint = %q, want set %v", got.UserAgent, tt.wantUA)
+			}
+		})
+	}
+
+	// Nothing to bind to leaves the session unbound
+	if got := (&SessionBinding{Mode: BindingEnforce}).bind(clientinfo.Info{}); got != nil {
+		t.Errorf("bind(unknown client) = %+v, want nil", got)
+	}
+	if got := (*SessionBinding)(nil).bind(clientinfo.Info{IP: "203.0.113.77"}); got != nil {
+		t.Errorf("disabled bind() = %+v, want nil", got)
+	}
+}
+
+func TestValidateTokenBinding(t *testing.T) {
+	signIn := clientinfo.Info{IP: "203.0.113.77", UserAgent: testUserAgent}
+
+	tests := []struct {
+		name      string
+		mode      BindingMode
+		clientIP  string
+		userAgent string
+		wantValid bool
+		wantWarn  bool
+	}{
+		{name: "same client", mode: BindingEnforce, clientIP: "203.0.113.77", userAgent: testUserAgent, wantValid: true},
+		{name: "same subnet", mode: BindingEnforce, clientIP: "203.0.113.9", userAgent: testUserAgent, wantValid: true},
+		{name: "updated browser", mode: BindingEnforce, clientIP: "203.0.113.77", userAgent: updatedUserAgent, wantValid: true},
+		{name: "enforce other subnet", mode: BindingEnforce, clientIP: "198.51.100.7", userAgent: testUserAgent, wantWarn: true},
+		{name: "enforce other browser", mode: BindingEnforce, clientIP: "203.0.113.77", userAgent: otherUserAgent, wantWarn: true},
+		{name: "warn other subnet", mode: BindingWarn, clientIP: "198.51.100.7", userAgent: testUserAgent, wantValid: true, wantWarn: true},
+		{name: "warn other browser", mode: BindingWarn, clientIP: "203.0.113.77", userAgent: otherUserAgent, wantValid: true, wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, logs := newBindingService(t, SessionBinding{Mode: tt.mode, UserAgent: true})
+			token := issueBound(t, s, signIn)
+
+			resp, err := s.ValidateToken(context.Background(), &ValidateTokenRequest{
+				Token:     token,
+				ClientIp:  tt.clientIP,
+				UserAgent: tt.userAgent,
+			})
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+			if resp.Valid != tt.wantValid {
+				t.Errorf("valid = %v, want %v", resp.Valid, tt.wantValid)
+			}
+			if warned := logs.FilterMessage("Session used from a mismatched client").Len() > 0; warned != tt.wantWarn {
+				t.Errorf("mismatch logged = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestValidateTokenBindingRequiresClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		clientIP  string
+		userAgent string
+	}{
+		{name: "missing client IP", userAgent: testUserAgent},
+		{name: "missing user agent", clientIP: "203.0.113.77"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newBindingService(t, SessionBinding{Mode: BindingWarn, UserAgent: true})
+			token := issueBound(t, s, clientinfo.Info{IP: "203.0.113.77", UserAgent: testUserAgent})
+
+			_, err := s.ValidateToken(context.Background(), &ValidateTokenRequest{
+				Token:     token,
+				ClientIp:  tt.clientIP,
+				UserAgent: tt.userAgent,
+			})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("ValidateToken error = %v, want %v", err, codes.InvalidArgument)
+			}
+		})
+	}
+}
+
+func TestRequireMFABinding(t *testing.T) {
+	const method = "/polyid.auth.AuthService/DeletePasskey"
+	signIn := clientinfo.Info{IP: "2001:db8:1:2::5"}
+
+	tests := []struct {
+		name     string
+		mode     BindingMode
+		caller   clientinfo.Info
+		wantCode codes.Code
+	}{
+		{name: "matching", mode: BindingEnforce, caller: clientinfo.Info{IP: "2001:db8:1:ff::9"}},
+		{name: "mismatched enforce", mode: BindingEnforce, caller: clientinfo.Info{IP: "2001:db8:2::9"}, wantCode: codes.Unauthenticated},
+		{name: "mismatched warn", mode: BindingWarn, caller: clientinfo.Info{IP: "2001:db8:2::9"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newBindingService(t, SessionBinding{Mode: tt.mode})
+			token := issueBound(t, s, signIn)
+
+			ctx := clientinfo.NewContext(withBearer(context.Background(), token), tt.caller)
+			called := false
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				return "ok", nil
+			}
+
+			_, err := s.RequireMFA(method)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("interceptor error = %v, want %v", err, tt.wantCode)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCode == codes.OK)
+			}
+		})
+	}
+}
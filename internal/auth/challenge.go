@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// mfaChallengeTTL is how long a client has to complete an MFA challenge
+const mfaChallengeTTL = 5 * time.Minute
+
+// newMFAChallenge records a pending MFA challenge for the user and returns
+// the payload telling the client which methods can complete it
+func (s *AuthService) newMFAChallenge(ctx context.Context, userID string, methods []*storage.MFAMethod) (*MFAChallenge, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge ID: %w", err)
+	}
+	challengeID := hex.EncodeToString(b)
+
+	if err := s.store.StoreTemporaryValue(ctx, "mfa_challenge:"+challengeID, userID, mfaChallengeTTL); err != nil {
+		return nil, fmt.Errorf("failed to store MFA challenge: %w", err)
+	}
+
+	// Report each method type once, in the order the user enrolled them
+	seen := make(map[string]bool, len(methods))
+	types := make([]string, 0, len(methods))
+	for _, method := range methods {
+		if !seen[method.Type] {
+			seen[method.Type] = true
+			types = append(types, method.Type)
+		}
+	}
+
+	return &MFAChallenge{
+		ChallengeId: challengeID,
+		Methods:     types,
+		ExpiresAt:   time.Now().Add(mfaChallengeTTL).Unix(),
+	}, nil
+}
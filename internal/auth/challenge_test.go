@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+func TestAuthenticateStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		methods     []*storage.MFAMethod
+		code        string
+		risk        RiskEvaluator
+		wantStatus  AuthenticateResponse_Status
+		wantMethods []string // offered by the MFA challenge
+	}{
+		{
+			name:       "password only",
+			methods:    []*storage.MFAMethod{},
+			wantStatus: AuthenticateResponse_AUTHENTICATED,
+		},
+		{
+			name:       "password and MFA code",
+			methods:    []*storage.MFAMethod{{ID: "mfa-1", UserID: "user-1", Type: "totp"}},
+			code:       "123456",
+			wantStatus: AuthenticateResponse_AUTHENTICATED,
+		},
+		{
+			name: "MFA required",
+			methods: []*storage.MFAMethod{
+				{ID: "mfa-1", UserID: "user-1", Type: "totp"},
+				{ID: "mfa-2", UserID: "user-1", Type: "sms"},
+				{ID: "mfa-3", UserID: "user-1", Type: "totp"},
+			},
+			wantStatus:  AuthenticateResponse_MFA_REQUIRED,
+			wantMethods: []string{"totp", "sms"},
+		},
+		{
+			name:       "locked",
+			methods:    []*storage.MFAMethod{{ID: "mfa-1", UserID: "user-1", Type: "totp"}},
+			code:       "123456",
+			risk:       staticRisk{decision: RiskDeny},
+			wantStatus: AuthenticateResponse_LOCKED,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			store.methods = tt.methods
+			s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+			s.SetCredentialVerifier(testVerifier{})
+			s.SetTokenIssuer(newTestIssuer(t))
+			if tt.risk != nil {
+				s.SetRiskEvaluator(tt.risk)
+			}
+			ctx := context.Background()
+
+			resp, err := s.Authenticate(ctx, &AuthenticateRequest{
+				Email:      "a@example.com",
+				AuthMethod: &AuthenticateRequest_Password{Password: "correct"},
+				MfaCode:    tt.code,
+			})
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Fatalf("Authenticate() status = %s, want %s", resp.Status, tt.wantStatus)
+			}
+
+			authenticated := tt.wantStatus == AuthenticateResponse_AUTHENTICATED
+			if got := resp.Token != ""; got != authenticated {
+				t.Errorf("Authenticate() returned token = %v, want %v", got, authenticated)
+			}
+			if got := resp.User != nil; got != authenticated {
+				t.Errorf("Authenticate() returned user = %v, want %v", got, authenticated)
+			}
+			if resp.RequiresMfa != (tt.wantStatus == AuthenticateResponse_MFA_REQUIRED) {
+				t.Errorf("Authenticate() requires_mfa = %v with status %s", resp.RequiresMfa, resp.Status)
+			}
+
+			challenge := resp.MfaChallenge
+			if tt.wantMethods == nil {
+				if challenge != nil {
+					t.Errorf("Authenticate() returned MFA challenge %v with status %s", challenge, resp.Status)
+				}
+				return
+			}
+			if challenge == nil {
+				t.Fatal("Authenticate() returned no MFA challenge")
+			}
+			if !reflect.DeepEqual(challenge.Methods, tt.wantMethods) {
+				t.Errorf("challenge methods = %v, want %v", challenge.Methods, tt.wantMethods)
+			}
+			if expires := time.Unix(challenge.ExpiresAt, 0); expires.Before(time.Now()) || expires.After(time.Now().Add(mfaChallengeTTL+time.Second)) {
+				t.Errorf("challenge expires at %v, want within %v", expires, mfaChallengeTTL)
+			}
+			userID, err := store.GetTemporaryValue(ctx, "mfa_challenge:"+challenge.ChallengeId)
+			if err != nil || userID != "user-1" {
+				t.Errorf("stored challenge = %q, %v, want user-1", userID, err)
+			}
+		})
+	}
+}
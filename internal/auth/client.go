@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Errors returned by Client, usable with errors.Is
+var (
+	ErrInvalidRequest   = errors.New("invalid request")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNotFound         = errors.New("not found")
+	ErrUnavailable      = errors.New("service unavailable")
+	ErrServer           = errors.New("server error")
+)
+
+// ClientError is returned by Client methods when a call fails
+type ClientError struct {
+	Kind    error
+	Message string
+}
+
+func (e *ClientError) Error() string {
+	return e.Kind.Error() + ": " + e.Message
+}
+
+func (e *ClientError) Unwrap() error {
+	return e.Kind
+}
+
+// Client is a convenience wrapper around the generated Auth gRPC stub. It
+// attaches the session token to outgoing calls and translates gRPC status
+// errors into ClientError values.
+type Client struct {
+	stub AuthClient
+
+	mu    sync.RWMutex
+	token string
+}
+
+// NewClient creates a client using an established gRPC connection
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{
+		stub: NewAuthClient(conn),
+	}
+}
+
+// SetToken sets the session token attached to subsequent calls
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Login authenticates with an email and password. If the response status is
+// MFA_REQUIRED, call Login again with a code for one of the methods in the
+// MFA challenge. On success the returned token is used for subsequent calls.
+func (c *Client) Login(ctx context.Context, email, password, mfaCode string) (*AuthenticateResponse, error) {
+	resp, err := c.stub.Authenticate(c.outgoing(ctx), &AuthenticateRequest{
+		Email:      email,
+		AuthMethod: &AuthenticateRequest_Password{Password: password},
+		MfaCode:    mfaCode,
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	if resp.Token != "" {
+		c.SetToken(resp.Token)
+	}
+	return resp, nil
+}
+
+// ValidateToken validates a token and returns its user
+func (c *Client) ValidateToken(ctx context.Context, token string) (*User, error) {
+	return c.ValidateTokenFor(ctx, token, "", "")
+}
+
+// ValidateTokenFor validates a token used by the end client at clientIP with
+// userAgent, as required when the server binds sessions to their client
+func (c *Client) ValidateTokenFor(ctx context.Context, token, clientIP, userAgent string) (*User, error) {
+	resp, err := c.stub.ValidateToken(c.outgoing(ctx), &ValidateTokenRequest{
+		Token:     token,
+		ClientIp:  clientIP,
+		UserAgent: userAgent,
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if resp.ReauthRequired {
+		return nil, &ClientError{Kind: ErrUnauthenticated, Message: "session quarantined; sign in again"}
+	}
+	if !resp.Valid {
+		return nil, &ClientError{Kind: ErrUnauthenticated, Message: "token is not valid"}
+	}
+	return resp.User, nil
+}
+
+// EnrollTOTP starts TOTP enrollment and returns the setup data
+func (c *Client) EnrollTOTP(ctx context.Context, userID string) (*MFASetupData, error) {
+	resp, err := c.stub.AddMFAMethod(c.outgoing(ctx), &AddMFAMethodRequest{
+		UserId: userID,
+		Method: "totp",
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return resp.SetupData, nil
+}
+
+// ConfirmTOTP completes TOTP enrollment with a code from the authenticator
+func (c *Client) ConfirmTOTP(ctx context.Context, userID, code string) error {
+	resp, err := c.stub.VerifyMFAMethod(c.outgoing(ctx), &VerifyMFAMethodRequest{
+		UserId: userID,
+		Method: "totp",
+		Code:   code,
+	})
+	if err != nil {
+		return translateError(err)
+	}
+	if !resp.Success {
+		return &ClientError{Kind: ErrInvalidRequest, Message: "invalid code"}
+	}
+	return nil
+}
+
+// MFAMethods lists a user's MFA methods
+func (c *Client) MFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error) {
+	resp, err := c.stub.GetMFAMethods(c.outgoing(ctx), &GetMFAMethodsRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return resp.Methods, nil
+}
+
+// RemoveMFAMethod removes one of a user's MFA methods
+func (c *Client) RemoveMFAMethod(ctx context.Context, userID, methodID string) error {
+	_, err := c.stub.RemoveMFAMethod(c.outgoing(ctx), &RemoveMFAMethodRequest{
+		UserId:   userID,
+		MethodId: methodID,
+	})
+	return translateError(err)
+}
+
+// RegisterPasskey starts passkey registration and returns the options to
+// pass to the authenticator
+func (c *Client) RegisterPasskey(ctx context.Context, userID string) (*PasskeyOptions, error) {
+	resp, err := c.stub.RegisterPasskey(c.outgoing(ctx), &RegisterPasskeyRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return resp.Options, nil
+}
+
+// BeginPasskeyLogin starts a passkey login and returns the ceremony ID and
+// the JSON-encoded options to pass to the authenticator
+func (c *Client) BeginPasskeyLogin(ctx context.Context, userID string) (string, []byte, error) {
+	resp, err := c.stub.BeginPasskeyLogin(c.outgoing(ctx), &BeginPasskeyLoginRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return "", nil, translateError(err)
+	}
+	return resp.CeremonyId, resp.Options, nil
+}
+
+// FinishPasskeyLogin submits the authenticator's JSON-encoded assertion and
+// returns a session token
+func (c *Client) FinishPasskeyLogin(ctx context.Context, userID, ceremonyID string, assertion []byte) (string, error) {
+	resp, err := c.stub.FinishPasskeyLogin(c.outgoing(ctx), &FinishPasskeyLoginRequest{
+		UserId:     userID,
+		CeremonyId: ceremonyID,
+		Assertion:  assertion,
+	})
+	if err != nil {
+		return "", translateError(err)
+	}
+	return resp.Token, nil
+}
+
+// RevokeDevice revokes a remembered device
+func (c *Client) RevokeDevice(ctx context.Context, userID, fingerprint string) error {
+	_, err := c.stub.RevokeDevice(c.outgoing(ctx), &RevokeDeviceRequest{
+		UserId:            userID,
+		DeviceFingerprint: fingerprint,
+	})
+	return translateError(err)
+}
+
+// QuarantineSession suspends a session pending investigation
+func (c *Client) QuarantineSession(ctx context.Context, sessionID string) error {
+	_, err := c.stub.QuarantineSession(c.outgoing(ctx), &QuarantineSessionRequest{
+		SessionId: sessionID,
+	})
+	return translateError(err)
+}
+
+// ResolveSession ends a session's quarantine, revoking it if revoke is set
+// and otherwise restoring it
+func (c *Client) ResolveSession(ctx context.Context, sessionID string, revoke bool) error {
+	_, err := c.stub.ResolveSession(c.outgoing(ctx), &ResolveSessionRequest{
+		SessionId: sessionID,
+		Revoke:    revoke,
+	})
+	return translateError(err)
+}
+
+// outgoing attaches the session token, if any, to the call metadata
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// translateError converts a gRPC status error into a ClientError
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return &ClientError{Kind: ErrServer, Message: err.Error()}
+	}
+
+	var kind error
+	switch st.Code() {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		kind = ErrInvalidRequest
+	case codes.Unauthenticated:
+		kind = ErrUnauthenticated
+	case codes.PermissionDenied:
+		kind = ErrPermissionDenied
+	case codes.NotFound:
+		kind = ErrNotFound
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		kind = ErrUnavailable
+	default:
+		kind = ErrServer
+	}
+
+	return &ClientError{Kind: kind, Message: st.Message()}
+}
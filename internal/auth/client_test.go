@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	store := newTestStore(t)
+	s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+	s.SetCredentialVerifier(testVerifier{})
+	s.SetTokenIssuer(newTestIssuer(t))
+	return NewClient(dialBufconn(t, s))
+}
+
+func TestClientLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		email      string
+		password   string
+		code       string
+		wantStatus AuthenticateResponse_Status
+		wantErr    error
+		wantToken  bool
+	}{
+		{name: "MFA required", email: "a@example.com", password: "correct", wantStatus: AuthenticateResponse_MFA_REQUIRED},
+		{name: "with MFA code", email: "a@example.com", password: "correct", code: "123456", wantStatus: AuthenticateResponse_AUTHENTICATED, wantToken: true},
+		{name: "wrong password", email: "a@example.com", password: "wrong", wantErr: ErrUnauthenticated},
+		{name: "unknown email", email: "nobody@example.com", password: "correct", wantErr: ErrUnauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t)
+
+			resp, err := client.Login(context.Background(), tt.email, tt.password, tt.code)
+			if tt.wantErr != nil {
+				var clientErr *ClientError
+				if !errors.Is(err, tt.wantErr) || !errors.As(err, &clientErr) {
+					t.Fatalf("Login() error = %v, want a ClientError of kind %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("Login() status = %s, want %s", resp.Status, tt.wantStatus)
+			}
+			if got := resp.Token != ""; got != tt.wantToken {
+				t.Errorf("Login() returned token = %v, want %v", got, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestClientAttachesToken(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	if err := client.RevokeDevice(ctx, "user-1", "laptop"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("RevokeDevice() before login = %v, want %v", err, ErrUnauthenticated)
+	}
+
+	if _, err := client.Login(ctx, "a@example.com", "correct", "123456"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := client.RevokeDevice(ctx, "user-1", "laptop"); err != nil {
+		t.Errorf("RevokeDevice() after login = %v", err)
+	}
+	if err := client.RevokeDevice(ctx, "user-2", "laptop"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("RevokeDevice() for another user = %v, want %v", err, ErrPermissionDenied)
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// Conversions between storage models and their gRPC messages. Every gRPC
+// handler goes through these so the two representations can't drift.
+
+func storageUserToProto(user *storage.User) *User {
+	if user == nil {
+		return nil
+	}
+	return &User{
+		Id:        user.ID,
+		Email:     user.Email,
+		CreatedAt: timeToProto(user.CreatedAt),
+		UpdatedAt: timeToProto(user.UpdatedAt),
+	}
+}
+
+func protoUserToStorage(user *User) *storage.User {
+	if user == nil {
+		return nil
+	}
+	return &storage.User{
+		ID:        user.Id,
+		Email:     user.Email,
+		CreatedAt: protoToTime(user.CreatedAt),
+		UpdatedAt: protoToTime(user.UpdatedAt),
+	}
+}
+
+// storageCredentialToProto omits the public key; it is never returned
+// through the API
+func storageCredentialToProto(credential *storage.Credential) *Credential {
+	if credential == nil {
+		return nil
+	}
+	c := &Credential{
+		Id:              credential.ID,
+		UserId:          credential.UserID,
+		AttestationType: credential.AttestationType,
+		RpId:            credential.RPID,
+		CreatedAt:       timeToProto(credential.CreatedAt),
+	}
+	if credential.Discoverable != nil {
+		c.Discoverable = *credential.Discoverable
+	}
+	return c
+}
+
+func protoCredentialToStorage(credential *Credential) *storage.Credential {
+	if credential == nil {
+		return nil
+	}
+	discoverable := credential.Discoverable
+	return &storage.Credential{
+		ID:              credential.Id,
+		UserID:          credential.UserId,
+		AttestationType: credential.AttestationType,
+		RPID:            credential.RpId,
+		Discoverable:    &discoverable,
+		CreatedAt:       protoToTime(credential.CreatedAt),
+	}
+}
+
+// storageMFAMethodToProto omits the method's value, which holds secrets or
+// contact details
+func storageMFAMethodToProto(method *storage.MFAMethod) *MFAMethod {
+	if method == nil {
+		return nil
+	}
+	return &MFAMethod{
+		Id:        method.ID,
+		Type:      method.Type,
+		CreatedAt: timeToProto(method.CreatedAt),
+	}
+}
+
+func protoMFAMethodToStorage(method *MFAMethod) *storage.MFAMethod {
+	if method == nil {
+		return nil
+	}
+	return &storage.MFAMethod{
+		ID:        method.Id,
+		Type:      method.Type,
+		CreatedAt: protoToTime(method.CreatedAt),
+	}
+}
+
+func storageMFAMethodsToProto(methods []*storage.MFAMethod) []*MFAMethod {
+	converted := make([]*MFAMethod, 0, len(methods))
+	for _, method := range methods {
+		converted = append(converted, storageMFAMethodToProto(method))
+	}
+	return converted
+}
+
+func timeToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func protoToTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
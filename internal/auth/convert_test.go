@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+var convertTime = time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+// fillStruct sets every field of the struct v points to to a non-zero value
+func fillStruct(t *testing.T, v interface{}) {
+	t.Helper()
+	s := reflect.ValueOf(v).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Field(i)
+		name := s.Type().Field(i).Name
+		switch value := field.Addr().Interface().(type) {
+		case *string:
+			*value = name
+		case *[]byte:
+			*value = []byte(name)
+		case *[]string:
+			*value = []string{name}
+		case *bool:
+			*value = true
+		case **bool:
+			b := true
+			*value = &b
+		case *int:
+			*value = 7
+		case *int64:
+			*value = 7
+		case *time.Time:
+			*value = convertTime.Add(time.Duration(i) * time.Hour)
+		default:
+			t.Fatalf("no fixture value for field %s of type %s", name, field.Type())
+		}
+	}
+}
+
+// fillMessage sets every field of m to a non-zero value
+func fillMessage(t *testing.T, m protoreflect.Message) {
+	t.Helper()
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		switch {
+		case fd.Kind() == protoreflect.StringKind:
+			m.Set(fd, protoreflect.ValueOfString(string(fd.Name())))
+		case fd.Kind() == protoreflect.BoolKind:
+			m.Set(fd, protoreflect.ValueOfBool(true))
+		case fd.Kind() == protoreflect.MessageKind && fd.Message().FullName() == "google.protobuf.Timestamp":
+			ts := timestamppb.New(convertTime.Add(time.Duration(i) * time.Hour))
+			m.Set(fd, protoreflect.ValueOfMessage(ts.ProtoReflect()))
+		default:
+			t.Fatalf("no fixture value for field %s of kind %s", fd.FullName(), fd.Kind())
+		}
+	}
+}
+
+// checkMapped reports storage fields that were lost converting original to
+// proto and back, and fields listed as unmapped that survived. A field added
+// to a storage model must either be mapped or listed as deliberately
+// unmapped.
+func checkMapped(t *testing.T, original, converted interface{}, unmapped []string) {
+	t.Helper()
+	skip := make(map[string]bool, len(unmapped))
+	for _, name := range unmapped {
+		skip[name] = true
+	}
+
+	want := reflect.ValueOf(original).Elem()
+	got := reflect.ValueOf(converted).Elem()
+	for i := 0; i < want.NumField(); i++ {
+		name := want.Type().Field(i).Name
+		mapped := reflect.DeepEqual(got.Field(i).Interface(), want.Field(i).Interface())
+		switch {
+		case skip[name] && !got.Field(i).IsZero():
+			t.Errorf("field %s is listed as unmapped but converts to %v", name, got.Field(i))
+		case !skip[name] && !mapped:
+			t.Errorf("field %s is not mapped: got %v, want %v", name, got.Field(i), want.Field(i))
+		}
+	}
+}
+
+func TestConvertStorageModels(t *testing.T) {
+	t.Run("user", func(t *testing.T) {
+		user := &storage.User{}
+		fillStruct(t, user)
+		checkMapped(t, user, protoUserToStorage(storageUserToProto(user)),
+			[]string{"LastLoginAt", "DeletedAt", "MergedInto"})
+	})
+
+	t.Run("credential", func(t *testing.T) {
+		credential := &storage.Credential{}
+		fillStruct(t, credential)
+		checkMapped(t, credential, protoCredentialToStorage(storageCredentialToProto(credential)),
+			[]string{"PublicKey", "Attachment", "Transports", "LargeBlobSupported", "LastUsedAt", "DeviceSerial"})
+	})
+
+	t.Run("MFA method", func(t *testing.T) {
+		method := &storage.MFAMethod{}
+		fillStruct(t, method)
+		checkMapped(t, method, protoMFAMethodToStorage(storageMFAMethodToProto(method)),
+			[]string{"UserID", "Value", "KeyID", "DriftSteps", "LastUsedStep", "Algorithm", "UpdatedAt"})
+	})
+}
+
+func TestConvertProtoRoundTrip(t *testing.T) {
+	user := &User{}
+	fillMessage(t, user.ProtoReflect())
+	credential := &Credential{}
+	fillMessage(t, credential.ProtoReflect())
+	method := &MFAMethod{}
+	fillMessage(t, method.ProtoReflect())
+
+	tests := []struct {
+		name string
+		msg  proto.Message
+		got  proto.Message
+	}{
+		{name: "user", msg: user, got: storageUserToProto(protoUserToStorage(user))},
+		{name: "credential", msg: credential, got: storageCredentialToProto(protoCredentialToStorage(credential))},
+		{name: "MFA method", msg: method, got: storageMFAMethodToProto(protoMFAMethodToStorage(method))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !proto.Equal(tt.got, tt.msg) {
+				t.Errorf("round trip = %v, want %v", tt.got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestConvertNil(t *testing.T) {
+	if storageUserToProto(nil) != nil || protoUserToStorage(nil) != nil {
+		t.Error("nil user converted to non-nil")
+	}
+	if storageCredentialToProto(nil) != nil || protoCredentialToStorage(nil) != nil {
+		t.Error("nil credential converted to non-nil")
+	}
+	if storageMFAMethodToProto(nil) != nil || protoMFAMethodToStorage(nil) != nil {
+		t.Error("nil MFA method converted to non-nil")
+	}
+	if got := storageMFAMethodsToProto(nil); got == nil || len(got) != 0 {
+		t.Errorf("storageMFAMethodsToProto(nil) = %v, want an empty slice", got)
+	}
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// Credential check errors
+var (
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrInvalidMFACode  = errors.New("invalid MFA code")
+)
+
+// CredentialVerifier checks the factors presented to Authenticate
+type CredentialVerifier interface {
+	// VerifyPassword returns ErrInvalidPassword unless password is the
+	// user's
+	VerifyPassword(ctx context.Context, user *storage.User, password string) error
+	// VerifyMFACode checks code against methods, the ones permitted to
+	// satisfy MFA, and returns the type of the method it matched. It
+	// returns ErrInvalidMFACode if it matches none.
+	VerifyMFACode(ctx context.Context, userID string, methods []*storage.MFAMethod, code string) (string, error)
+}
+
+// SetCredentialVerifier sets the verifier Authenticate checks passwords and
+// MFA codes with. Without one Authenticate fails with Unimplemented rather
+// than sign in unverified users.
+func (s *AuthService) SetCredentialVerifier(verifier CredentialVerifier) {
+	s.credentials = verifier
+}
+
+// codeAMR returns the authentication method reference for an MFA code from a
+// method of methodType
+func codeAMR(methodType string) string {
+	if methodType == "sms" {
+		return AMRSMS
+	}
+	return AMROTP
+}
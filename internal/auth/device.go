@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// ErrInvalidDeviceToken is returned when a device token fails verification
+var ErrInvalidDeviceToken = errors.New("invalid device token")
+
+// DeviceTrust issues and verifies "remember this device" tokens that let a
+// user skip MFA on a device that recently completed it
+type DeviceTrust struct {
+	store  storage.Storage
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewDeviceTrust creates a new device trust manager
+func NewDeviceTrust(store storage.Storage, secret []byte, ttl time.Duration) *DeviceTrust {
+	return &DeviceTrust{
+		store:  store,
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+// Issue creates a signed device token bound to the user and device fingerprint
+func (d *DeviceTrust) Issue(ctx context.Context, userID string, fingerprint string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate device nonce: %w", err)
+	}
+
+	expiresAt := time.Now().Add(d.ttl).Unix()
+	payload := strings.Join([]string{
+		userID,
+		hashFingerprint(fingerprint),
+		strconv.FormatInt(expiresAt, 10),
+		hex.EncodeToString(nonce),
+	}, "|")
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + d.sign(payload)
+
+	// Store the token hash so the device can be revoked server-side
+	if err := d.store.StoreTemporaryValue(ctx, deviceKey(userID, fingerprint), hashToken(token), d.ttl); err != nil {
+		return "", fmt.Errorf("failed to store device token: %w", err)
+	}
+
+	return token, nil
+}
+
+// Verify checks that a device token is authentic, unexpired, not revoked, and
+// bound to the given user and device fingerprint
+func (d *DeviceTrust) Verify(ctx context.Context, userID string, fingerprint string, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return ErrInvalidDeviceToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidDeviceToken
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(d.sign(payload)), []byte(parts[1])) {
+		return ErrInvalidDeviceToken
+	}
+
+	fields := strings.Split(payload, "|")
+	if len(fields) != 4 || fields[0] != userID || fields[1] != hashFingerprint(fingerprint) {
+		return ErrInvalidDeviceToken
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrInvalidDeviceToken
+	}
+
+	// A missing or replaced server-side record means the device was revoked
+	stored, err := d.store.GetTemporaryValue(ctx, deviceKey(userID, fingerprint))
+	if err != nil || !hmac.Equal([]byte(stored), []byte(hashToken(token))) {
+		return ErrInvalidDeviceToken
+	}
+
+	return nil
+}
+
+// Revoke removes the trust record for a user's device
+func (d *DeviceTrust) Revoke(ctx context.Context, userID string, fingerprint string) error {
+	return d.store.DeleteTemporaryValue(ctx, deviceKey(userID, fingerprint))
+}
+
+func (d *DeviceTrust) sign(payload string) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func deviceKey(userID string, fingerprint string) string {
+	return fmt.Sprintf("device:%s:%s", userID, hashFingerprint(fingerprint))
+}
+
+func hashFingerprint(fingerprint string) string {
+	sum := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
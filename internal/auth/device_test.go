@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+var (
+	testTokenKey     = []byte(strings.Repeat("k", minTokenKeyBytes))
+	testDeviceSecret = []byte(strings.Repeat("d", 32))
+)
+
+func newTestIssuer(t *testing.T) *TokenIssuer {
+	t.Helper()
+	issuer, err := NewTokenIssuer(testTokenKey, time.Hour)
+	if err != nil {
+		t.Fatalf("NewTokenIssuer: %v", err)
+	}
+	return issuer
+}
+
+// testStore is a storage.Storage holding one user, their MFA methods, and
+// temporary values. Other Storage methods are unimplemented.
+type testStore struct {
+	storage.Storage
+	temp    *storage.MemoryStore
+	user    *storage.User
+	methods []*storage.MFAMethod
+}
+
+func newTestStore(t *testing.T) *testStore {
+	t.Helper()
+	temp := storage.NewMemoryStore(0)
+	t.Cleanup(temp.Close)
+	return &testStore{
+		temp:    temp,
+		user:    &storage.User{ID: "user-1", Email: "a@example.com"},
+		methods: []*storage.MFAMethod{{ID: "mfa-1", UserID: "user-1", Type: "totp"}},
+	}
+}
+
+func (s *testStore) GetUserByEmail(ctx context.Context, email string) (*storage.User, error) {
+	if email != s.user.Email {
+		return nil, &storage.StorageError{Code: storage.ErrNotFound, Message: "User not found"}
+	}
+	return s.user, nil
+}
+
+func (s *testStore) GetUser(ctx context.Context, id string) (*storage.User, error) {
+	if id != s.user.ID {
+		return nil, &storage.StorageError{Code: storage.ErrNotFound, Message: "User not found"}
+	}
+	return s.user, nil
+}
+
+func (s *testStore) GetMFAMethods(ctx context.Context, userID string) ([]*storage.MFAMethod, error) {
+	return s.methods, nil
+}
+
+func (s *testStore) StoreTemporaryValue(ctx context.Context, key string, value string, expiry time.Duration) error {
+	return s.temp.StoreTemporaryValue(ctx, key, value, expiry)
+}
+
+func (s *testStore) GetTemporaryValue(ctx context.Context, key string) (string, error) {
+	return s.temp.GetTemporaryValue(ctx, key)
+}
+
+func (s *testStore) DeleteTemporaryValue(ctx context.Context, key string) error {
+	return s.temp.DeleteTemporaryValue(ctx, key)
+}
+
+// testVerifier accepts the password "correct" and the MFA code "123456"
+type testVerifier struct{}
+
+func (testVerifier) VerifyPassword(ctx context.Context, user *storage.User, password string) error {
+	if password != "correct" {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func (testVerifier) VerifyMFACode(ctx context.Context, userID string, methods []*storage.MFAMethod, code string) (string, error) {
+	if code != "123456" || len(methods) == 0 {
+		return "", ErrInvalidMFACode
+	}
+	return methods[0].Type, nil
+}
+
+// withBearer returns ctx carrying token as incoming authorization metadata
+func withBearer(ctx context.Context, token string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestDeviceTrustVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		userID      string
+		fingerprint string
+		alter       func(t *testing.T, ctx context.Context, d *DeviceTrust, token string) string
+		wantErr     error
+	}{
+		{name: "trusted device", ttl: time.Hour, userID: "user-1", fingerprint: "laptop"},
+		{name: "another user", ttl: time.Hour, userID: "user-2", fingerprint: "laptop", wantErr: ErrInvalidDeviceToken},
+		{name: "another device", ttl: time.Hour, userID: "user-1", fingerprint: "phone", wantErr: ErrInvalidDeviceToken},
+		{name: "expired", ttl: -time.Minute, userID: "user-1", fingerprint: "laptop", wantErr: ErrInvalidDeviceToken},
+		{
+			name: "tampered", ttl: time.Hour, userID: "user-1", fingerprint: "laptop",
+			alter:   func(t *testing.T, ctx context.Context, d *DeviceTrust, token string) string { return token + "x" },
+			wantErr: ErrInvalidDeviceToken,
+		},
+		{
+			name: "revoked", ttl: time.Hour, userID: "user-1", fingerprint: "laptop",
+			alter: func(t *testing.T, ctx context.Context, d *DeviceTrust, token string) string {
+				if err := d.Revoke(ctx, "user-1", "laptop"); err != nil {
+					t.Fatalf("Revoke: %v", err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidDeviceToken,
+		},
+		{
+			name: "replaced by a newer token", ttl: time.Hour, userID: "user-1", fingerprint: "laptop",
+			alter: func(t *testing.T, ctx context.Context, d *DeviceTrust, token string) string {
+				if _, err := d.Issue(ctx, "user-1", "laptop"); err != nil {
+					t.Fatalf("Issue: %v", err)
+				}
+				return token
+			},
+			wantErr: ErrInvalidDeviceToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDeviceTrust(newTestStore(t), testDeviceSecret, tt.ttl)
+			ctx := context.Background()
+
+			token, err := d.Issue(ctx, "user-1", "laptop")
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			if tt.alter != nil {
+				token = tt.alter(t, ctx, d, token)
+			}
+
+			if err := d.Verify(ctx, tt.userID, tt.fingerprint, token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRememberedDevice(t *testing.T) {
+	issuer := newTestIssuer(t)
+	owner, _, err := issuer.Issue("user-1", []string{AMRPassword, AMRMFA}, nil, time.Now())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	admin, _, err := issuer.IssueScoped("ops", []string{ScopeAdmin}, time.Now())
+	if err != nil {
+		t.Fatalf("IssueScoped: %v", err)
+	}
+	stranger, _, err := issuer.Issue("user-2", []string{AMRPassword, AMRMFA}, nil, time.Now())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		// before runs between remembering the device and signing in again
+		before     func(t *testing.T, ctx context.Context, s *AuthService, store *testStore, deviceToken string) string
+		wantStatus AuthenticateResponse_Status
+	}{
+		{
+			name:        "known device skips MFA",
+			fingerprint: "laptop",
+			wantStatus:  AuthenticateResponse_AUTHENTICATED,
+		},
+		{
+			name:        "token from another device",
+			fingerprint: "phone",
+			wantStatus:  AuthenticateResponse_MFA_REQUIRED,
+		},
+		{
+			name:        "expired device token",
+			fingerprint: "laptop",
+			before: func(t *testing.T, ctx context.Context, s *AuthService, store *testStore, deviceToken string) string {
+				expired := NewDeviceTrust(store, testDeviceSecret, -time.Minute)
+				token, err := expired.Issue(ctx, "user-1", "laptop")
+				if err != nil {
+					t.Fatalf("Issue: %v", err)
+				}
+				return token
+			},
+			wantStatus: AuthenticateResponse_MFA_REQUIRED,
+		},
+		{
+			name:        "revoked by its owner",
+			fingerprint: "laptop",
+			before: func(t *testing.T, ctx context.Context, s *AuthService, store *testStore, deviceToken string) string {
+				revokeDevice(t, s, owner)
+				return deviceToken
+			},
+			wantStatus: AuthenticateResponse_MFA_REQUIRED,
+		},
+		{
+			name:        "revoked by an admin",
+			fingerprint: "laptop",
+			before: func(t *testing.T, ctx context.Context, s *AuthService, store *testStore, deviceToken string) string {
+				revokeDevice(t, s, admin)
+				return deviceToken
+			},
+			wantStatus: AuthenticateResponse_MFA_REQUIRED,
+		},
+		{
+			name:        "revocation by another user is refused",
+			fingerprint: "laptop",
+			before: func(t *testing.T, ctx context.Context, s *AuthService, store *testStore, deviceToken string) string {
+				req := &RevokeDeviceRequest{UserId: "user-1", DeviceFingerprint: "laptop"}
+				if _, err := s.RevokeDevice(withBearer(ctx, stranger), req); err == nil {
+					t.Fatal("RevokeDevice() by another user succeeded")
+				}
+				if _, err := s.RevokeDevice(ctx, req); err == nil {
+					t.Fatal("RevokeDevice() without a token succeeded")
+				}
+				return deviceToken
+			},
+			wantStatus: AuthenticateResponse_AUTHENTICATED,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+			s.SetCredentialVerifier(testVerifier{})
+			s.SetTokenIssuer(issuer)
+			ctx := context.Background()
+
+			first, err := s.Authenticate(ctx, &AuthenticateRequest{
+				Email:             "a@example.com",
+				AuthMethod:        &AuthenticateRequest_Password{Password: "correct"},
+				MfaCode:           "123456",
+				DeviceFingerprint: "laptop",
+				RememberDevice:    true,
+			})
+			if err != nil {
+				t.Fatalf("Authenticate with MFA: %v", err)
+			}
+			if first.DeviceToken == "" {
+				t.Fatal("Authenticate() with MFA issued no device token")
+			}
+
+			deviceToken := first.DeviceToken
+			if tt.before != nil {
+				deviceToken = tt.before(t, ctx, s, store, deviceToken)
+			}
+
+			resp, err := s.Authenticate(ctx, &AuthenticateRequest{
+				Email:             "a@example.com",
+				AuthMethod:        &AuthenticateRequest_Password{Password: "correct"},
+				DeviceFingerprint: tt.fingerprint,
+				DeviceToken:       deviceToken,
+			})
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("Authenticate() status = %s, want %s", resp.Status, tt.wantStatus)
+			}
+			if resp.DeviceToken != "" {
+				t.Error("Authenticate() without MFA issued a device token")
+			}
+		})
+	}
+}
+
+// revokeDevice revokes user-1's laptop as the bearer of token
+func revokeDevice(t *testing.T, s *AuthService, token string) {
+	t.Helper()
+	resp, err := s.RevokeDevice(withBearer(context.Background(), token), &RevokeDeviceRequest{UserId: "user-1", DeviceFingerprint: "laptop"})
+	if err != nil {
+		t.Fatalf("RevokeDevice: %v", err)
+	}
+	if !resp.Success {
+		t.Fatal("RevokeDevice() reported failure")
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/polyid/auth/internal/mfa"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// passkeyMethod is the MFA challenge method type telling the client to
+// complete the challenge with a passkey login
+const passkeyMethod = "passkey"
+
+// FactorPolicy decides whether a tenant's users who have a passkey may
+// still satisfy MFA with a weaker factor. See mfa.FactorPolicy.
+type FactorPolicy = mfa.FactorPolicy
+
+// StaticFactorPolicy is a config-backed FactorPolicy, strict by Default or
+// per tenant. See mfa.StaticFactorPolicy.
+type StaticFactorPolicy = mfa.StaticFactorPolicy
+
+// SetFactorPolicy sets the policy guarding against downgrading MFA to a
+// weaker factor and returns the guard applying it. Pass the guard to
+// mfa.Config.Factors so the HTTP handlers apply the same policy. Without one
+// every enrolled method may satisfy MFA.
+func (s *AuthService) SetFactorPolicy(policy FactorPolicy) *mfa.DowngradeGuard {
+	s.factors = mfa.NewDowngradeGuard(policy, s.store)
+	return s.factors
+}
+
+// permittedMFAMethods returns the methods that may satisfy MFA for the user.
+// Under a strict policy, weak methods are dropped if the user has a passkey,
+// and the passkey is offered instead.
+func (s *AuthService) permittedMFAMethods(ctx context.Context, userID string, methods []*storage.MFAMethod) ([]*storage.MFAMethod, error) {
+	strict, err := s.factors.Strict(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strict {
+		return methods, nil
+	}
+
+	permitted := make([]*storage.MFAMethod, 0, len(methods)+1)
+	for _, method := range methods {
+		if !mfa.IsWeakMethod(method.Type) {
+			permitted = append(permitted, method)
+		}
+	}
+	return append(permitted, &storage.MFAMethod{UserID: userID, Type: passkeyMethod}), nil
+}
+
+// acceptsMFACode reports whether any of methods can be satisfied with a
+// one-time code in AuthenticateRequest.mfa_code
+func acceptsMFACode(methods []*storage.MFAMethod) bool {
+	for _, method := range methods {
+		if method.Type == "totp" || method.Type == "sms" {
+			return true
+		}
+	}
+	return false
+}
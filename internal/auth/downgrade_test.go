@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// passkeyStore is a testStore whose user has the given passkeys
+type passkeyStore struct {
+	*testStore
+	credentials []*storage.Credential
+	err         error
+}
+
+func (s *passkeyStore) GetCredentials(ctx context.Context, userID string) ([]*storage.Credential, error) {
+	return s.credentials, s.err
+}
+
+func TestAuthenticateDowngradeProtection(t *testing.T) {
+	sms := &storage.MFAMethod{ID: "mfa-1", UserID: "user-1", Type: "sms"}
+	totp := &storage.MFAMethod{ID: "mfa-2", UserID: "user-1", Type: "totp"}
+	passkey := []*storage.Credential{{ID: "cred-1", UserID: "user-1"}}
+
+	tests := []struct {
+		name        string
+		policy      FactorPolicy
+		tenant      string
+		methods     []*storage.MFAMethod
+		credentials []*storage.Credential
+		code        string
+		wantStatus  AuthenticateResponse_Status
+		wantMethods []string // offered by the MFA challenge
+		wantErr     codes.Code
+	}{
+		{name: "SMS challenge replaced by the passkey", policy: StaticFactorPolicy{Default: true}, methods: []*storage.MFAMethod{sms}, credentials: passkey, wantStatus: AuthenticateResponse_MFA_REQUIRED, wantMethods: []string{passkeyMethod}},
+		{name: "SMS code rejected", policy: StaticFactorPolicy{Default: true}, methods: []*storage.MFAMethod{sms}, credentials: passkey, code: "123456", wantErr: codes.FailedPrecondition},
+		{name: "TOTP still offered", policy: StaticFactorPolicy{Default: true}, methods: []*storage.MFAMethod{sms, totp}, credentials: passkey, wantStatus: AuthenticateResponse_MFA_REQUIRED, wantMethods: []string{"totp", passkeyMethod}},
+		{name: "TOTP code accepted", policy: StaticFactorPolicy{Default: true}, methods: []*storage.MFAMethod{sms, totp}, credentials: passkey, code: "123456", wantStatus: AuthenticateResponse_AUTHENTICATED},
+		{name: "strict tenant", policy: StaticFactorPolicy{Tenants: map[string]bool{"acme": true}}, tenant: "acme", methods: []*storage.MFAMethod{sms}, credentials: passkey, code: "123456", wantErr: codes.FailedPrecondition},
+		{name: "SMS allowed without a passkey", policy: StaticFactorPolicy{Default: true}, methods: []*storage.MFAMethod{sms}, code: "123456", wantStatus: AuthenticateResponse_AUTHENTICATED},
+		{name: "SMS allowed under a lenient policy", policy: StaticFactorPolicy{}, methods: []*storage.MFAMethod{sms}, credentials: passkey, code: "123456", wantStatus: AuthenticateResponse_AUTHENTICATED},
+		{name: "SMS allowed without a policy", methods: []*storage.MFAMethod{sms}, credentials: passkey, wantStatus: AuthenticateResponse_MFA_REQUIRED, wantMethods: []string{"sms"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &passkeyStore{testStore: newTestStore(t), credentials: tt.credentials}
+			store.methods = tt.methods
+			s := NewAuthService(zap.NewNop(), store, nil)
+			s.SetCredentialVerifier(testVerifier{})
+			s.SetTokenIssuer(newTestIssuer(t))
+			if tt.policy != nil {
+				s.SetFactorPolicy(tt.policy)
+			}
+			notifier := &recordingNotifier{}
+			s.SetFailureNotifier(notifier)
+
+			resp, err := s.Authenticate(events.WithTenant(context.Background(), tt.tenant), &AuthenticateRequest{
+				Email:      "a@example.com",
+				AuthMethod: &AuthenticateRequest_Password{Password: "correct"},
+				MfaCode:    tt.code,
+			})
+			if tt.wantErr != codes.OK {
+				if status.Code(err) != tt.wantErr {
+					t.Fatalf("Authenticate() error = %v, want %s", err, tt.wantErr)
+				}
+				if len(notifier.failures) != 1 || notifier.failures[0].reason != events.ReasonMFAFailed {
+					t.Errorf("failures = %+v, want one %s", notifier.failures, events.ReasonMFAFailed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("Authenticate() status = %s, want %s", resp.Status, tt.wantStatus)
+			}
+			if tt.wantMethods == nil {
+				return
+			}
+			if resp.MfaChallenge == nil {
+				t.Fatal("Authenticate() returned no MFA challenge")
+			}
+			if !reflect.DeepEqual(resp.MfaChallenge.Methods, tt.wantMethods) {
+				t.Errorf("challenge methods = %v, want %v", resp.MfaChallenge.Methods, tt.wantMethods)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDowngradeLookupFailure(t *testing.T) {
+	store := &passkeyStore{testStore: newTestStore(t), err: errors.New("storage down")}
+	s := NewAuthService(zap.NewNop(), store, nil)
+	s.SetCredentialVerifier(testVerifier{})
+	s.SetTokenIssuer(newTestIssuer(t))
+	s.SetFactorPolicy(StaticFactorPolicy{Default: true})
+
+	_, err := s.Authenticate(context.Background(), &AuthenticateRequest{
+		Email:      "a@example.com",
+		AuthMethod: &AuthenticateRequest_Password{Password: "correct"},
+		MfaCode:    "123456",
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("Authenticate() error = %v, want %s", err, codes.Internal)
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errInvalidCredentials is the single error returned for any failed
+// email-based lookup or credential check, so responses don't reveal whether
+// an account exists
+var errInvalidCredentials = status.Error(codes.Unauthenticated, "invalid credentials")
+
+// SetUniformResponses enables uniform-response mode. Flows driven by an email
+// lookup take at least minDuration regardless of whether the account exists,
+// so response timing can't be used to enumerate accounts. A zero duration
+// disables the mode.
+func (s *AuthService) SetUniformResponses(minDuration time.Duration) {
+	s.minResponseTime = minDuration
+}
+
+// padResponse blocks until minResponseTime has elapsed since start, or the
+// context is done
+func (s *AuthService) padResponse(ctx context.Context, start time.Time) {
+	remaining := s.minResponseTime - time.Since(start)
+	if remaining <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
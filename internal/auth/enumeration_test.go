@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// failingLookupStore fails every email lookup with err
+type failingLookupStore struct {
+	*testStore
+	err error
+}
+
+func (s *failingLookupStore) GetUserByEmail(ctx context.Context, email string) (*storage.User, error) {
+	return nil, s.err
+}
+
+func TestAuthenticateEnumerationParity(t *testing.T) {
+	const minDuration = 50 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		store    func(t *testing.T) storage.Storage
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{name: "unknown email", email: "nobody@example.com", password: "correct", wantCode: codes.Unauthenticated, wantMsg: "invalid credentials"},
+		{name: "known email, wrong password", email: "a@example.com", password: "wrong", wantCode: codes.Unauthenticated, wantMsg: "invalid credentials"},
+		{
+			name: "lookup outage", email: "a@example.com", password: "correct",
+			store: func(t *testing.T) storage.Storage {
+				return &failingLookupStore{
+					testStore: newTestStore(t),
+					err:       &storage.StorageError{Code: storage.ErrInternal, Message: "Failed to query user", Err: errors.New("connection refused")},
+				}
+			},
+			wantCode: codes.Internal,
+			wantMsg:  "failed to verify credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var store storage.Storage = newTestStore(t)
+			if tt.store != nil {
+				store = tt.store(t)
+			}
+			s := NewAuthService(zap.NewNop(), store, nil)
+			s.SetCredentialVerifier(testVerifier{})
+			s.SetUniformResponses(minDuration)
+
+			start := time.Now()
+			resp, err := s.Authenticate(context.Background(), &AuthenticateRequest{
+				Email:      tt.email,
+				AuthMethod: &AuthenticateRequest_Password{Password: tt.password},
+			})
+			elapsed := time.Since(start)
+
+			if resp != nil {
+				t.Errorf("Authenticate() response = %+v, want none", resp)
+			}
+			st, _ := status.FromError(err)
+			if st.Code() != tt.wantCode || st.Message() != tt.wantMsg {
+				t.Errorf("Authenticate() error = %v, want %s %q", err, tt.wantCode, tt.wantMsg)
+			}
+			if elapsed < minDuration {
+				t.Errorf("Authenticate() returned after %s, want at least %s", elapsed, minDuration)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/polyid/auth/internal/events"
+)
+
+// SetFailureNotifier reports each failed Authenticate call to notifier
+func (s *AuthService) SetFailureNotifier(notifier events.FailureNotifier) {
+	s.failures = notifier
+}
+
+// reportFailure notifies the failure notifier, if any, of a failed attempt.
+// userID is empty if the user is unknown.
+func (s *AuthService) reportFailure(ctx context.Context, userID, reason string) {
+	if s.failures == nil {
+		return
+	}
+	s.failures.AuthFailed(ctx, userID, reason, "")
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// recordedFailure is one AuthFailed call
+type recordedFailure struct {
+	userID, reason, method string
+}
+
+// recordingNotifier records failures instead of publishing them
+type recordingNotifier struct {
+	mu       sync.Mutex
+	failures []recordedFailure
+}
+
+func (n *recordingNotifier) AuthFailed(ctx context.Context, userID, reason, method string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = append(n.failures, recordedFailure{userID: userID, reason: reason, method: method})
+}
+
+func TestAuthenticateFailureEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		mfaCode  string
+		risk     RiskEvaluator
+		noMFA    bool
+		wantCode codes.Code
+		want     []recordedFailure
+	}{
+		{name: "unknown user", email: "b@example.com", password: "correct", wantCode: codes.Unauthenticated, want: []recordedFailure{{reason: events.ReasonUnknownUser}}},
+		{name: "wrong password", email: "a@example.com", password: "wrong", wantCode: codes.Unauthenticated, want: []recordedFailure{{userID: "user-1", reason: events.ReasonBadCredential}}},
+		{name: "wrong MFA code", email: "a@example.com", password: "correct", mfaCode: "000000", wantCode: codes.Unauthenticated, want: []recordedFailure{{userID: "user-1", reason: events.ReasonMFAFailed}}},
+		{name: "denied by risk", email: "a@example.com", password: "correct", risk: staticRisk{decision: RiskDeny}, want: []recordedFailure{{userID: "user-1", reason: events.ReasonLocked}}},
+		{name: "risky login without MFA", email: "a@example.com", password: "correct", risk: staticRisk{decision: RiskRequireMFA}, noMFA: true, want: []recordedFailure{{userID: "user-1", reason: events.ReasonLocked}}},
+		{name: "success", email: "a@example.com", password: "correct", mfaCode: "123456"},
+		{name: "MFA challenge", email: "a@example.com", password: "correct"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			if tt.noMFA {
+				store.methods = []*storage.MFAMethod{}
+			}
+			s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+			s.SetCredentialVerifier(testVerifier{})
+			s.SetTokenIssuer(newTestIssuer(t))
+			if tt.risk != nil {
+				s.SetRiskEvaluator(tt.risk)
+			}
+			notifier := &recordingNotifier{}
+			s.SetFailureNotifier(notifier)
+
+			_, err := s.Authenticate(context.Background(), &AuthenticateRequest{
+				Email:      tt.email,
+				AuthMethod: &AuthenticateRequest_Password{Password: tt.password},
+				MfaCode:    tt.mfaCode,
+			})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("Authenticate() code = %s, want %s (%v)", got, tt.wantCode, err)
+			}
+			if len(notifier.failures) != len(tt.want) {
+				t.Fatalf("failures = %+v, want %+v", notifier.failures, tt.want)
+			}
+			for i, want := range tt.want {
+				if notifier.failures[i] != want {
+					t.Errorf("failure %d = %+v, want %+v", i, notifier.failures[i], want)
+				}
+			}
+		})
+	}
+}
@@ -2,24 +2,54 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/status"
 	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/clientinfo"
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/mfa"
+	"github.com/polyid/auth/internal/storage"
 )
 
 // AuthService implements the gRPC authentication service
 type AuthService struct {
-	logger *zap.Logger
+	logger   *zap.Logger
+	store    storage.Storage
+	devices  *DeviceTrust
+	health   *health.Server
+	risk     RiskEvaluator
+	passkeys PasskeyLogin
+	limits   mfa.MethodLimits
+	rps      *RPResolver
+	tokens   *TokenIssuer
+	failures events.FailureNotifier
+	factors  *mfa.DowngradeGuard
+	sessions *SessionRegistry
+	binding  *SessionBinding
+
+	// credentials checks the factors presented to Authenticate
+	credentials CredentialVerifier
+
+	// minResponseTime pads email-driven responses when uniform-response
+	// mode is enabled
+	minResponseTime time.Duration
 	// Add other dependencies
 }
 
 // NewAuthService creates a new authentication service
-func NewAuthService(logger *zap.Logger) *AuthService {
+func NewAuthService(logger *zap.Logger, store storage.Storage, devices *DeviceTrust) *AuthService {
 	return &AuthService{
-		logger: logger,
+		logger:  logger,
+		store:   store,
+		devices: devices,
+		health:  health.NewServer(),
+		risk:    NoopRiskEvaluator{},
 	}
 }
 
@@ -34,18 +64,151 @@ func (s *AuthService) Authenticate(ctx context.Context, req *AuthenticateRequest
 	if req == nil {
 		return nil, status.Error(codes.InvalidArgument, "request cannot be nil")
 	}
+	if s.credentials == nil {
+		return nil, status.Error(codes.Unimplemented, "password authentication is not enabled")
+	}
 
-	// TODO: Implement authentication logic
-	// This would involve:
-	// 1. Validating credentials
-	// 2. Checking MFA requirements
-	// 3. Generating session tokens
-	// 4. Recording audit logs
-
-	return &AuthenticateResponse{
-		Token: "dummy-token",
-		ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-	}, nil
+	if s.minResponseTime > 0 {
+		defer s.padResponse(ctx, time.Now())
+	}
+
+	user, err := s.store.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		var storageErr *storage.StorageError
+		if !errors.As(err, &storageErr) || storageErr.Code != storage.ErrNotFound {
+			// Reporting an outage as bad credentials would hide it
+			s.logger.Error("Failed to get user", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to verify credentials")
+		}
+		s.logger.Info("Authentication failed", clientinfo.Fields(ctx)...)
+		s.reportFailure(ctx, "", events.ReasonUnknownUser)
+		return nil, errInvalidCredentials
+	}
+
+	if err := s.credentials.VerifyPassword(ctx, user, req.GetPassword()); err != nil {
+		if !errors.Is(err, ErrInvalidPassword) {
+			s.logger.Error("Failed to verify password", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to verify credentials")
+		}
+		s.logger.Info("Authentication failed", clientinfo.Fields(ctx)...)
+		s.reportFailure(ctx, user.ID, events.ReasonBadCredential)
+		return nil, errInvalidCredentials
+	}
+
+	methods, err := s.store.GetMFAMethods(ctx, user.ID)
+	if err != nil {
+		s.logger.Error("Failed to get MFA methods", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to check MFA requirements")
+	}
+
+	// A remembered device skips MFA until its token expires or is revoked
+	requiresMFA := len(methods) > 0
+	if requiresMFA && s.devices != nil && req.DeviceToken != "" {
+		if err := s.devices.Verify(ctx, user.ID, req.DeviceFingerprint, req.DeviceToken); err == nil {
+			requiresMFA = false
+		}
+	}
+
+	// Risky logins must complete MFA even on a remembered device
+	client, _ := clientinfo.FromContext(ctx)
+	decision, err := s.risk.Evaluate(ctx, &LoginAttempt{
+		UserID:            user.ID,
+		IP:                client.IP,
+		UserAgent:         client.UserAgent,
+		DeviceFingerprint: req.DeviceFingerprint,
+		Time:              time.Now(),
+	})
+	if err != nil {
+		// Fail closed to MFA rather than blocking logins outright
+		s.logger.Error("Failed to evaluate login risk", zap.Error(err))
+		decision = RiskRequireMFA
+	}
+
+	switch decision {
+	case RiskDeny:
+		s.logger.Warn("Login denied by risk evaluation", clientinfo.Fields(ctx)...)
+		s.reportFailure(ctx, user.ID, events.ReasonLocked)
+		return &AuthenticateResponse{Status: AuthenticateResponse_LOCKED}, nil
+	case RiskRequireMFA:
+		if len(methods) == 0 {
+			s.logger.Warn("Risky login denied for user without MFA", clientinfo.Fields(ctx)...)
+			s.reportFailure(ctx, user.ID, events.ReasonLocked)
+			return &AuthenticateResponse{Status: AuthenticateResponse_LOCKED}, nil
+		}
+		requiresMFA = true
+	}
+
+	// Users with a passkey may be barred from weaker factors
+	permitted, err := s.permittedMFAMethods(ctx, user.ID, methods)
+	if err != nil {
+		s.logger.Error("Failed to check MFA factor policy", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to check MFA requirements")
+	}
+
+	if requiresMFA && req.MfaCode == "" {
+		challenge, err := s.newMFAChallenge(ctx, user.ID, permitted)
+		if err != nil {
+			s.logger.Error("Failed to create MFA challenge", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to create MFA challenge")
+		}
+
+		// No token until the second factor is completed
+		return &AuthenticateResponse{
+			Status:       AuthenticateResponse_MFA_REQUIRED,
+			RequiresMfa:  true,
+			MfaChallenge: challenge,
+		}, nil
+	}
+
+	// A code can't complete MFA if every method it could come from is barred
+	if requiresMFA && acceptsMFACode(methods) && !acceptsMFACode(permitted) {
+		s.reportFailure(ctx, user.ID, events.ReasonMFAFailed)
+		return nil, status.Error(codes.FailedPrecondition, "weaker MFA factor not allowed; use a passkey")
+	}
+
+	// Record the factors used so downstream services can require MFA
+	amr := []string{AMRPassword}
+	mfaVerified := false
+	if requiresMFA {
+		methodType, err := s.credentials.VerifyMFACode(ctx, user.ID, permitted, req.MfaCode)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidMFACode) {
+				s.logger.Error("Failed to verify MFA code", zap.Error(err))
+				return nil, status.Error(codes.Internal, "failed to verify MFA code")
+			}
+			s.logger.Info("MFA verification failed", clientinfo.Fields(ctx)...)
+			s.reportFailure(ctx, user.ID, events.ReasonMFAFailed)
+			return nil, status.Error(codes.Unauthenticated, "invalid MFA code")
+		}
+		amr = append(amr, AMRMFA, codeAMR(methodType))
+		mfaVerified = true
+	}
+
+	token, expiresAt, err := s.issueToken(ctx, user.ID, amr)
+	if err != nil {
+		s.logger.Error("Failed to issue session token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to issue session token")
+	}
+
+	resp := &AuthenticateResponse{
+		Status:    AuthenticateResponse_AUTHENTICATED,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      storageUserToProto(user),
+	}
+
+	// Only a verified second factor may let the device skip it next time
+	if mfaVerified && req.RememberDevice && req.DeviceFingerprint != "" && s.devices != nil {
+		deviceToken, err := s.devices.Issue(ctx, user.ID, req.DeviceFingerprint)
+		if err != nil {
+			// Remembering the device is best-effort; the login itself succeeded
+			s.logger.Error("Failed to issue device token", zap.Error(err))
+		} else {
+			resp.DeviceToken = deviceToken
+		}
+	}
+
+	return resp, nil
 }
 
 // ValidateToken validates an authentication token
@@ -54,6 +217,10 @@ func (s *AuthService) ValidateToken(ctx context.Context, req *ValidateTokenReque
 		return nil, status.Error(codes.InvalidArgument, "invalid token")
 	}
 
+	if s.tokens != nil {
+		return s.validateSignedToken(ctx, req)
+	}
+
 	// TODO: Implement token validation
 	// This would involve:
 	// 1. Verifying token signature
@@ -76,6 +243,12 @@ func (s *AuthService) RegisterPasskey(ctx context.Context, req *RegisterPasskeyR
 		return nil, status.Error(codes.InvalidArgument, "invalid request")
 	}
 
+	rp, err := s.relyingParty(ctx)
+	if err != nil {
+		s.logger.Warn("Rejected passkey registration host", zap.Error(err))
+		return nil, status.Error(codes.PermissionDenied, "host not allowed")
+	}
+
 	// TODO: Implement passkey registration
 	// This would involve:
 	// 1. Generating registration options
@@ -85,8 +258,8 @@ func (s *AuthService) RegisterPasskey(ctx context.Context, req *RegisterPasskeyR
 	return &RegisterPasskeyResponse{
 		Options: &PasskeyOptions{
 			Challenge: "dummy-challenge",
-			RpId: "auth.polyid.io",
-			RpName: "PolyID",
+			RpId:      rp.ID,
+			RpName:    rp.Name,
 		},
 	}, nil
 }
@@ -114,6 +287,10 @@ func (s *AuthService) AddMFAMethod(ctx context.Context, req *AddMFAMethodRequest
 		return nil, status.Error(codes.InvalidArgument, "invalid request")
 	}
 
+	if err := s.checkMethodLimit(ctx, req.UserId, req.Method); err != nil {
+		return nil, err
+	}
+
 	// TODO: Implement MFA method addition
 	// This would involve:
 	// 1. Validating method type
@@ -134,6 +311,11 @@ func (s *AuthService) VerifyMFAMethod(ctx context.Context, req *VerifyMFAMethodR
 		return nil, status.Error(codes.InvalidArgument, "invalid request")
 	}
 
+	// Recheck in case another method was enrolled since AddMFAMethod
+	if err := s.checkMethodLimit(ctx, req.UserId, req.Method); err != nil {
+		return nil, err
+	}
+
 	// TODO: Implement MFA method verification
 	// This would involve:
 	// 1. Validating verification code
@@ -168,19 +350,52 @@ func (s *AuthService) GetMFAMethods(ctx context.Context, req *GetMFAMethodsReque
 		return nil, status.Error(codes.InvalidArgument, "invalid request")
 	}
 
-	// TODO: Implement MFA methods retrieval
-	// This would involve:
-	// 1. Retrieving methods from storage
-	// 2. Filtering sensitive data
-	// 3. Returning method list
+	if req.TypeFilter != "" && !mfa.IsSupportedMethod(req.TypeFilter) {
+		return nil, status.Error(codes.InvalidArgument, "unknown MFA method type")
+	}
 
+	page, next, err := s.store.ListMFAMethods(ctx, req.UserId, storage.MFAMethodFilter{
+		Type:   req.TypeFilter,
+		Cursor: req.PageToken,
+		Limit:  int(req.PageSize),
+	})
+	if err != nil {
+		var storageErr *storage.StorageError
+		if errors.As(err, &storageErr) && storageErr.Code == storage.ErrInvalidInput {
+			return nil, status.Error(codes.InvalidArgument, "invalid page size or token")
+		}
+		s.logger.Error("Failed to get MFA methods", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get MFA methods")
+	}
+
+	// Conversion drops method values, which hold secrets and contact details
 	return &GetMFAMethodsResponse{
-		Methods: []*MFAMethod{
-			{
-				Id: "dummy-method-id",
-				Type: "totp",
-				CreatedAt: time.Now().Unix(),
-			},
-		},
+		Methods:       storageMFAMethodsToProto(page),
+		NextPageToken: next,
+	}, nil
+} 
+
+// RevokeDevice revokes a remembered device. The caller's bearer token must
+// belong to the device's owner or grant ScopeAdmin.
+func (s *AuthService) RevokeDevice(ctx context.Context, req *RevokeDeviceRequest) (*RevokeDeviceResponse, error) {
+	if req == nil || req.UserId == "" || req.DeviceFingerprint == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
+	}
+
+	if s.devices == nil {
+		return nil, status.Error(codes.Unimplemented, "device trust is not enabled")
+	}
+
+	if err := s.requireUserOrScope(ctx, req.UserId, ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	if err := s.devices.Revoke(ctx, req.UserId, req.DeviceFingerprint); err != nil {
+		s.logger.Error("Failed to revoke device", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to revoke device")
+	}
+
+	return &RevokeDeviceResponse{
+		Success: true,
 	}, nil
-} 
\ No newline at end of file
+}
\ No newline at end of file
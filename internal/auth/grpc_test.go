@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// pagedStore is a testStore that pages its methods like
+// storage.NoSQLStorage.ListMFAMethods, failing with err if set
+type pagedStore struct {
+	*testStore
+	err error
+}
+
+func (s *pagedStore) ListMFAMethods(ctx context.Context, userID string, filter storage.MFAMethodFilter) ([]*storage.MFAMethod, string, error) {
+	if s.err != nil {
+		return nil, "", s.err
+	}
+	if filter.Limit < 0 || filter.Limit > storage.MaxMFAMethodPageSize {
+		return nil, "", &storage.StorageError{Code: storage.ErrInvalidInput, Message: "MFA method page size is out of range"}
+	}
+	limit := filter.Limit
+	if limit == 0 {
+		limit = storage.DefaultMFAMethodPageSize
+	}
+
+	var matches []*storage.MFAMethod
+	for _, method := range s.methods {
+		if method.UserID == userID && method.ID > filter.Cursor && (filter.Type == "" || method.Type == filter.Type) {
+			matches = append(matches, method)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	if len(matches) <= limit {
+		return matches, "", nil
+	}
+	return matches[:limit], matches[limit-1].ID, nil
+}
+
+func newPagedStore(t *testing.T) *pagedStore {
+	t.Helper()
+	store := &pagedStore{testStore: newTestStore(t)}
+	store.methods = []*storage.MFAMethod{
+		{ID: "m3", UserID: "user-1", Type: "totp", Value: "JBSWY3DPEHPK3PXP"},
+		{ID: "m1", UserID: "user-1", Type: "totp", Value: "KRSXG5CTMVRXEZLU"},
+		{ID: "m5", UserID: "user-1", Type: "app_link", Value: "device-1"},
+		{ID: "m2", UserID: "user-1", Type: "sms", Value: "+14155550100"},
+		{ID: "m4", UserID: "user-1", Type: "sms", Value: "+14155550101"},
+		{ID: "m0", UserID: "user-2", Type: "totp", Value: "GEZDGNBVGY3TQOJQ"},
+	}
+	return store
+}
+
+func TestGetMFAMethodsPaging(t *testing.T) {
+	tests := []struct {
+		name      string
+		pageSize  int32
+		filter    string
+		wantPages [][]string
+	}{
+		{name: "one page", wantPages: [][]string{{"m1", "m2", "m3", "m4", "m5"}}},
+		{name: "pages of two", pageSize: 2, wantPages: [][]string{{"m1", "m2"}, {"m3", "m4"}, {"m5"}}},
+		{name: "pages of one", pageSize: 1, wantPages: [][]string{{"m1"}, {"m2"}, {"m3"}, {"m4"}, {"m5"}}},
+		{name: "filtered by type", filter: "sms", wantPages: [][]string{{"m2", "m4"}}},
+		{name: "filtered pages", pageSize: 1, filter: "totp", wantPages: [][]string{{"m1"}, {"m3"}}},
+		{name: "single match", filter: "app_link", pageSize: 5, wantPages: [][]string{{"m5"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAuthService(zap.NewNop(), newPagedStore(t), nil)
+
+			var pages [][]string
+			token := ""
+			for {
+				resp, err := s.GetMFAMethods(context.Background(), &GetMFAMethodsRequest{
+					UserId:     "user-1",
+					PageSize:   tt.pageSize,
+					PageToken:  token,
+					TypeFilter: tt.filter,
+				})
+				if err != nil {
+					t.Fatalf("GetMFAMethods: %v", err)
+				}
+
+				var ids []string
+				for _, method := range resp.Methods {
+					ids = append(ids, method.Id)
+					if tt.filter != "" && method.Type != tt.filter {
+						t.Errorf("method %s type = %q, want %q", method.Id, method.Type, tt.filter)
+					}
+				}
+				pages = append(pages, ids)
+
+				token = resp.NextPageToken
+				if token == "" {
+					break
+				}
+				if len(pages) > 10 {
+					t.Fatal("GetMFAMethods() never returned a last page")
+				}
+			}
+
+			if !reflect.DeepEqual(pages, tt.wantPages) {
+				t.Errorf("pages = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestGetMFAMethodsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *GetMFAMethodsRequest
+		storeErr error
+		wantCode codes.Code
+	}{
+		{name: "nil request", wantCode: codes.InvalidArgument},
+		{name: "missing user", req: &GetMFAMethodsRequest{}, wantCode: codes.InvalidArgument},
+		{name: "unknown type", req: &GetMFAMethodsRequest{UserId: "user-1", TypeFilter: "carrier_pigeon"}, wantCode: codes.InvalidArgument},
+		{name: "negative page size", req: &GetMFAMethodsRequest{UserId: "user-1", PageSize: -1}, wantCode: codes.InvalidArgument},
+		{name: "page size too large", req: &GetMFAMethodsRequest{UserId: "user-1", PageSize: storage.MaxMFAMethodPageSize + 1}, wantCode: codes.InvalidArgument},
+		{name: "storage failure", req: &GetMFAMethodsRequest{UserId: "user-1"}, storeErr: errors.New("storage down"), wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newPagedStore(t)
+			store.err = tt.storeErr
+			s := NewAuthService(zap.NewNop(), store, nil)
+
+			if _, err := s.GetMFAMethods(context.Background(), tt.req); status.Code(err) != tt.wantCode {
+				t.Errorf("GetMFAMethods() error = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// HealthChecker reports whether the service's dependencies are healthy
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// RegisterAll registers the auth service, the standard gRPC health service,
+// and server reflection with a gRPC server
+func (s *AuthService) RegisterAll(server *grpc.Server) {
+	s.RegisterService(server)
+	healthpb.RegisterHealthServer(server, s.health)
+	reflection.Register(server)
+}
+
+// MonitorHealth polls the checker at the given interval and reports SERVING
+// or NOT_SERVING through the health service until the context is cancelled
+func (s *AuthService) MonitorHealth(ctx context.Context, checker HealthChecker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.setServingStatus(checker.Check(ctx))
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.health.Shutdown()
+			return
+		}
+	}
+}
+
+func (s *AuthService) setServingStatus(err error) {
+	servingStatus := healthpb.HealthCheckResponse_SERVING
+	if err != nil {
+		s.logger.Warn("Health check failed", zap.Error(err))
+		servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	// The empty service name reports overall server health
+	s.health.SetServingStatus("", servingStatus)
+	s.health.SetServingStatus(Auth_ServiceDesc.ServiceName, servingStatus)
+}
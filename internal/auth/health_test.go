@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialBufconn serves s with RegisterAll on an in-process listener and
+// returns a connection to it. Both are closed when the test ends.
+func dialBufconn(t *testing.T, s *AuthService, opts ...grpc.ServerOption) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	s.RegisterAll(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// switchChecker reports the error last passed to set
+type switchChecker struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (c *switchChecker) set(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *switchChecker) Check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func TestHealthStatusTransitions(t *testing.T) {
+	s := NewAuthService(zap.NewNop(), nil, nil)
+	client := healthpb.NewHealthClient(dialBufconn(t, s))
+	checker := &switchChecker{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	monitored := make(chan struct{})
+	go func() {
+		s.MonitorHealth(ctx, checker, 5*time.Millisecond)
+		close(monitored)
+	}()
+
+	steps := []struct {
+		name    string
+		err     error
+		service string
+		want    healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{name: "healthy server", want: healthpb.HealthCheckResponse_SERVING},
+		{name: "healthy auth service", service: Auth_ServiceDesc.ServiceName, want: healthpb.HealthCheckResponse_SERVING},
+		{name: "dependency down", err: errors.New("redis unreachable"), want: healthpb.HealthCheckResponse_NOT_SERVING},
+		{name: "auth service down", err: errors.New("redis unreachable"), service: Auth_ServiceDesc.ServiceName, want: healthpb.HealthCheckResponse_NOT_SERVING},
+		{name: "recovered", want: healthpb.HealthCheckResponse_SERVING},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			checker.set(step.err)
+			waitForHealth(t, client, step.service, step.want)
+		})
+	}
+
+	cancel()
+	<-monitored
+	waitForHealth(t, client, "", healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// waitForHealth polls the health service until service reports want
+func waitForHealth(t *testing.T, client healthpb.HealthClient, service string, want healthpb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err == nil && resp.Status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("health of %q = %v (%v), want %s", service, resp.GetStatus(), err, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
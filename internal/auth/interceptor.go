@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/authz"
+	"github.com/polyid/auth/internal/clientinfo"
+)
+
+var _ authz.ScopeChecker = (*AuthService)(nil)
+
+// RequireMFA returns an interceptor that rejects calls to the given full
+// method names unless their bearer token records a completed second factor
+// and its session is active and bound to the caller. With no methods it
+// applies to every call. The verified claims are stored in the call's
+// context for ClaimsFromContext. Chain it after the clientinfo interceptor
+// so session bindings are checked against the caller.
+func (s *AuthService) RequireMFA(fullMethods ...string) grpc.UnaryServerInterceptor {
+	protected := make(map[string]bool, len(fullMethods))
+	for _, method := range fullMethods {
+		protected[method] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if len(protected) > 0 && !protected[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		if s.tokens == nil {
+			return nil, status.Error(codes.Unauthenticated, "token verification is not enabled")
+		}
+
+		token := bearerToken(ctx)
+		if token == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		}
+
+		claims, err := s.tokens.Parse(token, time.Now())
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if err := s.checkSession(ctx, claims); err != nil {
+			return nil, err
+		}
+		client, _ := clientinfo.FromContext(ctx)
+		if !s.checkBinding(claims, client) {
+			return nil, status.Error(codes.Unauthenticated, "session bound to another client")
+		}
+		if err := claims.RequireMFA(); err != nil {
+			return nil, status.Error(codes.PermissionDenied, "multi-factor authentication required")
+		}
+
+		return handler(NewContextWithClaims(ctx, claims), req)
+	}
+}
+
+// checkSession returns an Unauthenticated error if the claims' session has
+// been quarantined or revoked. A quarantined session's message prompts the
+// client to sign in again.
+func (s *AuthService) checkSession(ctx context.Context, claims *Claims) error {
+	if s.sessions == nil {
+		return nil
+	}
+
+	err := s.sessions.Check(ctx, claims.SessionID)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrSessionQuarantined):
+		return status.Error(codes.Unauthenticated, "session quarantined; sign in again")
+	case errors.Is(err, ErrSessionRevoked):
+		return status.Error(codes.Unauthenticated, "session revoked")
+	default:
+		s.logger.Error("Failed to check session state", zap.Error(err))
+		return status.Error(codes.Internal, "failed to check session")
+	}
+}
+
+// requireScope returns an error unless the call's bearer token is valid,
+// its session active, and it grants scope
+func (s *AuthService) requireScope(ctx context.Context, scope string) error {
+	return s.checkScope(ctx, bearerToken(ctx), scope)
+}
+
+// HasScope implements authz.ScopeChecker for HTTP handlers, applying the
+// same checks as admin RPCs to the request's bearer token
+func (s *AuthService) HasScope(r *http.Request, scope string) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	return s.checkScope(r.Context(), strings.TrimPrefix(header, "Bearer "), scope) == nil
+}
+
+// checkScope returns an error unless token is valid, its session active,
+// and it grants scope
+func (s *AuthService) checkScope(ctx context.Context, token string, scope string) error {
+	claims, err := s.verifyToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !claims.HasScope(scope) {
+		return status.Error(codes.PermissionDenied, scope+" scope required")
+	}
+	return nil
+}
+
+// requireUserOrScope returns an error unless the call's bearer token is
+// valid, its session active, and it was issued to userID or grants scope
+func (s *AuthService) requireUserOrScope(ctx context.Context, userID string, scope string) error {
+	claims, err := s.verifyToken(ctx, bearerToken(ctx))
+	if err != nil {
+		return err
+	}
+	if claims.Subject != userID && !claims.HasScope(scope) {
+		return status.Error(codes.PermissionDenied, "not permitted for this user")
+	}
+	return nil
+}
+
+// verifyToken returns the claims of token if it is valid and its session
+// active
+func (s *AuthService) verifyToken(ctx context.Context, token string) (*Claims, error) {
+	if s.tokens == nil {
+		return nil, status.Error(codes.PermissionDenied, "token verification is not enabled")
+	}
+
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing token")
+	}
+	claims, err := s.tokens.Parse(token, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if err := s.checkSession(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// bearerToken returns the bearer token from the call's authorization
+// metadata, as the Client sends it
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get("authorization") {
+		if strings.HasPrefix(value, "Bearer ") {
+			return strings.TrimPrefix(value, "Bearer ")
+		}
+	}
+	return ""
+}
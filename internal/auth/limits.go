@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/mfa"
+)
+
+// SetMFAMethodLimits caps active MFA methods per type for AddMFAMethod and
+// VerifyMFAMethod. Use the same limits as the MFA HTTP handler.
+func (s *AuthService) SetMFAMethodLimits(limits mfa.MethodLimits) {
+	s.limits = limits
+}
+
+// checkMethodLimit returns a FailedPrecondition error if the user can't
+// enroll another method of methodType
+func (s *AuthService) checkMethodLimit(ctx context.Context, userID string, methodType string) error {
+	if len(s.limits) == 0 {
+		return nil
+	}
+
+	methods, err := s.store.GetMFAMethods(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to get MFA methods", zap.Error(err))
+		return status.Error(codes.Internal, "failed to check MFA method limit")
+	}
+
+	if !s.limits.Allows(methods, methodType) {
+		return status.Error(codes.FailedPrecondition, "maximum number of methods of this type reached")
+	}
+	return nil
+}
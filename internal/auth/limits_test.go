@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/mfa"
+)
+
+func TestMFAMethodLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   mfa.MethodLimits
+		method   string
+		wantCode codes.Code
+	}{
+		{name: "no limits", method: "totp", wantCode: codes.OK},
+		{name: "below the limit", limits: mfa.MethodLimits{"totp": 2}, method: "totp", wantCode: codes.OK},
+		{name: "at the limit", limits: mfa.MethodLimits{"totp": 1}, method: "totp", wantCode: codes.FailedPrecondition},
+		{name: "another type at its limit", limits: mfa.MethodLimits{"totp": 1, "sms": 1}, method: "sms", wantCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The test store's user has one TOTP method
+			store := newTestStore(t)
+			s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+			s.SetMFAMethodLimits(tt.limits)
+			ctx := context.Background()
+
+			_, err := s.AddMFAMethod(ctx, &AddMFAMethodRequest{UserId: "user-1", Method: tt.method})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("AddMFAMethod() = %v, want %s", err, tt.wantCode)
+			}
+			_, err = s.VerifyMFAMethod(ctx, &VerifyMFAMethodRequest{UserId: "user-1", Method: tt.method, Code: "123456"})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("VerifyMFAMethod() = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
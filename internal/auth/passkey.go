@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/webauthn"
+)
+
+// PasskeyLogin runs WebAuthn login ceremonies, typically a *webauthn.Handler
+// shared with the HTTP endpoints so both transports use one session store
+type PasskeyLogin interface {
+	BeginAssertion(ctx context.Context, userID string) ([]byte, string, error)
+	FinishAssertion(ctx context.Context, userID string, ceremonyID string, assertion []byte) (string, error)
+}
+
+// SetPasskeyLogin enables the passkey login methods
+func (s *AuthService) SetPasskeyLogin(passkeys PasskeyLogin) {
+	s.passkeys = passkeys
+}
+
+// BeginPasskeyLogin starts a passkey login ceremony
+func (s *AuthService) BeginPasskeyLogin(ctx context.Context, req *BeginPasskeyLoginRequest) (*BeginPasskeyLoginResponse, error) {
+	if req == nil || req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
+	}
+
+	if s.passkeys == nil {
+		return nil, status.Error(codes.Unimplemented, "passkey login is not enabled")
+	}
+
+	options, ceremonyID, err := s.passkeys.BeginAssertion(ctx, req.UserId)
+	if err != nil {
+		s.logger.Error("Failed to begin passkey login", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to begin passkey login")
+	}
+
+	return &BeginPasskeyLoginResponse{
+		CeremonyId: ceremonyID,
+		Options:    options,
+	}, nil
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and returns a session token.
+// With a token issuer the token is a signed one recording the passkey.
+func (s *AuthService) FinishPasskeyLogin(ctx context.Context, req *FinishPasskeyLoginRequest) (*FinishPasskeyLoginResponse, error) {
+	if req == nil || req.UserId == "" || req.CeremonyId == "" || len(req.Assertion) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
+	}
+
+	if s.passkeys == nil {
+		return nil, status.Error(codes.Unimplemented, "passkey login is not enabled")
+	}
+
+	token, err := s.passkeys.FinishAssertion(ctx, req.UserId, req.CeremonyId, req.Assertion)
+	switch {
+	case errors.Is(err, webauthn.ErrCeremonyExpired):
+		return nil, status.Error(codes.FailedPrecondition, "passkey login ceremony expired")
+	case errors.Is(err, webauthn.ErrUnknownCeremony), errors.Is(err, webauthn.ErrInvalidChallenge),
+		errors.Is(err, webauthn.ErrInvalidAssertion):
+		return nil, status.Error(codes.InvalidArgument, "invalid passkey assertion")
+	case errors.Is(err, webauthn.ErrUserVerificationRequired):
+		return nil, status.Error(codes.Unauthenticated, "user verification required")
+	case errors.Is(err, webauthn.ErrInvalidCredential):
+		return nil, status.Error(codes.Unauthenticated, "invalid credential")
+	case err != nil:
+		s.logger.Error("Failed to finish passkey login", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to finish passkey login")
+	}
+
+	// A user-verified passkey is phishing-resistant MFA on its own
+	if s.tokens != nil {
+		token, _, err = s.issueToken(ctx, req.UserId, []string{AMRPasskey, AMRMFA})
+		if err != nil {
+			s.logger.Error("Failed to issue session token", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to issue session token")
+		}
+	}
+
+	return &FinishPasskeyLoginResponse{
+		Token: token,
+	}, nil
+}
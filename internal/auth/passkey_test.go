@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/webauthn"
+)
+
+// fakePasskeys runs single-use login ceremonies, accepting only the
+// assertion "signed"
+type fakePasskeys struct {
+	ceremonies map[string]string // ceremony ID to user ID
+	err        error
+}
+
+func (p *fakePasskeys) BeginAssertion(ctx context.Context, userID string) ([]byte, string, error) {
+	if p.err != nil {
+		return nil, "", p.err
+	}
+	p.ceremonies["ceremony-1"] = userID
+	return []byte(`{"publicKey":{"challenge":"Y2hhbGxlbmdl"}}`), "ceremony-1", nil
+}
+
+func (p *fakePasskeys) FinishAssertion(ctx context.Context, userID string, ceremonyID string, assertion []byte) (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	owner, ok := p.ceremonies[ceremonyID]
+	delete(p.ceremonies, ceremonyID)
+	if !ok || owner != userID {
+		return "", webauthn.ErrUnknownCeremony
+	}
+	if string(assertion) != "signed" {
+		return "", webauthn.ErrInvalidAssertion
+	}
+	return "webauthn-token", nil
+}
+
+func newPasskeyClient(t *testing.T, passkeys PasskeyLogin, issuer *TokenIssuer) *Client {
+	t.Helper()
+	store := newTestStore(t)
+	s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+	if passkeys != nil {
+		s.SetPasskeyLogin(passkeys)
+	}
+	if issuer != nil {
+		s.SetTokenIssuer(issuer)
+	}
+	return NewClient(dialBufconn(t, s))
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := newPasskeyClient(t, &fakePasskeys{ceremonies: make(map[string]string)}, issuer)
+	ctx := context.Background()
+
+	ceremonyID, options, err := client.BeginPasskeyLogin(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin: %v", err)
+	}
+	if ceremonyID != "ceremony-1" || len(options) == 0 {
+		t.Fatalf("BeginPasskeyLogin() = %q, %q, want a ceremony and options", ceremonyID, options)
+	}
+
+	token, err := client.FinishPasskeyLogin(ctx, "user-1", ceremonyID, []byte("signed"))
+	if err != nil {
+		t.Fatalf("FinishPasskeyLogin: %v", err)
+	}
+	claims, err := issuer.Parse(token, time.Now())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if want := []string{AMRPasskey, AMRMFA}; claims.Subject != "user-1" || !reflect.DeepEqual(claims.AMR, want) {
+		t.Errorf("claims = %s %v, want user-1 %v", claims.Subject, claims.AMR, want)
+	}
+
+	// The ceremony is single use
+	if _, err := client.FinishPasskeyLogin(ctx, "user-1", ceremonyID, []byte("signed")); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("FinishPasskeyLogin() replayed = %v, want %v", err, ErrInvalidRequest)
+	}
+}
+
+func TestPasskeyLoginErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		passkeys  PasskeyLogin
+		userID    string
+		assertion string
+		wantErr   error
+	}{
+		{name: "not enabled", userID: "user-1", assertion: "signed", wantErr: ErrServer},
+		{name: "missing user", passkeys: &fakePasskeys{ceremonies: make(map[string]string)}, assertion: "signed", wantErr: ErrInvalidRequest},
+		{name: "ceremony for another user", passkeys: &fakePasskeys{ceremonies: map[string]string{"ceremony-1": "user-2"}}, userID: "user-1", assertion: "signed", wantErr: ErrInvalidRequest},
+		{name: "bad assertion", passkeys: &fakePasskeys{ceremonies: map[string]string{"ceremony-1": "user-1"}}, userID: "user-1", assertion: "forged", wantErr: ErrInvalidRequest},
+		{name: "expired ceremony", passkeys: &fakePasskeys{err: webauthn.ErrCeremonyExpired}, userID: "user-1", assertion: "signed", wantErr: ErrInvalidRequest},
+		{name: "user not verified", passkeys: &fakePasskeys{err: webauthn.ErrUserVerificationRequired}, userID: "user-1", assertion: "signed", wantErr: ErrUnauthenticated},
+		{name: "invalid credential", passkeys: &fakePasskeys{err: webauthn.ErrInvalidCredential}, userID: "user-1", assertion: "signed", wantErr: ErrUnauthenticated},
+		{name: "internal failure", passkeys: &fakePasskeys{err: errors.New("storage down")}, userID: "user-1", assertion: "signed", wantErr: ErrServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newPasskeyClient(t, tt.passkeys, nil)
+
+			_, err := client.FinishPasskeyLogin(context.Background(), tt.userID, "ceremony-1", []byte(tt.assertion))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("FinishPasskeyLogin() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RiskDecision is the outcome of evaluating a login attempt
+type RiskDecision int
+
+const (
+	// RiskAllow lets the login proceed normally
+	RiskAllow RiskDecision = iota
+	// RiskRequireMFA forces MFA, even on a remembered device
+	RiskRequireMFA
+	// RiskDeny rejects the login
+	RiskDeny
+)
+
+// LoginAttempt describes a login being evaluated for risk
+type LoginAttempt struct {
+	UserID            string
+	IP                string
+	UserAgent         string
+	DeviceFingerprint string
+	Time              time.Time
+}
+
+// RiskEvaluator assesses login attempts. Implementations keep whatever
+// history they need.
+type RiskEvaluator interface {
+	Evaluate(ctx context.Context, attempt *LoginAttempt) (RiskDecision, error)
+}
+
+// NoopRiskEvaluator allows every login
+type NoopRiskEvaluator struct{}
+
+// Evaluate implements RiskEvaluator.Evaluate
+func (NoopRiskEvaluator) Evaluate(ctx context.Context, attempt *LoginAttempt) (RiskDecision, error) {
+	return RiskAllow, nil
+}
+
+// Locator resolves an IP address to coordinates in degrees
+type Locator interface {
+	Locate(ip string) (lat float64, lon float64, ok bool)
+}
+
+// VelocityRiskEvaluator is a simple in-memory example evaluator. It requires
+// MFA when a user logs in too often within a window or from two places too
+// far apart to travel between, and denies logins well beyond the rate limit.
+type VelocityRiskEvaluator struct {
+	window       time.Duration
+	maxAttempts  int
+	maxSpeedKmh  float64
+	locator      Locator
+	historyLimit int
+
+	mu      sync.Mutex
+	history map[string][]LoginAttempt
+}
+
+// NewVelocityRiskEvaluator creates a velocity evaluator. MFA is required once
+// a user exceeds maxAttempts within window and logins are denied beyond twice
+// that. A nil locator disables the impossible-travel check.
+func NewVelocityRiskEvaluator(window time.Duration, maxAttempts int, locator Locator) *VelocityRiskEvaluator {
+	return &VelocityRiskEvaluator{
+		window:       window,
+		maxAttempts:  maxAttempts,
+		maxSpeedKmh:  1000,
+		locator:      locator,
+		historyLimit: 2*maxAttempts + 1,
+		history:      make(map[string][]LoginAttempt),
+	}
+}
+
+// Evaluate implements RiskEvaluator.Evaluate
+func (e *VelocityRiskEvaluator) Evaluate(ctx context.Context, attempt *LoginAttempt) (RiskDecision, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Keep only attempts inside the window
+	recent := e.history[attempt.UserID][:0]
+	for _, previous := range e.history[attempt.UserID] {
+		if attempt.Time.Sub(previous.Time) < e.window {
+			recent = append(recent, previous)
+		}
+	}
+
+	decision := RiskAllow
+	switch {
+	case len(recent) >= 2*e.maxAttempts:
+		decision = RiskDeny
+	case len(recent) >= e.maxAttempts:
+		decision = RiskRequireMFA
+	case len(recent) > 0 && e.impossibleTravel(&recent[len(recent)-1], attempt):
+		decision = RiskRequireMFA
+	}
+
+	recent = append(recent, *attempt)
+	if len(recent) > e.historyLimit {
+		recent = recent[len(recent)-e.historyLimit:]
+	}
+	e.history[attempt.UserID] = recent
+
+	return decision, nil
+}
+
+// impossibleTravel reports whether getting from the previous login location
+// to the current one would require travelling faster than maxSpeedKmh
+func (e *VelocityRiskEvaluator) impossibleTravel(previous *LoginAttempt, current *LoginAttempt) bool {
+	if e.locator == nil || previous.IP == current.IP {
+		return false
+	}
+
+	lat1, lon1, ok1 := e.locator.Locate(previous.IP)
+	lat2, lon2, ok2 := e.locator.Locate(current.IP)
+	if !ok1 || !ok2 {
+		return false
+	}
+
+	hours := current.Time.Sub(previous.Time).Hours()
+	distance := haversineKm(lat1, lon1, lat2, lon2)
+	if hours <= 0 {
+		return distance > 0
+	}
+	return distance/hours > e.maxSpeedKmh
+}
+
+// haversineKm returns the great-circle distance between two points
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// SetRiskEvaluator sets the evaluator consulted during Authenticate
+func (s *AuthService) SetRiskEvaluator(evaluator RiskEvaluator) {
+	s.risk = evaluator
+}
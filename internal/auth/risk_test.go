@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// staticRisk returns the same decision for every attempt
+type staticRisk struct {
+	decision RiskDecision
+	err      error
+}
+
+func (r staticRisk) Evaluate(ctx context.Context, attempt *LoginAttempt) (RiskDecision, error) {
+	return r.decision, r.err
+}
+
+// testLocator places each IP at fixed coordinates
+type testLocator map[string][2]float64
+
+func (l testLocator) Locate(ip string) (float64, float64, bool) {
+	coords, ok := l[ip]
+	return coords[0], coords[1], ok
+}
+
+func TestAuthenticateRisk(t *testing.T) {
+	tests := []struct {
+		name       string
+		risk       RiskEvaluator
+		noMFA      bool
+		wantStatus AuthenticateResponse_Status
+	}{
+		{name: "low risk on a remembered device", risk: staticRisk{decision: RiskAllow}, wantStatus: AuthenticateResponse_AUTHENTICATED},
+		{name: "high risk forces MFA", risk: staticRisk{decision: RiskRequireMFA}, wantStatus: AuthenticateResponse_MFA_REQUIRED},
+		{name: "very high risk denies", risk: staticRisk{decision: RiskDeny}, wantStatus: AuthenticateResponse_LOCKED},
+		{name: "evaluator failure forces MFA", risk: staticRisk{err: errors.New("boom")}, wantStatus: AuthenticateResponse_MFA_REQUIRED},
+		{name: "low risk without MFA", risk: staticRisk{decision: RiskAllow}, noMFA: true, wantStatus: AuthenticateResponse_AUTHENTICATED},
+		{name: "high risk without MFA denies", risk: staticRisk{decision: RiskRequireMFA}, noMFA: true, wantStatus: AuthenticateResponse_LOCKED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			devices := NewDeviceTrust(store, testDeviceSecret, time.Hour)
+			s := NewAuthService(zap.NewNop(), store, devices)
+			s.SetCredentialVerifier(testVerifier{})
+			s.SetTokenIssuer(newTestIssuer(t))
+			s.SetRiskEvaluator(tt.risk)
+			ctx := context.Background()
+
+			deviceToken, err := devices.Issue(ctx, "user-1", "laptop")
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			if tt.noMFA {
+				store.methods = []*storage.MFAMethod{}
+			}
+
+			resp, err := s.Authenticate(ctx, &AuthenticateRequest{
+				Email:             "a@example.com",
+				AuthMethod:        &AuthenticateRequest_Password{Password: "correct"},
+				DeviceFingerprint: "laptop",
+				DeviceToken:       deviceToken,
+			})
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("Authenticate() status = %s, want %s", resp.Status, tt.wantStatus)
+			}
+			if got := resp.Token != ""; got != (tt.wantStatus == AuthenticateResponse_AUTHENTICATED) {
+				t.Errorf("Authenticate() returned token = %v with status %s", got, resp.Status)
+			}
+		})
+	}
+}
+
+func TestVelocityRiskEvaluator(t *testing.T) {
+	start := time.Now()
+	locator := testLocator{
+		"198.51.100.1": {51.5, -0.1},   // London
+		"198.51.100.2": {48.9, 2.4},    // Paris
+		"203.0.113.1":  {-33.9, 151.2}, // Sydney
+	}
+
+	type step struct {
+		ip    string
+		after time.Duration // since start
+		want  RiskDecision
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "within the limit",
+			steps: []step{
+				{ip: "198.51.100.1", want: RiskAllow},
+				{ip: "198.51.100.1", after: time.Minute, want: RiskAllow},
+			},
+		},
+		{
+			name: "over the limit forces MFA, far over denies",
+			steps: []step{
+				{ip: "198.51.100.1", want: RiskAllow},
+				{ip: "198.51.100.1", after: time.Second, want: RiskAllow},
+				{ip: "198.51.100.1", after: 2 * time.Second, want: RiskRequireMFA},
+				{ip: "198.51.100.1", after: 3 * time.Second, want: RiskRequireMFA},
+				{ip: "198.51.100.1", after: 4 * time.Second, want: RiskDeny},
+			},
+		},
+		{
+			name: "attempts outside the window are forgotten",
+			steps: []step{
+				{ip: "198.51.100.1", want: RiskAllow},
+				{ip: "198.51.100.1", after: time.Second, want: RiskAllow},
+				{ip: "198.51.100.1", after: 2 * time.Hour, want: RiskAllow},
+			},
+		},
+		{
+			name: "impossible travel forces MFA",
+			steps: []step{
+				{ip: "198.51.100.1", want: RiskAllow},
+				{ip: "203.0.113.1", after: time.Hour, want: RiskRequireMFA},
+			},
+		},
+		{
+			name: "plausible travel",
+			steps: []step{
+				{ip: "198.51.100.1", want: RiskAllow},
+				{ip: "198.51.100.2", after: 2 * time.Hour, want: RiskAllow},
+			},
+		},
+		{
+			name: "unknown location",
+			steps: []step{
+				{ip: "198.51.100.1", want: RiskAllow},
+				{ip: "192.0.2.1", after: time.Second, want: RiskAllow},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewVelocityRiskEvaluator(time.Hour, 2, locator)
+			for i, step := range tt.steps {
+				got, err := e.Evaluate(context.Background(), &LoginAttempt{
+					UserID: "user-1",
+					IP:     step.ip,
+					Time:   start.Add(step.after),
+				})
+				if err != nil {
+					t.Fatalf("Evaluate: %v", err)
+				}
+				if got != step.want {
+					t.Errorf("attempt %d: Evaluate() = %d, want %d", i, got, step.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrUnknownHost is returned when a request host isn't in the RP allowlist
+var ErrUnknownHost = errors.New("unknown host")
+
+// defaultRelyingParty is used by RegisterPasskey when no RPResolver is set
+var defaultRelyingParty = RelyingParty{ID: "auth.polyid.io", Name: "PolyID"}
+
+// RelyingParty identifies the WebAuthn relying party passkeys are
+// registered with
+type RelyingParty struct {
+	ID   string
+	Name string
+}
+
+// RPResolver derives the relying party from the host a request was sent
+// to, so each brand of a multi-brand deployment registers passkeys under its
+// own domain. Only allowlisted hosts resolve.
+type RPResolver struct {
+	hosts map[string]RelyingParty
+}
+
+// NewRPResolver creates a resolver from a map of allowed hosts to their
+// relying parties. Each RP ID must be the host itself or a parent domain of
+// it, as browsers enforce.
+func NewRPResolver(hosts map[string]RelyingParty) (*RPResolver, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("at least one host is required")
+	}
+
+	resolved := make(map[string]RelyingParty, len(hosts))
+	for host, rp := range hosts {
+		host = normalizeHost(host)
+		if host == "" {
+			return nil, errors.New("host must not be empty")
+		}
+		if rp.ID == "" || rp.Name == "" {
+			return nil, fmt.Errorf("relying party ID and name are required for host %q", host)
+		}
+		if host != rp.ID && !strings.HasSuffix(host, "."+rp.ID) {
+			return nil, fmt.Errorf("relying party ID %q is not a suffix of host %q", rp.ID, host)
+		}
+		resolved[host] = rp
+	}
+
+	return &RPResolver{hosts: resolved}, nil
+}
+
+// Resolve returns the relying party for host, which may include a port
+func (r *RPResolver) Resolve(host string) (RelyingParty, error) {
+	rp, ok := r.hosts[normalizeHost(host)]
+	if !ok {
+		return RelyingParty{}, fmt.Errorf("%w: %q", ErrUnknownHost, host)
+	}
+	return rp, nil
+}
+
+// SetRPResolver resolves RegisterPasskey's relying party from the request
+// host, rejecting hosts the resolver doesn't know
+func (s *AuthService) SetRPResolver(resolver *RPResolver) {
+	s.rps = resolver
+}
+
+// relyingParty returns the relying party for the request in ctx
+func (s *AuthService) relyingParty(ctx context.Context) (RelyingParty, error) {
+	if s.rps == nil {
+		return defaultRelyingParty, nil
+	}
+	return s.rps.Resolve(requestHost(ctx))
+}
+
+// requestHost returns the host the client addressed, from the HTTP/2
+// :authority pseudo-header
+func requestHost(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if authority := md.Get(":authority"); len(authority) > 0 {
+		return authority[0]
+	}
+	return ""
+}
+
+// normalizeHost lowercases host and strips any port and trailing dot
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testRelyingParties = map[string]RelyingParty{
+	"auth.polyid.io":   {ID: "polyid.io", Name: "PolyID"},
+	"login.brand.com":  {ID: "brand.com", Name: "Brand"},
+	"Other.Example.IO": {ID: "other.example.io", Name: "Other"},
+}
+
+func TestNewRPResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   map[string]RelyingParty
+		wantErr bool
+	}{
+		{name: "valid", hosts: testRelyingParties},
+		{name: "no hosts", wantErr: true},
+		{name: "empty host", hosts: map[string]RelyingParty{"": {ID: "polyid.io", Name: "PolyID"}}, wantErr: true},
+		{name: "missing RP ID", hosts: map[string]RelyingParty{"auth.polyid.io": {Name: "PolyID"}}, wantErr: true},
+		{name: "missing RP name", hosts: map[string]RelyingParty{"auth.polyid.io": {ID: "polyid.io"}}, wantErr: true},
+		{name: "RP ID of another domain", hosts: map[string]RelyingParty{"auth.polyid.io": {ID: "brand.com", Name: "Brand"}}, wantErr: true},
+		{name: "RP ID sharing only a suffix", hosts: map[string]RelyingParty{"auth.notpolyid.io": {ID: "polyid.io", Name: "PolyID"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRPResolver(tt.hosts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRPResolver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRPResolverResolve(t *testing.T) {
+	resolver, err := NewRPResolver(testRelyingParties)
+	if err != nil {
+		t.Fatalf("NewRPResolver: %v", err)
+	}
+
+	tests := []struct {
+		host    string
+		want    RelyingParty
+		wantErr bool
+	}{
+		{host: "auth.polyid.io", want: RelyingParty{ID: "polyid.io", Name: "PolyID"}},
+		{host: "login.brand.com", want: RelyingParty{ID: "brand.com", Name: "Brand"}},
+		{host: "login.brand.com:443", want: RelyingParty{ID: "brand.com", Name: "Brand"}},
+		{host: "LOGIN.Brand.com.", want: RelyingParty{ID: "brand.com", Name: "Brand"}},
+		{host: "other.example.io", want: RelyingParty{ID: "other.example.io", Name: "Other"}},
+		{host: "brand.com", wantErr: true},
+		{host: "evil.example.com", wantErr: true},
+		{host: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			rp, err := resolver.Resolve(tt.host)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnknownHost) {
+					t.Errorf("Resolve() error = %v, want %v", err, ErrUnknownHost)
+				}
+				return
+			}
+			if err != nil || rp != tt.want {
+				t.Errorf("Resolve() = %+v, %v, want %+v", rp, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterPasskeyRelyingParty(t *testing.T) {
+	resolver, err := NewRPResolver(testRelyingParties)
+	if err != nil {
+		t.Fatalf("NewRPResolver: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		resolver *RPResolver
+		host     string
+		want     RelyingParty
+		wantCode codes.Code
+	}{
+		{name: "default without a resolver", host: "anything.example.com", want: defaultRelyingParty},
+		{name: "first brand", resolver: resolver, host: "auth.polyid.io", want: RelyingParty{ID: "polyid.io", Name: "PolyID"}},
+		{name: "second brand", resolver: resolver, host: "login.brand.com:443", want: RelyingParty{ID: "brand.com", Name: "Brand"}},
+		{name: "unknown host", resolver: resolver, host: "evil.example.com", wantCode: codes.PermissionDenied},
+		{name: "no host", resolver: resolver, wantCode: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+			if tt.resolver != nil {
+				s.SetRPResolver(tt.resolver)
+			}
+
+			ctx := context.Background()
+			if tt.host != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(":authority", tt.host))
+			}
+			resp, err := s.RegisterPasskey(ctx, &RegisterPasskeyRequest{UserId: "user-1"})
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Errorf("RegisterPasskey() error = %v, want %v", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RegisterPasskey: %v", err)
+			}
+			if got := (RelyingParty{ID: resp.Options.RpId, Name: resp.Options.RpName}); got != tt.want {
+				t.Errorf("relying party = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// SessionState is the state of a signed-in session
+type SessionState string
+
+// Session states. Sessions are active unless marked otherwise.
+const (
+	SessionActive      SessionState = "active"
+	SessionQuarantined SessionState = "quarantined"
+	SessionRevoked     SessionState = "revoked"
+)
+
+// Session check errors
+var (
+	ErrSessionQuarantined = errors.New("session quarantined")
+	ErrSessionRevoked     = errors.New("session revoked")
+)
+
+// maxSessionStateAttempts bounds how often a state change is retried when
+// the session's state changes underneath it
+const maxSessionStateAttempts = 3
+
+// SessionStore holds session states. State changes are conditional writes,
+// so a revocation can never be undone by a racing quarantine or restore.
+type SessionStore interface {
+	GetTemporaryValue(ctx context.Context, key string) (string, error)
+	StoreTemporaryValue(ctx context.Context, key string, value string, expiry time.Duration) error
+	storage.AtomicTempStore
+}
+
+// SessionRegistry records sessions that have been quarantined or revoked.
+// Only those are stored, each for as long as the session's tokens stay
+// valid, so active sessions cost nothing.
+type SessionRegistry struct {
+	store SessionStore
+	ttl   time.Duration
+}
+
+// NewSessionRegistry creates a session registry for tokens valid for ttl,
+// the TTL of the TokenIssuer
+func NewSessionRegistry(store SessionStore, ttl time.Duration) *SessionRegistry {
+	return &SessionRegistry{
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// State returns the session's state
+func (r *SessionRegistry) State(ctx context.Context, sessionID string) (SessionState, error) {
+	value, err := r.store.GetTemporaryValue(ctx, sessionStateKey(sessionID))
+	var storageErr *storage.StorageError
+	if errors.As(err, &storageErr) && storageErr.Code == storage.ErrNotFound {
+		return SessionActive, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return SessionState(value), nil
+}
+
+// Check returns ErrSessionQuarantined or ErrSessionRevoked unless the
+// session is active
+func (r *SessionRegistry) Check(ctx context.Context, sessionID string) error {
+	state, err := r.State(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case SessionActive:
+		return nil
+	case SessionQuarantined:
+		return ErrSessionQuarantined
+	default:
+		return ErrSessionRevoked
+	}
+}
+
+// Quarantine suspends an active session until it is restored or revoked.
+// Its tokens then fail validation with a step-up reauthentication prompt
+// rather than outright. Revoked sessions stay revoked.
+func (r *SessionRegistry) Quarantine(ctx context.Context, sessionID string) error {
+	return r.transition(ctx, sessionID, SessionActive, SessionQuarantined)
+}
+
+// Restore returns a quarantined session to active
+func (r *SessionRegistry) Restore(ctx context.Context, sessionID string) error {
+	return r.transition(ctx, sessionID, SessionQuarantined, SessionActive)
+}
+
+// transition moves a session from one state to another with a conditional
+// write. A session already in the target state is left alone, and a revoked
+// one returns ErrSessionRevoked.
+func (r *SessionRegistry) transition(ctx context.Context, sessionID string, from, to SessionState) error {
+	key := sessionStateKey(sessionID)
+	for attempt := 0; attempt < maxSessionStateAttempts; attempt++ {
+		swapped, err := r.store.SwapTemporaryValue(ctx, key, storedState(from), storedState(to), r.ttl)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			return nil
+		}
+
+		state, err := r.State(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case to:
+			return nil
+		case SessionRevoked:
+			return ErrSessionRevoked
+		}
+		// The state changed between the swap and the read; try again
+	}
+
+	return &storage.StorageError{
+		Code:    storage.ErrConflict,
+		Message: "Session state was concurrently modified",
+	}
+}
+
+// storedState returns the value stored for a state. Active sessions have
+// no stored value.
+func storedState(state SessionState) string {
+	if state == SessionActive {
+		return ""
+	}
+	return string(state)
+}
+
+// Revoke permanently ends a session
+func (r *SessionRegistry) Revoke(ctx context.Context, sessionID string) error {
+	return r.store.StoreTemporaryValue(ctx, sessionStateKey(sessionID), string(SessionRevoked), r.ttl)
+}
+
+func sessionStateKey(sessionID string) string {
+	return "session_state:" + sessionID
+}
+
+// SetSessionRegistry enables session quarantine and revocation. It requires
+// a token issuer, whose tokens carry the session ID. Quarantining and
+// resolving sessions requires a token with ScopeAdmin.
+func (s *AuthService) SetSessionRegistry(sessions *SessionRegistry) {
+	s.sessions = sessions
+}
+
+// QuarantineSession suspends a session pending investigation
+func (s *AuthService) QuarantineSession(ctx context.Context, req *QuarantineSessionRequest) (*QuarantineSessionResponse, error) {
+	if req == nil || req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
+	}
+	if s.sessions == nil {
+		return nil, status.Error(codes.Unimplemented, "session quarantine is not enabled")
+	}
+	if err := s.requireScope(ctx, ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	err := s.sessions.Quarantine(ctx, req.SessionId)
+	if errors.Is(err, ErrSessionRevoked) {
+		return nil, status.Error(codes.FailedPrecondition, "session already revoked")
+	}
+	if err != nil {
+		s.logger.Error("Failed to quarantine session", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to quarantine session")
+	}
+
+	s.logger.Info("Quarantined session", zap.String("session_id", req.SessionId))
+	return &QuarantineSessionResponse{Success: true}, nil
+}
+
+// ResolveSession ends a session's quarantine, restoring it to active or
+// revoking it
+func (s *AuthService) ResolveSession(ctx context.Context, req *ResolveSessionRequest) (*ResolveSessionResponse, error) {
+	if req == nil || req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
+	}
+	if s.sessions == nil {
+		return nil, status.Error(codes.Unimplemented, "session quarantine is not enabled")
+	}
+	if err := s.requireScope(ctx, ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	if req.Revoke {
+		if err := s.sessions.Revoke(ctx, req.SessionId); err != nil {
+			s.logger.Error("Failed to revoke session", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to revoke session")
+		}
+		s.logger.Info("Revoked session", zap.String("session_id", req.SessionId))
+		return &ResolveSessionResponse{Success: true}, nil
+	}
+
+	err := s.sessions.Restore(ctx, req.SessionId)
+	if errors.Is(err, ErrSessionRevoked) {
+		return nil, status.Error(codes.FailedPrecondition, "session already revoked")
+	}
+	if err != nil {
+		s.logger.Error("Failed to restore session", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to restore session")
+	}
+
+	s.logger.Info("Restored session", zap.String("session_id", req.SessionId))
+	return &ResolveSessionResponse{Success: true}, nil
+}
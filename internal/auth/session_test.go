@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+func newTestSessions(t *testing.T) *SessionRegistry {
+	t.Helper()
+	store := storage.NewMemoryStore(0)
+	t.Cleanup(store.Close)
+	return NewSessionRegistry(store, time.Hour)
+}
+
+func TestSessionRegistryTransitions(t *testing.T) {
+	quarantine := func(r *SessionRegistry) error { return r.Quarantine(context.Background(), "session-1") }
+	restore := func(r *SessionRegistry) error { return r.Restore(context.Background(), "session-1") }
+	revoke := func(r *SessionRegistry) error { return r.Revoke(context.Background(), "session-1") }
+
+	tests := []struct {
+		name      string
+		setup     []func(*SessionRegistry) error
+		op        func(*SessionRegistry) error
+		wantErr   error
+		wantState SessionState
+		wantCheck error
+	}{
+		{name: "quarantine an active session", op: quarantine, wantState: SessionQuarantined, wantCheck: ErrSessionQuarantined},
+		{name: "quarantine twice", setup: []func(*SessionRegistry) error{quarantine}, op: quarantine, wantState: SessionQuarantined, wantCheck: ErrSessionQuarantined},
+		{name: "restore a quarantined session", setup: []func(*SessionRegistry) error{quarantine}, op: restore, wantState: SessionActive},
+		{name: "restore an active session", op: restore, wantState: SessionActive},
+		{name: "revoke a quarantined session", setup: []func(*SessionRegistry) error{quarantine}, op: revoke, wantState: SessionRevoked, wantCheck: ErrSessionRevoked},
+		{name: "revoke an active session", op: revoke, wantState: SessionRevoked, wantCheck: ErrSessionRevoked},
+		{name: "quarantine a revoked session", setup: []func(*SessionRegistry) error{revoke}, op: quarantine, wantErr: ErrSessionRevoked, wantState: SessionRevoked, wantCheck: ErrSessionRevoked},
+		{name: "restore a revoked session", setup: []func(*SessionRegistry) error{quarantine, revoke}, op: restore, wantErr: ErrSessionRevoked, wantState: SessionRevoked, wantCheck: ErrSessionRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestSessions(t)
+			ctx := context.Background()
+			for _, setup := range tt.setup {
+				if err := setup(r); err != nil {
+					t.Fatalf("setup: %v", err)
+				}
+			}
+
+			if err := tt.op(r); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			state, err := r.State(ctx, "session-1")
+			if err != nil {
+				t.Fatalf("State: %v", err)
+			}
+			if state != tt.wantState {
+				t.Errorf("State() = %s, want %s", state, tt.wantState)
+			}
+			if err := r.Check(ctx, "session-1"); !errors.Is(err, tt.wantCheck) {
+				t.Errorf("Check() = %v, want %v", err, tt.wantCheck)
+			}
+
+			// Other sessions are unaffected
+			if err := r.Check(ctx, "session-2"); err != nil {
+				t.Errorf("Check(session-2) = %v, want nil", err)
+			}
+		})
+	}
+}
+
+// newSessionService returns a service with a session registry and a token
+// issuer, and an admin token for it
+func newSessionService(t *testing.T) (*AuthService, *TokenIssuer, string) {
+	t.Helper()
+	store := newTestStore(t)
+	s := NewAuthService(zap.NewNop(), store, nil)
+	issuer := newTestIssuer(t)
+	s.SetTokenIssuer(issuer)
+	s.SetSessionRegistry(newTestSessions(t))
+
+	admin, _, err := issuer.IssueScoped("ops", []string{ScopeAdmin}, time.Now())
+	if err != nil {
+		t.Fatalf("IssueScoped: %v", err)
+	}
+	return s, issuer, admin
+}
+
+func TestQuarantinedSessionForcesReauth(t *testing.T) {
+	const protected = "/polyid.auth.AuthService/DeletePasskey"
+	s, issuer, admin := newSessionService(t)
+	adminCtx := withBearer(context.Background(), admin)
+
+	token, claims, err := issuer.Issue("user-1", []string{AMRPassword, AMRMFA, AMROTP}, nil, time.Now())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	interceptor := s.RequireMFA(protected)
+	call := func() error {
+		_, err := interceptor(withBearer(context.Background(), token), nil, &grpc.UnaryServerInfo{FullMethod: protected},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil })
+		return err
+	}
+	validate := func() *ValidateTokenResponse {
+		t.Helper()
+		resp, err := s.ValidateToken(context.Background(), &ValidateTokenRequest{Token: token})
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		return resp
+	}
+
+	if resp := validate(); !resp.Valid || resp.ReauthRequired || resp.SessionId != claims.SessionID {
+		t.Fatalf("active ValidateToken() = %+v, want valid for session %s", resp, claims.SessionID)
+	}
+
+	// Quarantine prompts the client to sign in again
+	if _, err := s.QuarantineSession(adminCtx, &QuarantineSessionRequest{SessionId: claims.SessionID}); err != nil {
+		t.Fatalf("QuarantineSession: %v", err)
+	}
+	if resp := validate(); resp.Valid || !resp.ReauthRequired || resp.SessionId != claims.SessionID || resp.User == nil {
+		t.Errorf("quarantined ValidateToken() = %+v, want reauth required", resp)
+	}
+	if err := call(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("quarantined call error = %v, want %s", err, codes.Unauthenticated)
+	}
+
+	// Restoring makes the same token valid again
+	if _, err := s.ResolveSession(adminCtx, &ResolveSessionRequest{SessionId: claims.SessionID}); err != nil {
+		t.Fatalf("ResolveSession(restore): %v", err)
+	}
+	if resp := validate(); !resp.Valid || resp.ReauthRequired {
+		t.Errorf("restored ValidateToken() = %+v, want valid", resp)
+	}
+	if err := call(); err != nil {
+		t.Errorf("restored call error = %v, want nil", err)
+	}
+
+	// Revoking ends the session for good
+	if _, err := s.QuarantineSession(adminCtx, &QuarantineSessionRequest{SessionId: claims.SessionID}); err != nil {
+		t.Fatalf("QuarantineSession: %v", err)
+	}
+	if _, err := s.ResolveSession(adminCtx, &ResolveSessionRequest{SessionId: claims.SessionID, Revoke: true}); err != nil {
+		t.Fatalf("ResolveSession(revoke): %v", err)
+	}
+	if resp := validate(); resp.Valid || resp.ReauthRequired {
+		t.Errorf("revoked ValidateToken() = %+v, want invalid without reauth", resp)
+	}
+	if err := call(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("revoked call error = %v, want %s", err, codes.Unauthenticated)
+	}
+	if _, err := s.ResolveSession(adminCtx, &ResolveSessionRequest{SessionId: claims.SessionID}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("restoring a revoked session error = %v, want %s", err, codes.FailedPrecondition)
+	}
+	if _, err := s.QuarantineSession(adminCtx, &QuarantineSessionRequest{SessionId: claims.SessionID}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("quarantining a revoked session error = %v, want %s", err, codes.FailedPrecondition)
+	}
+}
+
+func TestSessionRPCAuthorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		as         string // "admin", "user", or "" for no token
+		noRegistry bool
+		sessionID  string
+		wantCode   codes.Code
+	}{
+		{name: "admin", as: "admin", sessionID: "session-1"},
+		{name: "missing session ID", as: "admin", wantCode: codes.InvalidArgument},
+		{name: "missing token", sessionID: "session-1", wantCode: codes.Unauthenticated},
+		{name: "without the admin scope", as: "user", sessionID: "session-1", wantCode: codes.PermissionDenied},
+		{name: "not enabled", as: "admin", noRegistry: true, sessionID: "session-1", wantCode: codes.Unimplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, issuer, admin := newSessionService(t)
+			if tt.noRegistry {
+				s.SetSessionRegistry(nil)
+			}
+			ctx := context.Background()
+			switch tt.as {
+			case "admin":
+				ctx = withBearer(ctx, admin)
+			case "user":
+				user, _, err := issuer.Issue("user-1", []string{AMRPassword}, nil, time.Now())
+				if err != nil {
+					t.Fatalf("Issue: %v", err)
+				}
+				ctx = withBearer(ctx, user)
+			}
+
+			if _, err := s.QuarantineSession(ctx, &QuarantineSessionRequest{SessionId: tt.sessionID}); status.Code(err) != tt.wantCode {
+				t.Errorf("QuarantineSession() error = %v, want %s", err, tt.wantCode)
+			}
+			if _, err := s.ResolveSession(ctx, &ResolveSessionRequest{SessionId: tt.sessionID}); status.Code(err) != tt.wantCode {
+				t.Errorf("ResolveSession() error = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
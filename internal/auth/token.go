@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/authz"
+	"github.com/polyid/auth/internal/clientinfo"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// minTokenKeyBytes is the minimum session token signing key length
+const minTokenKeyBytes = 32
+
+// Authentication method references (RFC 8176) recorded in the amr claim
+const (
+	AMRPassword = "pwd"
+	AMRMFA      = "mfa"
+	AMROTP      = "otp" // TOTP code
+	AMRSMS      = "sms"
+	AMRPasskey  = "hwk" // proof of possession of a hardware-bound key
+	AMRAppLink  = "pop" // proof of possession of a registered app key
+)
+
+// Token errors
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrMFARequired  = errors.New("multi-factor authentication required")
+)
+
+// Claims are the claims carried by a session token
+type Claims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// SessionID identifies the sign-in, so the session can be quarantined
+	// or revoked
+	SessionID string `json:"sid"`
+
+	// AMR lists the authentication methods used to sign in
+	AMR []string `json:"amr,omitempty"`
+	// MFASatisfied reports whether a second factor was completed in the
+	// sign-in that issued the token. Logins that skipped MFA on a
+	// remembered device don't satisfy it.
+	MFASatisfied bool `json:"mfa_satisfied"`
+	// Binding is the client the session is bound to, if any
+	Binding *Binding `json:"bnd,omitempty"`
+	// Scopes grants access beyond the subject's own account, e.g.
+	// ScopeAdmin. Only IssueScoped sets it.
+	Scopes []string `json:"scope,omitempty"`
+}
+
+// ScopeAdmin grants access to admin-only RPCs and endpoints
+const ScopeAdmin = authz.ScopeAdmin
+
+// HasScope reports whether the claims grant scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireMFA returns ErrMFARequired unless the claims record a completed
+// second factor
+func (c *Claims) RequireMFA() error {
+	if !c.MFASatisfied {
+		return ErrMFARequired
+	}
+	return nil
+}
+
+// TokenIssuer issues and verifies signed session tokens
+type TokenIssuer struct {
+	key []byte
+	ttl time.Duration
+}
+
+// NewTokenIssuer creates a token issuer signing with key. Every instance
+// must share the key.
+func NewTokenIssuer(key []byte, ttl time.Duration) (*TokenIssuer, error) {
+	if len(key) < minTokenKeyBytes {
+		return nil, fmt.Errorf("token key must be at least %d bytes", minTokenKeyBytes)
+	}
+	if ttl <= 0 {
+		return nil, errors.New("token TTL must be positive")
+	}
+	return &TokenIssuer{key: key, ttl: ttl}, nil
+}
+
+// Issue creates a token for userID recording the methods used to sign in.
+// MFA is satisfied when amr includes AMRMFA. A non-nil binding binds the
+// session to the client that signed in.
+func (t *TokenIssuer) Issue(userID string, amr []string, binding *Binding, now time.Time) (string, *Claims, error) {
+	claims := &Claims{
+		Subject:   userID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.ttl).Unix(),
+		AMR:       amr,
+		Binding:   binding,
+	}
+	for _, method := range amr {
+		if method == AMRMFA {
+			claims.MFASatisfied = true
+		}
+	}
+	return t.signClaims(claims)
+}
+
+// IssueScoped creates a token for an operator or service account granting
+// scopes, e.g. ScopeAdmin. Mint these out of band; Authenticate never grants
+// scopes.
+func (t *TokenIssuer) IssueScoped(subject string, scopes []string, now time.Time) (string, *Claims, error) {
+	if len(scopes) == 0 {
+		return "", nil, errors.New("scoped token requires at least one scope")
+	}
+	return t.signClaims(&Claims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.ttl).Unix(),
+		Scopes:    scopes,
+	})
+}
+
+// signClaims assigns the claims a new session ID and encodes and signs them
+func (t *TokenIssuer) signClaims(claims *Claims) (string, *Claims, error) {
+	sid := make([]byte, 16)
+	if _, err := rand.Read(sid); err != nil {
+		return "", nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	claims.SessionID = hex.EncodeToString(sid)
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode token claims: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + t.sign(encoded), claims, nil
+}
+
+// Parse verifies a token's signature and expiry and returns its claims
+func (t *TokenIssuer) Parse(token string, now time.Time) (*Claims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(t.sign(encoded)), []byte(signature)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Subject == "" || now.Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+func (t *TokenIssuer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type claimsKey struct{}
+
+// NewContextWithClaims returns a copy of ctx carrying the token claims
+func NewContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the token claims stored in ctx, if any
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// SetTokenIssuer issues signed session tokens from Authenticate and
+// verifies them in ValidateToken. Without one, placeholder tokens are
+// returned.
+func (s *AuthService) SetTokenIssuer(tokens *TokenIssuer) {
+	s.tokens = tokens
+}
+
+// issueToken issues a session token, or a placeholder if no issuer is set.
+// It returns the token and its expiry as a Unix time.
+func (s *AuthService) issueToken(ctx context.Context, userID string, amr []string) (string, int64, error) {
+	if s.tokens == nil {
+		return "dummy-token", time.Now().Add(24 * time.Hour).Unix(), nil
+	}
+
+	client, _ := clientinfo.FromContext(ctx)
+	token, claims, err := s.tokens.Issue(userID, amr, s.binding.bind(client), time.Now())
+	if err != nil {
+		return "", 0, err
+	}
+	return token, claims.ExpiresAt, nil
+}
+
+// validateSignedToken verifies a token issued by the token issuer and
+// reports its user and MFA claims
+func (s *AuthService) validateSignedToken(ctx context.Context, req *ValidateTokenRequest) (*ValidateTokenResponse, error) {
+	claims, err := s.tokens.Parse(req.Token, time.Now())
+	if err != nil {
+		return &ValidateTokenResponse{Valid: false}, nil
+	}
+	client, err := s.validatingClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if !s.checkBinding(claims, client) {
+		return &ValidateTokenResponse{Valid: false}, nil
+	}
+
+	reauth := false
+	if s.sessions != nil {
+		err := s.sessions.Check(ctx, claims.SessionID)
+		switch {
+		case errors.Is(err, ErrSessionRevoked):
+			return &ValidateTokenResponse{Valid: false}, nil
+		case errors.Is(err, ErrSessionQuarantined):
+			// Not valid, but the user can step up by signing in again
+			reauth = true
+		case err != nil:
+			s.logger.Error("Failed to check session state", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to validate token")
+		}
+	}
+
+	user, err := s.store.GetUser(ctx, claims.Subject)
+	var storageErr *storage.StorageError
+	if errors.As(err, &storageErr) && storageErr.Code == storage.ErrNotFound {
+		// A deleted user's tokens are no longer valid
+		return &ValidateTokenResponse{Valid: false}, nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to get token subject", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to validate token")
+	}
+
+	if reauth {
+		return &ValidateTokenResponse{
+			Valid:          false,
+			User:           storageUserToProto(user),
+			SessionId:      claims.SessionID,
+			ReauthRequired: true,
+		}, nil
+	}
+
+	return &ValidateTokenResponse{
+		Valid:        true,
+		User:         storageUserToProto(user),
+		Amr:          claims.AMR,
+		MfaSatisfied: claims.MFASatisfied,
+		SessionId:    claims.SessionID,
+	}, nil
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewTokenIssuer(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     []byte
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "valid", key: testTokenKey, ttl: time.Hour},
+		{name: "short key", key: testTokenKey[:minTokenKeyBytes-1], ttl: time.Hour, wantErr: true},
+		{name: "zero TTL", key: testTokenKey, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTokenIssuer(tt.key, tt.ttl)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTokenIssuer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenIssuerMFAClaim(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	tests := []struct {
+		name    string
+		amr     []string
+		wantMFA bool
+	}{
+		{name: "password only", amr: []string{AMRPassword}},
+		{name: "password and TOTP", amr: []string{AMRPassword, AMRMFA, AMROTP}, wantMFA: true},
+		{name: "passkey", amr: []string{AMRPasskey, AMRMFA}, wantMFA: true},
+		{name: "one-time code without the mfa method", amr: []string{AMRPassword, AMROTP}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := issuer.Issue("user-1", tt.amr, nil, time.Now())
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+
+			claims, err := issuer.Parse(token, time.Now())
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if claims.Subject != "user-1" || !reflect.DeepEqual(claims.AMR, tt.amr) || claims.MFASatisfied != tt.wantMFA {
+				t.Errorf("claims = %+v, want user-1 with amr %v and mfa_satisfied %v", claims, tt.amr, tt.wantMFA)
+			}
+
+			err = claims.RequireMFA()
+			if tt.wantMFA && err != nil {
+				t.Errorf("RequireMFA() = %v, want nil", err)
+			}
+			if !tt.wantMFA && !errors.Is(err, ErrMFARequired) {
+				t.Errorf("RequireMFA() = %v, want %v", err, ErrMFARequired)
+			}
+		})
+	}
+}
+
+func TestTokenIssuerParse(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+	token, claims, err := issuer.Issue("user-1", []string{AMRPassword}, nil, now)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Claiming MFA without re-signing must not verify
+	encoded, signature, _ := strings.Cut(token, ".")
+	forged := *claims
+	forged.MFASatisfied = true
+	payload, err := json.Marshal(forged)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	forgedToken := base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+
+	otherIssuer, err := NewTokenIssuer([]byte(strings.Repeat("o", minTokenKeyBytes)), time.Hour)
+	if err != nil {
+		t.Fatalf("NewTokenIssuer: %v", err)
+	}
+	otherToken, _, err := otherIssuer.Issue("user-1", []string{AMRPassword}, nil, now)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		at      time.Time
+		wantErr bool
+	}{
+		{name: "valid", token: token, at: now},
+		{name: "forged MFA claim", token: forgedToken, at: now, wantErr: true},
+		{name: "signed with another key", token: otherToken, at: now, wantErr: true},
+		{name: "missing signature", token: encoded, at: now, wantErr: true},
+		{name: "expired", token: token, at: now.Add(time.Hour), wantErr: true},
+		{name: "empty", at: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := issuer.Parse(tt.token, tt.at)
+			if tt.wantErr && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Parse() = %v, want %v", err, ErrInvalidToken)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Parse() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestValidateTokenMFAClaim(t *testing.T) {
+	store := newTestStore(t)
+	s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+	issuer := newTestIssuer(t)
+	s.SetTokenIssuer(issuer)
+
+	for _, amr := range [][]string{{AMRPassword}, {AMRPassword, AMRMFA, AMROTP}} {
+		token, claims, err := issuer.Issue("user-1", amr, nil, time.Now())
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+
+		resp, err := s.ValidateToken(context.Background(), &ValidateTokenRequest{Token: token})
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		if !resp.Valid || !reflect.DeepEqual(resp.Amr, amr) || resp.MfaSatisfied != claims.MFASatisfied {
+			t.Errorf("ValidateToken(%v) = valid %v, amr %v, mfa_satisfied %v", amr, resp.Valid, resp.Amr, resp.MfaSatisfied)
+		}
+	}
+}
+
+func TestRequireMFAInterceptor(t *testing.T) {
+	const protected = "/polyid.auth.AuthService/DeletePasskey"
+	issuer := newTestIssuer(t)
+	issue := func(amr ...string) string {
+		token, _, err := issuer.Issue("user-1", amr, nil, time.Now())
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name     string
+		noIssuer bool
+		method   string
+		token    string
+		wantCode codes.Code
+		wantMFA  bool
+	}{
+		{name: "MFA satisfied", method: protected, token: issue(AMRPassword, AMRMFA, AMROTP), wantMFA: true},
+		{name: "password only", method: protected, token: issue(AMRPassword), wantCode: codes.PermissionDenied},
+		{name: "missing token", method: protected, wantCode: codes.Unauthenticated},
+		{name: "invalid token", method: protected, token: "not-a-token", wantCode: codes.Unauthenticated},
+		{name: "unprotected method", method: "/polyid.auth.AuthService/Authenticate", token: issue(AMRPassword)},
+		{name: "no token issuer", noIssuer: true, method: protected, token: issue(AMRPassword, AMRMFA), wantCode: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			s := NewAuthService(zap.NewNop(), store, NewDeviceTrust(store, testDeviceSecret, time.Hour))
+			if !tt.noIssuer {
+				s.SetTokenIssuer(issuer)
+			}
+			interceptor := s.RequireMFA(protected)
+
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = withBearer(ctx, tt.token)
+			}
+			called := false
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				claims, ok := ClaimsFromContext(ctx)
+				if tt.wantMFA && (!ok || !claims.MFASatisfied) {
+					t.Errorf("handler claims = %+v, %v, want MFA satisfied", claims, ok)
+				}
+				return "ok", nil
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("interceptor error = %v, want %v", err, tt.wantCode)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCode == codes.OK)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+// Package authz defines the scope checks the HTTP handlers share with the
+// token issuer in package auth, which they can't import
+package authz
+
+import "net/http"
+
+// ScopeAdmin grants access to admin-only RPCs and endpoints
+const ScopeAdmin = "admin"
+
+// ScopeChecker reports whether a request's bearer token grants a scope,
+// typically an auth.AuthService
+type ScopeChecker interface {
+	HasScope(r *http.Request, scope string) bool
+}
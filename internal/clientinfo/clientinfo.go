@@ -0,0 +1,116 @@
+package clientinfo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Info describes the client that issued a request
+type Info struct {
+	IP        string
+	UserAgent string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the client info
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the client info stored in ctx, if any
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(contextKey{}).(Info)
+	return info, ok
+}
+
+// Fields returns the client info in ctx as log fields for audit logging
+func Fields(ctx context.Context) []zap.Field {
+	info, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("client_ip", info.IP),
+		zap.String("user_agent", info.UserAgent),
+	}
+}
+
+// Extractor resolves the client IP of a request, honouring X-Forwarded-For
+// only when the request arrived through a trusted proxy
+type Extractor struct {
+	trusted []*net.IPNet
+}
+
+// NewExtractor creates an extractor trusting the given proxy IPs or CIDRs
+func NewExtractor(trustedProxies []string) (*Extractor, error) {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		trusted = append(trusted, network)
+	}
+
+	return &Extractor{
+		trusted: trusted,
+	}, nil
+}
+
+// ClientIP returns the client IP for a request received from remoteAddr with
+// the given X-Forwarded-For header. The header is walked right to left past
+// trusted proxies; the first untrusted hop is the client.
+func (e *Extractor) ClientIP(remoteAddr string, forwardedFor string) string {
+	ip := hostOnly(remoteAddr)
+	if !e.isTrusted(ip) || forwardedFor == "" {
+		return ip
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !e.isTrusted(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (e *Extractor) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range e.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,42 @@
+package clientinfo
+
+import "testing"
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		trusted      []string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:5123", want: "203.0.113.7"},
+		{name: "header ignored without trusted proxies", remoteAddr: "203.0.113.7:5123", forwardedFor: "198.51.100.1", want: "203.0.113.7"},
+		{name: "header ignored from an untrusted peer", trusted: []string{"10.0.0.0/8"}, remoteAddr: "203.0.113.7:5123", forwardedFor: "198.51.100.1", want: "203.0.113.7"},
+		{name: "client behind a trusted proxy", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:5123", forwardedFor: "198.51.100.1", want: "198.51.100.1"},
+		{name: "trusted proxy given as a single IP", trusted: []string{"10.0.0.2"}, remoteAddr: "10.0.0.2:5123", forwardedFor: "198.51.100.1", want: "198.51.100.1"},
+		{name: "trusted proxy without a header", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:5123", want: "10.0.0.2"},
+		{name: "chain of trusted proxies", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:5123", forwardedFor: "198.51.100.1, 10.0.0.9", want: "198.51.100.1"},
+		{name: "spoofed leftmost hop", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:5123", forwardedFor: "1.2.3.4, 198.51.100.1", want: "198.51.100.1"},
+		{name: "malformed hop", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:5123", forwardedFor: "198.51.100.1, garbage", want: "10.0.0.2"},
+		{name: "IPv6 behind a trusted proxy", trusted: []string{"::1"}, remoteAddr: "[::1]:5123", forwardedFor: "2001:db8::1", want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewExtractor(tt.trusted)
+			if err != nil {
+				t.Fatalf("NewExtractor: %v", err)
+			}
+			if got := e.ClientIP(tt.remoteAddr, tt.forwardedFor); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewExtractorInvalidProxy(t *testing.T) {
+	if _, err := NewExtractor([]string{"not-an-ip"}); err == nil {
+		t.Error("NewExtractor() accepted an invalid proxy")
+	}
+}
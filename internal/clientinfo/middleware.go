@@ -0,0 +1,41 @@
+package clientinfo
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// GinMiddleware stores the client info of each HTTP request in its context
+func (e *Extractor) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := Info{
+			IP:        e.ClientIP(c.Request.RemoteAddr, c.GetHeader("X-Forwarded-For")),
+			UserAgent: c.Request.UserAgent(),
+		}
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), info))
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor stores the client info of each gRPC call in its context
+func (e *Extractor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var remoteAddr string
+		if p, ok := peer.FromContext(ctx); ok {
+			remoteAddr = p.Addr.String()
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		client := Info{
+			IP:        e.ClientIP(remoteAddr, strings.Join(md.Get("x-forwarded-for"), ",")),
+			UserAgent: strings.Join(md.Get("user-agent"), " "),
+		}
+
+		return handler(NewContext(ctx, client), req)
+	}
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// CommitStrategy controls when marked consumer offsets are committed
+type CommitStrategy int
+
+const (
+	// CommitPerMessage marks each message once handled and lets the client
+	// auto-commit marked offsets every second. It is the default.
+	CommitPerMessage CommitStrategy = iota
+	// CommitBatch commits once every ConsumerConfig.CommitBatchSize marked
+	// messages
+	CommitBatch
+	// CommitInterval commits every ConsumerConfig.CommitInterval
+	CommitInterval
+)
+
+// committer commits marked offsets for one consumer group session according
+// to the configured strategy. With batch and interval commits, offsets marked
+// since the last commit are lost on a crash and their messages are
+// re-delivered; on a clean shutdown or rebalance they are committed.
+type committer struct {
+	session   sarama.ConsumerGroupSession
+	strategy  CommitStrategy
+	batchSize int
+
+	mu      sync.Mutex
+	pending int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newCommitter(session sarama.ConsumerGroupSession, strategy CommitStrategy, batchSize int, interval time.Duration) *committer {
+	c := &committer{
+		session:   session,
+		strategy:  strategy,
+		batchSize: batchSize,
+		done:      make(chan struct{}),
+	}
+
+	if strategy == CommitInterval {
+		c.wg.Add(1)
+		go c.intervalLoop(interval)
+	}
+
+	return c
+}
+
+// mark marks msg as handled and commits if the batch is full
+func (c *committer) mark(msg *sarama.ConsumerMessage) {
+	c.session.MarkMessage(msg, "")
+
+	if c.strategy != CommitBatch {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending++
+	if c.pending >= c.batchSize {
+		c.pending = 0
+		c.session.Commit()
+	}
+}
+
+func (c *committer) intervalLoop(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.session.Commit()
+		}
+	}
+}
+
+// stop commits any offsets marked since the last commit
+func (c *committer) stop() {
+	close(c.done)
+	c.wg.Wait()
+
+	if c.strategy != CommitPerMessage {
+		c.session.Commit()
+	}
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// committingSession tracks marked and committed offsets as the broker would
+// see them. Other ConsumerGroupSession methods are unimplemented.
+type committingSession struct {
+	sarama.ConsumerGroupSession
+
+	mu        sync.Mutex
+	marked    int64
+	committed int64
+	commits   int
+}
+
+func newCommittingSession() *committingSession {
+	return &committingSession{marked: -1, committed: -1}
+}
+
+func (s *committingSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = msg.Offset
+}
+
+func (s *committingSession) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed = s.marked
+	s.commits++
+}
+
+// redeliveredFrom returns the first offset a new consumer would receive
+func (s *committingSession) redeliveredFrom() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.committed + 1
+}
+
+// markOffsets marks offsets 0 to n-1 in order
+func markOffsets(c *committer, n int) {
+	for i := 0; i < n; i++ {
+		c.mark(&sarama.ConsumerMessage{Topic: "events", Offset: int64(i)})
+	}
+}
+
+func TestBatchCommit(t *testing.T) {
+	tests := []struct {
+		name          string
+		handled       int
+		wantRedeliver int64
+	}{
+		{name: "crash before the first batch", handled: 2, wantRedeliver: 0},
+		{name: "crash on a batch boundary", handled: 6, wantRedeliver: 6},
+		{name: "crash mid-batch", handled: 8, wantRedeliver: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newCommittingSession()
+			c := newCommitter(session, CommitBatch, 3, 0)
+
+			// Crash: the committer is never stopped
+			markOffsets(c, tt.handled)
+
+			if got := session.redeliveredFrom(); got != tt.wantRedeliver {
+				t.Errorf("after a crash, delivery resumes at offset %d, want %d", got, tt.wantRedeliver)
+			}
+		})
+	}
+}
+
+func TestCommitOnStop(t *testing.T) {
+	tests := []struct {
+		name        string
+		strategy    CommitStrategy
+		batchSize   int
+		interval    time.Duration
+		wantCommits int
+	}{
+		{name: "batch", strategy: CommitBatch, batchSize: 3, wantCommits: 2},
+		{name: "interval", strategy: CommitInterval, interval: time.Hour, wantCommits: 1},
+		{name: "per message leaves commits to the client", strategy: CommitPerMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newCommittingSession()
+			c := newCommitter(session, tt.strategy, tt.batchSize, tt.interval)
+
+			markOffsets(c, 5)
+			c.stop()
+
+			if session.commits != tt.wantCommits {
+				t.Errorf("commits = %d, want %d", session.commits, tt.wantCommits)
+			}
+			if tt.strategy != CommitPerMessage && session.redeliveredFrom() != 5 {
+				t.Errorf("after a clean stop, delivery resumes at offset %d, want 5", session.redeliveredFrom())
+			}
+		})
+	}
+}
+
+func TestIntervalCommit(t *testing.T) {
+	session := newCommittingSession()
+	c := newCommitter(session, CommitInterval, 0, 5*time.Millisecond)
+	defer c.stop()
+
+	markOffsets(c, 3)
+
+	deadline := time.Now().Add(time.Second)
+	for session.redeliveredFrom() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("marked offsets were not committed on the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// consumeConcurrently handles up to h.cfg.Concurrency messages from the claim at
+// once, marking offsets only once every earlier message has completed
+func (h *consumerGroupHandler) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := newOffsetTracker(h.commits)
+	sem := make(chan struct{}, h.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for msg := range claim.Messages() {
+		sem <- struct{}{}
+		tracker.start(msg)
+
+		wg.Add(1)
+		go func(msg *sarama.ConsumerMessage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Failed messages are passed over, as in sequential mode, once a
+			// later message completes
+			h.processMessage(session.Context(), msg)
+			tracker.complete(msg)
+		}(msg)
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// offsetTracker marks the highest offset below which every started message
+// has completed
+type offsetTracker struct {
+	commits *committer
+
+	mu        sync.Mutex
+	inFlight  []*sarama.ConsumerMessage // started messages, in offset order
+	completed map[int64]bool
+}
+
+func newOffsetTracker(commits *committer) *offsetTracker {
+	return &offsetTracker{
+		commits:   commits,
+		completed: make(map[int64]bool),
+	}
+}
+
+func (t *offsetTracker) start(msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight = append(t.inFlight, msg)
+}
+
+// complete records msg as done and marks the end of the contiguous run of
+// completed messages at the head of the queue, if any
+func (t *offsetTracker) complete(msg *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.completed[msg.Offset] = true
+
+	var last *sarama.ConsumerMessage
+	for len(t.inFlight) > 0 && t.completed[t.inFlight[0].Offset] {
+		last = t.inFlight[0]
+		delete(t.completed, last.Offset)
+		t.inFlight = t.inFlight[1:]
+	}
+
+	// Marking under the lock keeps marks in offset order
+	if last != nil {
+		t.commits.mark(last)
+	}
+}
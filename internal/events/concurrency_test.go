@@ -0,0 +1,96 @@
+package events
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+// markingSession records the offsets marked on it. Other
+// ConsumerGroupSession methods are unimplemented.
+type markingSession struct {
+	sarama.ConsumerGroupSession
+
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *markingSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *markingSession) Commit() {}
+
+// newTrackedMessages starts n messages with offsets 0 to n-1 on a tracker
+func newTrackedMessages(n int) (*offsetTracker, *markingSession, []*sarama.ConsumerMessage) {
+	session := &markingSession{}
+	tracker := newOffsetTracker(newCommitter(session, CommitPerMessage, 0, 0))
+	msgs := make([]*sarama.ConsumerMessage, n)
+	for i := range msgs {
+		msgs[i] = &sarama.ConsumerMessage{Topic: "events", Offset: int64(i)}
+		tracker.start(msgs[i])
+	}
+	return tracker, session, msgs
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name       string
+		order      []int // offsets in completion order
+		wantMarked []int64
+	}{
+		{name: "in order", order: []int{0, 1, 2, 3}, wantMarked: []int64{0, 1, 2, 3}},
+		{name: "reversed", order: []int{3, 2, 1, 0}, wantMarked: []int64{3}},
+		{name: "gap filled later", order: []int{0, 2, 3, 1}, wantMarked: []int64{0, 3}},
+		{name: "head still in flight", order: []int{1, 2, 3}},
+		{name: "interleaved", order: []int{1, 0, 3, 2}, wantMarked: []int64{1, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, session, msgs := newTrackedMessages(4)
+			for _, i := range tt.order {
+				tracker.complete(msgs[i])
+			}
+
+			if !reflect.DeepEqual(session.marked, tt.wantMarked) {
+				t.Errorf("marked offsets = %v, want %v", session.marked, tt.wantMarked)
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerConcurrent(t *testing.T) {
+	const n = 500
+	tracker, session, msgs := newTrackedMessages(n)
+
+	var wg sync.WaitGroup
+	for _, i := range rand.Perm(n) {
+		wg.Add(1)
+		go func(msg *sarama.ConsumerMessage) {
+			defer wg.Done()
+			tracker.complete(msg)
+		}(msgs[i])
+	}
+	wg.Wait()
+
+	if len(session.marked) == 0 {
+		t.Fatal("no offsets marked")
+	}
+	for i := 1; i < len(session.marked); i++ {
+		if session.marked[i] <= session.marked[i-1] {
+			t.Fatalf("marked offsets out of order: %v", session.marked)
+		}
+	}
+	if last := session.marked[len(session.marked)-1]; last != n-1 {
+		t.Errorf("last marked offset = %d, want %d", last, n-1)
+	}
+	if len(tracker.inFlight) != 0 || len(tracker.completed) != 0 {
+		t.Errorf("tracker not drained: %d in flight, %d completed", len(tracker.inFlight), len(tracker.completed))
+	}
+}
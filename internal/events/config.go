@@ -0,0 +1,133 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// minIdempotentVersion is the first Kafka version with idempotent producers
+var minIdempotentVersion = sarama.V0_11_0_0
+
+// ProducerConfig configures a KafkaProducer
+type ProducerConfig struct {
+	Brokers []string
+	// Version is the Kafka protocol version to speak, such as "2.8.0". It
+	// should match the oldest broker in the cluster. Empty uses Sarama's
+	// default, which predates features like idempotence.
+	Version string
+	// Idempotent makes the producer deduplicate its own retries on the
+	// broker. It requires Version 0.11.0 or later.
+	Idempotent bool
+	// BatchSize enables buffered mode: events are sent in batches once
+	// BatchSize events are buffered or FlushInterval elapses, whichever comes
+	// first. Zero sends each event individually.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Validate reports the first problem with the configuration
+func (c ProducerConfig) Validate() error {
+	if err := validateBrokers(c.Brokers); err != nil {
+		return err
+	}
+	version, err := kafkaVersion(c.Version)
+	if err != nil {
+		return err
+	}
+	if c.Idempotent && !version.IsAtLeast(minIdempotentVersion) {
+		return fmt.Errorf("idempotent producer requires Kafka version %s or later", minIdempotentVersion)
+	}
+	if c.BatchSize < 0 {
+		return errors.New("batch size must not be negative")
+	}
+	if c.BatchSize > 0 && c.FlushInterval <= 0 {
+		return errors.New("flush interval must be positive when batching")
+	}
+	return nil
+}
+
+// ConsumerConfig configures a KafkaConsumer
+type ConsumerConfig struct {
+	Brokers []string
+	GroupID string
+	// Version is the Kafka protocol version to speak, as in ProducerConfig
+	Version string
+	// Concurrency is how many messages from a single partition may be
+	// handled at once. 0 or 1 processes each partition in order; higher
+	// values give up per-partition ordering for throughput, so only use them
+	// when handlers are independent of event order. Offsets are only
+	// committed up to the last contiguous completed message.
+	Concurrency int
+
+	// CommitStrategy chooses when handled offsets are committed. Batch and
+	// interval commits reduce commit traffic at the cost of re-delivering
+	// more messages after a crash.
+	CommitStrategy  CommitStrategy
+	CommitBatchSize int
+	CommitInterval  time.Duration
+}
+
+// Validate reports the first problem with the configuration
+func (c ConsumerConfig) Validate() error {
+	if err := validateBrokers(c.Brokers); err != nil {
+		return err
+	}
+	if _, err := kafkaVersion(c.Version); err != nil {
+		return err
+	}
+	if strings.TrimSpace(c.GroupID) == "" {
+		return errors.New("group ID is required")
+	}
+	if c.Concurrency < 0 {
+		return errors.New("concurrency must not be negative")
+	}
+	switch c.CommitStrategy {
+	case CommitPerMessage:
+	case CommitBatch:
+		if c.CommitBatchSize <= 0 {
+			return errors.New("commit batch size must be positive for batch commits")
+		}
+	case CommitInterval:
+		if c.CommitInterval <= 0 {
+			return errors.New("commit interval must be positive for interval commits")
+		}
+	default:
+		return errors.New("unknown commit strategy")
+	}
+	return nil
+}
+
+func validateBrokers(brokers []string) error {
+	if len(brokers) == 0 {
+		return errors.New("at least one broker is required")
+	}
+	for _, broker := range brokers {
+		if strings.TrimSpace(broker) == "" {
+			return errors.New("broker addresses must not be empty")
+		}
+	}
+	return nil
+}
+
+// kafkaVersion parses a configured Kafka version, returning Sarama's default
+// if it is empty. Only versions Sarama supports are accepted.
+func kafkaVersion(version string) (sarama.KafkaVersion, error) {
+	if version == "" {
+		return sarama.NewConfig().Version, nil
+	}
+
+	parsed, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return sarama.KafkaVersion{}, fmt.Errorf("invalid Kafka version %q", version)
+	}
+	for _, supported := range sarama.SupportedVersions {
+		if parsed == supported {
+			return parsed, nil
+		}
+	}
+	return sarama.KafkaVersion{}, fmt.Errorf("unsupported Kafka version %q", version)
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestProducerConfigValidate(t *testing.T) {
+	brokers := []string{"kafka-1:9092", "kafka-2:9092"}
+
+	tests := []struct {
+		name    string
+		cfg     ProducerConfig
+		wantErr bool
+	}{
+		{name: "minimal", cfg: ProducerConfig{Brokers: brokers}},
+		{name: "idempotent and batched", cfg: ProducerConfig{Brokers: brokers, Version: "2.8.0", Idempotent: true, BatchSize: 100, FlushInterval: time.Second}},
+		{name: "no brokers", cfg: ProducerConfig{}, wantErr: true},
+		{name: "empty broker", cfg: ProducerConfig{Brokers: []string{"kafka-1:9092", " "}}, wantErr: true},
+		{name: "invalid version", cfg: ProducerConfig{Brokers: brokers, Version: "latest"}, wantErr: true},
+		{name: "unsupported version", cfg: ProducerConfig{Brokers: brokers, Version: "0.7.0.0"}, wantErr: true},
+		{name: "idempotent on the first supporting version", cfg: ProducerConfig{Brokers: brokers, Version: "0.11.0.0", Idempotent: true}},
+		{name: "idempotent on an old version", cfg: ProducerConfig{Brokers: brokers, Version: "0.10.2.0", Idempotent: true}, wantErr: true},
+		{name: "idempotent on the default version", cfg: ProducerConfig{Brokers: brokers, Idempotent: true}, wantErr: !sarama.NewConfig().Version.IsAtLeast(sarama.V0_11_0_0)},
+		{name: "negative batch size", cfg: ProducerConfig{Brokers: brokers, BatchSize: -1}, wantErr: true},
+		{name: "batching without a flush interval", cfg: ProducerConfig{Brokers: brokers, BatchSize: 100}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConsumerConfigValidate(t *testing.T) {
+	brokers := []string{"kafka-1:9092"}
+
+	tests := []struct {
+		name    string
+		cfg     ConsumerConfig
+		wantErr bool
+	}{
+		{name: "minimal", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid"}},
+		{name: "concurrent", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", Version: "2.8.0", Concurrency: 8}},
+		{name: "batch commits", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", CommitStrategy: CommitBatch, CommitBatchSize: 50}},
+		{name: "interval commits", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", CommitStrategy: CommitInterval, CommitInterval: time.Second}},
+		{name: "no brokers", cfg: ConsumerConfig{GroupID: "polyid"}, wantErr: true},
+		{name: "invalid version", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", Version: "2.x"}, wantErr: true},
+		{name: "no group ID", cfg: ConsumerConfig{Brokers: brokers, GroupID: "  "}, wantErr: true},
+		{name: "negative concurrency", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", Concurrency: -1}, wantErr: true},
+		{name: "batch commits without a size", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", CommitStrategy: CommitBatch}, wantErr: true},
+		{name: "interval commits without an interval", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", CommitStrategy: CommitInterval}, wantErr: true},
+		{name: "unknown commit strategy", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", CommitStrategy: CommitStrategy(99)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKafkaVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    sarama.KafkaVersion
+		wantErr bool
+	}{
+		{version: "", want: sarama.NewConfig().Version},
+		{version: "2.8.0", want: sarama.V2_8_0_0},
+		{version: "0.11.0.0", want: sarama.V0_11_0_0},
+		{version: "latest", wantErr: true},
+		{version: "0.7.0.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := kafkaVersion(tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("kafkaVersion(%q) error = %v, want error %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("kafkaVersion(%q) = %s, want %s", tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DedupStore records which events have already been processed
+type DedupStore interface {
+	// Seen reports whether the event ID has already been processed
+	Seen(ctx context.Context, id string) (bool, error)
+	// MarkProcessed records the event ID as processed
+	MarkProcessed(ctx context.Context, id string) error
+}
+
+// RedisDedupStore is a DedupStore backed by Redis keys that expire after ttl.
+// The TTL should exceed the longest expected redelivery delay.
+type RedisDedupStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisDedupStore creates a Redis dedup store. The prefix scopes the keys,
+// typically to the consumer group.
+func NewRedisDedupStore(client *redis.Client, prefix string, ttl time.Duration) *RedisDedupStore {
+	return &RedisDedupStore{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+// Seen implements DedupStore.Seen
+func (s *RedisDedupStore) Seen(ctx context.Context, id string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.key(id)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check event ID: %w", err)
+	}
+	return n > 0, nil
+}
+
+// MarkProcessed implements DedupStore.MarkProcessed
+func (s *RedisDedupStore) MarkProcessed(ctx context.Context, id string) error {
+	if err := s.client.Set(ctx, s.key(id), "1", s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to mark event ID: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisDedupStore) key(id string) string {
+	return fmt.Sprintf("%s:dedup:%s", s.prefix, id)
+}
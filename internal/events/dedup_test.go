@@ -0,0 +1,98 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// countingHandler counts the events it handles, failing while err is set
+type countingHandler struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (h *countingHandler) HandleEvent(ctx context.Context, event *Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	return h.err
+}
+
+func newTestDedupStore(t *testing.T) *RedisDedupStore {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisDedupStore(client, "auth-consumers", time.Hour)
+}
+
+func eventMessage(t *testing.T, event *Event) *sarama.ConsumerMessage {
+	t.Helper()
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	return &sarama.ConsumerMessage{Topic: "auth-events", Value: data}
+}
+
+func TestProcessMessageDeduplication(t *testing.T) {
+	login := &Event{ID: "evt-1", Type: "user.login"}
+	other := &Event{ID: "evt-2", Type: "user.login"}
+	noID := &Event{Type: "user.login"}
+
+	tests := []struct {
+		name string
+		// deliveries are delivered in order; failFirst fails the first
+		deliveries []*Event
+		failFirst  bool
+		noDedup    bool
+		wantCalls  int
+	}{
+		{name: "same event twice", deliveries: []*Event{login, login}, wantCalls: 1},
+		{name: "distinct events", deliveries: []*Event{login, other, login}, wantCalls: 2},
+		{name: "failed event is retried", deliveries: []*Event{login, login, login}, failFirst: true, wantCalls: 2},
+		{name: "events without an ID are always handled", deliveries: []*Event{noID, noID}, wantCalls: 2},
+		{name: "deduplication disabled", deliveries: []*Event{login, login}, noDedup: true, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &countingHandler{}
+			registry := newHandlerRegistry()
+			registry.set("user.login", handler)
+
+			h := &consumerGroupHandler{handlers: registry, logger: zap.NewNop()}
+			if !tt.noDedup {
+				h.dedup = newTestDedupStore(t)
+			}
+
+			for i, event := range tt.deliveries {
+				handler.mu.Lock()
+				handler.err = nil
+				if tt.failFirst && i == 0 {
+					handler.err = errors.New("downstream unavailable")
+				}
+				handler.mu.Unlock()
+
+				handled := h.processMessage(context.Background(), eventMessage(t, event))
+				if want := !(tt.failFirst && i == 0); handled != want {
+					t.Errorf("delivery %d handled = %v, want %v", i, handled, want)
+				}
+			}
+
+			if handler.calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", handler.calls, tt.wantCalls)
+			}
+		})
+	}
+}
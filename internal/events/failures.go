@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/clientinfo"
+)
+
+// Reasons reported in auth.failed events
+const (
+	ReasonBadCredential = "bad-credential"
+	ReasonMFAFailed     = "mfa-failed"
+	ReasonLocked        = "locked"
+	ReasonUnknownUser   = "unknown-user"
+)
+
+const (
+	// maxPendingFailures bounds the auth.failed events being published at
+	// once. A burst of failed logins is exactly when the broker is most
+	// likely to fall behind, so events beyond this are dropped.
+	maxPendingFailures = 256
+
+	failurePublishTimeout = 5 * time.Second
+)
+
+// AuthFailedData is the payload of an auth.failed event. It never carries
+// the submitted password or code.
+type AuthFailedData struct {
+	UserID    string    `json:"user_id,omitempty"` // Empty for unknown users
+	Reason    string    `json:"reason"`
+	Method    string    `json:"method,omitempty"` // MFA method for mfa-failed
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// FailureNotifier is notified of failed authentication and MFA attempts,
+// typically a FailurePublisher. Reasons are the Reason constants. It must not
+// block.
+type FailureNotifier interface {
+	AuthFailed(ctx context.Context, userID, reason, method string)
+}
+
+var _ FailureNotifier = (*FailurePublisher)(nil)
+
+// FailurePublisher publishes auth.failed events in the background so a
+// slow or unavailable broker never delays the failed request
+type FailurePublisher struct {
+	producer *KafkaProducer
+	topic    string
+	logger   *zap.Logger
+	pending  chan struct{}
+}
+
+// NewFailurePublisher creates an auth.failed publisher that sends to topic
+func NewFailurePublisher(producer *KafkaProducer, topic string, logger *zap.Logger) *FailurePublisher {
+	return &FailurePublisher{
+		producer: producer,
+		topic:    topic,
+		logger:   logger,
+		pending:  make(chan struct{}, maxPendingFailures),
+	}
+}
+
+// AuthFailed publishes an auth.failed event for a failed attempt by userID,
+// which is empty if the user is unknown. The client IP and user agent are
+// taken from ctx. It returns immediately; publish errors are logged.
+func (p *FailurePublisher) AuthFailed(ctx context.Context, userID, reason, method string) {
+	client, _ := clientinfo.FromContext(ctx)
+	failure := AuthFailedData{
+		UserID:    userID,
+		Reason:    reason,
+		Method:    method,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		FailedAt:  time.Now(),
+	}
+
+	select {
+	case p.pending <- struct{}{}:
+	default:
+		p.logger.Warn("Dropped auth.failed event", zap.String("reason", reason))
+		return
+	}
+
+	// The request context is cancelled once the response is sent, but its
+	// tenant and trace values still belong in the message headers
+	ctx = detach(ctx)
+	go func() {
+		defer func() { <-p.pending }()
+
+		ctx, cancel := context.WithTimeout(ctx, failurePublishTimeout)
+		defer cancel()
+
+		if err := p.publish(ctx, failure); err != nil {
+			p.logger.Error("Failed to publish auth.failed event",
+				zap.Error(err),
+				zap.String("reason", reason))
+		}
+	}()
+}
+
+func (p *FailurePublisher) publish(ctx context.Context, failure AuthFailedData) error {
+	data, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+
+	// Unknown users are keyed by IP so one client's attempts stay ordered
+	key := failure.UserID
+	if key == "" {
+		key = failure.IP
+	}
+
+	return p.producer.PublishEvent(ctx, p.topic, &Event{
+		Key:       key,
+		Type:      EventAuthFailed,
+		Timestamp: failure.FailedAt,
+		Data:      data,
+	})
+}
+
+// detachedContext keeps its parent's values but not its deadline or
+// cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
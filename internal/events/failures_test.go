@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/clientinfo"
+	"github.com/polyid/auth/internal/idgen"
+)
+
+// sentProducer hands each message sent to it to sent. Other SyncProducer
+// methods are unimplemented.
+type sentProducer struct {
+	sarama.SyncProducer
+	sent chan *sarama.ProducerMessage
+}
+
+func (p *sentProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.sent <- msg
+	return 0, 0, nil
+}
+
+func TestFailurePublisher(t *testing.T) {
+	client := clientinfo.Info{IP: "203.0.113.7", UserAgent: "test-agent"}
+
+	tests := []struct {
+		name    string
+		userID  string
+		reason  string
+		method  string
+		wantKey string
+	}{
+		{name: "unknown user", reason: ReasonUnknownUser, wantKey: client.IP},
+		{name: "bad credential", userID: "user-1", reason: ReasonBadCredential, wantKey: "user-1"},
+		{name: "locked", userID: "user-1", reason: ReasonLocked, wantKey: "user-1"},
+		{name: "MFA failed", userID: "user-1", reason: ReasonMFAFailed, method: "totp", wantKey: "user-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &sentProducer{sent: make(chan *sarama.ProducerMessage, 1)}
+			p := NewFailurePublisher(&KafkaProducer{
+				producer: producer,
+				logger:   zap.NewNop(),
+				ids:      idgen.NewUUIDv7(),
+				topics:   StaticTopicResolver{},
+			}, "auth.failed", zap.NewNop())
+
+			// The request context may be cancelled before the event is sent
+			ctx, cancel := context.WithCancel(clientinfo.NewContext(context.Background(), client))
+			p.AuthFailed(ctx, tt.userID, tt.reason, tt.method)
+			cancel()
+
+			var msg *sarama.ProducerMessage
+			select {
+			case msg = <-producer.sent:
+			case <-time.After(time.Second):
+				t.Fatal("no auth.failed event published")
+			}
+
+			if key, _ := msg.Key.Encode(); string(key) != tt.wantKey {
+				t.Errorf("key = %q, want %q", key, tt.wantKey)
+			}
+			value, _ := msg.Value.Encode()
+			var event Event
+			if err := json.Unmarshal(value, &event); err != nil {
+				t.Fatalf("decode event: %v", err)
+			}
+			if event.Type != EventAuthFailed {
+				t.Errorf("type = %q, want %q", event.Type, EventAuthFailed)
+			}
+			var data AuthFailedData
+			if err := json.Unmarshal(event.Data, &data); err != nil {
+				t.Fatalf("decode data: %v", err)
+			}
+			if data.UserID != tt.userID || data.Reason != tt.reason || data.Method != tt.method {
+				t.Errorf("data = %+v, want user %q reason %q method %q", data, tt.userID, tt.reason, tt.method)
+			}
+			if data.IP != client.IP || data.UserAgent != client.UserAgent {
+				t.Errorf("data client = %q %q, want %q %q", data.IP, data.UserAgent, client.IP, client.UserAgent)
+			}
+			if strings.Contains(string(event.Data), "password") {
+				t.Errorf("data %s carries a password", event.Data)
+			}
+		})
+	}
+}
+
+func TestFailurePublisherDropsWhenFull(t *testing.T) {
+	// Nothing drains the producer, so every publish stays pending
+	producer := &sentProducer{sent: make(chan *sarama.ProducerMessage)}
+	p := NewFailurePublisher(&KafkaProducer{
+		producer: producer,
+		logger:   zap.NewNop(),
+		ids:      idgen.NewUUIDv7(),
+		topics:   StaticTopicResolver{},
+	}, "auth.failed", zap.NewNop())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < maxPendingFailures+10; i++ {
+			p.AuthFailed(context.Background(), "user-1", ReasonBadCredential, "")
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("AuthFailed blocked with the pending limit reached")
+	}
+	if got := len(p.pending); got != maxPendingFailures {
+		t.Errorf("pending = %d, want %d", got, maxPendingFailures)
+	}
+
+	// Release the blocked sends
+	go func() {
+		for range producer.sent {
+		}
+	}()
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/polyid/auth/internal/sanitize"
+)
+
+// Kafka headers carrying request context alongside events. Trace context
+// uses the W3C "traceparent" and "tracestate" headers.
+const (
+	HeaderTenantID      = "tenant-id"
+	HeaderCorrelationID = "correlation-id"
+)
+
+// traceContext propagates W3C trace context regardless of the globally
+// configured propagator
+var traceContext = propagation.TraceContext{}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant ID
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the context's tenant ID, or "" if it has none
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey{}).(string)
+	return tenantID
+}
+
+// messageHeaders builds the headers for an event published from ctx. The
+// event's own tenant takes precedence over the context's.
+func messageHeaders(ctx context.Context, event *Event) []sarama.RecordHeader {
+	carrier := &headerCarrier{}
+
+	tenantID := event.TenantID
+	if tenantID == "" {
+		tenantID = TenantFromContext(ctx)
+	}
+	if tenantID != "" {
+		carrier.Set(HeaderTenantID, tenantID)
+	}
+	if id := sanitize.CorrelationID(ctx); id != "" {
+		carrier.Set(HeaderCorrelationID, id)
+	}
+	traceContext.Inject(ctx, carrier)
+
+	return carrier.headers
+}
+
+// contextFromHeaders returns a copy of ctx carrying the tenant, correlation
+// ID, and trace context found in a consumed message's headers
+func contextFromHeaders(ctx context.Context, headers []*sarama.RecordHeader) context.Context {
+	carrier := &headerCarrier{}
+	for _, h := range headers {
+		if h != nil {
+			carrier.headers = append(carrier.headers, *h)
+		}
+	}
+
+	if tenantID := carrier.Get(HeaderTenantID); tenantID != "" {
+		ctx = WithTenant(ctx, tenantID)
+	}
+	if id := carrier.Get(HeaderCorrelationID); id != "" {
+		ctx = sanitize.NewContext(ctx, id, sanitize.ModeSanitized)
+	}
+	return traceContext.Extract(ctx, carrier)
+}
+
+// headerCarrier adapts Kafka record headers to propagation.TextMapCarrier
+type headerCarrier struct {
+	headers []sarama.RecordHeader
+}
+
+// Get implements propagation.TextMapCarrier
+func (c *headerCarrier) Get(key string) string {
+	for _, h := range c.headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set implements propagation.TextMapCarrier, replacing any existing value
+func (c *headerCarrier) Set(key string, value string) {
+	for i, h := range c.headers {
+		if string(h.Key) == key {
+			c.headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.headers = append(c.headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Keys implements propagation.TextMapCarrier
+func (c *headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.headers))
+	for _, h := range c.headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/sanitize"
+)
+
+// contextRecordingHandler records the request context each event arrives with
+type contextRecordingHandler struct {
+	mu            sync.Mutex
+	tenantID      string
+	correlationID string
+	spanContext   trace.SpanContext
+}
+
+func (h *contextRecordingHandler) HandleEvent(ctx context.Context, event *Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tenantID = TenantFromContext(ctx)
+	h.correlationID = sanitize.CorrelationID(ctx)
+	h.spanContext = trace.SpanContextFromContext(ctx)
+	return nil
+}
+
+// consumed converts a produced message into the message a consumer receives
+func consumed(t *testing.T, msg *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	t.Helper()
+	value, err := msg.Value.Encode()
+	if err != nil {
+		t.Fatalf("encode value: %v", err)
+	}
+	headers := make([]*sarama.RecordHeader, len(msg.Headers))
+	for i := range msg.Headers {
+		headers[i] = &msg.Headers[i]
+	}
+	return &sarama.ConsumerMessage{Topic: msg.Topic, Value: value, Headers: headers}
+}
+
+func TestHeaderContextRoundTrip(t *testing.T) {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	tests := []struct {
+		name          string
+		ctxTenant     string
+		eventTenant   string
+		correlationID string
+		traced        bool
+		wantTenant    string
+		wantHeaders   int
+	}{
+		{name: "full context", ctxTenant: "acme", correlationID: "corr-1", traced: true, wantTenant: "acme", wantHeaders: 3},
+		{name: "event tenant wins", ctxTenant: "acme", eventTenant: "globex", wantTenant: "globex", wantHeaders: 1},
+		{name: "no context"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.ctxTenant != "" {
+				ctx = WithTenant(ctx, tt.ctxTenant)
+			}
+			if tt.correlationID != "" {
+				ctx = sanitize.NewContext(ctx, tt.correlationID, sanitize.ModeSanitized)
+			}
+			if tt.traced {
+				ctx = trace.ContextWithSpanContext(ctx, spanContext)
+			}
+
+			recorder := &recordingProducer{}
+			p := newBufferedProducer(recorder, 1, time.Hour)
+			event := &Event{Type: "user.login", TenantID: tt.eventTenant}
+			if err := p.PublishEvent(ctx, "auth-events", event); err != nil {
+				t.Fatalf("PublishEvent: %v", err)
+			}
+			if err := p.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if sizes := recorder.sizes(); len(sizes) != 1 || sizes[0] != 1 {
+				t.Fatalf("batches = %v, want one message", sizes)
+			}
+			msg := recorder.batches[0][0]
+			if len(msg.Headers) != tt.wantHeaders {
+				t.Errorf("headers = %d, want %d", len(msg.Headers), tt.wantHeaders)
+			}
+
+			handler := &contextRecordingHandler{}
+			registry := newHandlerRegistry()
+			registry.set("user.login", handler)
+			h := &consumerGroupHandler{handlers: registry, logger: zap.NewNop()}
+			if !h.processMessage(context.Background(), consumed(t, msg)) {
+				t.Fatal("processMessage() did not handle the message")
+			}
+
+			if handler.tenantID != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", handler.tenantID, tt.wantTenant)
+			}
+			if handler.correlationID != tt.correlationID {
+				t.Errorf("correlation ID = %q, want %q", handler.correlationID, tt.correlationID)
+			}
+			if tt.traced {
+				if handler.spanContext.TraceID() != spanContext.TraceID() || handler.spanContext.SpanID() != spanContext.SpanID() || !handler.spanContext.IsRemote() {
+					t.Errorf("span context = %+v, want remote %+v", handler.spanContext, spanContext)
+				}
+			} else if handler.spanContext.IsValid() {
+				t.Errorf("span context = %+v, want none", handler.spanContext)
+			}
+		})
+	}
+}
+
+func TestContextFromHeadersSkipsNil(t *testing.T) {
+	headers := []*sarama.RecordHeader{nil, {Key: []byte(HeaderTenantID), Value: []byte("acme")}}
+
+	ctx := contextFromHeaders(context.Background(), headers)
+	if tenantID := TenantFromContext(ctx); tenantID != "acme" {
+		t.Errorf("tenant = %q, want acme", tenantID)
+	}
+}
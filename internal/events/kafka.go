@@ -3,15 +3,22 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/idgen"
 )
 
 // Event represents a system event
 type Event struct {
+	ID        string          `json:"id"`
+	Key       string          `json:"key,omitempty"` // Partition key; events sharing a key stay ordered
+	TenantID  string          `json:"tenant_id,omitempty"`
 	Type      string          `json:"type"`
 	Timestamp time.Time       `json:"timestamp"`
 	Data      json.RawMessage `json:"data"`
@@ -22,40 +29,119 @@ type EventHandler interface {
 	HandleEvent(ctx context.Context, event *Event) error
 }
 
+// maxBufferedBatches bounds the events buffered while Kafka is unavailable,
+// in batches. Publishing fails once it is reached rather than buffer without
+// limit.
+const maxBufferedBatches = 100
+
 // KafkaProducer handles event production
 type KafkaProducer struct {
 	producer sarama.SyncProducer
 	logger   *zap.Logger
+	ids      idgen.Generator
+	topics   TopicResolver
+
+	// Buffered mode; batchSize is zero when events are sent individually.
+	// flushMu serializes flushes so batches can't overtake each other.
+	mu            sync.Mutex
+	flushMu       sync.Mutex
+	buffer        []*sarama.ProducerMessage
+	batchSize     int
+	flushInterval time.Duration
+	done          chan struct{}
+	wg            sync.WaitGroup
 }
 
 // NewKafkaProducer creates a new Kafka producer
-func NewKafkaProducer(brokers []string, logger *zap.Logger) (*KafkaProducer, error) {
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Retry.Max = 5
-	config.Producer.Return.Successes = true
+func NewKafkaProducer(cfg ProducerConfig, logger *zap.Logger) (*KafkaProducer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka producer config: %w", err)
+	}
 
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, producerSaramaConfig(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
 
-	return &KafkaProducer{
+	p := &KafkaProducer{
 		producer: producer,
 		logger:   logger,
-	}, nil
+		ids:      idgen.NewUUIDv7(),
+		topics:   StaticTopicResolver{},
+	}
+
+	if cfg.BatchSize > 0 {
+		p.batchSize = cfg.BatchSize
+		p.flushInterval = cfg.FlushInterval
+		p.done = make(chan struct{})
+
+		p.wg.Add(1)
+		go p.flushLoop()
+	}
+
+	return p, nil
 }
 
-// PublishEvent publishes an event to Kafka
+// producerSaramaConfig returns the Sarama configuration for a validated
+// ProducerConfig
+func producerSaramaConfig(cfg ProducerConfig) *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version, _ = kafkaVersion(cfg.Version) // checked by Validate
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
+	if cfg.BatchSize > 0 || cfg.Idempotent {
+		// A single in-flight request keeps retries from reordering messages
+		config.Net.MaxOpenRequests = 1
+	}
+	// Validate has checked that the version supports idempotence
+	config.Producer.Idempotent = cfg.Idempotent
+	return config
+}
+
+// SetTopicResolver overrides how event topics are chosen
+func (p *KafkaProducer) SetTopicResolver(resolver TopicResolver) {
+	p.topics = resolver
+}
+
+// PublishEvent publishes an event to Kafka. The topic is passed through the
+// producer's TopicResolver. The tenant, correlation ID, and trace context are
+// taken from ctx and sent as message headers. In buffered mode the event is
+// queued and sent on the next flush.
 func (p *KafkaProducer) PublishEvent(ctx context.Context, topic string, event *Event) error {
+	// Consumers use the ID to drop redelivered duplicates
+	if event.ID == "" {
+		event.ID = p.ids.NewID()
+	}
+
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
 	msg := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.StringEncoder(data),
+		Topic:   p.topics.Resolve(topic, event),
+		Value:   sarama.StringEncoder(data),
+		Headers: messageHeaders(ctx, event),
+	}
+	if event.Key != "" {
+		msg.Key = sarama.StringEncoder(event.Key)
+	}
+
+	if p.batchSize > 0 {
+		p.mu.Lock()
+		if len(p.buffer) >= p.batchSize*maxBufferedBatches {
+			p.mu.Unlock()
+			return fmt.Errorf("event buffer full with %d unsent events", p.batchSize*maxBufferedBatches)
+		}
+		p.buffer = append(p.buffer, msg)
+		full := len(p.buffer) >= p.batchSize
+		p.mu.Unlock()
+
+		if full {
+			return p.Flush()
+		}
+		return nil
 	}
 
 	_, _, err = p.producer.SendMessage(msg)
@@ -66,46 +152,185 @@ func (p *KafkaProducer) PublishEvent(ctx context.Context, topic string, event *E
 	return nil
 }
 
-// Close closes the Kafka producer
+// Flush sends all buffered events in the order they were published. Events
+// that fail to send, along with the batch's later events for the same key,
+// are put back at the front of the buffer, ahead of any published
+// meanwhile, so the next flush retries each key's events in order. The
+// error reports how many were put back.
+func (p *KafkaProducer) Flush() error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	msgs := p.buffer
+	p.buffer = nil
+	p.mu.Unlock()
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	err := p.producer.SendMessages(msgs)
+	if err == nil {
+		return nil
+	}
+
+	failed := msgs
+	var producerErrs sarama.ProducerErrors
+	if errors.As(err, &producerErrs) {
+		failed = failedMessages(msgs, producerErrs)
+	}
+
+	p.mu.Lock()
+	p.buffer = append(failed, p.buffer...)
+	p.mu.Unlock()
+
+	return fmt.Errorf("failed to send %d of %d messages in order: %w", len(failed), len(msgs), err)
+}
+
+// failedMessages returns the messages to retry after errs, in the order
+// they were sent: each failed message, and every later message with the
+// same key even if it was sent, so a retry can't deliver a key's events out
+// of order. Resent events keep their IDs for consumers to deduplicate.
+func failedMessages(msgs []*sarama.ProducerMessage, errs sarama.ProducerErrors) []*sarama.ProducerMessage {
+	failed := make(map[*sarama.ProducerMessage]bool, len(errs))
+	for _, err := range errs {
+		failed[err.Msg] = true
+	}
+
+	blocked := make(map[string]bool)
+	result := make([]*sarama.ProducerMessage, 0, len(errs))
+	for _, msg := range msgs {
+		key, keyed := messageKey(msg)
+		if failed[msg] || (keyed && blocked[key]) {
+			result = append(result, msg)
+			if keyed {
+				blocked[key] = true
+			}
+		}
+	}
+	return result
+}
+
+// messageKey returns a message's partition key, and false if it has none
+// or it can't be encoded
+func messageKey(msg *sarama.ProducerMessage) (string, bool) {
+	if msg.Key == nil {
+		return "", false
+	}
+	key, err := msg.Key.Encode()
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// flushLoop periodically flushes buffered events until the producer is closed
+func (p *KafkaProducer) flushLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Flush(); err != nil {
+				p.logger.Error("Failed to flush events", zap.Error(err))
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Close drains any buffered events and closes the Kafka producer. Events
+// that still fail to send are lost, and reported in the returned error.
 func (p *KafkaProducer) Close() error {
+	if p.batchSize > 0 {
+		close(p.done)
+		p.wg.Wait()
+
+		if err := p.Flush(); err != nil {
+			if closeErr := p.producer.Close(); closeErr != nil {
+				p.logger.Error("Failed to close Kafka producer", zap.Error(closeErr))
+			}
+			return fmt.Errorf("failed to drain events on close: %w", err)
+		}
+	}
+
 	return p.producer.Close()
 }
 
 // KafkaConsumer handles event consumption
 type KafkaConsumer struct {
 	consumer sarama.ConsumerGroup
-	handlers map[string]EventHandler
+	handlers *handlerRegistry
+	dedup    DedupStore
 	logger   *zap.Logger
+	cfg      ConsumerConfig
 }
 
 // NewKafkaConsumer creates a new Kafka consumer
-func NewKafkaConsumer(brokers []string, groupID string, logger *zap.Logger) (*KafkaConsumer, error) {
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+func NewKafkaConsumer(cfg ConsumerConfig, logger *zap.Logger) (*KafkaConsumer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka consumer config: %w", err)
+	}
 
-	consumer, err := sarama.NewConsumerGroup(brokers, groupID, config)
+	consumer, err := sarama.NewConsumerGroup(cfg.Brokers, cfg.GroupID, consumerSaramaConfig(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
 	}
 
 	return &KafkaConsumer{
 		consumer: consumer,
-		handlers: make(map[string]EventHandler),
+		handlers: newHandlerRegistry(),
 		logger:   logger,
+		cfg:      cfg,
 	}, nil
 }
 
-// RegisterHandler registers an event handler for a specific event type
+// consumerSaramaConfig returns the Sarama configuration for a validated
+// ConsumerConfig
+func consumerSaramaConfig(cfg ConsumerConfig) *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version, _ = kafkaVersion(cfg.Version) // checked by Validate
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	if cfg.CommitStrategy != CommitPerMessage {
+		// Offsets are committed explicitly by the commit strategy
+		config.Consumer.Offsets.AutoCommit.Enable = false
+	}
+	return config
+}
+
+// RegisterHandler registers an event handler for a specific event type,
+// replacing any existing one. It is safe to call while consuming; messages
+// already being handled finish with the previous handler.
 func (c *KafkaConsumer) RegisterHandler(eventType string, handler EventHandler) {
-	c.handlers[eventType] = handler
+	c.handlers.set(eventType, handler)
+}
+
+// DeregisterHandler removes the handler for an event type and reports
+// whether one was registered. Events of that type are then treated like any
+// other unregistered type. It is safe to call while consuming.
+func (c *KafkaConsumer) DeregisterHandler(eventType string) bool {
+	return c.handlers.remove(eventType)
+}
+
+// EnableDeduplication skips events whose IDs the store has already seen.
+// Deduplication is off unless enabled.
+func (c *KafkaConsumer) EnableDeduplication(store DedupStore) {
+	c.dedup = store
 }
 
 // Start starts consuming events
 func (c *KafkaConsumer) Start(ctx context.Context, topics []string) error {
 	consumer := &consumerGroupHandler{
 		handlers: c.handlers,
+		dedup:    c.dedup,
 		logger:   c.logger,
+		cfg:      c.cfg,
 	}
 
 	for {
@@ -127,50 +352,108 @@ func (c *KafkaConsumer) Close() error {
 
 // consumerGroupHandler implements sarama.ConsumerGroupHandler
 type consumerGroupHandler struct {
-	handlers map[string]EventHandler
+	handlers *handlerRegistry
+	dedup    DedupStore
 	logger   *zap.Logger
+	cfg      ConsumerConfig
+
+	// commits is replaced for each session in Setup
+	commits *committer
 }
 
 // Setup is called when the consumer group is set up
-func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+func (h *consumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.commits = newCommitter(session, h.cfg.CommitStrategy, h.cfg.CommitBatchSize, h.cfg.CommitInterval)
 	return nil
 }
 
 // Cleanup is called when the consumer group is torn down
 func (h *consumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	h.commits.stop()
 	return nil
 }
 
 // ConsumeClaim processes messages from a claim
 func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if h.cfg.Concurrency > 1 {
+		return h.consumeConcurrently(session, claim)
+	}
+
 	for msg := range claim.Messages() {
-		var event Event
-		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			h.logger.Error("Failed to unmarshal event",
-				zap.Error(err),
-				zap.String("topic", msg.Topic),
-				zap.Int64("offset", msg.Offset))
-			continue
+		if h.processMessage(session.Context(), msg) {
+			h.commits.mark(msg)
 		}
+	}
 
-		handler, ok := h.handlers[event.Type]
-		if !ok {
-			h.logger.Warn("No handler registered for event type",
-				zap.String("type", event.Type))
-			continue
-		}
+	return nil
+}
+
+// processMessage decodes and handles a single message, passing the handler a
+// context carrying the message's header context. It reports whether the
+// message was handled (or skipped as a duplicate) and can be marked.
+func (h *consumerGroupHandler) processMessage(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	ctx = contextFromHeaders(ctx, msg.Headers)
+
+	var event Event
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		h.logger.Error("Failed to unmarshal event",
+			zap.Error(err),
+			zap.String("topic", msg.Topic),
+			zap.Int64("offset", msg.Offset))
+		return false
+	}
+
+	handler, ok := h.handlers.snapshot()[event.Type]
+	if !ok {
+		h.logger.Warn("No handler registered for event type",
+			zap.String("type", event.Type))
+		return false
+	}
 
-		if err := handler.HandleEvent(session.Context(), &event); err != nil {
-			h.logger.Error("Failed to handle event",
+	if h.isDuplicate(ctx, &event) {
+		return true
+	}
+
+	if err := handler.HandleEvent(ctx, &event); err != nil {
+		h.logger.Error("Failed to handle event",
+			zap.Error(err),
+			zap.String("type", event.Type))
+		return false
+	}
+
+	if h.dedup != nil && event.ID != "" {
+		if err := h.dedup.MarkProcessed(ctx, event.ID); err != nil {
+			h.logger.Warn("Failed to record processed event",
 				zap.Error(err),
-				zap.String("type", event.Type))
-			continue
+				zap.String("id", event.ID))
 		}
+	}
+
+	return true
+}
 
-		session.MarkMessage(msg, "")
+// isDuplicate reports whether the event has already been processed. Dedup
+// store failures are logged and the event is processed anyway, since
+// handlers must tolerate at-least-once delivery regardless.
+func (h *consumerGroupHandler) isDuplicate(ctx context.Context, event *Event) bool {
+	if h.dedup == nil || event.ID == "" {
+		return false
 	}
 
-	return nil
+	seen, err := h.dedup.Seen(ctx, event.ID)
+	if err != nil {
+		h.logger.Warn("Failed to check event deduplication",
+			zap.Error(err),
+			zap.String("id", event.ID))
+		return false
+	}
+
+	if seen {
+		h.logger.Debug("Skipping duplicate event",
+			zap.String("id", event.ID),
+			zap.String("type", event.Type))
+	}
+	return seen
 }
 
 // Common event types
@@ -178,6 +461,10 @@ const (
 	EventUserCreated     = "user.created"
 	EventUserUpdated     = "user.updated"
 	EventUserDeleted     = "user.deleted"
+	EventUserMerged      = "user.merged"
 	EventCredentialAdded = "credential.added"
+	EventCredentialUsed  = "credential.used"
 	EventMFAMethodAdded  = "mfa.added"
+	EventAuthFailed      = "auth.failed"
+	EventBackupCodeUsed  = "backup_code.used"
 ) 
\ No newline at end of file
@@ -0,0 +1,255 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/idgen"
+)
+
+// recordingProducer records the batches sent to it. Other SyncProducer
+// methods are unimplemented.
+type recordingProducer struct {
+	sarama.SyncProducer
+	mu      sync.Mutex
+	batches [][]*sarama.ProducerMessage
+	closed  bool
+}
+
+func (p *recordingProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches = append(p.batches, msgs)
+	return nil
+}
+
+func (p *recordingProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+// sizes returns the number of messages in each batch sent so far
+func (p *recordingProducer) sizes() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sizes := make([]int, len(p.batches))
+	for i, batch := range p.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+// newBufferedProducer returns a KafkaProducer in buffered mode sending
+// through producer, as NewKafkaProducer would set it up
+func newBufferedProducer(producer sarama.SyncProducer, batchSize int, interval time.Duration) *KafkaProducer {
+	p := &KafkaProducer{
+		producer:      producer,
+		logger:        zap.NewNop(),
+		ids:           idgen.NewUUIDv7(),
+		topics:        StaticTopicResolver{},
+		batchSize:     batchSize,
+		flushInterval: interval,
+		done:          make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.flushLoop()
+	return p
+}
+
+func TestKafkaProducerBatching(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+		interval  time.Duration
+		publish   int
+		// wait is how long to wait after publishing, before closing
+		wait        time.Duration
+		wantBefore  []int
+		wantOnClose []int
+	}{
+		{name: "flushes a full batch", batchSize: 2, interval: time.Hour, publish: 4, wantBefore: []int{2, 2}, wantOnClose: []int{2, 2}},
+		{name: "holds a partial batch", batchSize: 3, interval: time.Hour, publish: 4, wantBefore: []int{3}, wantOnClose: []int{3, 1}},
+		{name: "flushes on the interval", batchSize: 10, interval: 10 * time.Millisecond, publish: 3, wait: 200 * time.Millisecond, wantBefore: []int{3}, wantOnClose: []int{3}},
+		{name: "drains on close", batchSize: 10, interval: time.Hour, publish: 3, wantBefore: []int{}, wantOnClose: []int{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingProducer{}
+			p := newBufferedProducer(recorder, tt.batchSize, tt.interval)
+
+			for i := 0; i < tt.publish; i++ {
+				if err := p.PublishEvent(context.Background(), "auth-events", &Event{Type: "user.login"}); err != nil {
+					t.Fatalf("PublishEvent: %v", err)
+				}
+			}
+			time.Sleep(tt.wait)
+
+			if got := recorder.sizes(); !reflect.DeepEqual(got, tt.wantBefore) {
+				t.Errorf("batches before close = %v, want %v", got, tt.wantBefore)
+			}
+
+			if err := p.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if got := recorder.sizes(); !reflect.DeepEqual(got, tt.wantOnClose) {
+				t.Errorf("batches after close = %v, want %v", got, tt.wantOnClose)
+			}
+			if !recorder.closed {
+				t.Error("Close() left the underlying producer open")
+			}
+		})
+	}
+}
+
+func TestFailedMessages(t *testing.T) {
+	msg := func(key string, value string) *sarama.ProducerMessage {
+		m := &sarama.ProducerMessage{Topic: "events", Value: sarama.StringEncoder(value)}
+		if key != "" {
+			m.Key = sarama.StringEncoder(key)
+		}
+		return m
+	}
+	a1, b1, a2, c1, b2, a3 := msg("a", "a1"), msg("b", "b1"), msg("a", "a2"), msg("c", "c1"), msg("b", "b2"), msg("a", "a3")
+	n1, n2 := msg("", "n1"), msg("", "n2")
+	batch := []*sarama.ProducerMessage{a1, b1, a2, n1, c1, b2, n2, a3}
+
+	tests := []struct {
+		name   string
+		failed []*sarama.ProducerMessage
+		want   []*sarama.ProducerMessage
+	}{
+		{name: "nothing failed", want: []*sarama.ProducerMessage{}},
+		{name: "last of its key", failed: []*sarama.ProducerMessage{a3}, want: []*sarama.ProducerMessage{a3}},
+		{name: "later messages of the key follow", failed: []*sarama.ProducerMessage{a2}, want: []*sarama.ProducerMessage{a2, a3}},
+		{name: "earlier messages of the key stay sent", failed: []*sarama.ProducerMessage{b2}, want: []*sarama.ProducerMessage{b2}},
+		{
+			name:   "several keys",
+			failed: []*sarama.ProducerMessage{b1, a1},
+			want:   []*sarama.ProducerMessage{a1, b1, a2, b2, a3},
+		},
+		{name: "unkeyed messages only retry themselves", failed: []*sarama.ProducerMessage{n1}, want: []*sarama.ProducerMessage{n1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs sarama.ProducerErrors
+			for _, m := range tt.failed {
+				errs = append(errs, &sarama.ProducerError{Msg: m, Err: errors.New("broker unavailable")})
+			}
+
+			got := failedMessages(batch, errs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failedMessages() = %v, want %v", values(got), values(tt.want))
+			}
+		})
+	}
+}
+
+// values lists the messages' values for failure output
+func values(msgs []*sarama.ProducerMessage) []string {
+	result := make([]string, len(msgs))
+	for i, m := range msgs {
+		result[i] = string(m.Value.(sarama.StringEncoder))
+	}
+	return result
+}
+
+func TestProducerSaramaConfig(t *testing.T) {
+	brokers := []string{"kafka-1:9092"}
+
+	tests := []struct {
+		name            string
+		cfg             ProducerConfig
+		wantVersion     sarama.KafkaVersion
+		wantIdempotent  bool
+		wantOneInFlight bool
+	}{
+		{name: "default version", cfg: ProducerConfig{Brokers: brokers}, wantVersion: sarama.NewConfig().Version},
+		{name: "configured version", cfg: ProducerConfig{Brokers: brokers, Version: "2.8.0"}, wantVersion: sarama.V2_8_0_0},
+		{name: "idempotent", cfg: ProducerConfig{Brokers: brokers, Version: "2.8.0", Idempotent: true}, wantVersion: sarama.V2_8_0_0, wantIdempotent: true, wantOneInFlight: true},
+		{name: "batched", cfg: ProducerConfig{Brokers: brokers, Version: "1.0.0", BatchSize: 10, FlushInterval: time.Second}, wantVersion: sarama.V1_0_0_0, wantOneInFlight: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			config := producerSaramaConfig(tt.cfg)
+
+			if config.Version != tt.wantVersion {
+				t.Errorf("Version = %s, want %s", config.Version, tt.wantVersion)
+			}
+			if config.Producer.Idempotent != tt.wantIdempotent {
+				t.Errorf("Idempotent = %v, want %v", config.Producer.Idempotent, tt.wantIdempotent)
+			}
+			if got := config.Net.MaxOpenRequests == 1; got != tt.wantOneInFlight {
+				t.Errorf("MaxOpenRequests = %d, want one in flight %v", config.Net.MaxOpenRequests, tt.wantOneInFlight)
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("sarama Validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestProducerIdempotenceByVersion(t *testing.T) {
+	// Idempotence passes our validation exactly when Sarama accepts it
+	for _, version := range sarama.SupportedVersions {
+		cfg := ProducerConfig{Brokers: []string{"kafka-1:9092"}, Version: version.String(), Idempotent: true}
+		err := cfg.Validate()
+		if want := version.IsAtLeast(sarama.V0_11_0_0); (err == nil) != want {
+			t.Errorf("Validate() at %s = %v, want accepted %v", version, err, want)
+			continue
+		}
+		if err == nil {
+			if err := producerSaramaConfig(cfg).Validate(); err != nil {
+				t.Errorf("sarama Validate at %s: %v", version, err)
+			}
+		}
+	}
+}
+
+func TestConsumerSaramaConfig(t *testing.T) {
+	brokers := []string{"kafka-1:9092"}
+
+	tests := []struct {
+		name           string
+		cfg            ConsumerConfig
+		wantVersion    sarama.KafkaVersion
+		wantAutoCommit bool
+	}{
+		{name: "default version", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid"}, wantVersion: sarama.NewConfig().Version, wantAutoCommit: true},
+		{name: "configured version", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", Version: "2.8.0"}, wantVersion: sarama.V2_8_0_0, wantAutoCommit: true},
+		{name: "batch commits", cfg: ConsumerConfig{Brokers: brokers, GroupID: "polyid", CommitStrategy: CommitBatch, CommitBatchSize: 50}, wantVersion: sarama.NewConfig().Version},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			config := consumerSaramaConfig(tt.cfg)
+
+			if config.Version != tt.wantVersion {
+				t.Errorf("Version = %s, want %s", config.Version, tt.wantVersion)
+			}
+			if config.Consumer.Offsets.AutoCommit.Enable != tt.wantAutoCommit {
+				t.Errorf("AutoCommit = %v, want %v", config.Consumer.Offsets.AutoCommit.Enable, tt.wantAutoCommit)
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("sarama Validate: %v", err)
+			}
+		})
+	}
+}
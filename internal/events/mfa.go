@@ -0,0 +1,10 @@
+package events
+
+import "time"
+
+// BackupCodeUsedData is the payload of a backup_code.used event
+type BackupCodeUsedData struct {
+	UserID    string    `json:"user_id"`
+	Remaining int       `json:"remaining"`
+	UsedAt    time.Time `json:"used_at"`
+}
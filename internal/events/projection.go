@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// CredentialUsedData is the payload of a credential.used event
+type CredentialUsedData struct {
+	UserID       string    `json:"user_id"`
+	CredentialID string    `json:"credential_id"`
+	UsedAt       time.Time `json:"used_at"`
+}
+
+// LastLoginProjection maintains each user's last login time and each
+// credential's last use time from credential.used events. Updates only move
+// timestamps forward, so redelivered or reordered events are harmless.
+type LastLoginProjection struct {
+	store storage.Storage
+}
+
+// NewLastLoginProjection creates a projection that writes to store
+func NewLastLoginProjection(store storage.Storage) *LastLoginProjection {
+	return &LastLoginProjection{store: store}
+}
+
+// HandleEvent implements EventHandler
+func (p *LastLoginProjection) HandleEvent(ctx context.Context, event *Event) error {
+	var data CredentialUsedData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return fmt.Errorf("failed to decode credential.used event: %w", err)
+	}
+
+	user, err := p.store.GetUser(ctx, data.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if data.UsedAt.After(user.LastLoginAt) {
+		// Patch only the timestamp so concurrent changes to the user, e.g.
+		// an email change, aren't overwritten by this stale copy
+		patch := map[string]interface{}{"last_login_at": data.UsedAt}
+		if _, err := p.store.PatchUser(ctx, data.UserID, patch); err != nil {
+			return fmt.Errorf("failed to update last login: %w", err)
+		}
+	}
+
+	credentials, err := p.store.GetCredentials(ctx, data.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get credentials: %w", err)
+	}
+	for _, credential := range credentials {
+		if credential.ID != data.CredentialID || !data.UsedAt.After(credential.LastUsedAt) {
+			continue
+		}
+		credential.LastUsedAt = data.UsedAt
+		if err := p.store.StoreCredential(ctx, credential); err != nil {
+			return fmt.Errorf("failed to update credential last use: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// projectionStore holds one user and their credentials. Other Storage
+// methods are unimplemented.
+type projectionStore struct {
+	storage.Storage
+	user        *storage.User
+	credentials []*storage.Credential
+	patches     []map[string]interface{}
+}
+
+func (s *projectionStore) GetUser(ctx context.Context, id string) (*storage.User, error) {
+	if s.user == nil || s.user.ID != id {
+		return nil, &storage.StorageError{Code: storage.ErrNotFound, Message: "User not found"}
+	}
+	user := *s.user
+	return &user, nil
+}
+
+func (s *projectionStore) PatchUser(ctx context.Context, id string, fields map[string]interface{}) (*storage.User, error) {
+	s.patches = append(s.patches, fields)
+	if at, ok := fields["last_login_at"].(time.Time); ok {
+		s.user.LastLoginAt = at
+	}
+	user := *s.user
+	return &user, nil
+}
+
+func (s *projectionStore) GetCredentials(ctx context.Context, userID string) ([]*storage.Credential, error) {
+	result := make([]*storage.Credential, 0, len(s.credentials))
+	for _, credential := range s.credentials {
+		copied := *credential
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (s *projectionStore) StoreCredential(ctx context.Context, credential *storage.Credential) error {
+	for i, stored := range s.credentials {
+		if stored.ID == credential.ID {
+			s.credentials[i] = credential
+		}
+	}
+	return nil
+}
+
+// credentialUsedEvent returns a credential.used event for user-1
+func credentialUsedEvent(t *testing.T, credentialID string, usedAt time.Time) *Event {
+	t.Helper()
+	data, err := json.Marshal(CredentialUsedData{UserID: "user-1", CredentialID: credentialID, UsedAt: usedAt})
+	if err != nil {
+		t.Fatalf("marshal event data: %v", err)
+	}
+	return &Event{Key: "user-1", Type: EventCredentialUsed, Timestamp: usedAt, Data: data}
+}
+
+func TestLastLoginProjection(t *testing.T) {
+	previous := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	earlier, later := previous.Add(-time.Hour), previous.Add(time.Hour)
+
+	tests := []struct {
+		name         string
+		credentialID string
+		usedAt       time.Time
+		wantLogin    time.Time
+		wantUsed     map[string]time.Time
+		wantPatches  int
+	}{
+		{
+			name:         "newer login",
+			credentialID: "cred-1",
+			usedAt:       later,
+			wantLogin:    later,
+			wantUsed:     map[string]time.Time{"cred-1": later, "cred-2": previous},
+			wantPatches:  1,
+		},
+		{
+			name:         "redelivered or reordered older login",
+			credentialID: "cred-1",
+			usedAt:       earlier,
+			wantLogin:    previous,
+			wantUsed:     map[string]time.Time{"cred-1": previous, "cred-2": previous},
+		},
+		{
+			name:         "unknown credential",
+			credentialID: "cred-9",
+			usedAt:       later,
+			wantLogin:    later,
+			wantUsed:     map[string]time.Time{"cred-1": previous, "cred-2": previous},
+			wantPatches:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &projectionStore{
+				user: &storage.User{ID: "user-1", Email: "a@example.com", LastLoginAt: previous},
+				credentials: []*storage.Credential{
+					{ID: "cred-1", UserID: "user-1", LastUsedAt: previous},
+					{ID: "cred-2", UserID: "user-1", LastUsedAt: previous},
+				},
+			}
+			p := NewLastLoginProjection(store)
+
+			if err := p.HandleEvent(context.Background(), credentialUsedEvent(t, tt.credentialID, tt.usedAt)); err != nil {
+				t.Fatalf("HandleEvent: %v", err)
+			}
+
+			if !store.user.LastLoginAt.Equal(tt.wantLogin) {
+				t.Errorf("last login = %v, want %v", store.user.LastLoginAt, tt.wantLogin)
+			}
+			if len(store.patches) != tt.wantPatches {
+				t.Errorf("user patched %d times, want %d", len(store.patches), tt.wantPatches)
+			}
+			for _, patch := range store.patches {
+				if len(patch) != 1 {
+					t.Errorf("patch = %v, want only last_login_at", patch)
+				}
+			}
+			for _, credential := range store.credentials {
+				if want := tt.wantUsed[credential.ID]; !credential.LastUsedAt.Equal(want) {
+					t.Errorf("%s last used = %v, want %v", credential.ID, credential.LastUsedAt, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLastLoginProjectionErrors(t *testing.T) {
+	store := &projectionStore{user: &storage.User{ID: "user-2"}}
+	p := NewLastLoginProjection(store)
+	ctx := context.Background()
+
+	if err := p.HandleEvent(ctx, &Event{Type: EventCredentialUsed, Data: json.RawMessage(`{"used_at":`)}); err == nil {
+		t.Error("HandleEvent() accepted a malformed payload")
+	}
+	if err := p.HandleEvent(ctx, credentialUsedEvent(t, "cred-1", time.Now())); err == nil {
+		t.Error("HandleEvent() succeeded for an unknown user")
+	}
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// handlerRegistry maps event types to handlers. It is copy-on-write:
+// writers replace the whole map, so consumers read a snapshot without
+// locking and handlers can be changed while consuming.
+type handlerRegistry struct {
+	mu       sync.Mutex // serializes writers
+	handlers atomic.Value
+}
+
+func newHandlerRegistry() *handlerRegistry {
+	r := &handlerRegistry{}
+	r.handlers.Store(map[string]EventHandler{})
+	return r
+}
+
+// snapshot returns the current handlers. The map must not be modified.
+func (r *handlerRegistry) snapshot() map[string]EventHandler {
+	return r.handlers.Load().(map[string]EventHandler)
+}
+
+// set registers handler for eventType, replacing any existing one
+func (r *handlerRegistry) set(eventType string, handler EventHandler) {
+	r.update(func(handlers map[string]EventHandler) {
+		handlers[eventType] = handler
+	})
+}
+
+// remove deregisters the handler for eventType and reports whether there
+// was one
+func (r *handlerRegistry) remove(eventType string) bool {
+	removed := false
+	r.update(func(handlers map[string]EventHandler) {
+		_, removed = handlers[eventType]
+		delete(handlers, eventType)
+	})
+	return removed
+}
+
+func (r *handlerRegistry) update(fn func(map[string]EventHandler)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.snapshot()
+	next := make(map[string]EventHandler, len(current)+1)
+	for eventType, handler := range current {
+		next[eventType] = handler
+	}
+	fn(next)
+	r.handlers.Store(next)
+}
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// blockingHandler signals started when it begins handling an event and
+// returns once release is closed
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) HandleEvent(ctx context.Context, event *Event) error {
+	close(h.started)
+	<-h.release
+	return nil
+}
+
+func TestHandlerRegistry(t *testing.T) {
+	first, second := &countingHandler{}, &countingHandler{}
+	r := newHandlerRegistry()
+
+	r.set("user.login", first)
+	before := r.snapshot()
+	r.set("user.login", second)
+	r.set("user.logout", first)
+
+	// Snapshots are unaffected by later changes
+	if len(before) != 1 || before["user.login"] != first {
+		t.Errorf("earlier snapshot = %v, want only user.login -> first", before)
+	}
+	if got := r.snapshot()["user.login"]; got != second {
+		t.Errorf("user.login handler = %v, want the replacement", got)
+	}
+
+	if !r.remove("user.login") {
+		t.Error("remove(user.login) = false, want true")
+	}
+	if r.remove("user.login") {
+		t.Error("second remove(user.login) = true, want false")
+	}
+	if _, ok := r.snapshot()["user.login"]; ok {
+		t.Error("user.login still registered after remove")
+	}
+	if got := r.snapshot()["user.logout"]; got != first {
+		t.Errorf("user.logout handler = %v, want first", got)
+	}
+}
+
+func TestKafkaConsumerRegisterHandler(t *testing.T) {
+	c := &KafkaConsumer{handlers: newHandlerRegistry(), logger: zap.NewNop()}
+	h := &consumerGroupHandler{handlers: c.handlers, logger: zap.NewNop()}
+	msg := eventMessage(t, &Event{Type: "user.login"})
+	handler := &countingHandler{}
+
+	if h.processMessage(context.Background(), msg) {
+		t.Error("processMessage() handled an unregistered type")
+	}
+
+	c.RegisterHandler("user.login", handler)
+	if !h.processMessage(context.Background(), msg) {
+		t.Error("processMessage() did not handle a registered type")
+	}
+
+	if !c.DeregisterHandler("user.login") {
+		t.Error("DeregisterHandler() = false, want true")
+	}
+	if h.processMessage(context.Background(), msg) {
+		t.Error("processMessage() handled a deregistered type")
+	}
+	if c.DeregisterHandler("user.login") {
+		t.Error("second DeregisterHandler() = true, want false")
+	}
+
+	if handler.calls != 1 {
+		t.Errorf("handler calls = %d, want 1", handler.calls)
+	}
+}
+
+func TestDeregisterDuringHandling(t *testing.T) {
+	c := &KafkaConsumer{handlers: newHandlerRegistry(), logger: zap.NewNop()}
+	h := &consumerGroupHandler{handlers: c.handlers, logger: zap.NewNop()}
+	msg := eventMessage(t, &Event{Type: "user.login"})
+
+	handler := &blockingHandler{started: make(chan struct{}), release: make(chan struct{})}
+	c.RegisterHandler("user.login", handler)
+
+	handled := make(chan bool)
+	go func() { handled <- h.processMessage(context.Background(), msg) }()
+	<-handler.started
+
+	// The message in flight finishes with the handler it started with
+	c.DeregisterHandler("user.login")
+	close(handler.release)
+	if !<-handled {
+		t.Error("in-flight message was not handled")
+	}
+
+	if h.processMessage(context.Background(), msg) {
+		t.Error("processMessage() handled a message after deregistration")
+	}
+}
+
+func TestHandlerRegistryConcurrentWithConsumption(t *testing.T) {
+	c := &KafkaConsumer{handlers: newHandlerRegistry(), logger: zap.NewNop()}
+	h := &consumerGroupHandler{handlers: c.handlers, logger: zap.NewNop()}
+	handler := &countingHandler{}
+	const types, rounds = 4, 200
+
+	var wg sync.WaitGroup
+	var handledMu sync.Mutex
+	handled := 0
+
+	// Consumers process every type while registrations change underneath
+	for i := 0; i < types; i++ {
+		msg := eventMessage(t, &Event{Type: fmt.Sprintf("type-%d", i)})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				if h.processMessage(context.Background(), msg) {
+					handledMu.Lock()
+					handled++
+					handledMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < types; i++ {
+		eventType := fmt.Sprintf("type-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				c.RegisterHandler(eventType, handler)
+				c.DeregisterHandler(eventType)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if handler.calls != handled {
+		t.Errorf("handler calls = %d, want %d handled messages", handler.calls, handled)
+	}
+	if n := len(c.handlers.snapshot()); n != 0 {
+		t.Errorf("%d handlers still registered, want 0", n)
+	}
+}
@@ -0,0 +1,32 @@
+package events
+
+import "fmt"
+
+// TopicResolver chooses the Kafka topic for an event. defaultTopic is the
+// topic the caller passed to PublishEvent.
+type TopicResolver interface {
+	Resolve(defaultTopic string, event *Event) string
+}
+
+// StaticTopicResolver publishes every event to the caller's topic
+type StaticTopicResolver struct{}
+
+// Resolve implements TopicResolver.Resolve
+func (StaticTopicResolver) Resolve(defaultTopic string, event *Event) string {
+	return defaultTopic
+}
+
+// TenantTopicResolver routes tenant events to per-tenant topics of the form
+// "<prefix>tenant.<tenant>.<type>" so tenants can be isolated or consumed
+// separately. Events without a tenant go to the caller's topic.
+type TenantTopicResolver struct {
+	Prefix string
+}
+
+// Resolve implements TopicResolver.Resolve
+func (r TenantTopicResolver) Resolve(defaultTopic string, event *Event) string {
+	if event.TenantID == "" {
+		return defaultTopic
+	}
+	return fmt.Sprintf("%stenant.%s.%s", r.Prefix, event.TenantID, event.Type)
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTopicResolvers(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver TopicResolver
+		event    *Event
+		want     string
+	}{
+		{name: "static", resolver: StaticTopicResolver{}, event: &Event{TenantID: "acme", Type: EventUserCreated}, want: "auth-events"},
+		{name: "tenant event", resolver: TenantTopicResolver{}, event: &Event{TenantID: "acme", Type: EventUserCreated}, want: "tenant.acme.user.created"},
+		{name: "another tenant", resolver: TenantTopicResolver{}, event: &Event{TenantID: "globex", Type: EventUserCreated}, want: "tenant.globex.user.created"},
+		{name: "another type", resolver: TenantTopicResolver{}, event: &Event{TenantID: "acme", Type: EventMFAMethodAdded}, want: "tenant.acme.mfa.added"},
+		{name: "prefixed", resolver: TenantTopicResolver{Prefix: "prod."}, event: &Event{TenantID: "acme", Type: EventAuthFailed}, want: "prod.tenant.acme.auth.failed"},
+		{name: "no tenant", resolver: TenantTopicResolver{Prefix: "prod."}, event: &Event{Type: EventUserCreated}, want: "auth-events"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.resolver.Resolve("auth-events", tt.event); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishEventResolvesTopic(t *testing.T) {
+	recorder := &recordingProducer{}
+	p := newBufferedProducer(recorder, 1, time.Hour)
+	p.SetTopicResolver(TenantTopicResolver{})
+
+	for _, event := range []*Event{
+		{TenantID: "acme", Type: EventUserCreated},
+		{Type: EventUserCreated},
+	} {
+		if err := p.PublishEvent(context.Background(), "auth-events", event); err != nil {
+			t.Fatalf("PublishEvent: %v", err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	want := []string{"tenant.acme.user.created", "auth-events"}
+	if len(recorder.batches) != len(want) {
+		t.Fatalf("sent %d batches, want %d", len(recorder.batches), len(want))
+	}
+	for i, batch := range recorder.batches {
+		if batch[0].Topic != want[i] {
+			t.Errorf("event %d topic = %q, want %q", i, batch[0].Topic, want[i])
+		}
+	}
+}
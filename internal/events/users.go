@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// UserMergedData is the payload of a user.merged event
+type UserMergedData struct {
+	PrimaryID          string   `json:"primary_id"`
+	SecondaryID        string   `json:"secondary_id"`
+	MovedCredentials   []string `json:"moved_credentials,omitempty"`
+	DroppedCredentials []string `json:"dropped_credentials,omitempty"`
+	MovedMFAMethods    []string `json:"moved_mfa_methods,omitempty"`
+	DroppedMFAMethods  []string `json:"dropped_mfa_methods,omitempty"`
+}
+
+// UserDeletedData is the payload of a user.deleted event
+type UserDeletedData struct {
+	UserID      string   `json:"user_id"`
+	Credentials []string `json:"credentials,omitempty"`
+	MFAMethods  []string `json:"mfa_methods,omitempty"`
+}
+
+// UserPublisher implements storage.MergeNotifier and storage.DeleteNotifier
+// by publishing user.merged and user.deleted events to a topic
+type UserPublisher struct {
+	producer *KafkaProducer
+	topic    string
+}
+
+// NewUserPublisher creates a user event publisher that sends to topic
+func NewUserPublisher(producer *KafkaProducer, topic string) *UserPublisher {
+	return &UserPublisher{producer: producer, topic: topic}
+}
+
+// UsersMerged implements storage.MergeNotifier
+func (p *UserPublisher) UsersMerged(ctx context.Context, result storage.MergeResult) error {
+	data, err := json.Marshal(UserMergedData{
+		PrimaryID:          result.PrimaryID,
+		SecondaryID:        result.SecondaryID,
+		MovedCredentials:   result.MovedCredentials,
+		DroppedCredentials: result.DroppedCredentials,
+		MovedMFAMethods:    result.MovedMFAMethods,
+		DroppedMFAMethods:  result.DroppedMFAMethods,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode user.merged event: %w", err)
+	}
+
+	return p.producer.PublishEvent(ctx, p.topic, &Event{
+		Key:       result.PrimaryID,
+		Type:      EventUserMerged,
+		Timestamp: result.MergedAt,
+		Data:      data,
+	})
+}
+
+// UserDeleted implements storage.DeleteNotifier
+func (p *UserPublisher) UserDeleted(ctx context.Context, result storage.DeleteResult) error {
+	data, err := json.Marshal(UserDeletedData{
+		UserID:      result.UserID,
+		Credentials: result.Credentials,
+		MFAMethods:  result.MFAMethods,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode user.deleted event: %w", err)
+	}
+
+	return p.producer.PublishEvent(ctx, p.topic, &Event{
+		Key:       result.UserID,
+		Type:      EventUserDeleted,
+		Timestamp: result.DeletedAt,
+		Data:      data,
+	})
+}
@@ -0,0 +1,75 @@
+package idgen
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+)
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUIDv7(t *testing.T) {
+	g := NewUUIDv7()
+
+	// Enough to overflow a millisecond's counter into the next
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = g.NewID()
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for i, id := range ids {
+		if !uuidV7Pattern.MatchString(id) {
+			t.Fatalf("NewID() = %q, not a UUIDv7", id)
+		}
+		if seen[id] {
+			t.Fatalf("NewID() returned %q twice", id)
+		}
+		seen[id] = true
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("NewID() = %q after %q, want increasing IDs", id, ids[i-1])
+		}
+	}
+}
+
+func TestUUIDv7Concurrent(t *testing.T) {
+	g := NewUUIDv7()
+
+	const workers, perWorker = 8, 1000
+	ids := make([][]string, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				ids[w] = append(ids[w], g.NewID())
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, workers*perWorker)
+	for _, worker := range ids {
+		if !sort.StringsAreSorted(worker) {
+			t.Error("a worker's IDs are not increasing")
+		}
+		for _, id := range worker {
+			if seen[id] {
+				t.Fatalf("NewID() returned %q twice", id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	var g Generator = NewSequence("user")
+
+	for _, want := range []string{"user-000001", "user-000002", "user-000003"} {
+		if got := g.NewID(); got != want {
+			t.Errorf("NewID() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package logging provides zap helpers shared across PolyID services
+package logging
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedactMode controls how sensitive field values are masked
+type RedactMode int
+
+const (
+	// RedactFull replaces the whole value
+	RedactFull RedactMode = iota
+	// RedactPartial keeps the last few characters, which is enough to tell
+	// values apart when debugging (e.g. the end of a phone number)
+	RedactPartial
+)
+
+// partialVisible is how many trailing characters RedactPartial keeps
+const partialVisible = 4
+
+const redacted = "[REDACTED]"
+
+// DefaultSensitiveFields are the field keys redacted when none are given
+var DefaultSensitiveFields = []string{
+	"code",
+	"phone",
+	"phone_number",
+	"token",
+	"device_token",
+	"secret",
+	"password",
+}
+
+// NewRedactingCore wraps core so that string fields whose key is in fields
+// (or DefaultSensitiveFields if empty) are masked before they are written
+func NewRedactingCore(core zapcore.Core, mode RedactMode, fields ...string) zapcore.Core {
+	if len(fields) == 0 {
+		fields = DefaultSensitiveFields
+	}
+
+	keys := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		keys[strings.ToLower(field)] = true
+	}
+
+	return &redactingCore{Core: core, mode: mode, keys: keys}
+}
+
+// Redact returns a zap option that installs a redacting core on a logger
+func Redact(mode RedactMode, fields ...string) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return NewRedactingCore(core, mode, fields...)
+	})
+}
+
+type redactingCore struct {
+	zapcore.Core
+	mode RedactMode
+	keys map[string]bool
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{
+		Core: c.Core.With(c.redact(fields)),
+		mode: c.mode,
+		keys: c.keys,
+	}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, c.redact(fields))
+}
+
+// redact returns a copy of fields with sensitive values masked
+func (c *redactingCore) redact(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		if !c.keys[strings.ToLower(field.Key)] {
+			out[i] = field
+			continue
+		}
+
+		if field.Type == zapcore.StringType {
+			out[i] = zap.String(field.Key, c.mask(field.String))
+		} else {
+			// Non-string values can't be partially masked safely
+			out[i] = zap.String(field.Key, redacted)
+		}
+	}
+	return out
+}
+
+func (c *redactingCore) mask(value string) string {
+	if c.mode != RedactPartial || len(value) <= 2*partialVisible {
+		return redacted
+	}
+	return strings.Repeat("*", len(value)-partialVisible) + value[len(value)-partialVisible:]
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newCapturedLogger returns a redacting logger writing JSON to the buffer
+func newCapturedLogger(mode RedactMode, fields ...string) (*zap.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.DebugLevel)
+	return zap.New(core, Redact(mode, fields...)), &buf
+}
+
+func TestRedactingCore(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     RedactMode
+		fields   []string // sensitive keys; empty uses the defaults
+		log      []zap.Field
+		with     []zap.Field // added with Logger.With
+		secrets  []string    // must not appear in the output
+		wantKept []string    // must appear in the output
+	}{
+		{
+			name:     "default fields",
+			log:      []zap.Field{zap.String("code", "493817"), zap.String("password", "hunter2"), zap.String("user_id", "user-1")},
+			secrets:  []string{"493817", "hunter2"},
+			wantKept: []string{"user-1", redacted},
+		},
+		{
+			name:    "fields added with With",
+			log:     []zap.Field{zap.String("event", "login")},
+			with:    []zap.Field{zap.String("token", "eyJhbGciOi.payload.signature")},
+			secrets: []string{"eyJhbGciOi", "payload.signature"},
+		},
+		{
+			name:    "keys are case-insensitive",
+			log:     []zap.Field{zap.String("Phone_Number", "+14155550100")},
+			secrets: []string{"+14155550100", "4155550100"},
+		},
+		{
+			name:    "non-string values",
+			log:     []zap.Field{zap.Int("code", 493817), zap.ByteString("secret", []byte("JBSWY3DPEHPK3PXP"))},
+			secrets: []string{"493817", "JBSWY3DPEHPK3PXP"},
+		},
+		{
+			name:     "partial keeps the last characters",
+			mode:     RedactPartial,
+			log:      []zap.Field{zap.String("phone", "+14155550100")},
+			secrets:  []string{"+14155550100", "415555"},
+			wantKept: []string{"********0100"},
+		},
+		{
+			name:    "partial hides short values entirely",
+			mode:    RedactPartial,
+			log:     []zap.Field{zap.String("code", "493817")},
+			secrets: []string{"3817"},
+		},
+		{
+			name:     "custom fields",
+			fields:   []string{"ssn"},
+			log:      []zap.Field{zap.String("ssn", "078-05-1120"), zap.String("code", "493817")},
+			secrets:  []string{"078-05-1120"},
+			wantKept: []string{"493817"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newCapturedLogger(tt.mode, tt.fields...)
+			logger.With(tt.with...).Info("event", tt.log...)
+			if err := logger.Sync(); err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+
+			out := buf.String()
+			for _, secret := range tt.secrets {
+				if strings.Contains(out, secret) {
+					t.Errorf("log output contains %q: %s", secret, out)
+				}
+			}
+			for _, kept := range tt.wantKept {
+				if !strings.Contains(out, kept) {
+					t.Errorf("log output is missing %q: %s", kept, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactingCoreLevel(t *testing.T) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel)
+	logger := zap.New(NewRedactingCore(core, RedactFull))
+
+	logger.Debug("debug", zap.String("code", "493817"))
+	if buf.Len() != 0 {
+		t.Errorf("disabled level was written: %s", buf.String())
+	}
+}
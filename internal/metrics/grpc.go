@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor records each unary call's status code and latency.
+// Install it outside the recovery interceptor so recovered panics are
+// recorded with the code they are converted to. Without one, a panicking
+// handler is recorded as Internal and the panic continues.
+func UnaryServerInterceptor(recorder Recorder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		start := time.Now()
+		defer observe(recorder, info.FullMethod, start, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor records each streaming call's status code and
+// duration, with the same panic handling as UnaryServerInterceptor
+func StreamServerInterceptor(recorder Recorder) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
+		defer observe(recorder, info.FullMethod, start, &err)
+
+		return handler(srv, ss)
+	}
+}
+
+// observe records a finished call. It must be deferred directly so it can
+// see a panic, which it records and then re-raises.
+func observe(recorder Recorder, method string, start time.Time, err *error) {
+	if r := recover(); r != nil {
+		recorder.ObserveRPC(method, codes.Internal, time.Since(start))
+		panic(r)
+	}
+
+	recorder.ObserveRPC(method, status.Code(*err), time.Since(start))
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// observation is one call recorded by recordingRecorder
+type observation struct {
+	method string
+	code   codes.Code
+}
+
+// recordingRecorder records every observed call
+type recordingRecorder struct {
+	mu           sync.Mutex
+	observations []observation
+}
+
+func (r *recordingRecorder) ObserveRPC(method string, code codes.Code, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observations = append(r.observations, observation{method: method, code: code})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		panics   bool
+		wantCode codes.Code
+	}{
+		{name: "success", wantCode: codes.OK},
+		{name: "status error", err: status.Error(codes.NotFound, "user not found"), wantCode: codes.NotFound},
+		{name: "plain error", err: errors.New("boom"), wantCode: codes.Unknown},
+		{name: "panic", panics: true, wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingRecorder{}
+			interceptor := UnaryServerInterceptor(recorder)
+			info := &grpc.UnaryServerInfo{FullMethod: "/auth.Auth/Authenticate"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				if tt.panics {
+					panic("handler bug")
+				}
+				return "resp", tt.err
+			}
+
+			func() {
+				defer func() {
+					if r := recover(); (r != nil) != tt.panics {
+						t.Errorf("recovered %v, want panic %v", r, tt.panics)
+					}
+				}()
+				_, err := interceptor(context.Background(), "req", info, handler)
+				if err != tt.err {
+					t.Errorf("interceptor() error = %v, want %v", err, tt.err)
+				}
+			}()
+
+			want := observation{method: "/auth.Auth/Authenticate", code: tt.wantCode}
+			if len(recorder.observations) != 1 || recorder.observations[0] != want {
+				t.Errorf("observations = %v, want [%v]", recorder.observations, want)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	recorder := &recordingRecorder{}
+	interceptor := StreamServerInterceptor(recorder)
+	info := &grpc.StreamServerInfo{FullMethod: "/auth.Auth/Watch"}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		return status.Error(codes.PermissionDenied, "admin only")
+	}
+
+	if err := interceptor(nil, nil, info, handler); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("interceptor() = %v, want %s", err, codes.PermissionDenied)
+	}
+
+	want := observation{method: "/auth.Auth/Watch", code: codes.PermissionDenied}
+	if len(recorder.observations) != 1 || recorder.observations[0] != want {
+		t.Errorf("observations = %v, want [%v]", recorder.observations, want)
+	}
+}
@@ -0,0 +1,15 @@
+package metrics
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Recorder records the outcome of each RPC. Implementations must be safe for
+// concurrent use.
+type Recorder interface {
+	// ObserveRPC records one completed call to method, which is the full
+	// gRPC method name such as "/auth.Auth/Authenticate"
+	ObserveRPC(method string, code codes.Code, duration time.Duration)
+}
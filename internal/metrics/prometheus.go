@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// PrometheusRecorder implements Recorder with Prometheus metrics
+type PrometheusRecorder struct {
+	handled *prometheus.CounterVec
+	latency *prometheus.HistogramVec
+	panics  *prometheus.CounterVec
+}
+
+// NewPrometheusRecorder creates a recorder and registers its metrics with reg
+func NewPrometheusRecorder(reg prometheus.Registerer) (*PrometheusRecorder, error) {
+	r := &PrometheusRecorder{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total RPCs completed on the server, by method and status code.",
+		}, []string{"grpc_method", "grpc_code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Latency of RPCs handled by the server, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_method"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "server_panics_recovered_total",
+			Help: "Total handler panics recovered, by gRPC method or HTTP route.",
+		}, []string{"route"}),
+	}
+
+	for _, c := range []prometheus.Collector{r.handled, r.latency, r.panics} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// ObserveRPC implements Recorder
+func (r *PrometheusRecorder) ObserveRPC(method string, code codes.Code, duration time.Duration) {
+	r.handled.WithLabelValues(method, code.String()).Inc()
+	r.latency.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// RecordPanic implements recovery.PanicCounter
+func (r *PrometheusRecorder) RecordPanic(route string) {
+	r.panics.WithLabelValues(route).Inc()
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+)
+
+func TestPrometheusRecorder(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r, err := NewPrometheusRecorder(reg)
+	if err != nil {
+		t.Fatalf("NewPrometheusRecorder: %v", err)
+	}
+
+	r.ObserveRPC("/auth.Auth/Authenticate", codes.OK, time.Millisecond)
+	r.ObserveRPC("/auth.Auth/Authenticate", codes.OK, time.Millisecond)
+	r.ObserveRPC("/auth.Auth/Authenticate", codes.Unauthenticated, time.Millisecond)
+
+	tests := []struct {
+		name      string
+		collector prometheus.Collector
+		want      float64
+	}{
+		{name: "OK calls", collector: r.handled.WithLabelValues("/auth.Auth/Authenticate", "OK"), want: 2},
+		{name: "unauthenticated calls", collector: r.handled.WithLabelValues("/auth.Auth/Authenticate", "Unauthenticated"), want: 1},
+		{name: "other method", collector: r.handled.WithLabelValues("/auth.Auth/ValidateToken", "OK"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testutil.ToFloat64(tt.collector); got != tt.want {
+				t.Errorf("count = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewPrometheusRecorder(reg); err == nil {
+		t.Error("NewPrometheusRecorder() registered the same metrics twice")
+	}
+}
+
+func TestPrometheusRecorderPanics(t *testing.T) {
+	r, err := NewPrometheusRecorder(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewPrometheusRecorder: %v", err)
+	}
+
+	r.RecordPanic("/auth.Auth/ValidateToken")
+	r.RecordPanic("/auth.Auth/ValidateToken")
+	r.RecordPanic("/mfa/totp/verify")
+
+	if got := testutil.ToFloat64(r.panics.WithLabelValues("/auth.Auth/ValidateToken")); got != 2 {
+		t.Errorf("gRPC panics = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(r.panics.WithLabelValues("/mfa/totp/verify")); got != 1 {
+		t.Errorf("HTTP panics = %v, want 1", got)
+	}
+}
@@ -0,0 +1,108 @@
+package mfa
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/authz"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// TempValueAdmin is the temporary value store used by AdminHandler
+type TempValueAdmin interface {
+	storage.TempValueLister
+	DeleteTemporaryValue(ctx context.Context, key string) error
+}
+
+// AdminHandler serves admin-only endpoints for inspecting and resetting a
+// user's in-progress MFA flows and provisioning methods in bulk
+type AdminHandler struct {
+	logger    *zap.Logger
+	store     TempValueAdmin
+	scopes    authz.ScopeChecker
+	provision *ProvisionConfig
+}
+
+// NewAdminHandler creates a new MFA admin handler. Callers must have a token
+// with the admin scope, as checked by scopes.
+func NewAdminHandler(logger *zap.Logger, store TempValueAdmin, scopes authz.ScopeChecker) *AdminHandler {
+	return &AdminHandler{
+		logger: logger,
+		store:  store,
+		scopes: scopes,
+	}
+}
+
+// TempValue is the admin view of a temporary value. The value itself is
+// never returned.
+type TempValue struct {
+	storage.TempValueInfo
+	Value string `json:"value"`
+}
+
+// ListTempValues lists the temporary values (TOTP setup secrets, SMS codes,
+// app-link challenges) outstanding for the user in the user_id path parameter
+func (h *AdminHandler) ListTempValues(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	userID := c.Param("user_id")
+
+	infos, err := h.store.ListTemporaryValues(c.Request.Context(), tempKeyPrefix(userID))
+	if err != nil {
+		logStorageError(h.logger, "Failed to list temporary values", err)
+		writeStorageError(c, err, "Failed to list temporary values")
+		return
+	}
+
+	values := make([]TempValue, 0, len(infos))
+	for _, info := range infos {
+		values = append(values, TempValue{TempValueInfo: info, Value: "[REDACTED]"})
+	}
+
+	c.JSON(http.StatusOK, TempValuesResponse{Values: values})
+}
+
+// PurgeTempValues deletes every temporary value for the user in the user_id
+// path parameter, forcing any in-progress enrollment to start over
+func (h *AdminHandler) PurgeTempValues(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	userID := c.Param("user_id")
+	ctx := c.Request.Context()
+
+	infos, err := h.store.ListTemporaryValues(ctx, tempKeyPrefix(userID))
+	if err != nil {
+		logStorageError(h.logger, "Failed to list temporary values", err)
+		writeStorageError(c, err, "Failed to purge temporary values")
+		return
+	}
+
+	for _, info := range infos {
+		if err := h.store.DeleteTemporaryValue(ctx, info.Key); err != nil {
+			logStorageError(h.logger, "Failed to delete temporary value", err)
+			writeStorageError(c, err, "Failed to purge temporary values")
+			return
+		}
+	}
+
+	h.logger.Info("Purged MFA temporary values",
+		zap.String("user_id", userID),
+		zap.Int("count", len(infos)))
+
+	c.JSON(http.StatusOK, PurgeResponse{Purged: len(infos)})
+}
+
+// requireAdmin writes a 403 response and returns false unless the caller has
+// the admin scope
+func (h *AdminHandler) requireAdmin(c *gin.Context) bool {
+	if h.scopes != nil && h.scopes.HasScope(c.Request, authz.ScopeAdmin) {
+		return true
+	}
+	writeError(c, CodeForbidden, "Admin access required")
+	return false
+}
@@ -0,0 +1,139 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// staticScopes grants the same answer for every scope
+type staticScopes bool
+
+func (s staticScopes) HasScope(r *http.Request, scope string) bool {
+	return bool(s)
+}
+
+// newTestAdminHandler creates an admin handler over a store seeded with
+// temporary values for two users
+func newTestAdminHandler(t *testing.T, admin bool) (*AdminHandler, *storage.MemoryStore) {
+	t.Helper()
+	store := storage.NewMemoryStore(0)
+	t.Cleanup(store.Close)
+
+	ctx := context.Background()
+	for key, value := range map[string]string{
+		totpSetupKey("user-1"):               "JBSWY3DPEHPK3PXP",
+		smsCodeKey("user-1", "+14155550100"): "493817",
+		appLinkNonceKey("user-1", "nonce-1"): "1",
+		totpSetupKey("user-10"):              "KRSXG5CTMVRXEZLU",
+		smsCodeKey("user-2", "+14155550101"): "120394",
+	} {
+		if err := store.StoreTemporaryValue(ctx, key, value, time.Minute); err != nil {
+			t.Fatalf("StoreTemporaryValue: %v", err)
+		}
+	}
+
+	return NewAdminHandler(zap.NewNop(), store, staticScopes(admin)), store
+}
+
+// callAdmin calls handler for the user in the user_id path parameter
+func callAdmin(handler gin.HandlerFunc, userID string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Params = gin.Params{{Key: "user_id", Value: userID}}
+	handler(c)
+	return w
+}
+
+func TestListTempValues(t *testing.T) {
+	h, _ := newTestAdminHandler(t, true)
+
+	w := callAdmin(h.ListTempValues, "user-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp TempValuesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+
+	want := map[string]bool{
+		totpSetupKey("user-1"):               true,
+		smsCodeKey("user-1", "+14155550100"): true,
+		appLinkNonceKey("user-1", "nonce-1"): true,
+	}
+	if len(resp.Values) != len(want) {
+		t.Fatalf("listed %d values, want %d: %+v", len(resp.Values), len(want), resp.Values)
+	}
+	for _, value := range resp.Values {
+		if !want[value.Key] {
+			t.Errorf("listed unexpected key %q", value.Key)
+		}
+		if value.Value != "[REDACTED]" {
+			t.Errorf("value for %q = %q, want it redacted", value.Key, value.Value)
+		}
+		if value.ExpiresAt.IsZero() {
+			t.Errorf("value for %q has no expiry", value.Key)
+		}
+	}
+}
+
+func TestPurgeTempValues(t *testing.T) {
+	h, store := newTestAdminHandler(t, true)
+	ctx := context.Background()
+
+	w := callAdmin(h.PurgeTempValues, "user-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp PurgeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+	if resp.Purged != 3 {
+		t.Errorf("purged %d values, want 3", resp.Purged)
+	}
+
+	if infos, err := store.ListTemporaryValues(ctx, tempKeyPrefix("user-1")); err != nil || len(infos) != 0 {
+		t.Errorf("values left for user-1 = %+v, %v", infos, err)
+	}
+	// Other users' values, including those sharing a prefix, are kept
+	for _, key := range []string{totpSetupKey("user-10"), smsCodeKey("user-2", "+14155550101")} {
+		if _, err := store.GetTemporaryValue(ctx, key); err != nil {
+			t.Errorf("GetTemporaryValue(%q): %v", key, err)
+		}
+	}
+
+	// Purging again finds nothing
+	w = callAdmin(h.PurgeTempValues, "user-1")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Purged != 0 {
+		t.Errorf("second purge = %s, want 0 purged", w.Body.String())
+	}
+}
+
+func TestTempValuesRequireAdmin(t *testing.T) {
+	h, store := newTestAdminHandler(t, false)
+
+	for name, handler := range map[string]gin.HandlerFunc{"list": h.ListTempValues, "purge": h.PurgeTempValues} {
+		t.Run(name, func(t *testing.T) {
+			w := callAdmin(handler, "user-1")
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+
+	if infos, err := store.ListTemporaryValues(context.Background(), tempKeyPrefix("user-1")); err != nil || len(infos) != 3 {
+		t.Errorf("values left for user-1 = %+v, %v, want all 3", infos, err)
+	}
+}
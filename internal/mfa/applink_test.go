@@ -0,0 +1,76 @@
+package mfa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppLinkChallenge(t *testing.T) {
+	key := bytes.Repeat([]byte{2}, minAppLinkKeyBytes)
+	now := time.Now()
+	challenge, expiresAt, err := issueAppLinkChallenge(rand.Reader, key, "user-1", "device-1", now)
+	if err != nil {
+		t.Fatalf("issueAppLinkChallenge: %v", err)
+	}
+	if want := now.Add(appLinkChallengeTTL); !expiresAt.Equal(want) {
+		t.Errorf("expires at %v, want %v", expiresAt, want)
+	}
+
+	encoded, sig, _ := strings.Cut(challenge, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"u":"user-2","n":"bm9uY2U","e":9999999999}`))
+
+	tests := []struct {
+		name      string
+		key       []byte
+		challenge string
+		userID    string
+		at        time.Time
+		wantErr   error
+	}{
+		{name: "valid", key: key, challenge: challenge, userID: "user-1", at: now},
+		{name: "tampered claims", key: key, challenge: forged + "." + sig, userID: "user-2", at: now, wantErr: errChallengeSignature},
+		{name: "tampered signature", key: key, challenge: encoded + "." + strings.Repeat("A", len(sig)), userID: "user-1", at: now, wantErr: errChallengeSignature},
+		{name: "another key", key: bytes.Repeat([]byte{3}, minAppLinkKeyBytes), challenge: challenge, userID: "user-1", at: now, wantErr: errChallengeSignature},
+		{name: "missing signature", key: key, challenge: encoded, userID: "user-1", at: now, wantErr: errChallengeMalformed},
+		{name: "expired", key: key, challenge: challenge, userID: "user-1", at: expiresAt, wantErr: errChallengeExpired},
+		{name: "another user", key: key, challenge: challenge, userID: "user-2", at: now, wantErr: errChallengeUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := parseAppLinkChallenge(tt.key, tt.challenge, tt.userID, tt.at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseAppLinkChallenge() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (claims.UserID != "user-1" || claims.DeviceID != "device-1" || claims.Nonce == "") {
+				t.Errorf("claims = %+v, want user-1 on device-1 with a nonce", claims)
+			}
+		})
+	}
+}
+
+func TestAppLinkChallengeNonces(t *testing.T) {
+	key := bytes.Repeat([]byte{2}, minAppLinkKeyBytes)
+	now := time.Now()
+
+	first, _, err := issueAppLinkChallenge(rand.Reader, key, "user-1", "device-1", now)
+	if err != nil {
+		t.Fatalf("issueAppLinkChallenge: %v", err)
+	}
+	second, _, err := issueAppLinkChallenge(rand.Reader, key, "user-1", "device-1", now)
+	if err != nil {
+		t.Fatalf("issueAppLinkChallenge: %v", err)
+	}
+	if first == second {
+		t.Error("two challenges for the same device are identical")
+	}
+
+	if _, _, err := issueAppLinkChallenge(bytes.NewReader(nil), key, "user-1", "device-1", now); err == nil {
+		t.Error("issueAppLinkChallenge() succeeded without randomness")
+	}
+}
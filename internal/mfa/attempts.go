@@ -0,0 +1,47 @@
+package mfa
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Default attempt limit, used when Config.Attempts is unset
+const (
+	DefaultMaxAttempts   = 5
+	DefaultAttemptWindow = 15 * time.Minute
+)
+
+func attemptKey(userID, methodType string) string {
+	return tempKeyPrefix(userID) + "attempts:" + methodType
+}
+
+// withinAttemptLimit writes an error response and returns false if the user
+// has made too many recent attempts to verify a code for methodType. It
+// fails closed, since an unlimited verifier lets codes be guessed.
+func (h *Handler) withinAttemptLimit(c *gin.Context, userID string, methodType string) bool {
+	result, err := h.attempts.Allow(c.Request.Context(), attemptKey(userID, methodType))
+	if err != nil {
+		h.logger.Error("Failed to check attempt limit", zap.Error(err))
+		writeError(c, CodeUnavailable, "Failed to check attempt limit")
+		return false
+	}
+	if !result.Allowed {
+		c.Header("Retry-After", strconv.Itoa(int(result.Reset.Seconds())+1))
+		writeError(c, CodeTooManyAttempts, "Too many attempts; try again later")
+		return false
+	}
+	return true
+}
+
+// resetAttempts clears the user's attempts for methodType after a code is
+// accepted, so earlier typos don't count against their next verification.
+// Failures are logged; the window still expires on its own.
+func (h *Handler) resetAttempts(ctx context.Context, userID string, methodType string) {
+	if err := h.attempts.Reset(ctx, attemptKey(userID, methodType)); err != nil {
+		h.logger.Warn("Failed to reset attempt limit", zap.Error(err))
+	}
+}
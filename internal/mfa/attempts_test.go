@@ -0,0 +1,75 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polyid/auth/internal/ratelimit"
+)
+
+// failingLimiter fails every check
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("limiter unavailable")
+}
+
+func (failingLimiter) Reset(ctx context.Context, key string) error {
+	return errors.New("limiter unavailable")
+}
+
+// checkAttempt calls withinAttemptLimit for user-1 and returns the response
+func checkAttempt(h *Handler, methodType string) (bool, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	return h.withinAttemptLimit(c, "user-1", methodType), w
+}
+
+func TestAttemptLimit(t *testing.T) {
+	h, _ := newTestHandler(t, Config{Attempts: ratelimit.NewMemoryLimiter(2, time.Minute)})
+
+	for i := 0; i < 2; i++ {
+		if ok, w := checkAttempt(h, "sms"); !ok {
+			t.Fatalf("attempt %d rejected: %d %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	ok, w := checkAttempt(h, "sms")
+	if ok || w.Code != http.StatusTooManyRequests {
+		t.Fatalf("attempt over the limit = %v, status %d, want %d", ok, w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("limited response has no Retry-After header")
+	}
+
+	// Limits are per method type
+	if ok, _ := checkAttempt(h, "totp"); !ok {
+		t.Error("totp attempt rejected after sms attempts ran out")
+	}
+
+	// An accepted code resets the user's attempts
+	h.resetAttempts(context.Background(), "user-1", "sms")
+	if ok, _ := checkAttempt(h, "sms"); !ok {
+		t.Error("attempt rejected after a reset")
+	}
+}
+
+func TestAttemptLimitFailsClosed(t *testing.T) {
+	h, _ := newTestHandler(t, Config{Attempts: failingLimiter{}})
+
+	ok, w := checkAttempt(h, "sms")
+	if ok || w.Code != http.StatusServiceUnavailable {
+		t.Errorf("attempt with a failing limiter = %v, status %d, want %d", ok, w.Code, http.StatusServiceUnavailable)
+	}
+
+	// A failed reset is only logged
+	h.resetAttempts(context.Background(), "user-1", "sms")
+}
@@ -0,0 +1,75 @@
+package mfa
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LowBackupCodes is the number of remaining backup codes below which
+// VerifyBackupCode warns the user to regenerate them
+const LowBackupCodes = 3
+
+// Warnings returned in BackupCodeVerifiedResponse.Warnings
+const (
+	WarningLowBackupCodes = "low_backup_codes"
+)
+
+// VerifyBackupCode verifies and consumes one of the user's backup codes,
+// reporting how many remain
+func (h *Handler) VerifyBackupCode(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if !h.methodEnabled(c, FeatureBackupCode, userID) {
+		return
+	}
+	code := normalizeBackupCode(c.PostForm("code"))
+	if code == "" {
+		writeFieldError(c, CodeInvalidInput, "code", "Missing backup code")
+		return
+	}
+	// Backup codes are long-lived, so guessing must be limited like any code
+	if !h.withinAttemptLimit(c, userID, "backup_code") {
+		return
+	}
+
+	remaining, valid, err := consumeBackupCode(userID, code)
+	if err != nil {
+		logStorageError(h.logger, "Failed to verify backup code", err)
+		writeStorageError(c, err, "Failed to verify backup code")
+		return
+	}
+	if !valid {
+		h.rejectCode(c, userID, "backup_code", "code", "Invalid backup code")
+		return
+	}
+
+	h.resetAttempts(c.Request.Context(), userID, "backup_code")
+
+	now := time.Now()
+	h.publishBackupCodeUsed(c.Request.Context(), userID, remaining, now)
+
+	c.JSON(http.StatusOK, backupCodeVerified(remaining, now))
+}
+
+// backupCodeVerified returns the response for a backup code accepted at now
+// with remaining codes left, warning if they are running low
+func backupCodeVerified(remaining int, now time.Time) BackupCodeVerifiedResponse {
+	resp := BackupCodeVerifiedResponse{
+		Message:    "Backup code verified",
+		VerifiedAt: now,
+		Remaining:  remaining,
+	}
+	if remaining < LowBackupCodes {
+		resp.Warnings = append(resp.Warnings, WarningLowBackupCodes)
+	}
+	return resp
+}
+
+// normalizeBackupCode strips the separators and case that users commonly
+// vary when typing a code
+func normalizeBackupCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,128 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/events"
+)
+
+// recordingPublisher records published events, failing with err if set
+type recordingPublisher struct {
+	topics []string
+	events []*events.Event
+	err    error
+}
+
+func (p *recordingPublisher) PublishEvent(ctx context.Context, topic string, event *events.Event) error {
+	p.topics = append(p.topics, topic)
+	p.events = append(p.events, event)
+	return p.err
+}
+
+func TestBackupCodeVerified(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		remaining    int
+		wantWarnings []string
+	}{
+		{name: "plenty left", remaining: 8},
+		{name: "at the threshold", remaining: LowBackupCodes},
+		{name: "below the threshold", remaining: LowBackupCodes - 1, wantWarnings: []string{WarningLowBackupCodes}},
+		{name: "last code used", remaining: 0, wantWarnings: []string{WarningLowBackupCodes}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := backupCodeVerified(tt.remaining, now)
+			if resp.Remaining != tt.remaining {
+				t.Errorf("Remaining = %d, want %d", resp.Remaining, tt.remaining)
+			}
+			if !resp.VerifiedAt.Equal(now) {
+				t.Errorf("VerifiedAt = %v, want %v", resp.VerifiedAt, now)
+			}
+			if !reflect.DeepEqual(resp.Warnings, tt.wantWarnings) {
+				t.Errorf("Warnings = %v, want %v", resp.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestPublishBackupCodeUsed(t *testing.T) {
+	usedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	publisher := &recordingPublisher{}
+	h := &Handler{logger: zap.NewNop(), publisher: publisher, eventTopic: "mfa-events"}
+
+	h.publishBackupCodeUsed(context.Background(), "user-1", 2, usedAt)
+
+	if len(publisher.events) != 1 {
+		t.Fatalf("published %d events, want 1", len(publisher.events))
+	}
+	event := publisher.events[0]
+	if publisher.topics[0] != "mfa-events" || event.Type != events.EventBackupCodeUsed || event.Key != "user-1" {
+		t.Errorf("event = %s %s key %q, want mfa-events %s key user-1", publisher.topics[0], event.Type, event.Key, events.EventBackupCodeUsed)
+	}
+	var data events.BackupCodeUsedData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+	want := events.BackupCodeUsedData{UserID: "user-1", Remaining: 2, UsedAt: usedAt}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("data = %+v, want %+v", data, want)
+	}
+
+	// Publishing is best-effort
+	publisher.err = errors.New("broker down")
+	h.publishBackupCodeUsed(context.Background(), "user-1", 1, usedAt)
+
+	h.publisher = nil
+	h.publishBackupCodeUsed(context.Background(), "user-1", 0, usedAt)
+	if len(publisher.events) != 2 {
+		t.Errorf("published %d events, want 2", len(publisher.events))
+	}
+}
+
+func TestVerifyBackupCodeRejected(t *testing.T) {
+	publisher := &recordingPublisher{}
+	h, _ := newTestHandler(t, Config{Events: publisher, EventTopic: "mfa-events"})
+
+	w := postForm(h.VerifyBackupCode, url.Values{"code": {"abcd-efgh"}})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("published %d events for a rejected code, want 0", len(publisher.events))
+	}
+
+	w = postForm(h.VerifyBackupCode, url.Values{"code": {" - "}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("blank code status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestNormalizeBackupCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "abcd-efgh", want: "abcdefgh"},
+		{code: " ABCD EFGH ", want: "abcdefgh"},
+		{code: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeBackupCode(tt.code); got != tt.want {
+			t.Errorf("normalizeBackupCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package mfa
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+// secureCompare reports whether a and b are equal in time that depends on
+// neither their contents nor their lengths. Both inputs are hashed first so
+// the constant-time comparison always sees equal-length values. Every code,
+// challenge, and signature comparison must go through this function.
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
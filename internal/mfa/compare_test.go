@@ -0,0 +1,32 @@
+package mfa
+
+import "testing"
+
+func TestSecureCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{name: "equal", a: "493817", b: "493817", want: true},
+		{name: "both empty", a: "", b: "", want: true},
+		{name: "differ in the last digit", a: "493817", b: "493818"},
+		{name: "differ in the first digit", a: "493817", b: "593817"},
+		{name: "prefix", a: "4938", b: "493817"},
+		{name: "longer", a: "4938170", b: "493817"},
+		{name: "empty against a code", a: "", b: "493817"},
+		{name: "case differs", a: "abcdef", b: "ABCDEF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Equal and unequal inputs of any length take the same hashed path
+			if got := secureCompare(tt.a, tt.b); got != tt.want {
+				t.Errorf("secureCompare(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := secureCompare(tt.b, tt.a); got != tt.want {
+				t.Errorf("secureCompare(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
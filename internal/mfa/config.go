@@ -0,0 +1,105 @@
+package mfa
+
+import (
+	"errors"
+	"io"
+
+	"github.com/pquerna/otp"
+
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/ratelimit"
+)
+
+// Config configures an MFA Handler
+type Config struct {
+	// TempStore holds pending TOTP secrets, SMS codes, and used app-link
+	// nonces
+	TempStore TempStore
+
+	// Methods holds users' enrolled MFA methods
+	Methods MethodStore
+
+	// Secrets encrypts verified TOTP secrets before they are persisted
+	Secrets *SecretCipher
+
+	// TOTPAlgorithm is the HMAC algorithm for new TOTP enrollments. The zero
+	// value is SHA1, which every authenticator app supports; SHA256 and
+	// SHA512 are only honoured by some apps, and others silently fall back
+	// to SHA1 and generate codes that never validate. Existing enrollments
+	// keep the algorithm they were created with.
+	TOTPAlgorithm otp.Algorithm
+
+	// PhoneRegions restricts which countries' numbers SMS verification
+	// accepts, to limit SMS pumping fraud. The zero value accepts all.
+	PhoneRegions PhoneRegions
+
+	// Limits caps active methods per type, checked when enrollment starts
+	// and again before the method is stored
+	Limits MethodLimits
+
+	// Locker serializes per-user enrollment mutations. Without a locker,
+	// enrollment is only safe on a single instance.
+	Locker Locker
+
+	// Features is consulted before each MFA method is used. Nil enables
+	// every method.
+	Features FeatureGate
+
+	// Factors bars weak methods, such as SMS, for users with a passkey when
+	// their tenant's policy is strict. Use the guard given to
+	// auth.AuthService.SetFactorPolicy. Nil bars nothing.
+	Factors *DowngradeGuard
+
+	// Attempts limits code verifications per user and method type, so codes
+	// can't be guessed. A user's attempts are reset once a code is accepted.
+	// If unset an in-memory limiter allowing
+	// DefaultMaxAttempts per DefaultAttemptWindow is used, which only holds
+	// on a single instance.
+	Attempts ratelimit.Limiter
+
+	// AppLinkKey signs app-link challenges so they can be verified without
+	// storing them. Every instance must share it; if unset a random key is
+	// generated and challenges only verify on the instance that issued them.
+	AppLinkKey []byte
+
+	// Failures is notified of each rejected MFA code or app-link response
+	Failures events.FailureNotifier
+
+	// Events publishes backup_code.used events to EventTopic, which is
+	// required with it. Nil publishes nothing.
+	Events     EventPublisher
+	EventTopic string
+
+	// Random is the source for secrets, codes, and challenges. Nil uses
+	// crypto/rand; anything else must be cryptographically secure, e.g.
+	// HSM-backed, outside of tests.
+	Random io.Reader
+}
+
+// Validate reports the first problem with the configuration
+func (c Config) Validate() error {
+	if c.TempStore == nil {
+		return errors.New("temporary value store is required")
+	}
+	if c.Methods == nil {
+		return errors.New("method store is required")
+	}
+	if c.Secrets == nil {
+		return errors.New("secret cipher is required")
+	}
+	switch c.TOTPAlgorithm {
+	case otp.AlgorithmSHA1, otp.AlgorithmSHA256, otp.AlgorithmSHA512:
+	default:
+		return errors.New("TOTP algorithm must be SHA1, SHA256, or SHA512")
+	}
+	if err := c.PhoneRegions.Validate(); err != nil {
+		return err
+	}
+	if c.Events != nil && c.EventTopic == "" {
+		return errors.New("event topic is required with an event publisher")
+	}
+	if c.AppLinkKey != nil && len(c.AppLinkKey) < minAppLinkKeyBytes {
+		return errors.New("app-link key must be at least 32 bytes")
+	}
+	return c.Limits.Validate()
+}
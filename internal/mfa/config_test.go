@@ -0,0 +1,68 @@
+package mfa
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pquerna/otp"
+
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// nopPublisher discards published events
+type nopPublisher struct{}
+
+func (nopPublisher) PublishEvent(ctx context.Context, topic string, event *events.Event) error {
+	return nil
+}
+
+func TestConfigValidate(t *testing.T) {
+	store := storage.NewMemoryStore(0)
+	t.Cleanup(store.Close)
+	secrets, err := NewSecretCipher("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatalf("NewSecretCipher: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "minimal", cfg: Config{TempStore: store, Methods: store, Secrets: secrets}},
+		{
+			name: "fully configured",
+			cfg: Config{
+				TempStore:     store,
+				Methods:       store,
+				Secrets:       secrets,
+				TOTPAlgorithm: otp.AlgorithmSHA256,
+				PhoneRegions:  PhoneRegions{Allow: []string{"US", "CA"}, Deny: []string{"CA"}},
+				Limits:        MethodLimits{"totp": 2, "sms": 1},
+				AppLinkKey:    bytes.Repeat([]byte{2}, minAppLinkKeyBytes),
+				Events:        nopPublisher{},
+				EventTopic:    "mfa-events",
+			},
+		},
+		{name: "no temporary value store", cfg: Config{Methods: store, Secrets: secrets}, wantErr: true},
+		{name: "no method store", cfg: Config{TempStore: store, Secrets: secrets}, wantErr: true},
+		{name: "no secret cipher", cfg: Config{TempStore: store, Methods: store}, wantErr: true},
+		{name: "unknown TOTP algorithm", cfg: Config{TempStore: store, Methods: store, Secrets: secrets, TOTPAlgorithm: otp.AlgorithmMD5}, wantErr: true},
+		{name: "lowercase phone region", cfg: Config{TempStore: store, Methods: store, Secrets: secrets, PhoneRegions: PhoneRegions{Allow: []string{"us"}}}, wantErr: true},
+		{name: "invalid denied phone region", cfg: Config{TempStore: store, Methods: store, Secrets: secrets, PhoneRegions: PhoneRegions{Deny: []string{"USA"}}}, wantErr: true},
+		{name: "publisher without a topic", cfg: Config{TempStore: store, Methods: store, Secrets: secrets, Events: nopPublisher{}}, wantErr: true},
+		{name: "short app-link key", cfg: Config{TempStore: store, Methods: store, Secrets: secrets, AppLinkKey: []byte("short")}, wantErr: true},
+		{name: "limit on an unsupported method", cfg: Config{TempStore: store, Methods: store, Secrets: secrets, Limits: MethodLimits{"email": 1}}, wantErr: true},
+		{name: "non-positive limit", cfg: Config{TempStore: store, Methods: store, Secrets: secrets, Limits: MethodLimits{"totp": 0}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package mfa
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// weakMethods are the method types a strict FactorPolicy bars for users
+// with a passkey. SMS codes can be phished, intercepted, or SIM-swapped.
+var weakMethods = map[string]bool{
+	"sms": true,
+}
+
+// IsWeakMethod reports whether a strict FactorPolicy bars methodType for
+// users with a passkey
+func IsWeakMethod(methodType string) bool {
+	return weakMethods[methodType]
+}
+
+// FactorPolicy decides whether a tenant's users who have a phishing-resistant
+// factor (a passkey) may still satisfy MFA with a weaker one
+type FactorPolicy interface {
+	// Strict reports whether weaker factors are barred for the tenant. The
+	// tenant is "" for requests without one.
+	Strict(ctx context.Context, tenantID string) bool
+}
+
+// StaticFactorPolicy is a config-backed FactorPolicy
+type StaticFactorPolicy struct {
+	// Default is whether the policy is strict for tenants without an
+	// override
+	Default bool
+	// Tenants overrides Default per tenant
+	Tenants map[string]bool
+}
+
+// Strict implements FactorPolicy
+func (p StaticFactorPolicy) Strict(ctx context.Context, tenantID string) bool {
+	if strict, ok := p.Tenants[tenantID]; ok {
+		return strict
+	}
+	return p.Default
+}
+
+// CredentialLister looks up a user's passkeys, typically a storage.Storage
+type CredentialLister interface {
+	GetCredentials(ctx context.Context, userID string) ([]*storage.Credential, error)
+}
+
+// DowngradeGuard applies a FactorPolicy to a user. Share one between the
+// MFA Handler and auth.AuthService so a weak factor barred at sign-in can't
+// be used or enrolled over HTTP either.
+type DowngradeGuard struct {
+	policy      FactorPolicy
+	credentials CredentialLister
+}
+
+// NewDowngradeGuard creates a guard applying policy, looking up passkeys in
+// credentials
+func NewDowngradeGuard(policy FactorPolicy, credentials CredentialLister) *DowngradeGuard {
+	return &DowngradeGuard{policy: policy, credentials: credentials}
+}
+
+// Strict reports whether weak methods are barred for the user: the tenant's
+// policy is strict and the user has a passkey. A nil guard bars nothing.
+func (g *DowngradeGuard) Strict(ctx context.Context, userID string) (bool, error) {
+	if g == nil || !g.policy.Strict(ctx, events.TenantFromContext(ctx)) {
+		return false, nil
+	}
+
+	credentials, err := g.credentials.GetCredentials(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
+
+// factorAllowed writes an error response and returns false if the downgrade
+// policy bars methodType for the user
+func (h *Handler) factorAllowed(c *gin.Context, userID string, methodType string) bool {
+	if !IsWeakMethod(methodType) {
+		return true
+	}
+
+	strict, err := h.factors.Strict(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to check factor policy", err)
+		writeStorageError(c, err, "Failed to check factor policy")
+		return false
+	}
+	if strict {
+		writeError(c, CodeForbidden, "Use a passkey instead of this method")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// credentialList is a CredentialLister returning the same passkeys, or err,
+// for every user
+type credentialList struct {
+	credentials []*storage.Credential
+	err         error
+}
+
+func (l credentialList) GetCredentials(ctx context.Context, userID string) ([]*storage.Credential, error) {
+	return l.credentials, l.err
+}
+
+var withPasskey = credentialList{credentials: []*storage.Credential{{ID: "cred-1"}}}
+
+func TestDowngradeGuardStrict(t *testing.T) {
+	tests := []struct {
+		name       string
+		guard      *DowngradeGuard
+		tenant     string
+		wantStrict bool
+		wantErr    bool
+	}{
+		{name: "no guard"},
+		{name: "strict with a passkey", guard: NewDowngradeGuard(StaticFactorPolicy{Default: true}, withPasskey), wantStrict: true},
+		{name: "strict without a passkey", guard: NewDowngradeGuard(StaticFactorPolicy{Default: true}, credentialList{})},
+		{name: "lenient with a passkey", guard: NewDowngradeGuard(StaticFactorPolicy{}, withPasskey)},
+		{name: "strict tenant", guard: NewDowngradeGuard(StaticFactorPolicy{Tenants: map[string]bool{"acme": true}}, withPasskey), tenant: "acme", wantStrict: true},
+		{name: "lenient tenant", guard: NewDowngradeGuard(StaticFactorPolicy{Default: true, Tenants: map[string]bool{"acme": false}}, withPasskey), tenant: "acme"},
+		{name: "lookup failure", guard: NewDowngradeGuard(StaticFactorPolicy{Default: true}, credentialList{err: errors.New("storage down")}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := events.WithTenant(context.Background(), tt.tenant)
+			strict, err := tt.guard.Strict(ctx, "user-1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Strict() error = %v, want error %v", err, tt.wantErr)
+			}
+			if strict != tt.wantStrict {
+				t.Errorf("Strict() = %v, want %v", strict, tt.wantStrict)
+			}
+		})
+	}
+}
+
+func TestSMSDowngradeProtection(t *testing.T) {
+	strictPolicy := StaticFactorPolicy{Default: true}
+
+	tests := []struct {
+		name       string
+		guard      *DowngradeGuard
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "passkey under the strict policy", guard: NewDowngradeGuard(strictPolicy, withPasskey), wantStatus: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "no passkey under the strict policy", guard: NewDowngradeGuard(strictPolicy, credentialList{})},
+		{name: "passkey under a lenient policy", guard: NewDowngradeGuard(StaticFactorPolicy{}, withPasskey)},
+		{name: "no policy"},
+		{name: "lookup failure", guard: NewDowngradeGuard(strictPolicy, credentialList{err: &storage.StorageError{Code: storage.ErrUnavailable}}), wantStatus: http.StatusServiceUnavailable, wantCode: CodeUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{Factors: tt.guard})
+
+			for _, call := range []struct {
+				name    string
+				handler gin.HandlerFunc
+				form    url.Values
+			}{
+				{name: "SendSMS", handler: h.SendSMS, form: url.Values{"phone_number": {"+14155550100"}}},
+				{name: "VerifySMS", handler: h.VerifySMS, form: url.Values{"phone_number": {"+14155550100"}, "session_id": {"s1"}, "code": {"123456"}}},
+			} {
+				w := postForm(call.handler, call.form)
+				var resp ErrorResponse
+				_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+				if tt.wantCode == "" {
+					// Allowed through the guard; VerifySMS then fails on the code
+					if w.Code == http.StatusForbidden || resp.Code == CodeUnavailable {
+						t.Errorf("%s status = %d %s, want past the guard", call.name, w.Code, resp.Code)
+					}
+					continue
+				}
+				if w.Code != tt.wantStatus || resp.Code != tt.wantCode {
+					t.Errorf("%s = %d %s, want %d %s", call.name, w.Code, resp.Code, tt.wantStatus, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestFactorAllowedStrongMethods(t *testing.T) {
+	h, _ := newTestHandler(t, Config{Factors: NewDowngradeGuard(StaticFactorPolicy{Default: true}, withPasskey)})
+
+	for _, methodType := range []string{"totp", "app_link", "backup_code"} {
+		if IsWeakMethod(methodType) {
+			t.Errorf("IsWeakMethod(%q) = true, want false", methodType)
+		}
+		w := postForm(func(c *gin.Context) {
+			if h.factorAllowed(c, "user-1", methodType) {
+				c.Status(http.StatusNoContent)
+			}
+		}, nil)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("factorAllowed(%q) status = %d, want allowed", methodType, w.Code)
+		}
+	}
+	if !IsWeakMethod("sms") {
+		t.Error(`IsWeakMethod("sms") = false, want true`)
+	}
+}
@@ -0,0 +1,153 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/sanitize"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// Error codes returned to clients. These are part of the API and must not
+// change once released.
+const (
+	CodeInvalidInput     = "invalid_input"
+	CodeInvalidCode      = "invalid_code"
+	CodeCodeExpired      = "code_expired"
+	CodeSetupNotFound    = "setup_not_found"
+	CodeNotFound         = "not_found"
+	CodeDisabled         = "method_disabled"
+	CodeForbidden        = "forbidden"
+	CodeRegionNotAllowed = "region_not_allowed"
+	CodeLimitReached     = "method_limit_reached"
+	CodeTooManyAttempts  = "too_many_attempts"
+	CodeAlreadyExists    = "already_exists"
+	CodeConflict         = "conflict"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the body returned by MFA endpoints on failure
+type ErrorResponse struct {
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	Field         string `json:"field,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"` // set on server errors
+}
+
+// statusForCode maps an error code to its HTTP status
+func statusForCode(code string) int {
+	switch code {
+	case CodeInvalidInput, CodeCodeExpired, CodeSetupNotFound:
+		return http.StatusBadRequest
+	case CodeInvalidCode:
+		return http.StatusUnauthorized
+	case CodeDisabled, CodeForbidden, CodeRegionNotAllowed:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeLimitReached, CodeAlreadyExists, CodeConflict:
+		return http.StatusConflict
+	case CodeTooManyAttempts:
+		return http.StatusTooManyRequests
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// IsServerError reports whether code is a server fault, which clients may
+// retry and operators should be alerted to. Every other code is caused by
+// the request and will fail again unless the client changes it.
+func IsServerError(code string) bool {
+	return statusForCode(code) >= http.StatusInternalServerError
+}
+
+// writeError writes a structured error response
+func writeError(c *gin.Context, code string, message string) {
+	writeFieldError(c, code, "", message)
+}
+
+// writeFieldError writes a structured error response attributed to a
+// request field
+func writeFieldError(c *gin.Context, code string, field string, message string) {
+	status := statusForCode(code)
+
+	resp := ErrorResponse{
+		Code:    code,
+		Message: message,
+		Field:   field,
+	}
+	if IsServerError(code) {
+		resp.CorrelationID = sanitize.CorrelationID(c.Request.Context())
+	}
+
+	c.JSON(status, resp)
+}
+
+// writeStorageError writes a structured error response for a storage
+// failure, deriving the code from the storage error code. The storage error
+// itself is only shown to clients in detailed mode; it is always attached to
+// the request for server-side logging.
+func writeStorageError(c *gin.Context, err error, message string) {
+	c.Error(err)
+	writeError(c, storageErrorCode(err), sanitize.Message(c.Request.Context(), message, err))
+}
+
+// storageErrorCode maps a storage error to the error code reported for it.
+// This is the one place storage failures are classified, so client-caused
+// failures aren't reported as server faults.
+func storageErrorCode(err error) string {
+	var storageErr *storage.StorageError
+	if errors.As(err, &storageErr) {
+		switch storageErr.Code {
+		case storage.ErrNotFound:
+			return CodeNotFound
+		case storage.ErrInvalidInput:
+			return CodeInvalidInput
+		case storage.ErrAlreadyExists:
+			return CodeAlreadyExists
+		case storage.ErrConflict:
+			return CodeConflict
+		case storage.ErrUnavailable, storage.ErrLocked:
+			return CodeUnavailable
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+// logStorageError logs a storage failure at error level if it is a server
+// fault, and at warn level otherwise so client mistakes don't page anyone
+func logStorageError(logger *zap.Logger, message string, err error) {
+	if IsServerError(storageErrorCode(err)) {
+		logger.Error(message, zap.Error(err))
+		return
+	}
+	logger.Warn(message, zap.Error(err))
+}
+
+// requiredForm returns the named form value, writing a 400 response with
+// message and returning false if it is missing
+func requiredForm(c *gin.Context, field string, message string) (string, bool) {
+	value := c.PostForm(field)
+	if value == "" {
+		writeFieldError(c, CodeInvalidInput, field, message)
+		return "", false
+	}
+	return value, true
+}
+
+// PanicResponse writes the structured 500 response for a recovered panic.
+// Pass it to recovery.GinMiddleware on MFA routes so clients keep receiving
+// ErrorResponse bodies.
+func PanicResponse(c *gin.Context) {
+	writeError(c, CodeInternal, "Internal server error")
+}
@@ -0,0 +1,367 @@
+package mfa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/polyid/auth/internal/recovery"
+	"github.com/polyid/auth/internal/sanitize"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// newTestHandler creates a handler backed by an in-memory store, applying
+// cfg's optional settings
+func newTestHandler(t *testing.T, cfg Config) (*Handler, *storage.MemoryStore) {
+	t.Helper()
+	store := storage.NewMemoryStore(0)
+	t.Cleanup(store.Close)
+
+	secrets, err := NewSecretCipher("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatalf("NewSecretCipher: %v", err)
+	}
+	cfg.TempStore = store
+	cfg.Methods = store
+	cfg.Secrets = secrets
+	cfg.AppLinkKey = bytes.Repeat([]byte{2}, minAppLinkKeyBytes)
+
+	h, err := NewHandler(zap.NewNop(), cfg)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	return h, store
+}
+
+// postForm calls handler with form as the request body
+func postForm(handler gin.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler(c)
+	return w
+}
+
+func TestHandlerErrorResponses(t *testing.T) {
+	disabled := StaticFeatureGate{Features: map[string]bool{FeatureSMS: false}}
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		call       func(h *Handler) gin.HandlerFunc
+		form       url.Values
+		wantStatus int
+		want       ErrorResponse
+	}{
+		{
+			name:       "missing phone number",
+			call:       func(h *Handler) gin.HandlerFunc { return h.SendSMS },
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+			want:       ErrorResponse{Code: CodeInvalidInput, Field: "phone_number"},
+		},
+		{
+			name:       "missing session ID",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifySMS },
+			form:       url.Values{"phone_number": {"+14155550100"}, "code": {"123456"}},
+			wantStatus: http.StatusBadRequest,
+			want:       ErrorResponse{Code: CodeInvalidInput, Field: "session_id"},
+		},
+		{
+			name:       "wrong code",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifySMS },
+			form:       url.Values{"phone_number": {"+14155550100"}, "session_id": {"s1"}, "code": {"123456"}},
+			wantStatus: http.StatusUnauthorized,
+			want:       ErrorResponse{Code: CodeInvalidCode, Field: "code"},
+		},
+		{
+			name:       "disabled method",
+			cfg:        Config{Features: disabled},
+			call:       func(h *Handler) gin.HandlerFunc { return h.SendSMS },
+			form:       url.Values{"phone_number": {"+14155550100"}},
+			wantStatus: http.StatusForbidden,
+			want:       ErrorResponse{Code: CodeDisabled},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, tt.cfg)
+			w := postForm(tt.call(h), tt.form)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var got ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body.String(), err)
+			}
+			if got.Code != tt.want.Code || got.Field != tt.want.Field {
+				t.Errorf("error = %+v, want code %q field %q", got, tt.want.Code, tt.want.Field)
+			}
+			if got.Message == "" {
+				t.Error("error has no message")
+			}
+		})
+	}
+}
+
+func TestStorageErrorCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   string
+		wantStatus int
+	}{
+		{name: "not found", err: &storage.StorageError{Code: storage.ErrNotFound}, wantCode: CodeNotFound, wantStatus: http.StatusNotFound},
+		{name: "invalid input", err: &storage.StorageError{Code: storage.ErrInvalidInput}, wantCode: CodeInvalidInput, wantStatus: http.StatusBadRequest},
+		{name: "already exists", err: &storage.StorageError{Code: storage.ErrAlreadyExists}, wantCode: CodeAlreadyExists, wantStatus: http.StatusConflict},
+		{name: "conflict", err: &storage.StorageError{Code: storage.ErrConflict}, wantCode: CodeConflict, wantStatus: http.StatusConflict},
+		{name: "unavailable", err: &storage.StorageError{Code: storage.ErrUnavailable}, wantCode: CodeUnavailable, wantStatus: http.StatusServiceUnavailable},
+		{name: "locked", err: &storage.StorageError{Code: storage.ErrLocked}, wantCode: CodeUnavailable, wantStatus: http.StatusServiceUnavailable},
+		{name: "wrapped", err: fmt.Errorf("store: %w", &storage.StorageError{Code: storage.ErrNotFound}), wantCode: CodeNotFound, wantStatus: http.StatusNotFound},
+		{name: "deadline", err: context.DeadlineExceeded, wantCode: CodeUnavailable, wantStatus: http.StatusServiceUnavailable},
+		{name: "internal", err: &storage.StorageError{Code: storage.ErrInternal}, wantCode: CodeInternal, wantStatus: http.StatusInternalServerError},
+		{name: "unknown", err: errors.New("boom"), wantCode: CodeInternal, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := storageErrorCode(tt.err)
+			if code != tt.wantCode {
+				t.Errorf("storageErrorCode() = %q, want %q", code, tt.wantCode)
+			}
+			if status := statusForCode(code); status != tt.wantStatus {
+				t.Errorf("statusForCode(%q) = %d, want %d", code, status, tt.wantStatus)
+			}
+			if IsServerError(code) != (tt.wantStatus >= http.StatusInternalServerError) {
+				t.Errorf("IsServerError(%q) = %v", code, IsServerError(code))
+			}
+		})
+	}
+}
+
+func TestWriteStorageErrorSanitized(t *testing.T) {
+	const detail = "dial tcp 10.0.0.5:6379: connection refused"
+	err := &storage.StorageError{Code: storage.ErrInternal, Message: "Failed to query MFA methods", Err: errors.New(detail)}
+
+	tests := []struct {
+		name       string
+		mode       sanitize.Mode
+		wantDetail bool
+	}{
+		{name: "sanitized", mode: sanitize.ModeSanitized},
+		{name: "detailed", mode: sanitize.ModeDetailed, wantDetail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			ctx := sanitize.NewContext(context.Background(), "corr-1", tt.mode)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+			writeStorageError(c, err, "Failed to load MFA methods")
+
+			var got ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body.String(), err)
+			}
+			if got.Code != CodeInternal || got.CorrelationID != "corr-1" {
+				t.Errorf("error = %+v, want code %q with correlation ID corr-1", got, CodeInternal)
+			}
+			if strings.Contains(got.Message, detail) != tt.wantDetail {
+				t.Errorf("message %q contains internal detail = %v, want %v", got.Message, !tt.wantDetail, tt.wantDetail)
+			}
+
+			// The cause is attached to the request for server-side logging
+			if len(c.Errors) != 1 || !strings.Contains(c.Errors.String(), detail) {
+				t.Errorf("request errors = %v, want the storage error", c.Errors)
+			}
+		})
+	}
+}
+
+func TestClientErrorHasNoCorrelationID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	ctx := sanitize.NewContext(context.Background(), "corr-1", sanitize.ModeSanitized)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+	writeStorageError(c, &storage.StorageError{Code: storage.ErrNotFound, Message: "MFA method not found"}, "MFA method not found")
+
+	var got ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+	if got.Code != CodeNotFound || got.CorrelationID != "" {
+		t.Errorf("error = %+v, want code %q without a correlation ID", got, CodeNotFound)
+	}
+}
+
+func TestPanicResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(recovery.GinMiddleware(zap.NewNop(), nil, PanicResponse))
+	router.POST("/mfa/totp/verify", func(c *gin.Context) { panic("nil secret") })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/mfa/totp/verify", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+	if resp.Code != CodeInternal || strings.Contains(resp.Message, "nil secret") {
+		t.Errorf("response = %+v, want a sanitized %s error", resp, CodeInternal)
+	}
+}
+
+// failingMethods is a MethodStore whose every call fails with err
+type failingMethods struct {
+	err error
+}
+
+func (s failingMethods) GetMFAMethods(ctx context.Context, userID string) ([]*storage.MFAMethod, error) {
+	return nil, s.err
+}
+
+func (s failingMethods) StoreMFAMethod(ctx context.Context, method *storage.MFAMethod) error {
+	return s.err
+}
+
+// TestClientAndServerErrorStatus checks that requests a client can fix get a
+// 4xx while storage faults get a 5xx
+func TestClientAndServerErrorStatus(t *testing.T) {
+	code := url.Values{"code": {"123456"}}
+
+	tests := []struct {
+		name       string
+		methods    MethodStore
+		call       func(h *Handler) gin.HandlerFunc
+		form       url.Values
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "missing setup code",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyTOTP },
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidInput,
+		},
+		{
+			name:       "missing code",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyExistingTOTP },
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidInput,
+		},
+		{
+			name:       "missing device ID",
+			call:       func(h *Handler) gin.HandlerFunc { return h.InitiateAppLink },
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidInput,
+		},
+		{
+			name:       "missing signature",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyAppLink },
+			form:       url.Values{"challenge": {"c1"}},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidInput,
+		},
+		{
+			name:       "user not found",
+			methods:    failingMethods{err: &storage.StorageError{Code: storage.ErrNotFound}},
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyExistingTOTP },
+			form:       code,
+			wantStatus: http.StatusNotFound,
+			wantCode:   CodeNotFound,
+		},
+		{
+			name:       "store unavailable",
+			methods:    failingMethods{err: &storage.StorageError{Code: storage.ErrUnavailable}},
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyExistingTOTP },
+			form:       code,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   CodeUnavailable,
+		},
+		{
+			name:       "store failure",
+			methods:    failingMethods{err: errors.New("boom")},
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyExistingTOTP },
+			form:       code,
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{})
+			if tt.methods != nil {
+				h.methods = tt.methods
+			}
+			w := postForm(tt.call(h), tt.form)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var got ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body.String(), err)
+			}
+			if got.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", got.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestLogStorageErrorLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantLevel zapcore.Level
+	}{
+		{name: "client error", err: &storage.StorageError{Code: storage.ErrInvalidInput}, wantLevel: zapcore.WarnLevel},
+		{name: "conflict", err: &storage.StorageError{Code: storage.ErrConflict}, wantLevel: zapcore.WarnLevel},
+		{name: "unavailable", err: &storage.StorageError{Code: storage.ErrUnavailable}, wantLevel: zapcore.ErrorLevel},
+		{name: "internal", err: errors.New("boom"), wantLevel: zapcore.ErrorLevel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			logStorageError(zap.New(core), "Failed to store MFA method", tt.err)
+
+			entries := logs.All()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(entries))
+			}
+			if entries[0].Level != tt.wantLevel {
+				t.Errorf("level = %v, want %v", entries[0].Level, tt.wantLevel)
+			}
+		})
+	}
+}
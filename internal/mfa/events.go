@@ -0,0 +1,44 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/events"
+)
+
+// EventPublisher publishes MFA events, typically an events.KafkaProducer
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, event *events.Event) error
+}
+
+// publishBackupCodeUsed records a backup code being used. Publishing is
+// best-effort; failures are logged and never fail the verification.
+func (h *Handler) publishBackupCodeUsed(ctx context.Context, userID string, remaining int, usedAt time.Time) {
+	if h.publisher == nil {
+		return
+	}
+
+	data, err := json.Marshal(events.BackupCodeUsedData{
+		UserID:    userID,
+		Remaining: remaining,
+		UsedAt:    usedAt,
+	})
+	if err != nil {
+		h.logger.Error("Failed to encode backup_code.used event", zap.Error(err))
+		return
+	}
+
+	err = h.publisher.PublishEvent(ctx, h.eventTopic, &events.Event{
+		Key:       userID,
+		Type:      events.EventBackupCodeUsed,
+		Timestamp: usedAt,
+		Data:      data,
+	})
+	if err != nil {
+		h.logger.Error("Failed to publish backup_code.used event", zap.Error(err))
+	}
+}
@@ -0,0 +1,16 @@
+package mfa
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/polyid/auth/internal/events"
+)
+
+// rejectCode writes an invalid code response for field and reports the
+// failed verification of methodType
+func (h *Handler) rejectCode(c *gin.Context, userID, methodType, field, message string) {
+	if h.failures != nil {
+		h.failures.AuthFailed(c.Request.Context(), userID, events.ReasonMFAFailed, methodType)
+	}
+	writeFieldError(c, CodeInvalidCode, field, message)
+}
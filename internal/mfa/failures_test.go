@@ -0,0 +1,113 @@
+package mfa
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polyid/auth/internal/events"
+)
+
+// recordedFailure is one AuthFailed call
+type recordedFailure struct {
+	userID, reason, method string
+}
+
+// recordingNotifier records failures instead of publishing them
+type recordingNotifier struct {
+	mu       sync.Mutex
+	failures []recordedFailure
+}
+
+func (n *recordingNotifier) AuthFailed(ctx context.Context, userID, reason, method string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = append(n.failures, recordedFailure{userID: userID, reason: reason, method: method})
+}
+
+func TestFailureEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, h *Handler)
+		call       func(h *Handler) gin.HandlerFunc
+		form       url.Values
+		wantStatus int
+		want       []recordedFailure
+	}{
+		{
+			name: "wrong TOTP code",
+			setup: func(t *testing.T, h *Handler) {
+				if err := h.storeTemporarySecret(context.Background(), "", "JBSWY3DPEHPK3PXP"); err != nil {
+					t.Fatalf("storeTemporarySecret: %v", err)
+				}
+			},
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyTOTP },
+			form:       url.Values{"code": {"not-a-code"}},
+			wantStatus: http.StatusUnauthorized,
+			want:       []recordedFailure{{reason: events.ReasonMFAFailed, method: "totp"}},
+		},
+		{
+			name:       "wrong SMS code",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifySMS },
+			form:       url.Values{"phone_number": {"+14155550100"}, "session_id": {"s1"}, "code": {"123456"}},
+			wantStatus: http.StatusUnauthorized,
+			want:       []recordedFailure{{reason: events.ReasonMFAFailed, method: "sms"}},
+		},
+		{
+			name:       "forged app-link challenge",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyAppLink },
+			form:       url.Values{"challenge": {"forged.challenge"}, "signature": {"sig"}},
+			wantStatus: http.StatusUnauthorized,
+			want:       []recordedFailure{{reason: events.ReasonMFAFailed, method: "app_link"}},
+		},
+		{
+			// Malformed requests aren't failed attempts
+			name:       "missing code",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyTOTP },
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "no TOTP setup",
+			call:       func(h *Handler) gin.HandlerFunc { return h.VerifyTOTP },
+			form:       url.Values{"code": {"123456"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recordingNotifier{}
+			h, _ := newTestHandler(t, Config{Failures: notifier})
+			if tt.setup != nil {
+				tt.setup(t, h)
+			}
+
+			w := postForm(tt.call(h), tt.form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if len(notifier.failures) != len(tt.want) {
+				t.Fatalf("failures = %+v, want %+v", notifier.failures, tt.want)
+			}
+			for i, want := range tt.want {
+				if notifier.failures[i] != want {
+					t.Errorf("failure %d = %+v, want %+v", i, notifier.failures[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFailureEventsWithoutNotifier(t *testing.T) {
+	h, _ := newTestHandler(t, Config{})
+
+	w := postForm(h.VerifySMS, url.Values{"phone_number": {"+14155550100"}, "session_id": {"s1"}, "code": {"123456"}})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
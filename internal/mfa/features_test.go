@@ -0,0 +1,88 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStaticFeatureGate(t *testing.T) {
+	gate := StaticFeatureGate{
+		Features: map[string]bool{FeatureSMS: false, FeatureAppLink: false, FeatureTOTP: true},
+		Users:    map[string][]string{FeatureAppLink: {"user-beta"}},
+	}
+
+	tests := []struct {
+		name    string
+		feature string
+		userID  string
+		want    bool
+	}{
+		{name: "unlisted feature", feature: FeatureBackupCode, userID: "user-1", want: true},
+		{name: "enabled feature", feature: FeatureTOTP, userID: "user-1", want: true},
+		{name: "disabled feature", feature: FeatureSMS, userID: "user-1"},
+		{name: "disabled for users outside the cohort", feature: FeatureAppLink, userID: "user-1"},
+		{name: "enabled for a user in the cohort", feature: FeatureAppLink, userID: "user-beta", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gate.Enabled(context.Background(), tt.feature, tt.userID); got != tt.want {
+				t.Errorf("Enabled(%q, %q) = %v, want %v", tt.feature, tt.userID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMethodEnabled(t *testing.T) {
+	gate := StaticFeatureGate{
+		Features: map[string]bool{FeatureSMS: false},
+		Users:    map[string][]string{FeatureSMS: {"user-beta"}},
+	}
+
+	tests := []struct {
+		name     string
+		features FeatureGate
+		userID   string
+		want     bool
+	}{
+		{name: "no gate", userID: "user-1", want: true},
+		{name: "gated method for a disabled user", features: gate, userID: "user-1"},
+		{name: "gated method for an enabled user", features: gate, userID: "user-beta", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{Features: tt.features})
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+			if got := h.methodEnabled(c, FeatureSMS, tt.userID); got != tt.want {
+				t.Fatalf("methodEnabled() = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				if w.Body.Len() != 0 {
+					t.Errorf("enabled method wrote a response: %s", w.Body.String())
+				}
+				return
+			}
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+			var got ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body.String(), err)
+			}
+			if got.Code != CodeDisabled {
+				t.Errorf("error code = %q, want %q", got.Code, CodeDisabled)
+			}
+		})
+	}
+}
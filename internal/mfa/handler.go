@@ -3,238 +3,559 @@ package mfa
 import (
 	"crypto/rand"
 	"encoding/base32"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/events"
+	"github.com/polyid/auth/internal/idgen"
+	"github.com/polyid/auth/internal/ratelimit"
+	"github.com/polyid/auth/internal/storage"
 )
 
 type Handler struct {
-	logger *zap.Logger
+	logger   *zap.Logger
+	secrets  *SecretCipher
+	features FeatureGate
+	locker   Locker
+	totpAlg  otp.Algorithm
+
+	phoneRegions PhoneRegions
+	limits       MethodLimits
+	attempts     ratelimit.Limiter
+	factors      *DowngradeGuard
+	appLinkKey   []byte
+	temp         TempStore
+	methods      MethodStore
+	ids          idgen.Generator
+	random       io.Reader
+	failures     events.FailureNotifier
+	publisher    EventPublisher
+	eventTopic   string
 	// Add other dependencies like SMS service, app-link service, etc.
 }
 
 // NewHandler creates a new MFA handler
-func NewHandler(logger *zap.Logger) *Handler {
-	return &Handler{
-		logger: logger,
+func NewHandler(logger *zap.Logger, cfg Config) (*Handler, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MFA config: %w", err)
+	}
+
+	random := cfg.Random
+	if random == nil {
+		random = rand.Reader
+	}
+
+	appLinkKey := cfg.AppLinkKey
+	if appLinkKey == nil {
+		appLinkKey = make([]byte, minAppLinkKeyBytes)
+		if _, err := io.ReadFull(random, appLinkKey); err != nil {
+			return nil, fmt.Errorf("failed to generate app-link key: %w", err)
+		}
+		logger.Warn("No app-link key configured; challenges only verify on this instance")
 	}
+
+	attempts := cfg.Attempts
+	if attempts == nil {
+		attempts = ratelimit.NewMemoryLimiter(DefaultMaxAttempts, DefaultAttemptWindow)
+		logger.Warn("No attempt limiter configured; attempts are only limited per instance")
+	}
+
+	return &Handler{
+		logger:   logger,
+		secrets:  cfg.Secrets,
+		features: cfg.Features,
+		locker:   cfg.Locker,
+		totpAlg:  cfg.TOTPAlgorithm,
+
+		phoneRegions: cfg.PhoneRegions,
+		limits:       cfg.Limits,
+		attempts:     attempts,
+		factors:      cfg.Factors,
+		failures:     cfg.Failures,
+		publisher:    cfg.Events,
+		eventTopic:   cfg.EventTopic,
+		appLinkKey:   appLinkKey,
+		temp:         cfg.TempStore,
+		methods:      cfg.Methods,
+		ids:          idgen.NewUUIDv7(),
+		random:       random,
+	}, nil
 }
 
 // SetupTOTP initiates TOTP setup for a user
 func (h *Handler) SetupTOTP(c *gin.Context) {
 	userID := getUserIDFromContext(c)
-	
+	if !h.methodEnabled(c, FeatureTOTP, userID) {
+		return
+	}
+	if !h.withinMethodLimit(c, userID, "totp") {
+		return
+	}
+
 	// Generate a random secret
-	secret := make([]byte, 20)
-	if _, err := rand.Read(secret); err != nil {
+	secret, err := h.randomBytes(20)
+	if err != nil {
 		h.logger.Error("Failed to generate TOTP secret", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to setup TOTP"})
+		writeError(c, CodeInternal, "Failed to setup TOTP")
 		return
 	}
 
 	// Create TOTP key
-	key, err := totp.Generate(totp.GenerateOpts{
-		Issuer:      "PolyID",
-		AccountName: userID,
-		Secret:      base32.StdEncoding.EncodeToString(secret),
-	})
+	key, err := h.totpKey(userID, base32.StdEncoding.EncodeToString(secret))
 	if err != nil {
 		h.logger.Error("Failed to generate TOTP key", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to setup TOTP"})
+		writeError(c, CodeInternal, "Failed to setup TOTP")
 		return
 	}
 
 	// Store the secret temporarily for verification
-	storeTemporarySecret(userID, key.Secret())
+	if err := h.storeTemporarySecret(c.Request.Context(), userID, key.Secret()); err != nil {
+		logStorageError(h.logger, "Failed to store TOTP setup", err)
+		writeStorageError(c, err, "Failed to setup TOTP")
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"secret": key.Secret(),
-		"qr":     key.URL(),
+	c.JSON(http.StatusOK, TOTPSetupResponse{
+		Secret: key.Secret(),
+		QR:     key.URL(),
+	})
+}
+
+// GetPendingTOTP returns the secret and otpauth URL of the TOTP setup in
+// progress, so a user who lost the QR code can scan it again without
+// restarting setup
+func (h *Handler) GetPendingTOTP(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if !h.methodEnabled(c, FeatureTOTP, userID) {
+		return
+	}
+
+	secret, err := h.getTemporarySecret(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to get TOTP setup", err)
+		writeStorageError(c, err, "Failed to get TOTP setup")
+		return
+	}
+	if secret == "" {
+		writeError(c, CodeNotFound, "No TOTP setup in progress")
+		return
+	}
+
+	key, err := h.totpKey(userID, secret)
+	if err != nil {
+		h.logger.Error("Failed to rebuild TOTP key", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to get TOTP setup")
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPSetupResponse{
+		Secret: key.Secret(),
+		QR:     key.URL(),
 	})
 }
 
 // VerifyTOTP verifies a TOTP code
 func (h *Handler) VerifyTOTP(c *gin.Context) {
 	userID := getUserIDFromContext(c)
-	code := c.PostForm("code")
+	if !h.methodEnabled(c, FeatureTOTP, userID) {
+		return
+	}
+	code, ok := requiredForm(c, "code", "Missing code")
+	if !ok {
+		return
+	}
+	if !h.withinAttemptLimit(c, userID, "totp") {
+		return
+	}
 
-	secret := getTemporarySecret(userID)
+	secret, err := h.getTemporarySecret(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to get TOTP setup", err)
+		writeStorageError(c, err, "Failed to complete TOTP setup")
+		return
+	}
 	if secret == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No TOTP setup in progress"})
+		writeError(c, CodeSetupNotFound, "No TOTP setup in progress")
 		return
 	}
 
-	valid := totp.Validate(code, secret)
-	if !valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid TOTP code"})
+	valid, err := totp.ValidateCustom(code, secret, time.Now(), totpValidateOpts(h.totpAlg, 1))
+	if err != nil || !valid {
+		h.rejectCode(c, userID, "totp", "code", "Invalid TOTP code")
+		return
+	}
+
+	// Encrypt the secret so a storage breach doesn't expose TOTP seeds. The
+	// method's ID is bound into the ciphertext, so it is assigned up front.
+	methodID := h.ids.NewID()
+	sealed, keyID, err := h.secrets.Encrypt(secret, userID, methodID)
+	if err != nil {
+		h.logger.Error("Failed to encrypt TOTP secret", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to complete TOTP setup")
+		return
+	}
+
+	// Serialize enrollment so concurrent verifications can't both persist
+	unlock, err := h.lockEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to lock TOTP enrollment", err)
+		writeStorageError(c, err, "Failed to complete TOTP setup")
+		return
+	}
+	defer unlock()
+
+	// Recheck under the lock in case another method was enrolled since setup
+	if !h.withinMethodLimit(c, userID, "totp") {
+		return
+	}
+
+	// Claim the setup before persisting, so of two verifications of the
+	// same setup only one enrolls it
+	claimed, err := h.temp.SwapTemporaryValue(c.Request.Context(), totpSetupKey(userID), secret, "", 0)
+	if err != nil {
+		logStorageError(h.logger, "Failed to claim TOTP setup", err)
+		writeStorageError(c, err, "Failed to complete TOTP setup")
+		return
+	}
+	if !claimed {
+		writeError(c, CodeSetupNotFound, "No TOTP setup in progress")
 		return
 	}
 
 	// Store the verified secret permanently
-	if err := storeVerifiedTOTPSecret(userID, secret); err != nil {
-		h.logger.Error("Failed to store TOTP secret", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete TOTP setup"})
+	now := time.Now()
+	method := &storage.MFAMethod{
+		ID:        methodID,
+		UserID:    userID,
+		Type:      "totp",
+		Value:     sealed,
+		KeyID:     keyID,
+		Algorithm: h.totpAlg.String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.methods.StoreMFAMethod(c.Request.Context(), method); err != nil {
+		logStorageError(h.logger, "Failed to store TOTP secret", err)
+		writeStorageError(c, err, "Failed to complete TOTP setup")
+		return
+	}
+	h.resetAttempts(c.Request.Context(), userID, "totp")
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "TOTP setup completed"})
+}
+
+// VerifyExistingTOTP verifies a code against the user's enrolled TOTP
+// method, e.g. for step-up authentication. Unlike VerifyTOTP it needs no
+// setup in progress; each code is accepted at most once.
+func (h *Handler) VerifyExistingTOTP(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if !h.methodEnabled(c, FeatureTOTP, userID) {
+		return
+	}
+	code, ok := requiredForm(c, "code", "Missing code")
+	if !ok {
+		return
+	}
+	if !h.withinAttemptLimit(c, userID, "totp") {
+		return
+	}
+
+	// Serialize verifications so a code used concurrently can't pass the
+	// replay check twice
+	unlock, err := h.lockEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to lock TOTP verification", err)
+		writeStorageError(c, err, "Failed to verify TOTP code")
+		return
+	}
+	defer unlock()
+
+	methods, err := h.methods.GetMFAMethods(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to get MFA methods", err)
+		writeStorageError(c, err, "Failed to verify TOTP code")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "TOTP setup completed"})
+	enrolled := false
+	for _, method := range methods {
+		if method.Type != "totp" {
+			continue
+		}
+		enrolled = true
+
+		valid, err := h.verifyStoredTOTP(c.Request.Context(), method, code)
+		if err != nil {
+			logStorageError(h.logger, "Failed to verify TOTP code", err)
+			writeStorageError(c, err, "Failed to verify TOTP code")
+			return
+		}
+		if valid {
+			h.resetAttempts(c.Request.Context(), userID, "totp")
+			c.JSON(http.StatusOK, TOTPVerifiedResponse{
+				Message:    "TOTP verified",
+				VerifiedAt: time.Now(),
+			})
+			return
+		}
+	}
+
+	if !enrolled {
+		writeError(c, CodeNotFound, "No TOTP method enrolled")
+		return
+	}
+	h.rejectCode(c, userID, "totp", "code", "Invalid TOTP code")
 }
 
 // SendSMS sends an SMS verification code
 func (h *Handler) SendSMS(c *gin.Context) {
 	userID := getUserIDFromContext(c)
-	phoneNumber := c.PostForm("phone_number")
+	if !h.methodEnabled(c, FeatureSMS, userID) {
+		return
+	}
+	if !h.factorAllowed(c, userID, "sms") {
+		return
+	}
+	phoneNumber, ok := h.phoneNumber(c)
+	if !ok {
+		return
+	}
+	if !h.withinMethodLimit(c, userID, "sms") {
+		return
+	}
 
 	// Generate a 6-digit code
-	code := generateVerificationCode(6)
+	code, err := h.verificationCode(6)
+	if err != nil {
+		h.logger.Error("Failed to generate SMS verification code", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to send verification code")
+		return
+	}
 
-	// Store the code with expiration
-	if err := storeSMSVerificationCode(userID, phoneNumber, code); err != nil {
-		h.logger.Error("Failed to store SMS verification code", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+	// Bind the code to this send so codes from earlier sends can't be used
+	sessionID, err := h.sessionID()
+	if err != nil {
+		h.logger.Error("Failed to generate SMS session ID", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to send verification code")
 		return
 	}
 
-	// TODO: Integrate with SMS service
-	// For now, just log the code
-	h.logger.Info("SMS verification code",
+	// Store the code with expiration, replacing any outstanding code
+	if err := h.storeSMSVerificationCode(c.Request.Context(), userID, phoneNumber, sessionID, code); err != nil {
+		logStorageError(h.logger, "Failed to store SMS verification code", err)
+		writeStorageError(c, err, "Failed to send verification code")
+		return
+	}
+
+	// TODO: Integrate with SMS service. Never log the code itself.
+	h.logger.Info("SMS verification code sent",
 		zap.String("user_id", userID),
-		zap.String("phone", phoneNumber),
-		zap.String("code", code))
+		zap.String("phone", phoneNumber))
 
-	c.JSON(http.StatusOK, gin.H{"message": "Verification code sent"})
+	c.JSON(http.StatusOK, SMSSentResponse{
+		Message:   "Verification code sent",
+		SessionID: sessionID,
+	})
 }
 
 // VerifySMS verifies an SMS code
 func (h *Handler) VerifySMS(c *gin.Context) {
 	userID := getUserIDFromContext(c)
-	phoneNumber := c.PostForm("phone_number")
-	code := c.PostForm("code")
+	if !h.methodEnabled(c, FeatureSMS, userID) {
+		return
+	}
+	if !h.factorAllowed(c, userID, "sms") {
+		return
+	}
+	phoneNumber, ok := h.phoneNumber(c)
+	if !ok {
+		return
+	}
+	sessionID, ok := requiredForm(c, "session_id", "Missing session ID")
+	if !ok {
+		return
+	}
+	code, ok := requiredForm(c, "code", "Missing code")
+	if !ok {
+		return
+	}
+	// SMS codes are only 6 digits, so guessing must be limited
+	if !h.withinAttemptLimit(c, userID, "sms") {
+		return
+	}
 
-	valid, err := verifySMSCode(userID, phoneNumber, code)
+	valid, err := h.verifySMSCode(c.Request.Context(), userID, phoneNumber, sessionID, code)
 	if err != nil {
-		h.logger.Error("Failed to verify SMS code", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		logStorageError(h.logger, "Failed to verify SMS code", err)
+		writeStorageError(c, err, "Failed to verify code")
 		return
 	}
 
 	if !valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		h.rejectCode(c, userID, "sms", "code", "Invalid verification code")
+		return
+	}
+	h.resetAttempts(c.Request.Context(), userID, "sms")
+
+	if !h.withinMethodLimit(c, userID, "sms") {
 		return
 	}
 
 	// Store verified phone number
-	if err := storeVerifiedPhoneNumber(userID, phoneNumber); err != nil {
-		h.logger.Error("Failed to store verified phone number", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete phone verification"})
+	now := time.Now()
+	method := &storage.MFAMethod{
+		UserID:    userID,
+		Type:      "sms",
+		Value:     phoneNumber,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.methods.StoreMFAMethod(c.Request.Context(), method); err != nil {
+		logStorageError(h.logger, "Failed to store verified phone number", err)
+		writeStorageError(c, err, "Failed to complete phone verification")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Phone number verified"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "Phone number verified"})
 }
 
 // InitiateAppLink initiates the app-link verification process
 func (h *Handler) InitiateAppLink(c *gin.Context) {
 	userID := getUserIDFromContext(c)
+	if !h.methodEnabled(c, FeatureAppLink, userID) {
+		return
+	}
 
-	// Generate a challenge
-	challenge := generateChallenge()
+	deviceID, ok := requiredForm(c, "device_id", "Missing device ID")
+	if !ok {
+		return
+	}
+	if !h.withinMethodLimit(c, userID, "app_link") {
+		return
+	}
 
-	// Store the challenge
-	if err := storeAppLinkChallenge(userID, challenge); err != nil {
-		h.logger.Error("Failed to store app-link challenge", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate app-link verification"})
+	// The challenge is signed, so it needn't be stored until it is used
+	challenge, expiresAt, err := issueAppLinkChallenge(h.random, h.appLinkKey, userID, deviceID, time.Now())
+	if err != nil {
+		h.logger.Error("Failed to issue app-link challenge", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to initiate app-link verification")
 		return
 	}
 
 	// TODO: Send push notification to user's device
 	// For now, just return the challenge
-	c.JSON(http.StatusOK, gin.H{
-		"challenge": challenge,
-		"expires_in": 300, // 5 minutes
+	c.JSON(http.StatusOK, AppLinkChallengeResponse{
+		Challenge: challenge,
+		ExpiresIn: int(time.Until(expiresAt).Seconds()),
 	})
 }
 
 // VerifyAppLink verifies the app-link response
 func (h *Handler) VerifyAppLink(c *gin.Context) {
 	userID := getUserIDFromContext(c)
-	challenge := c.PostForm("challenge")
-	signature := c.PostForm("signature")
+	if !h.methodEnabled(c, FeatureAppLink, userID) {
+		return
+	}
+	challenge, ok := requiredForm(c, "challenge", "Missing challenge")
+	if !ok {
+		return
+	}
+	signature, ok := requiredForm(c, "signature", "Missing signature")
+	if !ok {
+		return
+	}
+	if !h.withinAttemptLimit(c, userID, "app_link") {
+		return
+	}
 
-	valid, err := verifyAppLinkResponse(userID, challenge, signature)
+	claims, err := parseAppLinkChallenge(h.appLinkKey, challenge, userID, time.Now())
+	if errors.Is(err, errChallengeExpired) {
+		writeFieldError(c, CodeCodeExpired, "challenge", "App-link challenge expired")
+		return
+	}
 	if err != nil {
-		h.logger.Error("Failed to verify app-link response", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify app-link"})
+		h.logger.Warn("Rejected app-link challenge", zap.Error(err))
+		h.rejectCode(c, userID, "app_link", "challenge", "Invalid app-link challenge")
+		return
+	}
+
+	valid, err := verifyAppLinkSignature(userID, claims.DeviceID, challenge, signature)
+	if err != nil {
+		logStorageError(h.logger, "Failed to verify app-link response", err)
+		writeStorageError(c, err, "Failed to verify app-link")
 		return
 	}
 
 	if !valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid app-link verification"})
+		h.rejectCode(c, userID, "app_link", "signature", "Invalid app-link verification")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "App-link verification successful"})
-}
+	// Recheck in case another device was linked since the challenge was
+	// issued
+	if !h.withinMethodLimit(c, userID, "app_link") {
+		return
+	}
 
-// Helper functions
-func getUserIDFromContext(c *gin.Context) string {
-	// TODO: Implement user ID retrieval from context
-	return ""
-}
+	// Consume the nonce last so a bad signature or reached limit doesn't
+	// burn the challenge
+	fresh, err := h.consumeAppLinkNonce(c.Request.Context(), userID, claims.Nonce, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		logStorageError(h.logger, "Failed to record app-link nonce", err)
+		writeStorageError(c, err, "Failed to verify app-link")
+		return
+	}
+	if !fresh {
+		h.rejectCode(c, userID, "app_link", "challenge", "App-link challenge already used")
+		return
+	}
+	h.resetAttempts(c.Request.Context(), userID, "app_link")
 
-func generateVerificationCode(length int) string {
-	// TODO: Implement proper code generation
-	return fmt.Sprintf("%06d", time.Now().UnixNano()%1000000)
+	c.JSON(http.StatusOK, MessageResponse{Message: "App-link verification successful"})
 }
 
-func generateChallenge() string {
-	// TODO: Implement proper challenge generation
-	b := make([]byte, 32)
-	rand.Read(b)
-	return base32.StdEncoding.EncodeToString(b)
+// totpSecret returns the plaintext secret of a stored TOTP method. Methods
+// without a key ID predate encryption and hold the secret in plaintext.
+func (h *Handler) totpSecret(method *storage.MFAMethod) (string, error) {
+	if method.KeyID == "" {
+		return method.Value, nil
+	}
+	return h.secrets.Decrypt(method.Value, method.KeyID, method.UserID, method.ID)
 }
 
-// Storage functions (to be implemented)
-func storeTemporarySecret(userID, secret string) error {
-	// TODO: Implement temporary secret storage
-	return nil
+// totpKey builds the TOTP key for a base32-encoded secret. The same secret
+// always yields the same otpauth URL.
+func (h *Handler) totpKey(userID, secret string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      "PolyID",
+		AccountName: userID,
+		Secret:      secret,
+		Algorithm:   h.totpAlg, // encoded in the otpauth URL
+	})
 }
 
-func getTemporarySecret(userID string) string {
-	// TODO: Implement temporary secret retrieval
+// Helper functions
+func getUserIDFromContext(c *gin.Context) string {
+	// TODO: Implement user ID retrieval from context
 	return ""
 }
 
-func storeVerifiedTOTPSecret(userID, secret string) error {
-	// TODO: Implement verified TOTP secret storage
-	return nil
-}
-
-func storeSMSVerificationCode(userID, phoneNumber, code string) error {
-	// TODO: Implement SMS verification code storage
-	return nil
-}
-
-func verifySMSCode(userID, phoneNumber, code string) (bool, error) {
-	// TODO: Implement SMS code verification
+func verifyAppLinkSignature(userID, deviceID, challenge, signature string) (bool, error) {
+	// TODO: Verify the signature against the user's registered device key
 	return false, nil
 }
 
-func storeVerifiedPhoneNumber(userID, phoneNumber string) error {
-	// TODO: Implement verified phone number storage
-	return nil
-}
-
-func storeAppLinkChallenge(userID, challenge string) error {
-	// TODO: Implement app-link challenge storage
-	return nil
+func consumeBackupCode(userID, code string) (remaining int, valid bool, err error) {
+	// TODO: Implement backup code consumption. Compare against the user's
+	// unused backup codes with secureCompare, then mark the match used and
+	// count the rest in one update so a code can't be used twice
+	return 0, false, nil
 }
-
-func verifyAppLinkResponse(userID, challenge, signature string) (bool, error) {
-	// TODO: Implement app-link response verification
-	return false, nil
-} 
\ No newline at end of file
@@ -0,0 +1,24 @@
+package mfa
+
+// Temporary value keys. Every key for a user shares tempKeyPrefix so an
+// in-progress flow can be found and cleared by user.
+
+func tempKeyPrefix(userID string) string {
+	return "mfa:" + userID + ":"
+}
+
+func totpSetupKey(userID string) string {
+	return tempKeyPrefix(userID) + "totp_setup"
+}
+
+func smsCodeKey(userID, phoneNumber string) string {
+	return tempKeyPrefix(userID) + "sms:" + phoneNumber
+}
+
+func appLinkNonceKey(userID, nonce string) string {
+	return tempKeyPrefix(userID) + "app_link:" + nonce
+}
+
+func totpRotationKey(userID string) string {
+	return tempKeyPrefix(userID) + "totp_rotation"
+}
@@ -0,0 +1,75 @@
+package mfa
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// MethodLimits caps how many active MFA methods of each type ("totp", "sms",
+// "app_link") a user may have. Types without an entry are unlimited.
+type MethodLimits map[string]int
+
+// Validate reports the first problem with the limits
+func (l MethodLimits) Validate() error {
+	for methodType, limit := range l {
+		if !IsSupportedMethod(methodType) {
+			return errors.New("method limits may only name supported method types")
+		}
+		if limit <= 0 {
+			return errors.New("method limits must be positive")
+		}
+	}
+	return nil
+}
+
+// Allows reports whether a user with the given methods may enroll another
+// method of methodType
+func (l MethodLimits) Allows(methods []*storage.MFAMethod, methodType string) bool {
+	limit, ok := l[methodType]
+	if !ok {
+		return true
+	}
+
+	active := 0
+	for _, method := range methods {
+		if method.Type == methodType {
+			active++
+		}
+	}
+	return active < limit
+}
+
+// IsSupportedMethod reports whether methodType is an MFA method type the
+// server supports
+func IsSupportedMethod(methodType string) bool {
+	for _, m := range supportedMethods {
+		if m.info.Type == methodType {
+			return true
+		}
+	}
+	return false
+}
+
+// withinMethodLimit writes an error response and returns false if the user
+// can't enroll another method of methodType
+func (h *Handler) withinMethodLimit(c *gin.Context, userID string, methodType string) bool {
+	if len(h.limits) == 0 {
+		return true
+	}
+
+	methods, err := h.methods.GetMFAMethods(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to get MFA methods", err)
+		writeStorageError(c, err, "Failed to check MFA method limit")
+		return false
+	}
+
+	if !h.limits.Allows(methods, methodType) {
+		writeError(c, CodeLimitReached, "Maximum number of methods of this type reached")
+		return false
+	}
+	return true
+}
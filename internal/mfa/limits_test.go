@@ -0,0 +1,95 @@
+package mfa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+func TestMethodLimitsAllows(t *testing.T) {
+	limits := MethodLimits{"totp": 1, "sms": 2}
+	methods := []*storage.MFAMethod{
+		{ID: "mfa-1", Type: "totp"},
+		{ID: "mfa-2", Type: "sms"},
+		{ID: "mfa-3", Type: "app_link"},
+	}
+
+	tests := []struct {
+		name       string
+		methodType string
+		want       bool
+	}{
+		{name: "at the limit", methodType: "totp"},
+		{name: "below the limit", methodType: "sms", want: true},
+		{name: "unlimited type", methodType: "app_link", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limits.Allows(methods, tt.methodType); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.methodType, got, tt.want)
+			}
+		})
+	}
+
+	if !(MethodLimits{}).Allows(methods, "totp") {
+		t.Error("empty limits rejected an enrollment")
+	}
+}
+
+func TestEnrollmentMethodLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		methodType string
+		enrolled   []storage.MFAMethod
+		wantStatus int
+	}{
+		{name: "TOTP below the limit", methodType: "totp", enrolled: []storage.MFAMethod{{ID: "mfa-1", Type: "sms"}}, wantStatus: http.StatusOK},
+		{name: "TOTP at the limit", methodType: "totp", enrolled: []storage.MFAMethod{{ID: "mfa-1", Type: "totp"}}, wantStatus: http.StatusConflict},
+		{name: "app link below the limit", methodType: "app_link", wantStatus: http.StatusOK},
+		{name: "app link at the limit", methodType: "app_link", enrolled: []storage.MFAMethod{{ID: "mfa-1", Type: "app_link"}, {ID: "mfa-2", Type: "app_link"}}, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{Limits: MethodLimits{"totp": 1, "app_link": 2}})
+			h.methods = &methodList{methods: tt.enrolled}
+
+			var handler gin.HandlerFunc = h.SetupTOTP
+			form := url.Values{}
+			if tt.methodType == "app_link" {
+				handler = h.InitiateAppLink
+				form.Set("device_id", "device-1")
+			}
+
+			w := postForm(handler, form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusConflict {
+				var resp ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != CodeLimitReached {
+					t.Errorf("response = %s, want code %q", w.Body.String(), CodeLimitReached)
+				}
+			}
+		})
+	}
+}
+
+func TestIsSupportedMethod(t *testing.T) {
+	for _, methodType := range []string{"totp", "sms", "app_link"} {
+		if !IsSupportedMethod(methodType) {
+			t.Errorf("IsSupportedMethod(%q) = false, want true", methodType)
+		}
+	}
+	for _, methodType := range []string{"", "TOTP", "passkey", "carrier_pigeon"} {
+		if IsSupportedMethod(methodType) {
+			t.Errorf("IsSupportedMethod(%q) = true, want false", methodType)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package mfa
+
+import (
+	"context"
+	"time"
+)
+
+// enrollmentLockTTL bounds how long an enrollment critical section may run
+const enrollmentLockTTL = 10 * time.Second
+
+// Locker provides mutual exclusion across instances, typically a
+// storage.RedisCache
+type Locker interface {
+	Lock(ctx context.Context, key string, ttl time.Duration) (func(), error)
+}
+
+// lockEnrollment locks the user's MFA enrollment
+func (h *Handler) lockEnrollment(ctx context.Context, userID string) (func(), error) {
+	if h.locker == nil {
+		return func() {}, nil
+	}
+	return h.locker.Lock(ctx, tempKeyPrefix(userID)+"enroll", enrollmentLockTTL)
+}
@@ -0,0 +1,54 @@
+package mfa
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MethodInfo describes an MFA method type the server supports
+type MethodInfo struct {
+	Type           string `json:"type"`
+	SetupReturnsQR bool   `json:"setup_returns_qr"`
+	RequiresPhone  bool   `json:"requires_phone"`
+	SupportsBackup bool   `json:"supports_backup"`
+	Enabled        bool   `json:"enabled"` // for the requesting user
+}
+
+// methodType pairs a supported method with the feature that gates it
+type methodType struct {
+	info    MethodInfo
+	feature string
+}
+
+// supportedMethods lists the method types in the order clients should
+// offer them
+var supportedMethods = []methodType{
+	{
+		info:    MethodInfo{Type: "totp", SetupReturnsQR: true, SupportsBackup: true},
+		feature: FeatureTOTP,
+	},
+	{
+		info:    MethodInfo{Type: "sms", RequiresPhone: true},
+		feature: FeatureSMS,
+	},
+	{
+		info:    MethodInfo{Type: "app_link"},
+		feature: FeatureAppLink,
+	},
+}
+
+// ListMethods returns the MFA method types the server supports, and whether
+// each is enabled for the current user, so clients needn't hardcode them
+func (h *Handler) ListMethods(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	methods := make([]MethodInfo, 0, len(supportedMethods))
+	for _, m := range supportedMethods {
+		info := m.info
+		info.Enabled = h.features == nil || h.features.Enabled(c.Request.Context(), m.feature, userID)
+		methods = append(methods, info)
+	}
+
+	c.JSON(http.StatusOK, MethodsResponse{Methods: methods})
+}
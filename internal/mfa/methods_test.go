@@ -0,0 +1,63 @@
+package mfa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestListMethods(t *testing.T) {
+	tests := []struct {
+		name        string
+		features    FeatureGate
+		wantEnabled map[string]bool
+	}{
+		{
+			name:        "no feature gate",
+			wantEnabled: map[string]bool{"totp": true, "sms": true, "app_link": true},
+		},
+		{
+			name:        "disabled features",
+			features:    StaticFeatureGate{Features: map[string]bool{FeatureSMS: false, FeatureAppLink: false}},
+			wantEnabled: map[string]bool{"totp": true, "sms": false, "app_link": false},
+		},
+		{
+			name:        "explicitly enabled feature",
+			features:    StaticFeatureGate{Features: map[string]bool{FeatureTOTP: true, FeatureSMS: false}},
+			wantEnabled: map[string]bool{"totp": true, "sms": false, "app_link": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{Features: tt.features})
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+			h.ListMethods(c)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			var resp MethodsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body.String(), err)
+			}
+
+			want := []MethodInfo{
+				{Type: "totp", SetupReturnsQR: true, SupportsBackup: true, Enabled: tt.wantEnabled["totp"]},
+				{Type: "sms", RequiresPhone: true, Enabled: tt.wantEnabled["sms"]},
+				{Type: "app_link", Enabled: tt.wantEnabled["app_link"]},
+			}
+			if !reflect.DeepEqual(resp.Methods, want) {
+				t.Errorf("ListMethods() = %+v, want %+v", resp.Methods, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package mfa
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// PhoneRegions restricts SMS verification to phone numbers from certain
+// regions, identified by ISO 3166-1 alpha-2 codes such as "US" or "GB"
+type PhoneRegions struct {
+	// Allow lists the only permitted regions; empty permits every region
+	Allow []string
+	// Deny lists regions that are always rejected, even if allowed
+	Deny []string
+}
+
+// Validate reports the first problem with the region lists
+func (r PhoneRegions) Validate() error {
+	for _, region := range append(append([]string{}, r.Allow...), r.Deny...) {
+		if len(region) != 2 || strings.ToUpper(region) != region {
+			return errors.New("phone regions must be uppercase ISO 3166-1 alpha-2 codes")
+		}
+	}
+	return nil
+}
+
+// permits reports whether numbers from region may be verified
+func (r PhoneRegions) permits(region string) bool {
+	for _, denied := range r.Deny {
+		if denied == region {
+			return false
+		}
+	}
+
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range r.Allow {
+		if allowed == region {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePhoneNumber parses an international phone number and returns it
+// in E.164 form with its region
+func normalizePhoneNumber(raw string) (string, string, error) {
+	num, err := phonenumbers.Parse(raw, "")
+	if err != nil {
+		return "", "", err
+	}
+	if !phonenumbers.IsValidNumber(num) {
+		return "", "", errors.New("invalid phone number")
+	}
+
+	return phonenumbers.Format(num, phonenumbers.E164), phonenumbers.GetRegionCodeForNumber(num), nil
+}
+
+// phoneNumber reads the request's phone number, normalizes it to E.164, and
+// checks it against the region policy. It writes the error response and
+// returns false if the number is invalid or not permitted.
+func (h *Handler) phoneNumber(c *gin.Context) (string, bool) {
+	number, region, err := normalizePhoneNumber(c.PostForm("phone_number"))
+	if err != nil {
+		writeFieldError(c, CodeInvalidInput, "phone_number", "Phone number must be in international format, e.g. +14155550100")
+		return "", false
+	}
+
+	if !h.phoneRegions.permits(region) {
+		writeFieldError(c, CodeRegionNotAllowed, "phone_number", "Phone numbers from this region can't be used for SMS verification")
+		return "", false
+	}
+
+	return number, true
+}
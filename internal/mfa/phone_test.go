@@ -0,0 +1,64 @@
+package mfa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPhoneNumberRegions(t *testing.T) {
+	tests := []struct {
+		name       string
+		regions    PhoneRegions
+		number     string
+		want       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "any region by default", number: "+44 20 7946 0958", want: "+442079460958"},
+		{name: "allowed region", regions: PhoneRegions{Allow: []string{"US", "GB"}}, number: "+1 415-555-0100", want: "+14155550100"},
+		{name: "region not allowed", regions: PhoneRegions{Allow: []string{"US"}}, number: "+44 20 7946 0958", wantStatus: http.StatusForbidden, wantCode: CodeRegionNotAllowed},
+		{name: "denied region", regions: PhoneRegions{Deny: []string{"GB"}}, number: "+44 20 7946 0958", wantStatus: http.StatusForbidden, wantCode: CodeRegionNotAllowed},
+		{name: "deny overrides allow", regions: PhoneRegions{Allow: []string{"US", "GB"}, Deny: []string{"GB"}}, number: "+44 20 7946 0958", wantStatus: http.StatusForbidden, wantCode: CodeRegionNotAllowed},
+		{name: "not international", regions: PhoneRegions{Allow: []string{"US"}}, number: "415-555-0100", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{phoneRegions: tt.regions}
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			form := url.Values{"phone_number": {tt.number}}
+			c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			number, ok := h.phoneNumber(c)
+
+			if tt.wantCode == "" {
+				if !ok || number != tt.want {
+					t.Errorf("phoneNumber() = %q, %v, want %q, true", number, ok, tt.want)
+				}
+				return
+			}
+			if ok {
+				t.Fatalf("phoneNumber() = %q, true, want rejection", number)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body.String(), err)
+			}
+			if resp.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+			}
+		})
+	}
+}
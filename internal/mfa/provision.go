@@ -0,0 +1,285 @@
+package mfa
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/sanitize"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// MaxProvisionEntries caps the entries in one BulkProvisionMFA request
+const MaxProvisionEntries = 1000
+
+// provisionableMethods are the method types an admin may provision on a
+// user's behalf. TOTP is excluded because its secret must only ever be
+// shown to the user enrolling it.
+var provisionableMethods = map[string]bool{
+	"sms":      true,
+	"app_link": true,
+}
+
+// ProvisionStore persists provisioned MFA methods, typically a
+// storage.Storage
+type ProvisionStore interface {
+	GetUser(ctx context.Context, id string) (*storage.User, error)
+	MethodStore
+}
+
+// ProvisionConfig configures BulkProvisionMFA. Use the same policy as the
+// MFA Handler so provisioned methods obey the same rules as enrolled ones.
+type ProvisionConfig struct {
+	Store        ProvisionStore
+	PhoneRegions PhoneRegions
+	Limits       MethodLimits
+}
+
+// Validate reports the first problem with the configuration
+func (c ProvisionConfig) Validate() error {
+	if c.Store == nil {
+		return errors.New("method store is required")
+	}
+	if err := c.PhoneRegions.Validate(); err != nil {
+		return err
+	}
+	return c.Limits.Validate()
+}
+
+// EnableProvisioning enables BulkProvisionMFA, which otherwise responds
+// 403
+func (h *AdminHandler) EnableProvisioning(cfg ProvisionConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid MFA provisioning config: %w", err)
+	}
+	h.provision = &cfg
+	return nil
+}
+
+// ProvisionEntry is one method to provision in a BulkProvisionRequest
+type ProvisionEntry struct {
+	UserID string `json:"user_id"`
+	Type   string `json:"type"`  // "sms" or "app_link"
+	Value  string `json:"value"` // phone number in international format, or device ID
+}
+
+// BulkProvisionRequest is the body of a BulkProvisionMFA request
+type BulkProvisionRequest struct {
+	Entries []ProvisionEntry `json:"entries"`
+}
+
+// ProvisionResult reports the outcome of one entry. MethodID is set if it
+// was provisioned; otherwise Code, Field, and Message say why not.
+type ProvisionResult struct {
+	Index    int    `json:"index"`
+	MethodID string `json:"method_id,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// BulkProvisionResponse reports the outcome of every entry, in request order
+type BulkProvisionResponse struct {
+	Provisioned int               `json:"provisioned"`
+	Failed      int               `json:"failed"`
+	Results     []ProvisionResult `json:"results"`
+}
+
+// BulkProvisionMFA provisions MFA methods for many users at once, e.g. when
+// onboarding an enterprise with known phone numbers or enrolled devices.
+// Each entry is validated and stored independently, so one bad entry
+// doesn't fail the rest; entries are not retried or rolled back.
+func (h *AdminHandler) BulkProvisionMFA(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	if h.provision == nil {
+		writeError(c, CodeDisabled, "MFA provisioning not enabled")
+		return
+	}
+
+	req, err := decodeProvisionRequest(c)
+	if err != nil {
+		writeError(c, CodeInvalidInput, sanitize.Message(c.Request.Context(), "Invalid provisioning request", err))
+		return
+	}
+	if len(req.Entries) == 0 {
+		writeFieldError(c, CodeInvalidInput, "entries", "No entries to provision")
+		return
+	}
+	if len(req.Entries) > MaxProvisionEntries {
+		writeFieldError(c, CodeInvalidInput, "entries", fmt.Sprintf("At most %d entries may be provisioned at once", MaxProvisionEntries))
+		return
+	}
+
+	ctx := c.Request.Context()
+	p := &provisioner{
+		cfg:     h.provision,
+		logger:  h.logger,
+		methods: make(map[string][]*storage.MFAMethod),
+	}
+
+	resp := BulkProvisionResponse{Results: make([]ProvisionResult, 0, len(req.Entries))}
+	for i, entry := range req.Entries {
+		result := p.provision(ctx, entry)
+		result.Index = i
+		if result.Code == "" {
+			resp.Provisioned++
+		} else {
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	h.logger.Info("Provisioned MFA methods",
+		zap.Int("provisioned", resp.Provisioned),
+		zap.Int("failed", resp.Failed))
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// provisionSchemaJSON is the JSON schema of a BulkProvisionRequest
+//
+//go:embed provision.schema.json
+var provisionSchemaJSON string
+
+var provisionSchema = jsonschema.MustCompileString("provision.schema.json", provisionSchemaJSON)
+
+// decodeProvisionRequest validates the request body against the provisioning
+// schema and decodes it
+func decodeProvisionRequest(c *gin.Context) (*BulkProvisionRequest, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if err := provisionSchema.Validate(doc); err != nil {
+		return nil, err
+	}
+
+	var req BulkProvisionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// provisioner provisions the entries of one request. It tracks each user's
+// methods, including those provisioned earlier in the request, so limits
+// and duplicates are checked across entries.
+type provisioner struct {
+	cfg     *ProvisionConfig
+	logger  *zap.Logger
+	methods map[string][]*storage.MFAMethod
+}
+
+func (p *provisioner) provision(ctx context.Context, entry ProvisionEntry) ProvisionResult {
+	userID := strings.TrimSpace(entry.UserID)
+	if userID == "" {
+		return failedEntry(CodeInvalidInput, "user_id", "Missing user ID")
+	}
+	if !provisionableMethods[entry.Type] {
+		return failedEntry(CodeInvalidInput, "type", "Method type can't be provisioned")
+	}
+
+	value, result, ok := p.value(entry)
+	if !ok {
+		return result
+	}
+
+	methods, err := p.userMethods(ctx, userID)
+	if err != nil {
+		code := storageErrorCode(err)
+		if code == CodeNotFound {
+			return failedEntry(code, "user_id", "User not found")
+		}
+		logStorageError(p.logger, "Failed to get MFA methods", err)
+		return failedEntry(code, "", "Failed to get user's MFA methods")
+	}
+
+	for _, method := range methods {
+		if method.Type == entry.Type && method.Value == value {
+			return failedEntry(CodeAlreadyExists, "value", "Method already enrolled")
+		}
+	}
+	if !p.cfg.Limits.Allows(methods, entry.Type) {
+		return failedEntry(CodeLimitReached, "type", "Maximum number of methods of this type reached")
+	}
+
+	now := time.Now()
+	method := &storage.MFAMethod{
+		UserID:    userID,
+		Type:      entry.Type,
+		Value:     value,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := p.cfg.Store.StoreMFAMethod(ctx, method); err != nil {
+		logStorageError(p.logger, "Failed to store MFA method", err)
+		return failedEntry(storageErrorCode(err), "", "Failed to store MFA method")
+	}
+
+	p.methods[userID] = append(methods, method)
+	return ProvisionResult{MethodID: method.ID}
+}
+
+// value validates and normalizes an entry's value for its method type
+func (p *provisioner) value(entry ProvisionEntry) (string, ProvisionResult, bool) {
+	switch entry.Type {
+	case "sms":
+		number, region, err := normalizePhoneNumber(entry.Value)
+		if err != nil {
+			return "", failedEntry(CodeInvalidInput, "value", "Phone number must be in international format, e.g. +14155550100"), false
+		}
+		if !p.cfg.PhoneRegions.permits(region) {
+			return "", failedEntry(CodeRegionNotAllowed, "value", "Phone numbers from this region can't be used for SMS verification"), false
+		}
+		return number, ProvisionResult{}, true
+	default:
+		deviceID := strings.TrimSpace(entry.Value)
+		if deviceID == "" {
+			return "", failedEntry(CodeInvalidInput, "value", "Missing device ID"), false
+		}
+		return deviceID, ProvisionResult{}, true
+	}
+}
+
+// userMethods returns the user's current methods, loading them the first
+// time the user is seen. A user that doesn't exist is reported as a
+// storage not-found error.
+func (p *provisioner) userMethods(ctx context.Context, userID string) ([]*storage.MFAMethod, error) {
+	if methods, ok := p.methods[userID]; ok {
+		return methods, nil
+	}
+
+	if _, err := p.cfg.Store.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	methods, err := p.cfg.Store.GetMFAMethods(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	p.methods[userID] = methods
+	return methods, nil
+}
+
+func failedEntry(code, field, message string) ProvisionResult {
+	return ProvisionResult{Code: code, Field: field, Message: message}
+}
@@ -0,0 +1,246 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// provisionStore is a ProvisionStore holding methods per user. Users not in
+// methods don't exist; failing fails every call for that user.
+type provisionStore struct {
+	methods map[string][]*storage.MFAMethod
+	failing string
+	nextID  int
+}
+
+func newProvisionStore(userIDs ...string) *provisionStore {
+	s := &provisionStore{methods: make(map[string][]*storage.MFAMethod)}
+	for _, userID := range userIDs {
+		s.methods[userID] = nil
+	}
+	return s
+}
+
+func (s *provisionStore) GetUser(ctx context.Context, id string) (*storage.User, error) {
+	if id == s.failing {
+		return nil, &storage.StorageError{Code: storage.ErrInternal, Message: "storage down"}
+	}
+	if _, ok := s.methods[id]; !ok {
+		return nil, &storage.StorageError{Code: storage.ErrNotFound, Message: "User not found"}
+	}
+	return &storage.User{ID: id}, nil
+}
+
+func (s *provisionStore) GetMFAMethods(ctx context.Context, userID string) ([]*storage.MFAMethod, error) {
+	return s.methods[userID], nil
+}
+
+func (s *provisionStore) StoreMFAMethod(ctx context.Context, method *storage.MFAMethod) error {
+	s.nextID++
+	method.ID = fmt.Sprintf("method-%d", s.nextID)
+	s.methods[method.UserID] = append(s.methods[method.UserID], method)
+	return nil
+}
+
+// postJSON calls handler with body as a JSON request
+func postJSON(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler(c)
+	return w
+}
+
+func newProvisionHandler(t *testing.T, store *provisionStore) *AdminHandler {
+	t.Helper()
+	h := NewAdminHandler(zap.NewNop(), nil, staticScopes(true))
+	err := h.EnableProvisioning(ProvisionConfig{
+		Store:        store,
+		PhoneRegions: PhoneRegions{Deny: []string{"GB"}},
+		Limits:       MethodLimits{"sms": 1},
+	})
+	if err != nil {
+		t.Fatalf("EnableProvisioning: %v", err)
+	}
+	return h
+}
+
+func TestBulkProvisionMFA(t *testing.T) {
+	store := newProvisionStore("user-1", "user-2", "user-3")
+	store.methods["user-3"] = []*storage.MFAMethod{{ID: "existing", UserID: "user-3", Type: "app_link", Value: "device-9"}}
+	store.failing = "user-broken"
+	h := newProvisionHandler(t, store)
+
+	entries := []ProvisionEntry{
+		{UserID: "user-1", Type: "sms", Value: "+1 415-555-0100"},
+		{UserID: "user-2", Type: "app_link", Value: " device-1 "},
+		{UserID: "user-1", Type: "sms", Value: "+14155550100"},
+		{UserID: "user-2", Type: "sms", Value: "+1 415-555-0101"},
+		{UserID: "user-2", Type: "sms", Value: "+1 415-555-0102"},
+		{UserID: "user-3", Type: "app_link", Value: "device-9"},
+		{UserID: "missing", Type: "sms", Value: "+1 415-555-0100"},
+		{UserID: " ", Type: "sms", Value: "+1 415-555-0100"},
+		{UserID: "user-1", Type: "totp", Value: "JBSWY3DPEHPK3PXP"},
+		{UserID: "user-3", Type: "sms", Value: "not a number"},
+		{UserID: "user-3", Type: "sms", Value: "+44 20 7946 0958"},
+		{UserID: "user-3", Type: "app_link", Value: "  "},
+		{UserID: "user-broken", Type: "app_link", Value: "device-2"},
+	}
+	want := []ProvisionResult{
+		{Index: 0},
+		{Index: 1},
+		{Index: 2, Code: CodeAlreadyExists, Field: "value"},
+		{Index: 3},
+		{Index: 4, Code: CodeLimitReached, Field: "type"},
+		{Index: 5, Code: CodeAlreadyExists, Field: "value"},
+		{Index: 6, Code: CodeNotFound, Field: "user_id"},
+		{Index: 7, Code: CodeInvalidInput, Field: "user_id"},
+		{Index: 8, Code: CodeInvalidInput, Field: "type"},
+		{Index: 9, Code: CodeInvalidInput, Field: "value"},
+		{Index: 10, Code: CodeRegionNotAllowed, Field: "value"},
+		{Index: 11, Code: CodeInvalidInput, Field: "value"},
+		{Index: 12, Code: CodeInternal},
+	}
+
+	body, err := json.Marshal(BulkProvisionRequest{Entries: entries})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	w := postJSON(h.BulkProvisionMFA, string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp BulkProvisionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+
+	if resp.Provisioned != 3 || resp.Failed != len(want)-3 {
+		t.Errorf("provisioned %d, failed %d, want 3 and %d", resp.Provisioned, resp.Failed, len(want)-3)
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(resp.Results), len(want))
+	}
+	for i, result := range resp.Results {
+		if result.Index != want[i].Index || result.Code != want[i].Code || result.Field != want[i].Field {
+			t.Errorf("result %d = %+v, want %+v", i, result, want[i])
+		}
+		if (result.MethodID != "") != (want[i].Code == "") {
+			t.Errorf("result %d method ID = %q with code %q", i, result.MethodID, result.Code)
+		}
+		if result.Code != "" && result.Message == "" {
+			t.Errorf("result %d has no message", i)
+		}
+	}
+
+	// Values are stored normalized
+	stored := map[string][]string{}
+	for userID, methods := range store.methods {
+		for _, method := range methods {
+			stored[userID] = append(stored[userID], method.Type+":"+method.Value)
+		}
+	}
+	if got := strings.Join(stored["user-1"], ","); got != "sms:+14155550100" {
+		t.Errorf("user-1 methods = %s, want sms:+14155550100", got)
+	}
+	if got := strings.Join(stored["user-2"], ","); got != "app_link:device-1,sms:+14155550101" {
+		t.Errorf("user-2 methods = %s, want app_link:device-1,sms:+14155550101", got)
+	}
+	if got := len(stored["user-3"]); got != 1 {
+		t.Errorf("user-3 has %d methods, want only the existing one", got)
+	}
+}
+
+func TestBulkProvisionMFARejected(t *testing.T) {
+	tooMany := BulkProvisionRequest{Entries: make([]ProvisionEntry, MaxProvisionEntries+1)}
+	for i := range tooMany.Entries {
+		tooMany.Entries[i] = ProvisionEntry{UserID: "user-1", Type: "app_link", Value: "device"}
+	}
+	tooManyBody, err := json.Marshal(tooMany)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		admin      bool
+		disabled   bool
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "not an admin", body: `{"entries":[]}`, wantStatus: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "not enabled", admin: true, disabled: true, body: `{"entries":[]}`, wantStatus: http.StatusForbidden, wantCode: CodeDisabled},
+		{name: "not JSON", admin: true, body: `entries`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+		{name: "missing entries", admin: true, body: `{}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+		{name: "unknown field", admin: true, body: `{"entries":[],"dry_run":true}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+		{name: "entry missing a value", admin: true, body: `{"entries":[{"user_id":"user-1","type":"sms"}]}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+		{name: "entry with a numeric value", admin: true, body: `{"entries":[{"user_id":"user-1","type":"sms","value":14155550100}]}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+		{name: "entry with an unknown field", admin: true, body: `{"entries":[{"user_id":"user-1","type":"sms","value":"+14155550100","secret":"x"}]}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+		{name: "no entries", admin: true, body: `{"entries":[]}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+		{name: "too many entries", admin: true, body: string(tooManyBody), wantStatus: http.StatusBadRequest, wantCode: CodeInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newProvisionStore("user-1")
+			h := newProvisionHandler(t, store)
+			h.scopes = staticScopes(tt.admin)
+			if tt.disabled {
+				h.provision = nil
+			}
+
+			w := postJSON(h.BulkProvisionMFA, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != tt.wantCode {
+				t.Errorf("response = %s, want code %q", w.Body.String(), tt.wantCode)
+			}
+			if len(store.methods["user-1"]) != 0 {
+				t.Errorf("stored %d methods for a rejected request", len(store.methods["user-1"]))
+			}
+		})
+	}
+}
+
+func TestEnableProvisioning(t *testing.T) {
+	store := newProvisionStore()
+
+	tests := []struct {
+		name    string
+		cfg     ProvisionConfig
+		wantErr bool
+	}{
+		{name: "minimal", cfg: ProvisionConfig{Store: store}},
+		{name: "no store", cfg: ProvisionConfig{}, wantErr: true},
+		{name: "invalid region", cfg: ProvisionConfig{Store: store, PhoneRegions: PhoneRegions{Deny: []string{"gb"}}}, wantErr: true},
+		{name: "invalid limit", cfg: ProvisionConfig{Store: store, Limits: MethodLimits{"carrier_pigeon": 1}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(zap.NewNop(), nil, staticScopes(true))
+			err := h.EnableProvisioning(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EnableProvisioning() = %v, want error %v", err, tt.wantErr)
+			}
+			if enabled := h.provision != nil; enabled == tt.wantErr {
+				t.Errorf("provisioning enabled = %v after error %v", enabled, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// randomBytes reads n bytes from the handler's random source
+func (h *Handler) randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(h.random, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// verificationCode returns a uniformly random numeric code of the given
+// number of digits
+func (h *Handler) verificationCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(h.random, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// sessionID returns a random identifier binding an SMS code to its send
+func (h *Handler) sessionID() (string, error) {
+	b, err := h.randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
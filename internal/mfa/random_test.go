@@ -0,0 +1,151 @@
+package mfa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seeded returns a deterministic random source
+func seeded(seed int64) io.Reader {
+	return mathrand.New(mathrand.NewSource(seed))
+}
+
+// failingReader fails every read
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy unavailable")
+}
+
+func TestRandomSourceDefault(t *testing.T) {
+	h, _ := newTestHandler(t, Config{})
+	if h.random != rand.Reader {
+		t.Errorf("random = %T, want crypto/rand.Reader", h.random)
+	}
+
+	a, err := h.randomBytes(20)
+	if err != nil {
+		t.Fatalf("randomBytes: %v", err)
+	}
+	b, err := h.randomBytes(20)
+	if err != nil {
+		t.Fatalf("randomBytes: %v", err)
+	}
+	if bytes.Equal(a, b) {
+		t.Errorf("randomBytes() returned %x twice", a)
+	}
+}
+
+func TestRandomSourceDeterministic(t *testing.T) {
+	outputs := func(seed int64) []string {
+		h, _ := newTestHandler(t, Config{Random: seeded(seed)})
+
+		secret, err := h.randomBytes(20)
+		if err != nil {
+			t.Fatalf("randomBytes: %v", err)
+		}
+		code, err := h.verificationCode(6)
+		if err != nil {
+			t.Fatalf("verificationCode: %v", err)
+		}
+		sessionID, err := h.sessionID()
+		if err != nil {
+			t.Fatalf("sessionID: %v", err)
+		}
+		challenge, _, err := issueAppLinkChallenge(h.random, h.appLinkKey, "user-1", "device-1", time.Unix(1700000000, 0))
+		if err != nil {
+			t.Fatalf("issueAppLinkChallenge: %v", err)
+		}
+		return []string{string(secret), code, sessionID, challenge}
+	}
+
+	first, again, other := outputs(1), outputs(1), outputs(2)
+	for i := range first {
+		if first[i] != again[i] {
+			t.Errorf("output %d differs for the same seed: %q, %q", i, first[i], again[i])
+		}
+		if first[i] == other[i] {
+			t.Errorf("output %d is the same for different seeds: %q", i, first[i])
+		}
+	}
+}
+
+func TestVerificationCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		random io.Reader
+		digits int
+		want   string
+	}{
+		{name: "zero pads", random: bytes.NewReader(make([]byte, 8)), digits: 6, want: "000000"},
+		{name: "eight digits", random: bytes.NewReader(make([]byte, 8)), digits: 8, want: "00000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{Random: tt.random})
+			got, err := h.verificationCode(tt.digits)
+			if err != nil {
+				t.Fatalf("verificationCode: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("verificationCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Codes are always the full length and numeric
+	h, _ := newTestHandler(t, Config{Random: seeded(3)})
+	for i := 0; i < 100; i++ {
+		code, err := h.verificationCode(6)
+		if err != nil {
+			t.Fatalf("verificationCode: %v", err)
+		}
+		if len(code) != 6 || strings.Trim(code, "0123456789") != "" {
+			t.Fatalf("verificationCode() = %q, want 6 digits", code)
+		}
+	}
+}
+
+func TestSetupTOTPDeterministic(t *testing.T) {
+	setup := func() TOTPSetupResponse {
+		h, _ := newTestHandler(t, Config{Random: seeded(1)})
+		w := postForm(h.SetupTOTP, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("SetupTOTP status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp TOTPSetupResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	if first, again := setup(), setup(); first.Secret != again.Secret {
+		t.Errorf("secrets differ for the same seed: %q, %q", first.Secret, again.Secret)
+	}
+}
+
+func TestRandomSourceFailure(t *testing.T) {
+	h, _ := newTestHandler(t, Config{Random: failingReader{}})
+
+	if _, err := h.randomBytes(20); err == nil {
+		t.Error("randomBytes() = nil, want error")
+	}
+	if _, err := h.verificationCode(6); err == nil {
+		t.Error("verificationCode() = nil, want error")
+	}
+
+	w := postForm(h.SetupTOTP, nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("SetupTOTP status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
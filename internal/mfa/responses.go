@@ -0,0 +1,61 @@
+package mfa
+
+import "time"
+
+// Success response bodies. Keys are snake_case like ErrorResponse; like the
+// error codes, they are part of the API and must not change once released.
+
+// MessageResponse is returned by endpoints that only confirm success
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// TOTPSetupResponse carries a new or pending TOTP setup
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	QR     string `json:"qr"` // otpauth URL to render as a QR code
+}
+
+// TOTPVerifiedResponse is returned when a code matches an enrolled TOTP
+// method
+type TOTPVerifiedResponse struct {
+	Message    string    `json:"message"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// BackupCodeVerifiedResponse is returned when a backup code is accepted.
+// Warnings lists conditions the client should prompt the user about, such
+// as WarningLowBackupCodes.
+type BackupCodeVerifiedResponse struct {
+	Message    string    `json:"message"`
+	VerifiedAt time.Time `json:"verified_at"`
+	Remaining  int       `json:"remaining"`
+	Warnings   []string  `json:"warnings,omitempty"`
+}
+
+// SMSSentResponse is returned when an SMS verification code is sent
+type SMSSentResponse struct {
+	Message   string `json:"message"`
+	SessionID string `json:"session_id"` // echoed back by VerifySMS
+}
+
+// AppLinkChallengeResponse carries a new app-link challenge
+type AppLinkChallengeResponse struct {
+	Challenge string `json:"challenge"`
+	ExpiresIn int    `json:"expires_in"` // seconds
+}
+
+// MethodsResponse lists the supported MFA method types
+type MethodsResponse struct {
+	Methods []MethodInfo `json:"methods"`
+}
+
+// TempValuesResponse lists a user's outstanding temporary values
+type TempValuesResponse struct {
+	Values []TempValue `json:"values"`
+}
+
+// PurgeResponse reports how many temporary values were purged
+type PurgeResponse struct {
+	Purged int `json:"purged"`
+}
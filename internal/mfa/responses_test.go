@@ -0,0 +1,79 @@
+package mfa
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// jsonKeys returns the sorted top-level keys v encodes to
+func jsonKeys(t *testing.T, v interface{}) []string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal %s: %v", data, err)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestResponseKeys(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{name: "message", value: MessageResponse{Message: "ok"}, want: []string{"message"}},
+		{name: "TOTP setup", value: TOTPSetupResponse{Secret: "s", QR: "otpauth://"}, want: []string{"qr", "secret"}},
+		{name: "TOTP verified", value: TOTPVerifiedResponse{Message: "ok", VerifiedAt: now}, want: []string{"message", "verified_at"}},
+		{
+			name:  "backup code verified",
+			value: BackupCodeVerifiedResponse{Message: "ok", VerifiedAt: now, Remaining: 2, Warnings: []string{WarningLowBackupCodes}},
+			want:  []string{"message", "remaining", "verified_at", "warnings"},
+		},
+		{
+			name:  "backup code verified without warnings",
+			value: BackupCodeVerifiedResponse{Message: "ok", VerifiedAt: now},
+			want:  []string{"message", "remaining", "verified_at"},
+		},
+		{name: "SMS sent", value: SMSSentResponse{Message: "ok", SessionID: "s1"}, want: []string{"message", "session_id"}},
+		{name: "app-link challenge", value: AppLinkChallengeResponse{Challenge: "c", ExpiresIn: 300}, want: []string{"challenge", "expires_in"}},
+		{name: "methods", value: MethodsResponse{}, want: []string{"methods"}},
+		{name: "method", value: MethodInfo{Type: "totp"}, want: []string{"enabled", "requires_phone", "setup_returns_qr", "supports_backup", "type"}},
+		{name: "temp values", value: TempValuesResponse{}, want: []string{"values"}},
+		{
+			name:  "temp value",
+			value: TempValue{TempValueInfo: storage.TempValueInfo{Key: "totp_setup:user-1", ExpiresAt: now}, Value: "v"},
+			want:  []string{"expires_at", "key", "value"},
+		},
+		{name: "purge", value: PurgeResponse{}, want: []string{"purged"}},
+		{name: "error", value: ErrorResponse{Code: CodeInvalidCode, Message: "m"}, want: []string{"code", "message"}},
+		{
+			name:  "server error",
+			value: ErrorResponse{Code: CodeInternal, Message: "m", Field: "f", CorrelationID: "c"},
+			want:  []string{"code", "correlation_id", "field", "message"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonKeys(t, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
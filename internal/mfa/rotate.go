@@ -0,0 +1,188 @@
+package mfa
+
+import (
+	"context"
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// RotateTOTP starts replacing the secret of an enrolled TOTP method. The new
+// secret is pending until ConfirmTOTPRotation verifies a code from it, and
+// the old secret keeps working until then, so the user is never left
+// without a factor. The method_id form value selects the method when the
+// user has more than one.
+func (h *Handler) RotateTOTP(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if !h.methodEnabled(c, FeatureTOTP, userID) {
+		return
+	}
+
+	method, ok := h.totpMethod(c, userID, c.PostForm("method_id"))
+	if !ok {
+		return
+	}
+
+	secret, err := h.randomBytes(20)
+	if err != nil {
+		h.logger.Error("Failed to generate TOTP secret", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to rotate TOTP")
+		return
+	}
+
+	key, err := h.totpKey(userID, base32.StdEncoding.EncodeToString(secret))
+	if err != nil {
+		h.logger.Error("Failed to generate TOTP key", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to rotate TOTP")
+		return
+	}
+
+	// Starting another rotation replaces any pending one
+	if err := h.storePendingRotation(c.Request.Context(), userID, method.ID, key.Secret()); err != nil {
+		logStorageError(h.logger, "Failed to store TOTP rotation", err)
+		writeStorageError(c, err, "Failed to rotate TOTP")
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPSetupResponse{
+		Secret: key.Secret(),
+		QR:     key.URL(),
+	})
+}
+
+// ConfirmTOTPRotation verifies a code from the pending secret and swaps it
+// into the method in a single update
+func (h *Handler) ConfirmTOTPRotation(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if !h.methodEnabled(c, FeatureTOTP, userID) {
+		return
+	}
+	code, ok := requiredForm(c, "code", "Missing code")
+	if !ok {
+		return
+	}
+	if !h.withinAttemptLimit(c, userID, "totp") {
+		return
+	}
+	ctx := c.Request.Context()
+
+	methodID, secret, err := h.getPendingRotation(ctx, userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to get TOTP rotation", err)
+		writeStorageError(c, err, "Failed to complete TOTP rotation")
+		return
+	}
+	if secret == "" {
+		writeError(c, CodeSetupNotFound, "No TOTP rotation in progress")
+		return
+	}
+
+	// Validate as a fresh method so the matched step and drift carry over
+	rotated := &storage.MFAMethod{Algorithm: h.totpAlg.String()}
+	step, drift, valid := validateTOTPWithDrift(rotated, secret, code, time.Now())
+	if !valid {
+		h.rejectCode(c, userID, "totp", "code", "Invalid TOTP code")
+		return
+	}
+
+	unlock, err := h.lockEnrollment(ctx, userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to lock TOTP enrollment", err)
+		writeStorageError(c, err, "Failed to complete TOTP rotation")
+		return
+	}
+	defer unlock()
+
+	// Reload under the lock in case the method was removed meanwhile
+	method, ok := h.totpMethod(c, userID, methodID)
+	if !ok {
+		return
+	}
+
+	sealed, keyID, err := h.secrets.Encrypt(secret, userID, method.ID)
+	if err != nil {
+		h.logger.Error("Failed to encrypt TOTP secret", zap.Error(err))
+		writeError(c, CodeInternal, "Failed to complete TOTP rotation")
+		return
+	}
+
+	method.Value = sealed
+	method.KeyID = keyID
+	method.Algorithm = rotated.Algorithm
+	method.DriftSteps = drift
+	method.LastUsedStep = step
+	method.UpdatedAt = time.Now()
+	if err := h.methods.StoreMFAMethod(ctx, method); err != nil {
+		logStorageError(h.logger, "Failed to store rotated TOTP secret", err)
+		writeStorageError(c, err, "Failed to complete TOTP rotation")
+		return
+	}
+
+	h.resetAttempts(ctx, userID, "totp")
+
+	if err := h.temp.DeleteTemporaryValue(ctx, totpRotationKey(userID)); err != nil {
+		h.logger.Warn("Failed to delete TOTP rotation", zap.Error(err))
+	}
+
+	h.logger.Info("Rotated TOTP secret",
+		zap.String("user_id", userID),
+		zap.String("method_id", method.ID))
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "TOTP rotation completed"})
+}
+
+// totpMethod returns the user's TOTP method with the given ID, or their only
+// TOTP method if methodID is empty, writing an error response if there is
+// no such method
+func (h *Handler) totpMethod(c *gin.Context, userID, methodID string) (*storage.MFAMethod, bool) {
+	methods, err := h.methods.GetMFAMethods(c.Request.Context(), userID)
+	if err != nil {
+		logStorageError(h.logger, "Failed to get MFA methods", err)
+		writeStorageError(c, err, "Failed to get TOTP method")
+		return nil, false
+	}
+
+	var found []*storage.MFAMethod
+	for _, method := range methods {
+		if method.Type == "totp" && (methodID == "" || method.ID == methodID) {
+			found = append(found, method)
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		writeError(c, CodeNotFound, "No TOTP method enrolled")
+		return nil, false
+	case len(found) > 1:
+		writeFieldError(c, CodeInvalidInput, "method_id", "Several TOTP methods enrolled; method ID required")
+		return nil, false
+	}
+	return found[0], true
+}
+
+// storePendingRotation stores a rotation's new secret with the method it
+// replaces
+func (h *Handler) storePendingRotation(ctx context.Context, userID, methodID, secret string) error {
+	return h.temp.StoreTemporaryValue(ctx, totpRotationKey(userID), methodID+":"+secret, totpSetupTTL)
+}
+
+// getPendingRotation returns the method and new secret of the rotation in
+// progress, or empty strings if there is none
+func (h *Handler) getPendingRotation(ctx context.Context, userID string) (methodID, secret string, err error) {
+	value, err := h.getTemporaryValue(ctx, totpRotationKey(userID))
+	if err != nil || value == "" {
+		return "", "", err
+	}
+
+	methodID, secret, ok := strings.Cut(value, ":")
+	if !ok {
+		return "", "", nil
+	}
+	return methodID, secret, nil
+}
@@ -0,0 +1,119 @@
+package mfa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// TestRotateTOTP checks that the old secret keeps verifying until a code
+// from the new one confirms the rotation, and stops verifying after
+func TestRotateTOTP(t *testing.T) {
+	h, _ := newTestHandler(t, Config{})
+	methods := &methodList{methods: []storage.MFAMethod{{ID: "mfa-1", Type: "totp", Value: testTOTPSecret}}}
+	h.methods = methods
+
+	codeFor := func(secret string, at time.Time) url.Values {
+		t.Helper()
+		code, err := totp.GenerateCodeCustom(secret, at, totpValidateOpts(h.totpAlg, 0))
+		if err != nil {
+			t.Fatalf("GenerateCodeCustom: %v", err)
+		}
+		return url.Values{"code": {code}}
+	}
+	expect := func(step string, w *httptest.ResponseRecorder, want int) {
+		t.Helper()
+		if w.Code != want {
+			t.Fatalf("%s: status = %d, want %d: %s", step, w.Code, want, w.Body.String())
+		}
+	}
+
+	w := postForm(h.RotateTOTP, nil)
+	expect("rotate", w, http.StatusOK)
+	var rotation TOTPSetupResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rotation); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+	if rotation.Secret == testTOTPSecret {
+		t.Fatal("rotation reused the old secret")
+	}
+
+	now := time.Now()
+	// While the rotation is pending only the old secret verifies
+	expect("new secret before confirming", postForm(h.VerifyExistingTOTP, codeFor(rotation.Secret, now)), http.StatusUnauthorized)
+	expect("old secret before confirming", postForm(h.VerifyExistingTOTP, codeFor(testTOTPSecret, now)), http.StatusOK)
+
+	// A code from the old secret can't confirm the rotation
+	expect("confirm with the old secret", postForm(h.ConfirmTOTPRotation, codeFor(testTOTPSecret, now)), http.StatusUnauthorized)
+	if methods.methods[0].Value != testTOTPSecret {
+		t.Fatal("failed confirmation replaced the secret")
+	}
+
+	expect("confirm", postForm(h.ConfirmTOTPRotation, codeFor(rotation.Secret, now)), http.StatusOK)
+	if len(methods.methods) != 1 || methods.methods[0].ID != "mfa-1" {
+		t.Fatalf("methods = %+v, want mfa-1 updated in place", methods.methods)
+	}
+
+	// Codes for the next step avoid replay rejection of the confirmed step
+	next := now.Add(totpPeriod * time.Second)
+	expect("old secret after confirming", postForm(h.VerifyExistingTOTP, codeFor(testTOTPSecret, next)), http.StatusUnauthorized)
+	expect("new secret after confirming", postForm(h.VerifyExistingTOTP, codeFor(rotation.Secret, next)), http.StatusOK)
+
+	// The rotation is used up
+	w = postForm(h.ConfirmTOTPRotation, codeFor(rotation.Secret, next))
+	expect("confirm again", w, http.StatusBadRequest)
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != CodeSetupNotFound {
+		t.Errorf("response = %s, want code %q", w.Body.String(), CodeSetupNotFound)
+	}
+}
+
+func TestRotateTOTPWithoutMethod(t *testing.T) {
+	tests := []struct {
+		name       string
+		methods    []storage.MFAMethod
+		form       url.Values
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "no TOTP method", methods: []storage.MFAMethod{{ID: "mfa-1", Type: "sms"}}, wantStatus: http.StatusNotFound, wantCode: CodeNotFound},
+		{name: "unknown method ID", methods: []storage.MFAMethod{{ID: "mfa-1", Type: "totp"}}, form: url.Values{"method_id": {"mfa-2"}}, wantStatus: http.StatusNotFound, wantCode: CodeNotFound},
+		{
+			name:       "several TOTP methods",
+			methods:    []storage.MFAMethod{{ID: "mfa-1", Type: "totp"}, {ID: "mfa-2", Type: "totp"}},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   CodeInvalidInput,
+		},
+		{
+			name:       "several TOTP methods with a method ID",
+			methods:    []storage.MFAMethod{{ID: "mfa-1", Type: "totp"}, {ID: "mfa-2", Type: "totp"}},
+			form:       url.Values{"method_id": {"mfa-2"}},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{})
+			h.methods = &methodList{methods: tt.methods}
+
+			w := postForm(h.RotateTOTP, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != tt.wantCode {
+					t.Errorf("response = %s, want code %q", w.Body.String(), tt.wantCode)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package mfa
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSecretCipher(t *testing.T) {
+	keys := map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}
+	otherKeys := map[string][]byte{"k1": bytes.Repeat([]byte{3}, 32)}
+
+	// Each case opens a secret sealed with k1 for user-1's mfa-1
+	tests := []struct {
+		name      string
+		activeKey string
+		keys      map[string][]byte
+		keyID     string
+		userID    string
+		methodID  string
+		tamper    bool
+		wantErr   bool
+		wantIs    error
+	}{
+		{name: "round trip", activeKey: "k1", keys: keys, keyID: "k1", userID: "user-1", methodID: "mfa-1"},
+		{name: "after rotating the active key", activeKey: "k2", keys: keys, keyID: "k1", userID: "user-1", methodID: "mfa-1"},
+		{name: "wrong key ID", activeKey: "k1", keys: keys, keyID: "k2", userID: "user-1", methodID: "mfa-1", wantErr: true},
+		{name: "wrong key material", activeKey: "k1", keys: otherKeys, keyID: "k1", userID: "user-1", methodID: "mfa-1", wantErr: true},
+		{name: "unknown key ID", activeKey: "k1", keys: keys, keyID: "k9", userID: "user-1", methodID: "mfa-1", wantErr: true, wantIs: ErrUnknownKeyID},
+		{name: "another user", activeKey: "k1", keys: keys, keyID: "k1", userID: "user-2", methodID: "mfa-1", wantErr: true},
+		{name: "another method", activeKey: "k1", keys: keys, keyID: "k1", userID: "user-1", methodID: "mfa-2", wantErr: true},
+		{name: "fields shifted between user and method", activeKey: "k1", keys: keys, keyID: "k1", userID: "user-1m", methodID: "fa-1", wantErr: true},
+		{name: "tampered ciphertext", activeKey: "k1", keys: keys, keyID: "k1", userID: "user-1", methodID: "mfa-1", tamper: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealer, err := NewSecretCipher("k1", keys)
+			if err != nil {
+				t.Fatalf("NewSecretCipher: %v", err)
+			}
+			ciphertext, keyID, err := sealer.Encrypt("JBSWY3DPEHPK3PXP", "user-1", "mfa-1")
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if keyID != "k1" {
+				t.Errorf("Encrypt() key ID = %q, want k1", keyID)
+			}
+			if tt.tamper {
+				ciphertext = "AAAA" + ciphertext[4:]
+			}
+
+			opener, err := NewSecretCipher(tt.activeKey, tt.keys)
+			if err != nil {
+				t.Fatalf("NewSecretCipher: %v", err)
+			}
+			plaintext, err := opener.Decrypt(ciphertext, tt.keyID, tt.userID, tt.methodID)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Decrypt() = %q, want an error", plaintext)
+				}
+				if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+					t.Errorf("Decrypt() error = %v, want %v", err, tt.wantIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if plaintext != "JBSWY3DPEHPK3PXP" {
+				t.Errorf("Decrypt() = %q, want the original secret", plaintext)
+			}
+		})
+	}
+}
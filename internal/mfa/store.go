@@ -0,0 +1,127 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+const (
+	// totpSetupTTL bounds how long a TOTP setup waits for its first code
+	totpSetupTTL = 10 * time.Minute
+
+	// smsCodeTTL bounds how long a sent SMS code can be verified
+	smsCodeTTL = 5 * time.Minute
+)
+
+// TempStore holds short-lived MFA state such as pending TOTP secrets, SMS
+// codes, and used app-link nonces. Missing or expired keys must return a
+// storage.StorageError with code storage.ErrNotFound. Single-use values are
+// consumed with its atomic operations.
+type TempStore interface {
+	StoreTemporaryValue(ctx context.Context, key string, value string, expiry time.Duration) error
+	GetTemporaryValue(ctx context.Context, key string) (string, error)
+	DeleteTemporaryValue(ctx context.Context, key string) error
+	storage.AtomicTempStore
+}
+
+// MethodStore holds users' enrolled MFA methods, typically a
+// storage.Storage. StoreMFAMethod also updates an existing method.
+type MethodStore interface {
+	GetMFAMethods(ctx context.Context, userID string) ([]*storage.MFAMethod, error)
+	StoreMFAMethod(ctx context.Context, method *storage.MFAMethod) error
+}
+
+var (
+	_ TempStore = (*storage.NoSQLStorage)(nil)
+	_ TempStore = (*storage.MemoryStore)(nil)
+	_ TempStore = (*storage.RedisCache)(nil)
+
+	_ MethodStore = (*storage.NoSQLStorage)(nil)
+	_ MethodStore = (*storage.MemoryStore)(nil)
+)
+
+// isNotFound reports whether err is a storage not-found error
+func isNotFound(err error) bool {
+	var storageErr *storage.StorageError
+	return errors.As(err, &storageErr) && storageErr.Code == storage.ErrNotFound
+}
+
+// getTemporaryValue reads a temporary value, returning "" if it is missing
+// or expired
+func (h *Handler) getTemporaryValue(ctx context.Context, key string) (string, error) {
+	value, err := h.temp.GetTemporaryValue(ctx, key)
+	if isNotFound(err) {
+		return "", nil
+	}
+	return value, err
+}
+
+// storeTemporarySecret stores a TOTP secret awaiting its first code
+func (h *Handler) storeTemporarySecret(ctx context.Context, userID, secret string) error {
+	return h.temp.StoreTemporaryValue(ctx, totpSetupKey(userID), secret, totpSetupTTL)
+}
+
+// getTemporarySecret returns the pending TOTP secret, or "" if no setup is
+// in progress
+func (h *Handler) getTemporarySecret(ctx context.Context, userID string) (string, error) {
+	return h.getTemporaryValue(ctx, totpSetupKey(userID))
+}
+
+// storeSMSVerificationCode stores the code and its send session under a single
+// user+phone record, so a new send invalidates any previously outstanding code
+func (h *Handler) storeSMSVerificationCode(ctx context.Context, userID, phoneNumber, sessionID, code string) error {
+	return h.temp.StoreTemporaryValue(ctx, smsCodeKey(userID, phoneNumber), sessionID+":"+code, smsCodeTTL)
+}
+
+// getSMSVerificationCode returns the latest send's session and code, or
+// empty strings if none is outstanding
+func (h *Handler) getSMSVerificationCode(ctx context.Context, userID, phoneNumber string) (sessionID, code string, err error) {
+	value, err := h.getTemporaryValue(ctx, smsCodeKey(userID, phoneNumber))
+	if err != nil || value == "" {
+		return "", "", err
+	}
+
+	sessionID, code, ok := strings.Cut(value, ":")
+	if !ok {
+		return "", "", nil
+	}
+	return sessionID, code, nil
+}
+
+// verifySMSCode accepts the code only if sessionID matches the latest send.
+// An accepted code is deleted, conditionally on it still being the latest,
+// so it verifies once even when submitted concurrently.
+func (h *Handler) verifySMSCode(ctx context.Context, userID, phoneNumber, sessionID, code string) (bool, error) {
+	storedSession, storedCode, err := h.getSMSVerificationCode(ctx, userID, phoneNumber)
+	if err != nil {
+		return false, err
+	}
+	if storedCode == "" {
+		return false, nil
+	}
+
+	// Compare both so a session mismatch takes as long as a code mismatch
+	sessionOK := secureCompare(sessionID, storedSession)
+	codeOK := secureCompare(code, storedCode)
+	if !sessionOK || !codeOK {
+		return false, nil
+	}
+
+	return h.temp.SwapTemporaryValue(ctx, smsCodeKey(userID, phoneNumber), storedSession+":"+storedCode, "", 0)
+}
+
+// consumeAppLinkNonce records a challenge nonce as used until the challenge
+// expires, reporting false if it was already used. The record is created
+// only if absent, so of two verifications racing on the same nonce exactly
+// one succeeds.
+func (h *Handler) consumeAppLinkNonce(ctx context.Context, userID, nonce string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	return h.temp.StoreTemporaryValueIfAbsent(ctx, appLinkNonceKey(userID, nonce), "1", ttl)
+}
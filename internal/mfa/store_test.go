@@ -0,0 +1,325 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+func newTestTempHandler(t *testing.T) *Handler {
+	t.Helper()
+	store := storage.NewMemoryStore(0)
+	t.Cleanup(store.Close)
+	return &Handler{logger: zap.NewNop(), temp: store}
+}
+
+func TestVerifySMSCode(t *testing.T) {
+	const phone = "+14155550100"
+
+	type send struct{ session, code string }
+	tests := []struct {
+		name    string
+		sends   []send
+		session string
+		code    string
+		want    bool
+	}{
+		{name: "latest send", sends: []send{{"s1", "111111"}}, session: "s1", code: "111111", want: true},
+		{name: "nothing sent", session: "s1", code: "111111"},
+		{name: "wrong code", sends: []send{{"s1", "111111"}}, session: "s1", code: "222222"},
+		{name: "wrong session", sends: []send{{"s1", "111111"}}, session: "s2", code: "111111"},
+		{name: "old code after a new send", sends: []send{{"s1", "111111"}, {"s2", "222222"}}, session: "s1", code: "111111"},
+		{name: "old code with the new session", sends: []send{{"s1", "111111"}, {"s2", "222222"}}, session: "s2", code: "111111"},
+		{name: "new code after a new send", sends: []send{{"s1", "111111"}, {"s2", "222222"}}, session: "s2", code: "222222", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestTempHandler(t)
+			ctx := context.Background()
+
+			for _, s := range tt.sends {
+				if err := h.storeSMSVerificationCode(ctx, "user-1", phone, s.session, s.code); err != nil {
+					t.Fatalf("storeSMSVerificationCode: %v", err)
+				}
+			}
+
+			valid, err := h.verifySMSCode(ctx, "user-1", phone, tt.session, tt.code)
+			if err != nil {
+				t.Fatalf("verifySMSCode: %v", err)
+			}
+			if valid != tt.want {
+				t.Errorf("verifySMSCode() = %v, want %v", valid, tt.want)
+			}
+
+			// A verified code is used up
+			if valid {
+				again, err := h.verifySMSCode(ctx, "user-1", phone, tt.session, tt.code)
+				if err != nil {
+					t.Fatalf("verifySMSCode: %v", err)
+				}
+				if again {
+					t.Error("verifySMSCode() accepted a code twice")
+				}
+			}
+		})
+	}
+}
+
+func TestConsumeAppLinkNonce(t *testing.T) {
+	h := newTestTempHandler(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name      string
+		userID    string
+		nonce     string
+		expiresAt time.Time
+		want      bool
+	}{
+		{name: "fresh nonce", userID: "user-1", nonce: "n1", expiresAt: expiresAt, want: true},
+		{name: "used nonce", userID: "user-1", nonce: "n1", expiresAt: expiresAt},
+		{name: "same nonce for another user", userID: "user-2", nonce: "n1", expiresAt: expiresAt, want: true},
+		{name: "expired challenge", userID: "user-1", nonce: "n2", expiresAt: time.Now().Add(-time.Second)},
+	}
+
+	// Cases run in order against one store
+	for _, tt := range tests {
+		fresh, err := h.consumeAppLinkNonce(ctx, tt.userID, tt.nonce, tt.expiresAt)
+		if err != nil {
+			t.Fatalf("%s: consumeAppLinkNonce: %v", tt.name, err)
+		}
+		if fresh != tt.want {
+			t.Errorf("%s: consumeAppLinkNonce() = %v, want %v", tt.name, fresh, tt.want)
+		}
+	}
+}
+
+func TestConsumeAppLinkNonceConcurrent(t *testing.T) {
+	h := newTestTempHandler(t)
+	expiresAt := time.Now().Add(time.Minute)
+
+	var wg sync.WaitGroup
+	var fresh atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := h.consumeAppLinkNonce(context.Background(), "user-1", "n1", expiresAt)
+			if err != nil {
+				t.Errorf("consumeAppLinkNonce: %v", err)
+			}
+			if ok {
+				fresh.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := fresh.Load(); n != 1 {
+		t.Errorf("%d verifications consumed the nonce, want 1", n)
+	}
+}
+
+// docClient is an in-memory NoSQL client with conditional writes. Items
+// round-trip through JSON like a real document store.
+type docClient struct {
+	mu    sync.Mutex
+	items map[string]map[string]interface{}
+}
+
+func (c *docClient) encode(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var item map[string]interface{}
+	return item, json.Unmarshal(data, &item)
+}
+
+func (c *docClient) Put(ctx context.Context, table, key string, value interface{}) error {
+	item, err := c.encode(value)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = item
+	return nil
+}
+
+func (c *docClient) Get(ctx context.Context, table, key string) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items[key], nil
+}
+
+func (c *docClient) Query(ctx context.Context, table, index, condition string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (c *docClient) Delete(ctx context.Context, table, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+	return nil
+}
+
+func (c *docClient) CreateIndex(ctx context.Context, table, index string, fields []string) error {
+	return nil
+}
+
+func (c *docClient) PutIfAbsent(ctx context.Context, table, key string, value interface{}) (bool, error) {
+	item, err := c.encode(value)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok {
+		return false, nil
+	}
+	c.items[key] = item
+	return true, nil
+}
+
+func (c *docClient) DeleteIf(ctx context.Context, table, key, field string, expected interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[key]
+	if !ok || item[field] != expected {
+		return false, nil
+	}
+	delete(c.items, key)
+	return true, nil
+}
+
+func (c *docClient) PutIf(ctx context.Context, table, key string, value interface{}, field string, expected interface{}) (bool, error) {
+	item, err := c.encode(value)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, ok := c.items[key]
+	if !ok || current[field] != expected {
+		return false, nil
+	}
+	c.items[key] = item
+	return true, nil
+}
+
+// tempBackends opens each TempStore implementation MFA runs against
+var tempBackends = []struct {
+	name string
+	open func(t *testing.T) TempStore
+}{
+	{
+		name: "memory",
+		open: func(t *testing.T) TempStore {
+			store := storage.NewMemoryStore(0)
+			t.Cleanup(store.Close)
+			return store
+		},
+	},
+	{
+		name: "redis",
+		open: func(t *testing.T) TempStore {
+			server := miniredis.RunT(t)
+			cache, err := storage.NewRedisCache(storage.RedisConfig{Options: &redis.Options{Addr: server.Addr()}}, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewRedisCache: %v", err)
+			}
+			return cache
+		},
+	},
+	{
+		name: "nosql",
+		open: func(t *testing.T) TempStore {
+			store, err := storage.NewNoSQLStorage(&docClient{items: make(map[string]map[string]interface{})}, zap.NewNop(), storage.NoSQLConfig{TableName: "auth"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			return store
+		},
+	},
+}
+
+func TestTempStoreBackends(t *testing.T) {
+	const phone = "+14155550100"
+
+	for _, backend := range tempBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			h := &Handler{logger: zap.NewNop(), temp: backend.open(t)}
+			ctx := context.Background()
+
+			// Pending TOTP setup
+			secret, err := h.getTemporarySecret(ctx, "user-1")
+			if err != nil || secret != "" {
+				t.Fatalf("getTemporarySecret() before setup = %q, %v, want none", secret, err)
+			}
+			if err := h.storeTemporarySecret(ctx, "user-1", testTOTPSecret); err != nil {
+				t.Fatalf("storeTemporarySecret: %v", err)
+			}
+			secret, err = h.getTemporarySecret(ctx, "user-1")
+			if err != nil || secret != testTOTPSecret {
+				t.Fatalf("getTemporarySecret() = %q, %v, want %q", secret, err, testTOTPSecret)
+			}
+
+			// SMS codes verify once, and only the latest send
+			for _, s := range [][2]string{{"s1", "111111"}, {"s2", "222222"}} {
+				if err := h.storeSMSVerificationCode(ctx, "user-1", phone, s[0], s[1]); err != nil {
+					t.Fatalf("storeSMSVerificationCode: %v", err)
+				}
+			}
+			for _, c := range []struct {
+				session, code string
+				want          bool
+			}{
+				{"s1", "111111", false},
+				{"s2", "222222", true},
+				{"s2", "222222", false},
+			} {
+				valid, err := h.verifySMSCode(ctx, "user-1", phone, c.session, c.code)
+				if err != nil {
+					t.Fatalf("verifySMSCode: %v", err)
+				}
+				if valid != c.want {
+					t.Errorf("verifySMSCode(%s, %s) = %v, want %v", c.session, c.code, valid, c.want)
+				}
+			}
+
+			// App-link nonces are single use, even under concurrent verification
+			expiresAt := time.Now().Add(time.Minute)
+			var wg sync.WaitGroup
+			var fresh atomic.Int32
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := h.consumeAppLinkNonce(ctx, "user-1", "n1", expiresAt)
+					if err != nil {
+						t.Errorf("consumeAppLinkNonce: %v", err)
+					}
+					if ok {
+						fresh.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if n := fresh.Load(); n != 1 {
+				t.Errorf("%d verifications consumed the nonce, want 1", n)
+			}
+		})
+	}
+}
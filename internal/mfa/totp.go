@@ -0,0 +1,113 @@
+package mfa
+
+import (
+	"context"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+const (
+	// totpPeriod is the TOTP time step
+	totpPeriod = 30
+	// maxDriftSteps caps how far a learned clock drift may move the
+	// validation window (10 steps is 5 minutes)
+	maxDriftSteps = 10
+)
+
+// verifyStoredTOTP validates a code against an enrolled TOTP method and
+// persists any change to its learned drift. A code is rejected if its time
+// step is not later than the last accepted one, so an intercepted code can't
+// be replayed within its validity window. The caller must hold the user's
+// enrollment lock so the check and the update of the used step are atomic.
+func (h *Handler) verifyStoredTOTP(ctx context.Context, method *storage.MFAMethod, code string) (bool, error) {
+	secret, err := h.totpSecret(method)
+	if err != nil {
+		return false, err
+	}
+
+	step, drift, valid := validateTOTPWithDrift(method, secret, code, time.Now())
+	if !valid {
+		return false, nil
+	}
+	if step <= method.LastUsedStep {
+		h.logger.Warn("Rejected replayed TOTP code", zap.String("method_id", method.ID))
+		return false, nil
+	}
+
+	// Replay protection depends on the used step being persisted. A replayed
+	// code must not move the drift, so it is only learned from accepted ones.
+	method.LastUsedStep = step
+	method.DriftSteps = drift
+	method.UpdatedAt = time.Now()
+	if err := h.methods.StoreMFAMethod(ctx, method); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// validateTOTPWithDrift validates code against secret, centring a one-step
+// window on the method's learned drift rather than on the server clock.
+// It returns the time step the code matched, the offset it matched at, and
+// whether it is valid. Once the code is accepted the offset becomes the
+// method's new drift, so a device that consistently runs fast or slow is
+// tracked over time without widening the window.
+func validateTOTPWithDrift(method *storage.MFAMethod, secret string, code string, now time.Time) (step int64, drift int, valid bool) {
+	learned := clampDrift(method.DriftSteps)
+
+	// Try the learned drift first, then one step either side of it
+	for _, offset := range []int{learned, learned - 1, learned + 1} {
+		if offset < -maxDriftSteps || offset > maxDriftSteps {
+			continue
+		}
+
+		at := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		ok, err := totp.ValidateCustom(code, secret, at, totpValidateOpts(methodAlgorithm(method), 0))
+		if err != nil || !ok {
+			continue
+		}
+
+		return at.Unix() / totpPeriod, offset, true
+	}
+
+	return 0, 0, false
+}
+
+// totpValidateOpts returns the validation options for the given algorithm
+// and skew, in time steps
+func totpValidateOpts(alg otp.Algorithm, skew uint) totp.ValidateOpts {
+	return totp.ValidateOpts{
+		Period:    totpPeriod,
+		Skew:      skew,
+		Digits:    otp.DigitsSix,
+		Algorithm: alg,
+	}
+}
+
+// methodAlgorithm returns the algorithm a TOTP method was enrolled with.
+// Methods without one predate configurable algorithms and use SHA1.
+func methodAlgorithm(method *storage.MFAMethod) otp.Algorithm {
+	switch method.Algorithm {
+	case otp.AlgorithmSHA256.String():
+		return otp.AlgorithmSHA256
+	case otp.AlgorithmSHA512.String():
+		return otp.AlgorithmSHA512
+	default:
+		return otp.AlgorithmSHA1
+	}
+}
+
+func clampDrift(drift int) int {
+	if drift > maxDriftSteps {
+		return maxDriftSteps
+	}
+	if drift < -maxDriftSteps {
+		return -maxDriftSteps
+	}
+	return drift
+}
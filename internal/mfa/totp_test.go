@@ -0,0 +1,341 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// testTOTPCode returns the code for testTOTPSecret at the given time
+func testTOTPCode(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(testTOTPSecret, at, totpValidateOpts(otp.AlgorithmSHA1, 0))
+	if err != nil {
+		t.Fatalf("GenerateCodeCustom: %v", err)
+	}
+	return code
+}
+
+func TestValidateTOTPWithDrift(t *testing.T) {
+	now := time.Now()
+	step := time.Duration(totpPeriod) * time.Second
+
+	tests := []struct {
+		name      string
+		learned   int
+		offset    int // device clock offset, in steps
+		wantValid bool
+		wantDrift int
+	}{
+		{name: "in sync", offset: 0, wantValid: true},
+		{name: "one step ahead", offset: 1, wantValid: true, wantDrift: 1},
+		{name: "one step behind", offset: -1, wantValid: true, wantDrift: -1},
+		{name: "offset device without learned drift", offset: 3},
+		{name: "offset device with learned drift", learned: 3, offset: 3, wantValid: true, wantDrift: 3},
+		{name: "learned drift moves by one", learned: 3, offset: 4, wantValid: true, wantDrift: 4},
+		{name: "window stays tight around learned drift", learned: 3, offset: 0},
+		{name: "window stays tight on the other side", learned: 3, offset: 5},
+		{name: "learned drift is clamped", learned: 50, offset: maxDriftSteps, wantValid: true, wantDrift: maxDriftSteps},
+		{name: "beyond the maximum drift", learned: maxDriftSteps, offset: maxDriftSteps + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := &storage.MFAMethod{Type: "totp", DriftSteps: tt.learned}
+			code := testTOTPCode(t, now.Add(time.Duration(tt.offset)*step))
+
+			gotStep, drift, valid := validateTOTPWithDrift(method, testTOTPSecret, code, now)
+			if valid != tt.wantValid {
+				t.Fatalf("validateTOTPWithDrift() valid = %v, want %v", valid, tt.wantValid)
+			}
+			if !valid {
+				return
+			}
+			if drift != tt.wantDrift {
+				t.Errorf("validateTOTPWithDrift() drift = %d, want %d", drift, tt.wantDrift)
+			}
+			if want := now.Add(time.Duration(tt.offset)*step).Unix() / totpPeriod; gotStep != want {
+				t.Errorf("validateTOTPWithDrift() step = %d, want %d", gotStep, want)
+			}
+		})
+	}
+}
+
+func TestTOTPDriftLearning(t *testing.T) {
+	now := time.Now()
+	step := time.Duration(totpPeriod) * time.Second
+	method := &storage.MFAMethod{Type: "totp"}
+
+	// A device whose clock runs further ahead over time is followed one
+	// step at a time
+	for offset := 1; offset <= 4; offset++ {
+		code := testTOTPCode(t, now.Add(time.Duration(offset)*step))
+		_, drift, valid := validateTOTPWithDrift(method, testTOTPSecret, code, now)
+		if !valid {
+			t.Fatalf("offset %d: code rejected with learned drift %d", offset, method.DriftSteps)
+		}
+		method.DriftSteps = drift
+	}
+	if method.DriftSteps != 4 {
+		t.Fatalf("learned drift = %d, want 4", method.DriftSteps)
+	}
+
+	// The learned drift doesn't widen the window: a code from the server's
+	// own clock is now out of range
+	if _, _, valid := validateTOTPWithDrift(method, testTOTPSecret, testTOTPCode(t, now), now); valid {
+		t.Error("code at the server clock accepted after learning a drift of 4")
+	}
+}
+
+func TestTOTPAlgorithms(t *testing.T) {
+	now := time.Now()
+	algorithms := []otp.Algorithm{otp.AlgorithmSHA1, otp.AlgorithmSHA256, otp.AlgorithmSHA512}
+
+	for _, alg := range algorithms {
+		t.Run(alg.String(), func(t *testing.T) {
+			h := &Handler{totpAlg: alg}
+			key, err := h.totpKey("user-1", testTOTPSecret)
+			if err != nil {
+				t.Fatalf("totpKey: %v", err)
+			}
+			if key.Algorithm() != alg {
+				t.Errorf("key algorithm = %s, want %s", key.Algorithm(), alg)
+			}
+
+			method := &storage.MFAMethod{Type: "totp", Algorithm: alg.String()}
+			for _, codeAlg := range algorithms {
+				code, err := totp.GenerateCodeCustom(key.Secret(), now, totpValidateOpts(codeAlg, 0))
+				if err != nil {
+					t.Fatalf("GenerateCodeCustom: %v", err)
+				}
+				_, _, valid := validateTOTPWithDrift(method, key.Secret(), code, now)
+				if want := codeAlg == alg; valid != want {
+					t.Errorf("%s code valid = %v, want %v", codeAlg, valid, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMethodAlgorithm(t *testing.T) {
+	tests := []struct {
+		stored string
+		want   otp.Algorithm
+	}{
+		{stored: "", want: otp.AlgorithmSHA1},
+		{stored: "SHA1", want: otp.AlgorithmSHA1},
+		{stored: "SHA256", want: otp.AlgorithmSHA256},
+		{stored: "SHA512", want: otp.AlgorithmSHA512},
+		{stored: "MD5", want: otp.AlgorithmSHA1},
+	}
+
+	for _, tt := range tests {
+		if got := methodAlgorithm(&storage.MFAMethod{Algorithm: tt.stored}); got != tt.want {
+			t.Errorf("methodAlgorithm(%q) = %s, want %s", tt.stored, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyStoredTOTPReplay(t *testing.T) {
+	now := time.Now()
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		lastUsed int64
+		code     string
+		want     bool
+	}{
+		{name: "first use", code: testTOTPCode(t, now), want: true},
+		{name: "later step", lastUsed: step - 1, code: testTOTPCode(t, now), want: true},
+		{name: "replayed step", lastUsed: step, code: testTOTPCode(t, now)},
+		{name: "earlier step after a later one", lastUsed: step + 1, code: testTOTPCode(t, now)},
+		{name: "wrong code", code: "000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStore(0)
+			t.Cleanup(store.Close)
+			h := &Handler{logger: zap.NewNop(), methods: store}
+			ctx := context.Background()
+			method := &storage.MFAMethod{ID: "mfa-1", UserID: "user-1", Type: "totp", Value: testTOTPSecret, LastUsedStep: tt.lastUsed}
+			if err := store.StoreMFAMethod(ctx, method); err != nil {
+				t.Fatalf("StoreMFAMethod: %v", err)
+			}
+
+			valid, err := h.verifyStoredTOTP(ctx, method, tt.code)
+			if err != nil {
+				t.Fatalf("verifyStoredTOTP: %v", err)
+			}
+			if valid != tt.want {
+				t.Errorf("verifyStoredTOTP() = %v, want %v", valid, tt.want)
+			}
+
+			methods, err := store.GetMFAMethods(ctx, "user-1")
+			if err != nil || len(methods) != 1 {
+				t.Fatalf("GetMFAMethods() = %v, %v", methods, err)
+			}
+			wantLastUsed := tt.lastUsed
+			if tt.want {
+				wantLastUsed = step
+			}
+			if methods[0].LastUsedStep != wantLastUsed {
+				t.Errorf("stored last used step = %d, want %d", methods[0].LastUsedStep, wantLastUsed)
+			}
+		})
+	}
+}
+
+// methodList is a MethodStore holding methods for whichever user asks, since
+// handlers can't yet resolve the request's user
+type methodList struct {
+	mu      sync.Mutex
+	methods []storage.MFAMethod
+}
+
+func (l *methodList) GetMFAMethods(ctx context.Context, userID string) ([]*storage.MFAMethod, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	methods := make([]*storage.MFAMethod, len(l.methods))
+	for i := range l.methods {
+		method := l.methods[i]
+		methods[i] = &method
+	}
+	return methods, nil
+}
+
+func (l *methodList) StoreMFAMethod(ctx context.Context, method *storage.MFAMethod) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.methods {
+		if l.methods[i].ID == method.ID {
+			l.methods[i] = *method
+			return nil
+		}
+	}
+	l.methods = append(l.methods, *method)
+	return nil
+}
+
+// TestVerifyTOTPSetupAndExisting checks that setup verification needs a
+// setup in progress while existing verification needs an enrolled method
+func TestVerifyTOTPSetupAndExisting(t *testing.T) {
+	tests := []struct {
+		name       string
+		enrolled   bool
+		existing   bool
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "setup without a setup in progress", enrolled: true, wantStatus: http.StatusBadRequest, wantCode: CodeSetupNotFound},
+		{name: "existing without an enrolled method", existing: true, wantStatus: http.StatusNotFound, wantCode: CodeNotFound},
+		{name: "existing with an enrolled method", enrolled: true, existing: true, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, Config{})
+			methods := &methodList{}
+			if tt.enrolled {
+				methods.methods = []storage.MFAMethod{{ID: "mfa-1", Type: "totp", Value: testTOTPSecret}}
+			}
+			h.methods = methods
+			handler := h.VerifyTOTP
+			if tt.existing {
+				handler = h.VerifyExistingTOTP
+			}
+
+			form := url.Values{"code": {testTOTPCode(t, time.Now())}}
+			w := postForm(handler, form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != tt.wantCode {
+					t.Errorf("response = %s, want code %q", w.Body.String(), tt.wantCode)
+				}
+				return
+			}
+
+			// The accepted code can't be used again
+			if w := postForm(handler, form); w.Code != http.StatusUnauthorized {
+				t.Errorf("replayed code status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestGetPendingTOTP(t *testing.T) {
+	h, _ := newTestHandler(t, Config{})
+	h.methods = &methodList{}
+	server := miniredis.RunT(t)
+	cache, err := storage.NewRedisCache(storage.RedisConfig{Options: &redis.Options{Addr: server.Addr()}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	h.temp = cache
+
+	pending := func() (int, TOTPSetupResponse) {
+		t.Helper()
+		w := postForm(h.GetPendingTOTP, nil)
+		var resp TOTPSetupResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body.String(), err)
+			}
+		}
+		return w.Code, resp
+	}
+	setup := func() TOTPSetupResponse {
+		t.Helper()
+		w := postForm(h.SetupTOTP, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("setup status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp TOTPSetupResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode body %q: %v", w.Body.String(), err)
+		}
+		return resp
+	}
+
+	if status, _ := pending(); status != http.StatusNotFound {
+		t.Fatalf("before setup: status = %d, want %d", status, http.StatusNotFound)
+	}
+
+	first := setup()
+	if status, resp := pending(); status != http.StatusOK || resp != first {
+		t.Fatalf("within the window: %d %+v, want %+v", status, resp, first)
+	}
+
+	// A new setup replaces the pending secret
+	second := setup()
+	if second.Secret == first.Secret {
+		t.Fatal("second setup reused the first secret")
+	}
+	server.FastForward(totpSetupTTL - time.Second)
+	if status, resp := pending(); status != http.StatusOK || resp != second {
+		t.Fatalf("near the end of the window: %d %+v, want %+v", status, resp, second)
+	}
+
+	server.FastForward(2 * time.Second)
+	if status, _ := pending(); status != http.StatusNotFound {
+		t.Errorf("after expiry: status = %d, want %d", status, http.StatusNotFound)
+	}
+}
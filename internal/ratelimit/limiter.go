@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Result describes the outcome of a rate limit check
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the current window resets
+	Reset time.Duration
+}
+
+// Limiter decides whether a request identified by key may proceed
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+	// Reset clears key's window, e.g. once a user has verified a code so
+	// earlier failures don't count against their next attempts
+	Reset(ctx context.Context, key string) error
+}
+
+// MemoryLimiter is a fixed-window limiter held in process memory. Expired
+// windows are swept at most once per window, so keys that stop sending
+// requests don't stay in memory.
+type MemoryLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*fixedWindow
+	lastSweep time.Time
+}
+
+type fixedWindow struct {
+	count int
+	start time.Time
+}
+
+// NewMemoryLimiter creates a limiter allowing limit requests per window
+func NewMemoryLimiter(limit int, window time.Duration) *MemoryLimiter {
+	return &MemoryLimiter{
+		limit:     limit,
+		window:    window,
+		windows:   make(map[string]*fixedWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow implements Limiter.Allow
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= l.window {
+		l.sweep(now)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &fixedWindow{start: now}
+		l.windows[key] = w
+	}
+
+	result := Result{
+		Limit: l.limit,
+		Reset: w.start.Add(l.window).Sub(now),
+	}
+
+	if w.count >= l.limit {
+		return result, nil
+	}
+
+	w.count++
+	result.Allowed = true
+	result.Remaining = l.limit - w.count
+	return result, nil
+}
+
+// Reset implements Limiter.Reset
+func (l *MemoryLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.windows, key)
+	return nil
+}
+
+// sweep removes windows that have expired. The caller must hold l.mu.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// KeyFunc derives the rate limit key for a request
+type KeyFunc func(c *gin.Context) string
+
+// Middleware enforces the limiter on gin routes and reports the standard
+// RateLimit-Limit, RateLimit-Remaining, and RateLimit-Reset headers on every
+// response, plus Retry-After when the request is throttled
+func Middleware(limiter Limiter, keyFunc KeyFunc, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := limiter.Allow(c.Request.Context(), keyFunc(c))
+		if err != nil {
+			// Fail open so a limiter outage doesn't take down authentication
+			logger.Error("Failed to check rate limit", zap.Error(err))
+			c.Next()
+			return
+		}
+
+		reset := strconv.Itoa(seconds(result.Reset))
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", reset)
+
+		if !result.Allowed {
+			c.Header("Retry-After", reset)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
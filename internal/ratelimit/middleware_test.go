@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// failingLimiter fails every check
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return Result{}, errors.New("limiter unavailable")
+}
+
+func (failingLimiter) Reset(ctx context.Context, key string) error {
+	return nil
+}
+
+func newTestRouter(limiter Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(limiter, func(c *gin.Context) string { return c.GetHeader("X-User") }, zap.NewNop()))
+	router.POST("/mfa/verify", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func send(router *gin.Engine, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/mfa/verify", nil)
+	req.Header.Set("X-User", user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	router := newTestRouter(NewMemoryLimiter(3, time.Minute))
+
+	tests := []struct {
+		name          string
+		user          string
+		wantStatus    int
+		wantRemaining string
+		wantRetry     bool
+	}{
+		{name: "first request", user: "user-1", wantStatus: http.StatusOK, wantRemaining: "2"},
+		{name: "second request", user: "user-1", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "last allowed request", user: "user-1", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "throttled", user: "user-1", wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: true},
+		{name: "still throttled", user: "user-1", wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantRetry: true},
+		{name: "another key has its own window", user: "user-2", wantStatus: http.StatusOK, wantRemaining: "2"},
+	}
+
+	// Successive requests run in order against the same limiter
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(router, tt.user)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("RateLimit-Limit"); got != "3" {
+				t.Errorf("RateLimit-Limit = %q, want 3", got)
+			}
+			if got := w.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("RateLimit-Remaining = %q, want %s", got, tt.wantRemaining)
+			}
+
+			reset, err := strconv.Atoi(w.Header().Get("RateLimit-Reset"))
+			if err != nil || reset < 1 || reset > 60 {
+				t.Errorf("RateLimit-Reset = %q, want 1-60 seconds", w.Header().Get("RateLimit-Reset"))
+			}
+			if retry := w.Header().Get("Retry-After"); (retry != "") != tt.wantRetry || (tt.wantRetry && retry != strconv.Itoa(reset)) {
+				t.Errorf("Retry-After = %q, want it set to the reset (%d) only when throttled", retry, reset)
+			}
+		})
+	}
+}
+
+func TestMiddlewareFailsOpen(t *testing.T) {
+	w := send(newTestRouter(failingLimiter{}), "user-1")
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("RateLimit-Limit = %q on a failed check, want none", got)
+	}
+}
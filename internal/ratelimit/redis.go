@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// RedisLimiter is a fixed-window limiter shared across instances through
+// Redis atomic counters
+type RedisLimiter struct {
+	cache  *storage.RedisCache
+	limit  int
+	window time.Duration
+}
+
+// NewRedisLimiter creates a limiter allowing limit requests per window
+func NewRedisLimiter(cache *storage.RedisCache, limit int, window time.Duration) *RedisLimiter {
+	return &RedisLimiter{
+		cache:  cache,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Allow implements Limiter.Allow
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	counter, err := l.cache.IncrWithLimit(ctx, "ratelimit:"+key, int64(l.limit), l.window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	remaining := l.limit - int(counter.Count)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Result{
+		Allowed:   counter.Allowed,
+		Limit:     l.limit,
+		Remaining: remaining,
+		Reset:     counter.TTL,
+	}, nil
+}
+
+// Reset implements Limiter.Reset
+func (l *RedisLimiter) Reset(ctx context.Context, key string) error {
+	return l.cache.ResetCounter(ctx, "ratelimit:"+key)
+}
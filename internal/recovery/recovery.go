@@ -0,0 +1,101 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/polyid/auth/internal/sanitize"
+)
+
+// PanicCounter counts recovered panics, e.g. metrics.PrometheusRecorder.
+// route is the gRPC method or gin route that panicked.
+type PanicCounter interface {
+	RecordPanic(route string)
+}
+
+// GinMiddleware recovers panics in later handlers, logs them with their stack
+// trace, and responds 500. respond writes the error body; nil writes a
+// generic {"error": ...} body. Stack details are never sent to the client.
+// counter may be nil.
+func GinMiddleware(logger *zap.Logger, counter PanicCounter, respond gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			logPanic(c.Request.Context(), logger, c.FullPath(), r)
+			if counter != nil {
+				counter.RecordPanic(c.FullPath())
+			}
+
+			if c.Writer.Written() {
+				// Too late to change the response; just stop the chain
+				c.Abort()
+				return
+			}
+			if respond != nil {
+				respond(c)
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}()
+
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor recovers panicking unary handlers, logs them with
+// their stack trace, and returns codes.Internal. counter may be nil.
+func UnaryServerInterceptor(logger *zap.Logger, counter PanicCounter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, logger, counter, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor recovers panicking stream handlers like
+// UnaryServerInterceptor
+func StreamServerInterceptor(logger *zap.Logger, counter PanicCounter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ss.Context(), logger, counter, info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// recovered logs and counts a gRPC panic and returns the client-safe error
+func recovered(ctx context.Context, logger *zap.Logger, counter PanicCounter, method string, r interface{}) error {
+	logPanic(ctx, logger, method, r)
+	if counter != nil {
+		counter.RecordPanic(method)
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func logPanic(ctx context.Context, logger *zap.Logger, route string, r interface{}) {
+	logger.Error("Recovered from panic",
+		zap.String("route", route),
+		zap.String("correlation_id", sanitize.CorrelationID(ctx)),
+		zap.String("panic", fmt.Sprint(r)),
+		zap.ByteString("stack", debug.Stack()))
+}
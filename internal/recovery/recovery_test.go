@@ -0,0 +1,165 @@
+package recovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const panicDetail = "index out of range [3] with length 2"
+
+// countingCounter records the routes of recovered panics
+type countingCounter struct {
+	mu     sync.Mutex
+	routes []string
+}
+
+func (c *countingCounter) RecordPanic(route string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routes = append(c.routes, route)
+}
+
+func panicking(c *gin.Context) {
+	panic(panicDetail)
+}
+
+func partialThenPanic(c *gin.Context) {
+	c.String(http.StatusAccepted, "partial")
+	panic(panicDetail)
+}
+
+func teapot(c *gin.Context) {
+	c.JSON(http.StatusTeapot, gin.H{"code": "internal_error"})
+}
+
+func TestGinMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		respond    gin.HandlerFunc
+		wantStatus int
+		wantBody   string
+		wantPanics int
+	}{
+		{name: "no panic", handler: teapot, wantStatus: http.StatusTeapot, wantBody: `{"code":"internal_error"}`},
+		{name: "generic response", handler: panicking, wantStatus: http.StatusInternalServerError, wantBody: `{"error":"Internal server error"}`, wantPanics: 1},
+		{name: "custom response", handler: panicking, respond: teapot, wantStatus: http.StatusTeapot, wantBody: `{"code":"internal_error"}`, wantPanics: 1},
+		{name: "response already written", handler: partialThenPanic, wantStatus: http.StatusAccepted, wantBody: "partial", wantPanics: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			counter := &countingCounter{}
+			router := gin.New()
+			router.Use(GinMiddleware(zap.NewNop(), counter, tt.respond))
+			router.GET("/users/:id", tt.handler)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if body := w.Body.String(); body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if strings.Contains(w.Body.String(), panicDetail) {
+				t.Error("response leaked the panic value")
+			}
+			if len(counter.routes) != tt.wantPanics {
+				t.Fatalf("recorded panics = %v, want %d", counter.routes, tt.wantPanics)
+			}
+			if tt.wantPanics > 0 && counter.routes[0] != "/users/:id" {
+				t.Errorf("panic route = %q, want /users/:id", counter.routes[0])
+			}
+		})
+	}
+}
+
+func TestGinMiddlewareWithoutCounter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware(zap.NewNop(), nil, nil))
+	router.GET("/boom", panicking)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name       string
+		panics     bool
+		wantCode   codes.Code
+		wantPanics int
+	}{
+		{name: "no panic", wantCode: codes.NotFound},
+		{name: "panic", panics: true, wantCode: codes.Internal, wantPanics: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &countingCounter{}
+			interceptor := UnaryServerInterceptor(zap.NewNop(), counter)
+			info := &grpc.UnaryServerInfo{FullMethod: "/auth.Auth/ValidateToken"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				if tt.panics {
+					panic(panicDetail)
+				}
+				return nil, status.Error(codes.NotFound, "token not found")
+			}
+
+			_, err := interceptor(context.Background(), "req", info, handler)
+
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("interceptor() = %v, want %s", err, tt.wantCode)
+			}
+			if strings.Contains(status.Convert(err).Message(), panicDetail) {
+				t.Error("error leaked the panic value")
+			}
+			if len(counter.routes) != tt.wantPanics {
+				t.Errorf("recorded panics = %v, want %d", counter.routes, tt.wantPanics)
+			}
+		})
+	}
+}
+
+// contextStream is a grpc.ServerStream that only supplies a context
+type contextStream struct {
+	grpc.ServerStream
+}
+
+func (contextStream) Context() context.Context { return context.Background() }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	counter := &countingCounter{}
+	interceptor := StreamServerInterceptor(zap.NewNop(), counter)
+	info := &grpc.StreamServerInfo{FullMethod: "/auth.Auth/Watch"}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		panic(panicDetail)
+	}
+
+	err := interceptor(nil, contextStream{}, info, handler)
+
+	if status.Code(err) != codes.Internal {
+		t.Errorf("interceptor() = %v, want %s", err, codes.Internal)
+	}
+	if len(counter.routes) != 1 || counter.routes[0] != "/auth.Auth/Watch" {
+		t.Errorf("recorded panics = %v, want [/auth.Auth/Watch]", counter.routes)
+	}
+}
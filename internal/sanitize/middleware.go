@@ -0,0 +1,74 @@
+package sanitize
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GinMiddleware assigns each HTTP request a correlation ID, returns it in
+// the response header, and logs server errors and any errors attached with
+// c.Error under that ID
+func GinMiddleware(logger *zap.Logger, mode Mode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := newCorrelationID()
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id, mode))
+		c.Header(HeaderName, id)
+
+		c.Next()
+
+		if len(c.Errors) > 0 || c.Writer.Status() >= http.StatusInternalServerError {
+			logger.Error("Request failed",
+				zap.String("correlation_id", id),
+				zap.String("path", c.FullPath()),
+				zap.Int("status", c.Writer.Status()),
+				zap.Strings("errors", c.Errors.Errors()))
+		}
+	}
+}
+
+// UnaryServerInterceptor assigns each gRPC call a correlation ID, returned in
+// the response trailer. Server-side failures are logged in full and, unless
+// in detailed mode, replaced with a generic message carrying the ID.
+// Client-side errors such as InvalidArgument pass through unchanged.
+func UnaryServerInterceptor(logger *zap.Logger, mode Mode) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := newCorrelationID()
+		grpc.SetTrailer(ctx, metadata.Pairs(HeaderName, id))
+
+		resp, err := handler(NewContext(ctx, id, mode), req)
+		if err == nil {
+			return resp, nil
+		}
+
+		st := status.Convert(err)
+		if !isServerError(st.Code()) {
+			return resp, err
+		}
+
+		logger.Error("Call failed",
+			zap.String("correlation_id", id),
+			zap.String("method", info.FullMethod),
+			zap.Error(err))
+
+		if mode == ModeDetailed {
+			return resp, err
+		}
+		return resp, status.Errorf(st.Code(), "internal error (correlation ID %s)", id)
+	}
+}
+
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		return true
+	default:
+		return false
+	}
+}
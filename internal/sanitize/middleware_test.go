@@ -0,0 +1,140 @@
+package sanitize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const internalDetail = "dial tcp 10.0.0.5:6379: connection refused"
+
+// newBufferLogger returns a logger writing JSON to the buffer
+func newBufferLogger() (*zap.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.DebugLevel)
+	return zap.New(core), &buf
+}
+
+func TestGinMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       Mode
+		wantDetail bool
+	}{
+		{name: "sanitized", mode: ModeSanitized},
+		{name: "detailed", mode: ModeDetailed, wantDetail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logs := newBufferLogger()
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(GinMiddleware(logger, tt.mode))
+			router.GET("/methods", func(c *gin.Context) {
+				err := errors.New(internalDetail)
+				c.Error(err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"message":        Message(c.Request.Context(), "Failed to load methods", err),
+					"correlation_id": CorrelationID(c.Request.Context()),
+				})
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/methods", nil))
+
+			id := w.Header().Get(HeaderName)
+			if id == "" {
+				t.Fatal("response has no correlation ID")
+			}
+			if !strings.Contains(w.Body.String(), id) {
+				t.Errorf("body %s doesn't carry correlation ID %s", w.Body.String(), id)
+			}
+			if got := strings.Contains(w.Body.String(), internalDetail); got != tt.wantDetail {
+				t.Errorf("body contains internal detail = %v, want %v: %s", got, tt.wantDetail, w.Body.String())
+			}
+
+			// The full cause is always logged under the correlation ID
+			if !strings.Contains(logs.String(), internalDetail) || !strings.Contains(logs.String(), id) {
+				t.Errorf("logs are missing the detail or correlation ID: %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestGinMiddlewareSuccess(t *testing.T) {
+	logger, logs := newBufferLogger()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware(logger, ModeSanitized))
+	router.GET("/methods", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/methods", nil))
+
+	if w.Header().Get(HeaderName) == "" {
+		t.Error("response has no correlation ID")
+	}
+	if logs.Len() != 0 {
+		t.Errorf("successful request was logged: %s", logs.String())
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        Mode
+		err         error
+		wantCode    codes.Code
+		wantDetail  bool
+		wantLogged  bool
+		wantGeneric bool
+	}{
+		{name: "internal error, sanitized", err: status.Error(codes.Internal, internalDetail), wantCode: codes.Internal, wantLogged: true, wantGeneric: true},
+		{name: "plain error, sanitized", err: errors.New(internalDetail), wantCode: codes.Unknown, wantLogged: true, wantGeneric: true},
+		{name: "internal error, detailed", mode: ModeDetailed, err: status.Error(codes.Unavailable, internalDetail), wantCode: codes.Unavailable, wantDetail: true, wantLogged: true},
+		{name: "client error passes through", err: status.Error(codes.InvalidArgument, "email is required"), wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logs := newBufferLogger()
+			interceptor := UnaryServerInterceptor(logger, tt.mode)
+			info := &grpc.UnaryServerInfo{FullMethod: "/polyid.Auth/GetUser"}
+
+			var id string
+			_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				id = CorrelationID(ctx)
+				return nil, tt.err
+			})
+
+			st := status.Convert(err)
+			if st.Code() != tt.wantCode {
+				t.Errorf("code = %s, want %s", st.Code(), tt.wantCode)
+			}
+			if id == "" {
+				t.Fatal("handler context has no correlation ID")
+			}
+			if got := strings.Contains(st.Message(), internalDetail); got != tt.wantDetail {
+				t.Errorf("message %q contains internal detail = %v, want %v", st.Message(), got, tt.wantDetail)
+			}
+			if tt.wantGeneric && !strings.Contains(st.Message(), id) {
+				t.Errorf("message %q doesn't carry correlation ID %s", st.Message(), id)
+			}
+			if got := strings.Contains(logs.String(), internalDetail) && strings.Contains(logs.String(), id); got != tt.wantLogged {
+				t.Errorf("logged with correlation ID = %v, want %v: %s", got, tt.wantLogged, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package sanitize keeps internal error details out of client responses.
+// Each request gets a correlation ID that is returned to the client and
+// attached to server-side logs, so a generic client error can still be
+// traced to its full cause.
+package sanitize
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+// Mode controls how much error detail reaches clients
+type Mode int
+
+const (
+	// ModeSanitized returns generic messages for server errors
+	ModeSanitized Mode = iota
+	// ModeDetailed includes internal error details, for development only
+	ModeDetailed
+)
+
+// HeaderName carries the correlation ID on HTTP responses and gRPC trailers
+const HeaderName = "X-Correlation-ID"
+
+// ModeFromEnv returns ModeDetailed if POLYID_ERROR_DETAIL is "true" and
+// ModeSanitized otherwise
+func ModeFromEnv() Mode {
+	if os.Getenv("POLYID_ERROR_DETAIL") == "true" {
+		return ModeDetailed
+	}
+	return ModeSanitized
+}
+
+type contextKey struct{}
+
+type requestInfo struct {
+	correlationID string
+	mode          Mode
+}
+
+// NewContext returns a copy of ctx carrying the correlation ID and mode
+func NewContext(ctx context.Context, correlationID string, mode Mode) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestInfo{correlationID: correlationID, mode: mode})
+}
+
+// CorrelationID returns the request's correlation ID, or "" outside a
+// sanitized request
+func CorrelationID(ctx context.Context) string {
+	info, _ := ctx.Value(contextKey{}).(requestInfo)
+	return info.correlationID
+}
+
+// Detailed reports whether internal details may be returned to the client
+func Detailed(ctx context.Context) bool {
+	info, _ := ctx.Value(contextKey{}).(requestInfo)
+	return info.mode == ModeDetailed
+}
+
+// Message returns the client-facing message for a server error: message
+// alone when sanitized, or message with err's detail in detailed mode
+func Message(ctx context.Context, message string, err error) string {
+	if err != nil && Detailed(ctx) {
+		return message + ": " + err.Error()
+	}
+	return message
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
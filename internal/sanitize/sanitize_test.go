@@ -0,0 +1,42 @@
+package sanitize
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	internal := errors.New("dial tcp 10.0.0.5:6379: connection refused")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{name: "sanitized", ctx: NewContext(context.Background(), "abc", ModeSanitized), err: internal, want: "Failed to load"},
+		{name: "outside a request", ctx: context.Background(), err: internal, want: "Failed to load"},
+		{name: "detailed", ctx: NewContext(context.Background(), "abc", ModeDetailed), err: internal, want: "Failed to load: dial tcp 10.0.0.5:6379: connection refused"},
+		{name: "detailed without an error", ctx: NewContext(context.Background(), "abc", ModeDetailed), want: "Failed to load"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Message(tt.ctx, "Failed to load", tt.err); got != tt.want {
+				t.Errorf("Message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModeFromEnv(t *testing.T) {
+	t.Setenv("POLYID_ERROR_DETAIL", "")
+	if ModeFromEnv() != ModeSanitized {
+		t.Error("ModeFromEnv() without the variable is not sanitized")
+	}
+	t.Setenv("POLYID_ERROR_DETAIL", "true")
+	if ModeFromEnv() != ModeDetailed {
+		t.Error("ModeFromEnv() with the variable set is not detailed")
+	}
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AtomicTempStore is implemented by stores that can update temporary values
+// atomically, for single-use values and state changes that must not race
+type AtomicTempStore interface {
+	// StoreTemporaryValueIfAbsent stores value and reports true unless key
+	// already holds an unexpired value, in which case nothing is written
+	StoreTemporaryValueIfAbsent(ctx context.Context, key string, value string, expiry time.Duration) (bool, error)
+	// TakeTemporaryValue returns a value and deletes it in one step, so only
+	// one caller ever receives it. Missing or expired keys return an
+	// ErrNotFound StorageError.
+	TakeTemporaryValue(ctx context.Context, key string) (string, error)
+	// SwapTemporaryValue replaces key's value with value, or deletes it if
+	// value is "", and reports true only if key held old. An old of ""
+	// matches a missing or expired key.
+	SwapTemporaryValue(ctx context.Context, key string, old string, value string, expiry time.Duration) (bool, error)
+}
+
+var (
+	_ AtomicTempStore = (*NoSQLStorage)(nil)
+	_ AtomicTempStore = (*MemoryStore)(nil)
+)
+
+// NoSQLConditionalWriter is implemented by NoSQL clients that can create and
+// delete items conditionally. NoSQLStorage needs it, along with
+// NoSQLConditionalPutter, for AtomicTempStore.
+type NoSQLConditionalWriter interface {
+	// PutIfAbsent writes value and reports true if no item exists at key,
+	// and otherwise writes nothing and reports false
+	PutIfAbsent(ctx context.Context, table string, key string, value interface{}) (bool, error)
+	// DeleteIf deletes the item and reports true if its field equals
+	// expected, and otherwise deletes nothing and reports false
+	DeleteIf(ctx context.Context, table string, key string, field string, expected interface{}) (bool, error)
+}
+
+// conditionalClient returns the client's conditional operations, or an
+// error if it has none. Atomic operations fail rather than fall back to
+// racy ones.
+func (s *NoSQLStorage) conditionalClient() (NoSQLConditionalWriter, NoSQLConditionalPutter, error) {
+	writer, ok := s.client.(NoSQLConditionalWriter)
+	putter, ok2 := s.client.(NoSQLConditionalPutter)
+	if !ok || !ok2 {
+		return nil, nil, &StorageError{
+			Code:    ErrInternal,
+			Message: "NoSQL client does not support conditional writes",
+		}
+	}
+	return writer, putter, nil
+}
+
+// isNotFound reports whether err is an ErrNotFound StorageError
+func isNotFound(err error) bool {
+	var storageErr *StorageError
+	return errors.As(err, &storageErr) && storageErr.Code == ErrNotFound
+}
+
+func tempRecordKey(key string) string {
+	return fmt.Sprintf("temp:%s", key)
+}
+
+func tempRecord(key string, value string, expiry time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"key":        key,
+		"value":      value,
+		"expires_at": time.Now().Add(expiry).Unix(),
+	}
+}
+
+// StoreTemporaryValueIfAbsent implements AtomicTempStore. An expired record
+// still present is removed first, conditionally so a fresh value written
+// meanwhile is kept.
+func (s *NoSQLStorage) StoreTemporaryValueIfAbsent(ctx context.Context, key string, value string, expiry time.Duration) (bool, error) {
+	writer, _, err := s.conditionalClient()
+	if err != nil {
+		return false, err
+	}
+
+	written, err := writer.PutIfAbsent(ctx, s.tableName, tempRecordKey(key), tempRecord(key, value, expiry))
+	if err != nil {
+		return false, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to store temporary value",
+			Err:     err,
+		}
+	}
+	if written {
+		return true, nil
+	}
+
+	result, err := s.client.Get(ctx, s.tableName, tempRecordKey(key))
+	if err != nil {
+		return false, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to get temporary value",
+			Err:     err,
+		}
+	}
+	expiresAt, _ := result["expires_at"].(float64)
+	if result != nil && time.Now().Unix() <= int64(expiresAt) {
+		return false, nil
+	}
+
+	if result != nil {
+		if _, err := writer.DeleteIf(ctx, s.tableName, tempRecordKey(key), "expires_at", result["expires_at"]); err != nil {
+			return false, &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to delete expired temporary value",
+				Err:     err,
+			}
+		}
+	}
+
+	written, err = writer.PutIfAbsent(ctx, s.tableName, tempRecordKey(key), tempRecord(key, value, expiry))
+	if err != nil {
+		return false, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to store temporary value",
+			Err:     err,
+		}
+	}
+	return written, nil
+}
+
+// TakeTemporaryValue implements AtomicTempStore. The delete is conditional
+// on the value read, so of two concurrent takes only one succeeds.
+func (s *NoSQLStorage) TakeTemporaryValue(ctx context.Context, key string) (string, error) {
+	writer, _, err := s.conditionalClient()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := s.GetTemporaryValue(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	deleted, err := writer.DeleteIf(ctx, s.tableName, tempRecordKey(key), "value", value)
+	if err != nil {
+		return "", &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to delete temporary value",
+			Err:     err,
+		}
+	}
+	if !deleted {
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Temporary value already taken",
+		}
+	}
+	return value, nil
+}
+
+// SwapTemporaryValue implements AtomicTempStore
+func (s *NoSQLStorage) SwapTemporaryValue(ctx context.Context, key string, old string, value string, expiry time.Duration) (bool, error) {
+	writer, putter, err := s.conditionalClient()
+	if err != nil {
+		return false, err
+	}
+	if old == "" {
+		if value == "" {
+			// Deleting a missing value leaves nothing to write
+			_, err := s.GetTemporaryValue(ctx, key)
+			if isNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		}
+		return s.StoreTemporaryValueIfAbsent(ctx, key, value, expiry)
+	}
+
+	current, err := s.GetTemporaryValue(ctx, key)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if current != old {
+		return false, nil
+	}
+
+	var swapped bool
+	if value == "" {
+		swapped, err = writer.DeleteIf(ctx, s.tableName, tempRecordKey(key), "value", old)
+	} else {
+		swapped, err = putter.PutIf(ctx, s.tableName, tempRecordKey(key), tempRecord(key, value, expiry), "value", old)
+	}
+	if err != nil {
+		return false, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to swap temporary value",
+			Err:     err,
+		}
+	}
+	return swapped, nil
+}
+
+// StoreTemporaryValueIfAbsent implements AtomicTempStore
+func (m *MemoryStore) StoreTemporaryValueIfAbsent(ctx context.Context, key string, value string, expiry time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.liveValue(key); ok {
+		return false, nil
+	}
+	m.temp[key] = memoryValue{value: value, expiresAt: time.Now().Add(expiry)}
+	return true, nil
+}
+
+// TakeTemporaryValue implements AtomicTempStore
+func (m *MemoryStore) TakeTemporaryValue(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v, ok := m.liveValue(key)
+	if !ok {
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Temporary value not found",
+		}
+	}
+	delete(m.temp, key)
+	return v.value, nil
+}
+
+// SwapTemporaryValue implements AtomicTempStore
+func (m *MemoryStore) SwapTemporaryValue(ctx context.Context, key string, old string, value string, expiry time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v, _ := m.liveValue(key)
+	if v.value != old {
+		return false, nil
+	}
+	if value == "" {
+		delete(m.temp, key)
+	} else {
+		m.temp[key] = memoryValue{value: value, expiresAt: time.Now().Add(expiry)}
+	}
+	return true, nil
+}
+
+// liveValue returns key's value unless it is missing or expired. The caller
+// must hold m.mu.
+func (m *MemoryStore) liveValue(key string) (memoryValue, bool) {
+	v, ok := m.temp[key]
+	if !ok || time.Now().After(v.expiresAt) {
+		return memoryValue{}, false
+	}
+	return v, true
+}
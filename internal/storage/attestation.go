@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Attestation is the attestation statement a credential was registered
+// with, kept so audits can re-examine it. Enterprise attestation
+// certificates identify the individual device, so attestations must only be
+// exposed to admins and their chains are stored encrypted.
+type Attestation struct {
+	CredentialID string    `json:"credential_id"`
+	UserID       string    `json:"user_id"`
+	Format       string    `json:"format"` // attestation statement format, e.g. "packed"
+	AAGUID       string    `json:"aaguid,omitempty"`
+	X5C          [][]byte  `json:"x5c,omitempty"`        // DER certificate chain, leaf first; never stored
+	SealedX5C    string    `json:"sealed_x5c,omitempty"` // encrypted X5C, as stored
+	KeyID        string    `json:"key_id,omitempty"`     // encryption key for SealedX5C
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AttestationStore is implemented by stores that keep credential
+// attestations
+type AttestationStore interface {
+	StoreAttestation(ctx context.Context, attestation *Attestation) error
+	// GetAttestation returns the attestation of a credential, or an
+	// ErrNotFound StorageError if none was kept
+	GetAttestation(ctx context.Context, credentialID string) (*Attestation, error)
+}
+
+var _ AttestationStore = (*NoSQLStorage)(nil)
+
+func attestationKey(credentialID string) string {
+	return fmt.Sprintf("attestation:%s", credentialID)
+}
+
+// StoreAttestation implements AttestationStore.StoreAttestation
+func (s *NoSQLStorage) StoreAttestation(ctx context.Context, attestation *Attestation) error {
+	if attestation.CredentialID == "" {
+		return &StorageError{Code: ErrInvalidInput, Message: "Attestation requires a credential ID"}
+	}
+	if len(attestation.X5C) > 0 {
+		return &StorageError{Code: ErrInvalidInput, Message: "Attestation certificates must be sealed"}
+	}
+	if attestation.CreatedAt.IsZero() {
+		attestation.CreatedAt = time.Now()
+	}
+
+	if err := s.putRecord(ctx, attestationKey(attestation.CredentialID), attestation); err != nil {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to store attestation",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// GetAttestation implements AttestationStore.GetAttestation
+func (s *NoSQLStorage) GetAttestation(ctx context.Context, credentialID string) (*Attestation, error) {
+	result, err := s.client.Get(ctx, s.tableName, attestationKey(credentialID))
+	if err != nil {
+		return nil, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to get attestation",
+			Err:     err,
+		}
+	}
+
+	if result == nil {
+		return nil, &StorageError{
+			Code:    ErrNotFound,
+			Message: "Attestation not found",
+		}
+	}
+
+	attestation := &Attestation{}
+	if err := s.mapToStruct(result, attestation); err != nil {
+		return nil, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to unmarshal attestation",
+			Err:     err,
+		}
+	}
+
+	return attestation, nil
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit entry results
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+const (
+	// MaxAuditQueryRange bounds the time range of a single audit query so
+	// compliance exports page through bounded result sets
+	MaxAuditQueryRange = 31 * 24 * time.Hour
+
+	// DefaultAuditPageSize is the page size used when AuditFilter.Limit is
+	// unset
+	DefaultAuditPageSize = 100
+
+	// MaxAuditPageSize bounds AuditFilter.Limit
+	MaxAuditPageSize = 1000
+)
+
+// AuditEntry records a security-relevant action
+type AuditEntry struct {
+	ID        string            `json:"id"`
+	ActorID   string            `json:"actor_id"`            // user or admin who acted
+	Action    string            `json:"action"`              // e.g. "login", "mfa.enroll"
+	Result    string            `json:"result"`              // AuditResultSuccess or AuditResultFailure
+	TargetID  string            `json:"target_id,omitempty"` // user acted on, if not the actor
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// AuditFilter selects audit entries. From and To are required and bound
+// CreatedAt to [From, To); the other fields match exactly when set.
+type AuditFilter struct {
+	ActorID string
+	Action  string
+	Result  string
+	From    time.Time
+	To      time.Time
+
+	// Cursor resumes after the last entry of a previous page. Pass "" for
+	// the first page.
+	Cursor string
+	// Limit caps the entries returned. Zero uses DefaultAuditPageSize.
+	Limit int
+}
+
+// validate reports an ErrInvalidInput StorageError for empty or over-broad
+// filters
+func (f AuditFilter) validate() error {
+	var message string
+	switch {
+	case f.From.IsZero() || f.To.IsZero():
+		message = "Audit query requires a time range"
+	case !f.To.After(f.From):
+		message = "Audit query time range is empty"
+	case f.To.Sub(f.From) > MaxAuditQueryRange:
+		message = "Audit query time range is too broad"
+	case f.Limit < 0 || f.Limit > MaxAuditPageSize:
+		message = "Audit query limit is out of range"
+	case f.Result != "" && f.Result != AuditResultSuccess && f.Result != AuditResultFailure:
+		message = "Unknown audit result"
+	default:
+		return nil
+	}
+	return &StorageError{Code: ErrInvalidInput, Message: message}
+}
+
+// AuditLog is implemented by stores that record and query audit entries
+type AuditLog interface {
+	RecordAudit(ctx context.Context, entry *AuditEntry) error
+	// QueryAudit returns the entries matching filter, oldest first, with
+	// the cursor of the next page or "" if there are no more pages
+	QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, string, error)
+}
+
+var _ AuditLog = (*NoSQLStorage)(nil)
+
+// auditRecord is the stored form of an AuditEntry. Timestamp duplicates
+// CreatedAt as Unix milliseconds so time ranges can be queried on an index.
+type auditRecord struct {
+	AuditEntry
+	Timestamp int64 `json:"audit_ts"`
+}
+
+// auditCursor identifies the last entry of a page. Entries are ordered by
+// timestamp and then ID, so the cursor holds both.
+type auditCursor struct {
+	timestamp int64
+	id        string
+}
+
+func (c auditCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.timestamp, 10) + ":" + c.id))
+}
+
+func decodeAuditCursor(cursor string) (auditCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return auditCursor{}, err
+	}
+	ts, id, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return auditCursor{}, errors.New("malformed audit cursor")
+	}
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return auditCursor{}, err
+	}
+	return auditCursor{timestamp: timestamp, id: id}, nil
+}
+
+// before reports whether the cursor sorts before record
+func (c auditCursor) before(record auditRecord) bool {
+	if record.Timestamp != c.timestamp {
+		return record.Timestamp > c.timestamp
+	}
+	return record.ID > c.id
+}
+
+// RecordAudit implements AuditLog.RecordAudit
+func (s *NoSQLStorage) RecordAudit(ctx context.Context, entry *AuditEntry) error {
+	if entry.ID == "" {
+		entry.ID = s.ids.NewID()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	record := auditRecord{AuditEntry: *entry, Timestamp: entry.CreatedAt.UnixMilli()}
+	if err := s.putRecord(ctx, fmt.Sprintf("audit:%s", entry.ID), record); err != nil {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to record audit entry",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// QueryAudit implements AuditLog.QueryAudit. The index returns the whole
+// time range, which MaxAuditQueryRange keeps bounded; pages are cut from it
+// after sorting.
+func (s *NoSQLStorage) QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, string, error) {
+	if err := filter.validate(); err != nil {
+		return nil, "", err
+	}
+
+	var after *auditCursor
+	if filter.Cursor != "" {
+		cursor, err := decodeAuditCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", &StorageError{
+				Code:    ErrInvalidInput,
+				Message: "Invalid audit cursor",
+				Err:     err,
+			}
+		}
+		after = &cursor
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultAuditPageSize
+	}
+
+	// Query by actor when set since that index is far more selective
+	index := "audit-time-index"
+	conditions := []Condition{Between("audit_ts", filter.From.UnixMilli(), filter.To.UnixMilli()-1)}
+	if filter.ActorID != "" {
+		index = "audit-actor-index"
+		conditions = append([]Condition{Eq("actor_id", filter.ActorID)}, conditions...)
+	}
+
+	results, err := s.query(ctx, index, And(conditions...))
+	if err != nil {
+		return nil, "", &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to query audit entries",
+			Err:     err,
+		}
+	}
+
+	records := make([]auditRecord, 0, len(results))
+	for _, result := range results {
+		var record auditRecord
+		if err := s.mapToStruct(result, &record); err != nil {
+			if s.skipCorrupt("audit", result, err) {
+				continue
+			}
+			return nil, "", &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to unmarshal audit entry",
+				Err:     err,
+			}
+		}
+
+		if (filter.Action != "" && record.Action != filter.Action) ||
+			(filter.Result != "" && record.Result != filter.Result) ||
+			(after != nil && !after.before(record)) {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Timestamp != records[j].Timestamp {
+			return records[i].Timestamp < records[j].Timestamp
+		}
+		return records[i].ID < records[j].ID
+	})
+
+	next := ""
+	if len(records) > limit {
+		records = records[:limit]
+		last := records[limit-1]
+		next = auditCursor{timestamp: last.Timestamp, id: last.ID}.encode()
+	}
+
+	entries := make([]AuditEntry, 0, len(records))
+	for _, record := range records {
+		entries = append(entries, record.AuditEntry)
+	}
+	return entries, next, nil
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/idgen"
+)
+
+// auditClient evaluates equality and between conditions natively over every
+// stored item and records the indexes queried
+type auditClient struct {
+	encodingClient
+	indexes []string
+}
+
+func (c *auditClient) QueryCondition(ctx context.Context, table string, index string, condition Condition) ([]map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexes = append(c.indexes, index)
+
+	var results []map[string]interface{}
+	for _, item := range c.items {
+		if matchesCondition(item, condition) {
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+func matchesCondition(item map[string]interface{}, condition Condition) bool {
+	switch c := condition.(type) {
+	case comparison:
+		return item[c.field] == c.value
+	case between:
+		value, ok := item[c.field].(float64)
+		return ok && value >= float64(c.low.(int64)) && value <= float64(c.high.(int64))
+	case and:
+		for _, sub := range c {
+			if !matchesCondition(item, sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func newTestAuditStore(t *testing.T) (*NoSQLStorage, *auditClient) {
+	t.Helper()
+	client := &auditClient{encodingClient: encodingClient{newFakeTxClient()}}
+	s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+	s.SetIDGenerator(idgen.NewSequence("audit"))
+	return s, client
+}
+
+// seedAudit records entries, returning their IDs in recording order
+func seedAudit(t *testing.T, s *NoSQLStorage, entries []*AuditEntry) []string {
+	t.Helper()
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if err := s.RecordAudit(context.Background(), entry); err != nil {
+			t.Fatalf("RecordAudit: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func auditIDs(entries []AuditEntry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestQueryAuditFilters(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, client := newTestAuditStore(t)
+	ids := seedAudit(t, s, []*AuditEntry{
+		{ActorID: "user-1", Action: "login", Result: AuditResultSuccess, CreatedAt: start},
+		{ActorID: "user-1", Action: "login", Result: AuditResultFailure, CreatedAt: start.Add(time.Minute)},
+		{ActorID: "user-2", Action: "mfa.enroll", Result: AuditResultSuccess, CreatedAt: start.Add(2 * time.Minute)},
+		{ActorID: "user-1", Action: "mfa.enroll", Result: AuditResultSuccess, CreatedAt: start.Add(3 * time.Minute)},
+		{ActorID: "user-2", Action: "login", Result: AuditResultFailure, CreatedAt: start.Add(-time.Hour)},
+		{ActorID: "user-2", Action: "login", Result: AuditResultSuccess, CreatedAt: start.Add(time.Minute)},
+	})
+
+	tests := []struct {
+		name      string
+		filter    AuditFilter
+		want      []string
+		wantIndex string
+	}{
+		{
+			name:      "time range",
+			filter:    AuditFilter{},
+			want:      []string{ids[0], ids[1], ids[5], ids[2], ids[3]},
+			wantIndex: "audit-time-index",
+		},
+		{
+			name:      "end of range is exclusive",
+			filter:    AuditFilter{To: start.Add(3 * time.Minute)},
+			want:      []string{ids[0], ids[1], ids[5], ids[2]},
+			wantIndex: "audit-time-index",
+		},
+		{
+			name:      "actor",
+			filter:    AuditFilter{ActorID: "user-1"},
+			want:      []string{ids[0], ids[1], ids[3]},
+			wantIndex: "audit-actor-index",
+		},
+		{
+			name:      "action",
+			filter:    AuditFilter{Action: "login"},
+			want:      []string{ids[0], ids[1], ids[5]},
+			wantIndex: "audit-time-index",
+		},
+		{
+			name:      "result",
+			filter:    AuditFilter{Result: AuditResultFailure},
+			want:      []string{ids[1]},
+			wantIndex: "audit-time-index",
+		},
+		{
+			name:      "every dimension",
+			filter:    AuditFilter{ActorID: "user-2", Action: "login", Result: AuditResultSuccess},
+			want:      []string{ids[5]},
+			wantIndex: "audit-actor-index",
+		},
+		{
+			name:      "no matches",
+			filter:    AuditFilter{ActorID: "user-3"},
+			want:      []string{},
+			wantIndex: "audit-actor-index",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			filter.From = start
+			if filter.To.IsZero() {
+				filter.To = start.Add(10 * time.Minute)
+			}
+
+			entries, next, err := s.QueryAudit(context.Background(), filter)
+			if err != nil {
+				t.Fatalf("QueryAudit: %v", err)
+			}
+			if got := auditIDs(entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryAudit() = %v, want %v", got, tt.want)
+			}
+			if next != "" {
+				t.Errorf("next cursor = %q, want none", next)
+			}
+			if got := client.indexes[len(client.indexes)-1]; got != tt.wantIndex {
+				t.Errorf("queried %s, want %s", got, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestQueryAuditPagination(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, _ := newTestAuditStore(t)
+	// The second and third entries share a timestamp, so pages must break
+	// ties by ID
+	ids := seedAudit(t, s, []*AuditEntry{
+		{ActorID: "user-1", Action: "login", Result: AuditResultSuccess, CreatedAt: start},
+		{ActorID: "user-1", Action: "login", Result: AuditResultSuccess, CreatedAt: start.Add(time.Minute)},
+		{ActorID: "user-1", Action: "login", Result: AuditResultSuccess, CreatedAt: start.Add(time.Minute)},
+		{ActorID: "user-1", Action: "login", Result: AuditResultSuccess, CreatedAt: start.Add(2 * time.Minute)},
+		{ActorID: "user-1", Action: "login", Result: AuditResultSuccess, CreatedAt: start.Add(3 * time.Minute)},
+	})
+
+	for _, limit := range []int{1, 2, 4, 5} {
+		filter := AuditFilter{From: start, To: start.Add(time.Hour), Limit: limit}
+		var got []string
+		for pages := 0; ; pages++ {
+			if pages > len(ids) {
+				t.Fatalf("limit %d: pagination did not terminate", limit)
+			}
+			entries, next, err := s.QueryAudit(context.Background(), filter)
+			if err != nil {
+				t.Fatalf("limit %d: QueryAudit: %v", limit, err)
+			}
+			if len(entries) > limit {
+				t.Errorf("limit %d: page has %d entries", limit, len(entries))
+			}
+			got = append(got, auditIDs(entries)...)
+			if next == "" {
+				break
+			}
+			filter.Cursor = next
+		}
+		if !reflect.DeepEqual(got, ids) {
+			t.Errorf("limit %d: pages = %v, want %v", limit, got, ids)
+		}
+	}
+}
+
+func TestQueryAuditRejected(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, client := newTestAuditStore(t)
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+	}{
+		{name: "no time range", filter: AuditFilter{ActorID: "user-1"}},
+		{name: "empty time range", filter: AuditFilter{From: start, To: start}},
+		{name: "reversed time range", filter: AuditFilter{From: start, To: start.Add(-time.Hour)}},
+		{name: "time range too broad", filter: AuditFilter{From: start, To: start.Add(MaxAuditQueryRange + time.Hour)}},
+		{name: "negative limit", filter: AuditFilter{From: start, To: start.Add(time.Hour), Limit: -1}},
+		{name: "limit too large", filter: AuditFilter{From: start, To: start.Add(time.Hour), Limit: MaxAuditPageSize + 1}},
+		{name: "unknown result", filter: AuditFilter{From: start, To: start.Add(time.Hour), Result: "denied"}},
+		{name: "malformed cursor", filter: AuditFilter{From: start, To: start.Add(time.Hour), Cursor: "not a cursor!"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.QueryAudit(context.Background(), tt.filter)
+			var storageErr *StorageError
+			if !errors.As(err, &storageErr) || storageErr.Code != ErrInvalidInput {
+				t.Fatalf("QueryAudit() = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+
+	if len(client.indexes) != 0 {
+		t.Errorf("rejected filters queried %v", client.indexes)
+	}
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// CachedStorage is a Storage backed by a durable store with a Redis cache in
+// front of hot per-user reads
+type CachedStorage struct {
+	Storage
+	cache  *RedisCache
+	logger *zap.Logger
+	ttl    time.Duration
+
+	// durableSessions also writes sessions to the durable store so other
+	// regions can resolve them on a cache miss
+	durableSessions bool
+}
+
+// NewCachedStorage creates a cached storage. Cache entries expire after ttl,
+// or after the cache's per-entity defaults if ttl is zero.
+func NewCachedStorage(store Storage, cache *RedisCache, logger *zap.Logger, ttl time.Duration) *CachedStorage {
+	return &CachedStorage{
+		Storage: store,
+		cache:   cache,
+		logger:  logger,
+		ttl:     ttl,
+	}
+}
+
+// GetMFAMethods reads MFA methods through the cache, coalescing concurrent
+// misses into a single durable-store query
+func (s *CachedStorage) GetMFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error) {
+	return s.cache.LoadMFAMethods(ctx, userID, s.ttl, func(ctx context.Context) ([]*MFAMethod, error) {
+		return s.Storage.GetMFAMethods(ctx, userID)
+	})
+}
+
+// StoreMFAMethod stores through the durable store and then drops the user's
+// cached methods. Cache failures are returned since a stale list would keep
+// serving a disabled method.
+func (s *CachedStorage) StoreMFAMethod(ctx context.Context, method *MFAMethod) error {
+	if err := s.Storage.StoreMFAMethod(ctx, method); err != nil {
+		return err
+	}
+	return s.cache.InvalidateMFAMethods(ctx, method.UserID)
+}
+
+// DeleteMFAMethod deletes through the durable store and then drops the
+// cached methods of the user owning it. Cache failures are returned since a
+// stale list would keep serving the removed method.
+func (s *CachedStorage) DeleteMFAMethod(ctx context.Context, id string) error {
+	// Find the owner first; the cache's owner entry outlives the method
+	userID, err := s.cache.MFAMethodOwner(ctx, id)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if err := s.Storage.DeleteMFAMethod(ctx, id); err != nil {
+		return err
+	}
+	if userID == "" {
+		// No cached list holds the method
+		return nil
+	}
+	return s.cache.InvalidateMFAMethods(ctx, userID)
+}
+
+// MergeUsers merges through the durable store, revokes the secondary's
+// cached sessions, and then drops both users' cache entries so neither
+// serves the pre-merge records. A failure to revoke is returned since a
+// surviving session would keep the retired user signed in.
+func (s *CachedStorage) MergeUsers(ctx context.Context, primaryID string, secondaryID string) error {
+	if err := s.Storage.MergeUsers(ctx, primaryID, secondaryID); err != nil {
+		return err
+	}
+	if err := s.cache.RevokeUserSessions(ctx, secondaryID); err != nil {
+		return err
+	}
+
+	for _, userID := range []string{primaryID, secondaryID} {
+		if err := s.cache.InvalidateUser(ctx, userID); err != nil {
+			s.logger.Warn("Failed to invalidate merged user cache",
+				zap.Error(err),
+				zap.String("user_id", userID))
+		}
+	}
+
+	return nil
+}
+
+// PatchUser patches through the durable store and then drops the user's
+// cache entry so it isn't served stale
+func (s *CachedStorage) PatchUser(ctx context.Context, id string, fields map[string]interface{}) (*User, error) {
+	user, err := s.Storage.PatchUser(ctx, id, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.InvalidateUser(ctx, id); err != nil {
+		s.logger.Warn("Failed to invalidate patched user cache",
+			zap.Error(err),
+			zap.String("user_id", id))
+	}
+	return user, nil
+}
+
+// DeleteUserCascade deletes the user from the durable store, then revokes
+// their cached sessions and drops their cache entries. Cache failures are
+// returned since a surviving session would keep the deleted user signed in.
+func (s *CachedStorage) DeleteUserCascade(ctx context.Context, userID string) error {
+	if err := s.Storage.DeleteUserCascade(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.cache.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	return s.cache.InvalidateUser(ctx, userID)
+}
+
+// WarmUser loads a user with their credentials and MFA methods from the
+// durable store and writes all three into the cache, replacing any stale
+// entries. The reads run concurrently; if any fails nothing is cached and
+// every read's error is returned.
+func (s *CachedStorage) WarmUser(ctx context.Context, userID string) error {
+	var (
+		wg          sync.WaitGroup
+		user        *User
+		credentials []*Credential
+		methods     []*MFAMethod
+		errs        [3]error
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		user, errs[0] = s.Storage.GetUser(ctx, userID)
+	}()
+	go func() {
+		defer wg.Done()
+		credentials, errs[1] = s.Storage.GetCredentials(ctx, userID)
+	}()
+	go func() {
+		defer wg.Done()
+		methods, errs[2] = s.Storage.GetMFAMethods(ctx, userID)
+	}()
+	wg.Wait()
+
+	if err := errors.Join(errs[:]...); err != nil {
+		return err
+	}
+	return s.cache.setUserEntries(ctx, user, credentials, methods, s.ttl)
+}
+
+// WarmUsers warms each user in turn, e.g. for recently active users after a
+// cold start. Failures are logged and skipped; it returns how many users
+// were warmed.
+func (s *CachedStorage) WarmUsers(ctx context.Context, userIDs []string) (int, error) {
+	warmed := 0
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return warmed, err
+		}
+
+		if err := s.WarmUser(ctx, userID); err != nil {
+			s.logger.Warn("Failed to warm user cache", zap.String("user_id", userID), zap.Error(err))
+			continue
+		}
+		warmed++
+	}
+	return warmed, nil
+}
+
+// SetDurableSessions enables writing sessions to the durable store as well as
+// the cache. In active-active deployments each region has its own Redis, so a
+// session created in one region is only visible in another through the
+// replicated durable store.
+func (s *CachedStorage) SetDurableSessions(enabled bool) {
+	s.durableSessions = enabled
+}
+
+// StoreSession stores a session in the cache and, if durable sessions are
+// enabled, in the durable store
+func (s *CachedStorage) StoreSession(ctx context.Context, sessionID string, userID string, expiry time.Duration) error {
+	if s.durableSessions {
+		// Write the durable copy first so a session is never cache-only
+		if err := s.Storage.StoreSession(ctx, sessionID, userID, expiry); err != nil {
+			return err
+		}
+	}
+
+	err := s.cache.StoreSession(ctx, sessionID, userID, expiry)
+	if err != nil && s.durableSessions {
+		// The durable copy still serves the session
+		s.logger.Warn("Failed to cache session", zap.Error(err))
+		return nil
+	}
+	return err
+}
+
+// GetSession resolves a session from the cache, falling back to the durable
+// store on a miss when durable sessions are enabled
+func (s *CachedStorage) GetSession(ctx context.Context, sessionID string) (string, error) {
+	userID, err := s.cache.GetSession(ctx, sessionID)
+	if err == nil || !s.durableSessions {
+		return userID, err
+	}
+
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || (storageErr.Code != ErrNotFound && storageErr.Code != ErrUnavailable) {
+		return "", err
+	}
+
+	return s.Storage.GetSession(ctx, sessionID)
+}
+
+// DeleteSession removes a session from the cache and the durable store
+func (s *CachedStorage) DeleteSession(ctx context.Context, sessionID string) error {
+	if err := s.cache.DeleteSession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	if s.durableSessions {
+		return s.Storage.DeleteSession(ctx, sessionID)
+	}
+	return nil
+}
+
+// setUserEntries writes a user's cache entries in a single round trip. A zero
+// expiration uses the per-entity defaults.
+func (c *RedisCache) setUserEntries(ctx context.Context, user *User, credentials []*Credential, methods []*MFAMethod, expiration time.Duration) error {
+	userData, err := json.Marshal(user)
+	if err != nil {
+		return &StorageError{Code: ErrInternal, Message: "Failed to marshal user for cache", Err: err}
+	}
+	credentialData, err := json.Marshal(credentials)
+	if err != nil {
+		return &StorageError{Code: ErrInternal, Message: "Failed to marshal credentials for cache", Err: err}
+	}
+	methodData, err := json.Marshal(methods)
+	if err != nil {
+		return &StorageError{Code: ErrInternal, Message: "Failed to marshal MFA methods for cache", Err: err}
+	}
+
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, c.keys.userKey(user.ID), userData, ttlOrDefault(expiration, c.ttls.User))
+		pipe.Set(ctx, c.keys.credentialsKey(user.ID), credentialData, ttlOrDefault(expiration, c.ttls.Credentials))
+		c.setMFAMethods(ctx, pipe, user.ID, methods, methodData, ttlOrDefault(expiration, c.ttls.MFAMethods))
+		return nil
+	})
+	if err != nil {
+		return c.wrapError("Failed to warm user cache", err)
+	}
+	return nil
+}
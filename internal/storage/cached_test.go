@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// warmStore serves a single user's records for warming. Other Storage
+// methods are unimplemented.
+type warmStore struct {
+	Storage
+	user        *User
+	credentials []*Credential
+	methods     []*MFAMethod
+	userErr     error
+	credErr     error
+}
+
+func (s *warmStore) GetUser(ctx context.Context, id string) (*User, error) {
+	return s.user, s.userErr
+}
+
+func (s *warmStore) GetCredentials(ctx context.Context, userID string) ([]*Credential, error) {
+	return s.credentials, s.credErr
+}
+
+func (s *warmStore) GetMFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error) {
+	return s.methods, nil
+}
+
+func newTestRedisCache(t *testing.T) *RedisCache {
+	t.Helper()
+	server := miniredis.RunT(t)
+	cache, err := NewRedisCache(RedisConfig{Options: &redis.Options{Addr: server.Addr()}}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { cache.client.Close() })
+	return cache
+}
+
+func TestWarmUser(t *testing.T) {
+	userErr := &StorageError{Code: ErrNotFound, Message: "User not found"}
+	credErr := &StorageError{Code: ErrInternal, Message: "Failed to query credentials"}
+
+	tests := []struct {
+		name     string
+		userErr  error
+		credErr  error
+		wantErrs []error
+	}{
+		{name: "caches user, credentials, and MFA methods"},
+		{name: "missing user", userErr: userErr, wantErrs: []error{userErr}},
+		{name: "failed credentials read", credErr: credErr, wantErrs: []error{credErr}},
+		{name: "joins every failure", userErr: userErr, credErr: credErr, wantErrs: []error{userErr, credErr}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &warmStore{
+				user:        &User{ID: "user-1", Email: "a@example.com"},
+				credentials: []*Credential{{ID: "cred-1", UserID: "user-1"}},
+				methods:     []*MFAMethod{{ID: "mfa-1", UserID: "user-1", Type: "totp"}},
+				userErr:     tt.userErr,
+				credErr:     tt.credErr,
+			}
+			cache := newTestRedisCache(t)
+			s := NewCachedStorage(store, cache, zap.NewNop(), 0)
+			ctx := context.Background()
+
+			err := s.WarmUser(ctx, "user-1")
+
+			if len(tt.wantErrs) > 0 {
+				for _, want := range tt.wantErrs {
+					if !errors.Is(err, want) {
+						t.Errorf("WarmUser() error = %v, want it to include %v", err, want)
+					}
+				}
+				if _, err := cache.GetMFAMethods(ctx, "user-1"); !isNotFound(err) {
+					t.Errorf("MFA methods cached after failure: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WarmUser: %v", err)
+			}
+
+			user, err := cache.GetUser(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("cached user: %v", err)
+			}
+			if user.ID != "user-1" || user.Email != "a@example.com" {
+				t.Errorf("cached user = %+v", user)
+			}
+
+			credentials, err := cache.GetCredentials(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("cached credentials: %v", err)
+			}
+			if len(credentials) != 1 || credentials[0].ID != "cred-1" {
+				t.Errorf("cached credentials = %+v", credentials)
+			}
+
+			methods, err := cache.GetMFAMethods(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("cached MFA methods: %v", err)
+			}
+			if !reflect.DeepEqual(methods, store.methods) {
+				t.Errorf("cached MFA methods = %+v, want %+v", methods, store.methods)
+			}
+			if owner, err := cache.MFAMethodOwner(ctx, "mfa-1"); err != nil || owner != "user-1" {
+				t.Errorf("MFAMethodOwner() = %q, %v, want user-1", owner, err)
+			}
+		})
+	}
+}
+
+// sessionStore is a durable store holding only sessions. Other Storage
+// methods are unimplemented.
+type sessionStore struct {
+	Storage
+	sessions map[string]string
+}
+
+func (s *sessionStore) StoreSession(ctx context.Context, sessionID string, userID string, expiry time.Duration) error {
+	s.sessions[sessionID] = userID
+	return nil
+}
+
+func (s *sessionStore) GetSession(ctx context.Context, sessionID string) (string, error) {
+	userID, ok := s.sessions[sessionID]
+	if !ok {
+		return "", &StorageError{Code: ErrNotFound, Message: "Session not found"}
+	}
+	return userID, nil
+}
+
+func (s *sessionStore) DeleteSession(ctx context.Context, sessionID string) error {
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+func TestCachedStorageDurableSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		durable     bool
+		evict       bool // remove the session from the cache after storing it
+		remote      bool // store the session only in the durable store, as another region would
+		cacheDown   bool
+		wantUser    string
+		wantErrCode string
+	}{
+		{name: "cached session", durable: true, wantUser: "user-1"},
+		{name: "evicted from the cache", durable: true, evict: true, wantUser: "user-1"},
+		{name: "created in another region", durable: true, remote: true, wantUser: "user-1"},
+		{name: "cache unavailable", durable: true, cacheDown: true, wantUser: "user-1"},
+		{name: "evicted without durable sessions", evict: true, wantErrCode: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &sessionStore{sessions: map[string]string{}}
+			cache := newTestRedisCache(t)
+			s := NewCachedStorage(store, cache, zap.NewNop(), 0)
+			s.SetDurableSessions(tt.durable)
+			ctx := context.Background()
+
+			if tt.remote {
+				store.sessions["sess-1"] = "user-1"
+			} else if err := s.StoreSession(ctx, "sess-1", "user-1", time.Hour); err != nil {
+				t.Fatalf("StoreSession: %v", err)
+			}
+			if tt.evict {
+				if err := cache.DeleteSession(ctx, "sess-1"); err != nil {
+					t.Fatalf("evict session: %v", err)
+				}
+			}
+			if tt.cacheDown {
+				cache.client.Close()
+			}
+
+			userID, err := s.GetSession(ctx, "sess-1")
+			if tt.wantErrCode != "" {
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != tt.wantErrCode {
+					t.Errorf("GetSession() error = %v, want code %s", err, tt.wantErrCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+			if userID != tt.wantUser {
+				t.Errorf("GetSession() = %q, want %q", userID, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestCachedStorageDeleteDurableSession(t *testing.T) {
+	store := &sessionStore{sessions: map[string]string{}}
+	cache := newTestRedisCache(t)
+	s := NewCachedStorage(store, cache, zap.NewNop(), 0)
+	s.SetDurableSessions(true)
+	ctx := context.Background()
+
+	if err := s.StoreSession(ctx, "sess-1", "user-1", time.Hour); err != nil {
+		t.Fatalf("StoreSession: %v", err)
+	}
+	if err := s.DeleteSession(ctx, "sess-1"); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+
+	if _, ok := store.sessions["sess-1"]; ok {
+		t.Error("session left in the durable store")
+	}
+	if _, err := s.GetSession(ctx, "sess-1"); !isNotFound(err) {
+		t.Errorf("GetSession() after delete error = %v, want not found", err)
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig configures a RedisCache
+type RedisConfig struct {
+	Options *redis.Options
+	Pool    RedisPoolConfig
+	// Namespace is prepended to every key; leave empty to disable prefixing
+	Namespace string
+	// Retry configures command retries after network errors. go-redis backs
+	// off exponentially between MinBackoff and MaxBackoff.
+	Retry RedisRetryConfig
+	// Probe configures the background health prober run by RunHealthProbe
+	Probe RedisProbeConfig
+	// TTLs are the default expirations for cached entities; zero fields use
+	// the package defaults
+	TTLs CacheTTLs
+}
+
+// RedisRetryConfig configures command retries. Zero values keep the go-redis
+// defaults; a negative MaxRetries disables retries.
+type RedisRetryConfig struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// RedisProbeConfig configures the health prober. Zero values use
+// DefaultProbeInterval and DefaultMaxProbeBackoff.
+type RedisProbeConfig struct {
+	Interval time.Duration
+	// MaxBackoff caps the probe interval while Redis is down
+	MaxBackoff time.Duration
+}
+
+// CacheTTLs are the default cache expirations per entity type, used when a
+// caller passes a zero expiration
+type CacheTTLs struct {
+	User        time.Duration
+	Credentials time.Duration
+	MFAMethods  time.Duration
+}
+
+// Default cache expirations
+const (
+	DefaultUserTTL        = 15 * time.Minute
+	DefaultCredentialsTTL = 15 * time.Minute
+	DefaultMFAMethodsTTL  = 5 * time.Minute
+)
+
+// withDefaults fills unset TTLs with the package defaults
+func (t CacheTTLs) withDefaults() CacheTTLs {
+	if t.User == 0 {
+		t.User = DefaultUserTTL
+	}
+	if t.Credentials == 0 {
+		t.Credentials = DefaultCredentialsTTL
+	}
+	if t.MFAMethods == 0 {
+		t.MFAMethods = DefaultMFAMethodsTTL
+	}
+	return t
+}
+
+// Validate reports the first problem with the configuration
+func (c RedisConfig) Validate() error {
+	if c.Options == nil {
+		return errors.New("redis options are required")
+	}
+	if strings.TrimSpace(c.Options.Addr) == "" {
+		return errors.New("redis address is required")
+	}
+	if c.Pool.PoolSize < 0 || c.Pool.MinIdleConns < 0 || c.Pool.PoolTimeout < 0 {
+		return errors.New("pool settings must not be negative")
+	}
+	if c.Pool.PoolSize > 0 && c.Pool.MinIdleConns > c.Pool.PoolSize {
+		return errors.New("min idle connections must not exceed the pool size")
+	}
+	if c.Retry.MinBackoff < 0 || c.Retry.MaxBackoff < 0 {
+		return errors.New("retry backoff must not be negative")
+	}
+	if c.Retry.MaxBackoff > 0 && c.Retry.MinBackoff > c.Retry.MaxBackoff {
+		return errors.New("min retry backoff must not exceed the max")
+	}
+	if c.Probe.Interval < 0 || c.Probe.MaxBackoff < 0 {
+		return errors.New("probe intervals must not be negative")
+	}
+	if c.TTLs.User < 0 || c.TTLs.Credentials < 0 || c.TTLs.MFAMethods < 0 {
+		return errors.New("cache TTLs must not be negative")
+	}
+	return nil
+}
+
+// NoSQLConfig configures a NoSQLStorage
+type NoSQLConfig struct {
+	TableName string
+	// Lenient makes credential and MFA method reads skip and log records
+	// that fail to decode, returning the rest, instead of failing outright
+	Lenient bool
+	// MFALookupSecret, when set, replaces the user ID on stored MFA method
+	// records with an HMAC of it keyed by this secret, so a table dump
+	// doesn't reveal which users have which factors. Lookups by user ID
+	// still work. Existing records must be rewritten when it is enabled or
+	// changed, e.g. with Migrate from a store using the old setting.
+	MFALookupSecret []byte
+}
+
+// Validate reports the first problem with the configuration
+func (c NoSQLConfig) Validate() error {
+	if strings.TrimSpace(c.TableName) == "" {
+		return errors.New("table name is required")
+	}
+	if c.MFALookupSecret != nil && len(c.MFALookupSecret) < minLookupSecretBytes {
+		return errors.New("MFA lookup secret must be at least 32 bytes")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisConfigValidate(t *testing.T) {
+	options := &redis.Options{Addr: "localhost:6379"}
+
+	tests := []struct {
+		name    string
+		cfg     RedisConfig
+		wantErr bool
+	}{
+		{name: "minimal", cfg: RedisConfig{Options: options}},
+		{
+			name: "fully configured",
+			cfg: RedisConfig{
+				Options:   options,
+				Pool:      RedisPoolConfig{PoolSize: 10, MinIdleConns: 2, PoolTimeout: time.Second},
+				Namespace: "polyid",
+				Retry:     RedisRetryConfig{MaxRetries: 3, MinBackoff: 10 * time.Millisecond, MaxBackoff: time.Second},
+				Probe:     RedisProbeConfig{Interval: time.Second, MaxBackoff: time.Minute},
+				TTLs:      CacheTTLs{User: time.Minute, Credentials: time.Minute, MFAMethods: time.Minute},
+			},
+		},
+		{name: "retries disabled", cfg: RedisConfig{Options: options, Retry: RedisRetryConfig{MaxRetries: -1}}},
+		{name: "no options", cfg: RedisConfig{}, wantErr: true},
+		{name: "no address", cfg: RedisConfig{Options: &redis.Options{Addr: " "}}, wantErr: true},
+		{name: "negative pool size", cfg: RedisConfig{Options: options, Pool: RedisPoolConfig{PoolSize: -1}}, wantErr: true},
+		{name: "negative pool timeout", cfg: RedisConfig{Options: options, Pool: RedisPoolConfig{PoolTimeout: -time.Second}}, wantErr: true},
+		{name: "more idle connections than the pool", cfg: RedisConfig{Options: options, Pool: RedisPoolConfig{PoolSize: 2, MinIdleConns: 3}}, wantErr: true},
+		{name: "negative backoff", cfg: RedisConfig{Options: options, Retry: RedisRetryConfig{MinBackoff: -time.Second}}, wantErr: true},
+		{name: "min backoff above max", cfg: RedisConfig{Options: options, Retry: RedisRetryConfig{MinBackoff: time.Second, MaxBackoff: time.Millisecond}}, wantErr: true},
+		{name: "negative probe interval", cfg: RedisConfig{Options: options, Probe: RedisProbeConfig{Interval: -time.Second}}, wantErr: true},
+		{name: "negative TTL", cfg: RedisConfig{Options: options, TTLs: CacheTTLs{MFAMethods: -time.Minute}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNoSQLConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     NoSQLConfig
+		wantErr bool
+	}{
+		{name: "minimal", cfg: NoSQLConfig{TableName: "polyid"}},
+		{name: "lookup secret", cfg: NoSQLConfig{TableName: "polyid", MFALookupSecret: bytes.Repeat([]byte{1}, minLookupSecretBytes)}},
+		{name: "no table name", cfg: NoSQLConfig{TableName: " "}, wantErr: true},
+		{name: "short lookup secret", cfg: NoSQLConfig{TableName: "polyid", MFALookupSecret: []byte("short")}, wantErr: true},
+		{name: "empty lookup secret", cfg: NoSQLConfig{TableName: "polyid", MFALookupSecret: []byte{}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheTTLDefaults(t *testing.T) {
+	got := CacheTTLs{User: time.Minute}.withDefaults()
+	want := CacheTTLs{User: time.Minute, Credentials: DefaultCredentialsTTL, MFAMethods: DefaultMFAMethodsTTL}
+	if got != want {
+		t.Errorf("withDefaults() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CounterResult is the state of a counter after an increment
+type CounterResult struct {
+	Count   int64
+	Allowed bool
+	// TTL is the time until the counter resets
+	TTL time.Duration
+}
+
+// incrScript increments a counter and sets its TTL only on the first
+// increment, so the window isn't pushed back by later increments
+var incrScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// incrWithLimitScript increments a counter unless it has reached the limit
+var incrWithLimitScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current >= tonumber(ARGV[2]) then
+	return {current, redis.call('PTTL', KEYS[1]), 0}
+end
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1]), 1}
+`)
+
+// Incr atomically increments a counter and returns the new count. The TTL is
+// applied when the counter is created.
+func (c *RedisCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, err := incrScript.Run(ctx, c.client, []string{c.keys.counterKey(key)}, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, c.wrapError("Failed to increment counter", err)
+	}
+	return count, nil
+}
+
+// IncrWithLimit atomically increments a counter unless it has already
+// reached limit. The TTL is applied when the counter is created.
+func (c *RedisCache) IncrWithLimit(ctx context.Context, key string, limit int64, ttl time.Duration) (CounterResult, error) {
+	values, err := incrWithLimitScript.Run(ctx, c.client, []string{c.keys.counterKey(key)},
+		ttl.Milliseconds(), limit).Int64Slice()
+	if err != nil {
+		return CounterResult{}, c.wrapError("Failed to increment counter", err)
+	}
+
+	return CounterResult{
+		Count:   values[0],
+		TTL:     time.Duration(values[1]) * time.Millisecond,
+		Allowed: values[2] == 1,
+	}, nil
+}
+
+// ResetCounter deletes a counter, so the next increment starts a new window
+func (c *RedisCache) ResetCounter(ctx context.Context, key string) error {
+	if err := c.client.Del(ctx, c.keys.counterKey(key)).Err(); err != nil {
+		return c.wrapError("Failed to reset counter", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncrConcurrent(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+	const workers = 50
+
+	var wg sync.WaitGroup
+	counts := make(chan int64, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := cache.Incr(ctx, "logins", time.Minute)
+			if err != nil {
+				t.Errorf("Incr: %v", err)
+				return
+			}
+			counts <- count
+		}()
+	}
+	wg.Wait()
+	close(counts)
+
+	// Every increment sees a distinct count
+	seen := make(map[int64]bool)
+	for count := range counts {
+		if seen[count] {
+			t.Errorf("count %d returned twice", count)
+		}
+		seen[count] = true
+	}
+	for count := int64(1); count <= workers; count++ {
+		if !seen[count] {
+			t.Errorf("count %d never returned", count)
+		}
+	}
+}
+
+func TestIncrTTLSetOnce(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+	key := cache.keys.counterKey("logins")
+
+	if _, err := cache.Incr(ctx, "logins", time.Minute); err != nil {
+		t.Fatalf("Incr: %v", err)
+	}
+	ttl, err := cache.client.PTTL(ctx, key).Result()
+	if err != nil {
+		t.Fatalf("PTTL: %v", err)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL after first Incr = %v, want up to %v", ttl, time.Minute)
+	}
+
+	// Shorten the window; later increments must not push it back
+	if err := cache.client.PExpire(ctx, key, 10*time.Second).Err(); err != nil {
+		t.Fatalf("PExpire: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Incr(ctx, "logins", time.Minute); err != nil {
+			t.Fatalf("Incr: %v", err)
+		}
+	}
+	if ttl, err := cache.client.PTTL(ctx, key).Result(); err != nil || ttl > 10*time.Second {
+		t.Errorf("TTL after later Incr = %v, %v, want at most %v", ttl, err, 10*time.Second)
+	}
+
+	if err := cache.ResetCounter(ctx, "logins"); err != nil {
+		t.Fatalf("ResetCounter: %v", err)
+	}
+	if count, err := cache.Incr(ctx, "logins", time.Minute); err != nil || count != 1 {
+		t.Errorf("Incr() after reset = %d, %v, want 1", count, err)
+	}
+}
+
+func TestIncrWithLimitConcurrent(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+	const workers, limit = 50, 10
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := cache.IncrWithLimit(ctx, "sms", limit, time.Minute)
+			if err != nil {
+				t.Errorf("IncrWithLimit: %v", err)
+				return
+			}
+			if result.Count > limit {
+				t.Errorf("IncrWithLimit() count = %d, over the limit %d", result.Count, limit)
+			}
+			if result.TTL <= 0 || result.TTL > time.Minute {
+				t.Errorf("IncrWithLimit() TTL = %v, want up to %v", result.TTL, time.Minute)
+			}
+			if result.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != limit {
+		t.Errorf("%d increments allowed, want %d", allowed, limit)
+	}
+	count, err := cache.client.Get(ctx, cache.keys.counterKey("sms")).Int64()
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if count != limit {
+		t.Errorf("counter = %d, want %d", count, limit)
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DeleteResult describes the records a cascading user deletion removed
+type DeleteResult struct {
+	UserID      string
+	Credentials []string
+	MFAMethods  []string
+	Sessions    int
+	DeletedAt   time.Time
+}
+
+// DeleteNotifier is told about completed cascading deletions, typically to
+// publish a user.deleted event
+type DeleteNotifier interface {
+	UserDeleted(ctx context.Context, result DeleteResult) error
+}
+
+// SetDeleteNotifier sets the notifier called after each successful
+// cascading deletion
+func (s *NoSQLStorage) SetDeleteNotifier(notifier DeleteNotifier) {
+	s.deleteNotifier = notifier
+}
+
+// DeleteUserCascade implements Storage.DeleteUserCascade. The user, their
+// credentials and any kept attestations, MFA methods, sessions, and email
+// reservation are deleted in one transaction; the notifier is called only
+// after it commits. Sessions stored before sessions recorded their ID can't
+// be found by user and are left to expire, but no longer resolve to a user.
+func (s *NoSQLStorage) DeleteUserCascade(ctx context.Context, userID string) error {
+	var result DeleteResult
+	err := s.Transaction(ctx, func(tx Storage) error {
+		var err error
+		result, err = tx.(*NoSQLStorage).deleteUserCascade(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.deleteNotifier != nil {
+		if err := s.deleteNotifier.UserDeleted(ctx, result); err != nil {
+			s.logger.Error("Failed to notify user deletion",
+				zap.Error(err),
+				zap.String("user_id", userID))
+		}
+	}
+
+	return nil
+}
+
+// deleteUserCascade performs the deletes against a transaction-scoped
+// storage
+func (s *NoSQLStorage) deleteUserCascade(ctx context.Context, userID string) (DeleteResult, error) {
+	result := DeleteResult{
+		UserID:    userID,
+		DeletedAt: time.Now(),
+	}
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return result, err
+	}
+	holder, err := s.emailHolder(ctx, user.Email)
+	if err != nil {
+		return result, err
+	}
+
+	credentials, err := s.GetCredentials(ctx, userID)
+	if err != nil {
+		return result, err
+	}
+	methods, err := s.GetMFAMethods(ctx, userID)
+	if err != nil {
+		return result, err
+	}
+	sessions, err := s.userSessionKeys(ctx, userID)
+	if err != nil {
+		return result, err
+	}
+
+	keys := make([]string, 0, 2*len(credentials)+len(methods)+len(sessions)+1)
+	for _, credential := range credentials {
+		// Deleting an attestation that was never kept is a no-op
+		keys = append(keys, credential.ID, attestationKey(credential.ID))
+		result.Credentials = append(result.Credentials, credential.ID)
+	}
+	for _, method := range methods {
+		keys = append(keys, method.ID)
+		result.MFAMethods = append(result.MFAMethods, method.ID)
+	}
+	keys = append(keys, sessions...)
+	result.Sessions = len(sessions)
+	if holder == userID {
+		keys = append(keys, emailKey(user.Email))
+	}
+	keys = append(keys, userID)
+
+	if err := s.deleteKeys(ctx, "Failed to delete user records", keys...); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// userSessionKeys returns the keys of the user's sessions that recorded
+// their user ID
+func (s *NoSQLStorage) userSessionKeys(ctx context.Context, userID string) ([]string, error) {
+	sessions, err := s.query(ctx, "user-sessions-index", Eq("user_id", userID))
+	if err != nil {
+		return nil, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to query sessions",
+			Err:     err,
+		}
+	}
+
+	keys := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if sessionID, ok := session["session_id"].(string); ok {
+			keys = append(keys, fmt.Sprintf("session:%s", sessionID))
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recordingDeleteNotifier records the deletions it is told about
+type recordingDeleteNotifier struct {
+	results []DeleteResult
+}
+
+func (n *recordingDeleteNotifier) UserDeleted(ctx context.Context, result DeleteResult) error {
+	n.results = append(n.results, result)
+	return nil
+}
+
+// seedDeleteUsers seeds user-1 with a credential, its attestation, an MFA
+// method, a session, and an email reservation, alongside user-2's records
+func seedDeleteUsers(client *fakeTxClient) {
+	client.seed("email-index", "user-1", map[string]interface{}{"id": "user-1", "email": "a@example.com"})
+	client.seed("", "email:a@example.com", map[string]interface{}{"email": "a@example.com", "user_id": "user-1"})
+	client.seed("user-credentials-index", "cred-1", map[string]interface{}{"id": "cred-1", "user_id": "user-1", "public_key": "AQID"})
+	client.seed("", "attestation:cred-1", map[string]interface{}{"credential_id": "cred-1", "format": "packed"})
+	client.seed("user-mfa-index", "mfa-1", map[string]interface{}{"id": "mfa-1", "user_id": "user-1", "type": "totp"})
+	client.seed("user-sessions-index", "session:s1", map[string]interface{}{"session_id": "s1", "user_id": "user-1"})
+	client.seed("email-index", "user-2", map[string]interface{}{"id": "user-2", "email": "b@example.com"})
+	client.seed("user-credentials-index", "cred-2", map[string]interface{}{"id": "cred-2", "user_id": "user-2", "public_key": "BAUG"})
+	client.seed("user-sessions-index", "session:s2", map[string]interface{}{"session_id": "s2", "user_id": "user-2"})
+}
+
+func TestDeleteUserCascade(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      string
+		emailHolder string
+		commitErr   error
+		wantCode    string
+		wantKeys    []string
+		wantResult  *DeleteResult
+	}{
+		{
+			name:     "deletes every related record",
+			userID:   "user-1",
+			wantKeys: []string{"cred-2", "session:s2", "user-2"},
+			wantResult: &DeleteResult{
+				UserID:      "user-1",
+				Credentials: []string{"cred-1"},
+				MFAMethods:  []string{"mfa-1"},
+				Sessions:    1,
+			},
+		},
+		{
+			name:        "keeps an email reserved by another user",
+			userID:      "user-1",
+			emailHolder: "user-2",
+			wantKeys:    []string{"cred-2", "email:a@example.com", "session:s2", "user-2"},
+			wantResult: &DeleteResult{
+				UserID:      "user-1",
+				Credentials: []string{"cred-1"},
+				MFAMethods:  []string{"mfa-1"},
+				Sessions:    1,
+			},
+		},
+		{
+			name:     "unknown user",
+			userID:   "user-9",
+			wantCode: ErrNotFound,
+		},
+		{
+			name:      "failed commit deletes nothing",
+			userID:    "user-1",
+			commitErr: errors.New("transaction cancelled"),
+			wantCode:  ErrInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeTxClient()
+			seedDeleteUsers(client)
+			if tt.emailHolder != "" {
+				client.items["email:a@example.com"]["user_id"] = tt.emailHolder
+			}
+			client.commitErr = tt.commitErr
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			notifier := &recordingDeleteNotifier{}
+			s.SetDeleteNotifier(notifier)
+			before := client.keys()
+
+			err = s.DeleteUserCascade(context.Background(), tt.userID)
+
+			if tt.wantCode != "" {
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+					t.Errorf("DeleteUserCascade() = %v, want code %s", err, tt.wantCode)
+				}
+				if after := client.keys(); !reflect.DeepEqual(after, before) {
+					t.Errorf("keys = %v, want %v", after, before)
+				}
+				if len(notifier.results) != 0 {
+					t.Errorf("notifications = %d, want 0", len(notifier.results))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DeleteUserCascade: %v", err)
+			}
+
+			if keys := client.keys(); !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if len(notifier.results) != 1 {
+				t.Fatalf("notifications = %d, want 1", len(notifier.results))
+			}
+			result := notifier.results[0]
+			if result.DeletedAt.IsZero() {
+				t.Error("result has no deletion time")
+			}
+			tt.wantResult.DeletedAt = result.DeletedAt
+			if !reflect.DeepEqual(result, *tt.wantResult) {
+				t.Errorf("result = %+v, want %+v", result, *tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestCachedDeleteUserCascade(t *testing.T) {
+	client := newFakeTxClient()
+	seedDeleteUsers(client)
+	durable, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+	cache := newTestRedisCache(t)
+	s := NewCachedStorage(durable, cache, zap.NewNop(), time.Hour)
+	ctx := context.Background()
+
+	if err := cache.SetUser(ctx, &User{ID: "user-1", Email: "a@example.com"}, 0); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if err := cache.StoreSession(ctx, "s1", "user-1", time.Hour); err != nil {
+		t.Fatalf("StoreSession: %v", err)
+	}
+	if err := cache.StoreSession(ctx, "s2", "user-2", time.Hour); err != nil {
+		t.Fatalf("StoreSession: %v", err)
+	}
+
+	if err := s.DeleteUserCascade(ctx, "user-1"); err != nil {
+		t.Fatalf("DeleteUserCascade: %v", err)
+	}
+
+	if _, err := cache.GetUser(ctx, "user-1"); !isNotFound(err) {
+		t.Errorf("cached user after deletion: %v, want not found", err)
+	}
+	if _, err := cache.GetSession(ctx, "s1"); !isNotFound(err) {
+		t.Errorf("cached session after deletion: %v, want not found", err)
+	}
+	if userID, err := cache.GetSession(ctx, "s2"); err != nil || userID != "user-2" {
+		t.Errorf("another user's session = %q, %v, want user-2", userID, err)
+	}
+}
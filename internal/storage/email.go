@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// emailKey is the key of the record reserving an email for one user. Users
+// only reserve their email through clients with conditional writes; users
+// created before reservations are still found by the email index.
+func emailKey(email string) string {
+	return fmt.Sprintf("email:%s", email)
+}
+
+// reserveEmail claims email for userID with a conditional create, so of two
+// writers racing for the same email only one succeeds; the other gets
+// ErrAlreadyExists. It reports whether it created the reservation, which
+// the caller must release if its write fails. Without conditional writes
+// nothing is reserved and uniqueness is only checked, not enforced.
+func (s *NoSQLStorage) reserveEmail(ctx context.Context, email string, userID string) (bool, error) {
+	writer, ok := s.client.(NoSQLConditionalWriter)
+	if !ok {
+		return false, nil
+	}
+
+	created, err := writer.PutIfAbsent(ctx, s.tableName, emailKey(email), map[string]interface{}{
+		"email":   email,
+		"user_id": userID,
+	})
+	if err != nil {
+		return false, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to reserve email",
+			Err:     err,
+		}
+	}
+	if created {
+		return true, nil
+	}
+
+	holder, err := s.emailHolder(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	if holder != userID {
+		return false, &StorageError{
+			Code:    ErrAlreadyExists,
+			Message: "Email already in use",
+		}
+	}
+	return false, nil
+}
+
+// releaseEmail drops userID's reservation of email, leaving any other
+// user's reservation in place. Failures are logged; a stale reservation
+// only keeps the email from being reused.
+func (s *NoSQLStorage) releaseEmail(ctx context.Context, email string, userID string) {
+	writer, ok := s.client.(NoSQLConditionalWriter)
+	if !ok {
+		return
+	}
+
+	if _, err := writer.DeleteIf(ctx, s.tableName, emailKey(email), "user_id", userID); err != nil {
+		s.logger.Warn("Failed to release email reservation",
+			zap.Error(err),
+			zap.String("user_id", userID))
+	}
+}
+
+// emailHolder returns the ID of the user holding email's reservation, or ""
+// if it isn't reserved
+func (s *NoSQLStorage) emailHolder(ctx context.Context, email string) (string, error) {
+	result, err := s.client.Get(ctx, s.tableName, emailKey(email))
+	if err != nil {
+		return "", &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to get email reservation",
+			Err:     err,
+		}
+	}
+	userID, _ := result["user_id"].(string)
+	return userID, nil
+}
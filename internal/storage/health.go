@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// errCacheDown is returned without contacting Redis while the health prober
+// considers it unavailable
+var errCacheDown = errors.New("redis is unavailable")
+
+// Health prober defaults
+const (
+	DefaultProbeInterval   = 5 * time.Second
+	DefaultMaxProbeBackoff = time.Minute
+	probeTimeout           = time.Second
+)
+
+// Available reports whether the last health probe succeeded. It is true
+// until a probe fails.
+func (c *RedisCache) Available() bool {
+	return !c.down.Load()
+}
+
+// Check implements auth.HealthChecker, reporting ErrUnavailable while the
+// prober considers Redis down
+func (c *RedisCache) Check(ctx context.Context) error {
+	if !c.Available() {
+		return &StorageError{
+			Code:    ErrUnavailable,
+			Message: "Cache unavailable",
+			Err:     errCacheDown,
+		}
+	}
+	return nil
+}
+
+// RunHealthProbe pings Redis every probe interval until ctx is cancelled.
+// After a failed ping, commands fail fast with ErrUnavailable instead of
+// waiting on timeouts, and pings back off exponentially up to the max probe
+// backoff until one succeeds.
+func (c *RedisCache) RunHealthProbe(ctx context.Context) {
+	interval := c.probe.Interval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if c.ping(ctx) {
+			interval = c.probe.Interval
+		} else {
+			interval *= 2
+			if interval > c.probe.MaxBackoff {
+				interval = c.probe.MaxBackoff
+			}
+		}
+		timer.Reset(interval)
+	}
+}
+
+// ping probes Redis and records the result, logging availability changes
+func (c *RedisCache) ping(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	// The probe bypasses the fail-fast hook so it can detect recovery
+	err := c.client.Ping(withProbe(pingCtx)).Err()
+	wasDown := c.down.Swap(err != nil)
+
+	switch {
+	case err != nil && !wasDown:
+		c.logger.Error("Redis became unavailable", zap.Error(err))
+	case err == nil && wasDown:
+		c.logger.Info("Redis is available again")
+	}
+	return err == nil
+}
+
+type probeKey struct{}
+
+func withProbe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, probeKey{}, true)
+}
+
+func isProbe(ctx context.Context) bool {
+	probe, _ := ctx.Value(probeKey{}).(bool)
+	return probe
+}
+
+// failFastHook rejects commands while Redis is marked unavailable
+type failFastHook struct {
+	cache *RedisCache
+}
+
+func (h failFastHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h failFastHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !h.cache.Available() && !isProbe(ctx) {
+			cmd.SetErr(errCacheDown)
+			return errCacheDown
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h failFastHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !h.cache.Available() {
+			for _, cmd := range cmds {
+				cmd.SetErr(errCacheDown)
+			}
+			return errCacheDown
+		}
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// newProbedRedisCache creates a cache that doesn't retry, so an outage
+// fails commands immediately
+func newProbedRedisCache(t *testing.T, probe RedisProbeConfig) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	cache, err := NewRedisCache(RedisConfig{
+		Options: &redis.Options{Addr: server.Addr()},
+		Retry:   RedisRetryConfig{MaxRetries: -1},
+		Probe:   probe,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { cache.client.Close() })
+	return cache, server
+}
+
+// waitForAvailable waits until the cache's availability is want
+func waitForAvailable(t *testing.T, cache *RedisCache, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for cache.Available() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Available() stayed %v", !want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRedisOutageAndRecovery(t *testing.T) {
+	cache, server := newProbedRedisCache(t, RedisProbeConfig{})
+	ctx := context.Background()
+
+	if !cache.ping(ctx) || !cache.Available() {
+		t.Fatal("probe of a running server failed")
+	}
+	if err := cache.Set(ctx, "k", "1", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	server.Close()
+	if cache.ping(ctx) {
+		t.Fatal("probe of a stopped server succeeded")
+	}
+	var storageErr *StorageError
+	if err := cache.Check(ctx); !errors.As(err, &storageErr) || storageErr.Code != ErrUnavailable {
+		t.Errorf("Check() while down = %v, want code %s", err, ErrUnavailable)
+	}
+	// Commands fail fast rather than dialing
+	if err := cache.Set(ctx, "k", "2", time.Minute); !errors.As(err, &storageErr) || storageErr.Code != ErrUnavailable || !errors.Is(storageErr.Err, errCacheDown) {
+		t.Errorf("Set() while down = %v, want fail-fast %s", err, ErrUnavailable)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if !cache.ping(ctx) {
+		t.Fatal("probe after recovery failed")
+	}
+	if err := cache.Check(ctx); err != nil {
+		t.Errorf("Check() after recovery = %v", err)
+	}
+	if err := cache.Set(ctx, "k", "3", time.Minute); err != nil {
+		t.Errorf("Set() after recovery = %v", err)
+	}
+}
+
+func TestRunHealthProbe(t *testing.T) {
+	cache, server := newProbedRedisCache(t, RedisProbeConfig{Interval: 5 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cache.RunHealthProbe(ctx)
+		close(done)
+	}()
+
+	server.Close()
+	waitForAvailable(t, cache, false)
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	waitForAvailable(t, cache, true)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunHealthProbe did not stop after cancellation")
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InvalidationError reports the users whose cache entries InvalidateUsers
+// couldn't delete, keyed by user ID
+type InvalidationError struct {
+	Failed map[string]error
+}
+
+func (e *InvalidationError) Error() string {
+	return fmt.Sprintf("failed to invalidate cache for %d users", len(e.Failed))
+}
+
+// InvalidateUsers invalidates the cache entries of every user in userIDs in
+// a single pipelined round trip, e.g. after a tenant-wide policy change.
+// Each user's delete succeeds or fails on its own; failures don't abort the
+// rest of the batch and are returned as an *InvalidationError.
+func (c *RedisCache) InvalidateUsers(ctx context.Context, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	cmds := make([][]redis.Cmder, len(userIDs))
+	// The pipeline only returns the first failed command's error, so each
+	// user's commands are checked below instead
+	_, _ = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, userID := range userIDs {
+			genKey := c.keys.mfaGenerationKey(userID)
+			cmds[i] = []redis.Cmder{
+				// Bump the generation so in-flight MFA loads aren't cached
+				pipe.Incr(ctx, genKey),
+				pipe.Expire(ctx, genKey, mfaGenerationTTL),
+				pipe.Del(ctx,
+					c.keys.userKey(userID),
+					c.keys.credentialsKey(userID),
+					c.keys.mfaKey(userID)),
+			}
+		}
+		return nil
+	})
+
+	var failed map[string]error
+	for i, userCmds := range cmds {
+		if err := firstCmdError(userCmds); err != nil {
+			if failed == nil {
+				failed = make(map[string]error)
+			}
+			failed[userIDs[i]] = c.wrapError("Failed to delete cache keys", err)
+		}
+	}
+	if failed != nil {
+		return &InvalidationError{Failed: failed}
+	}
+	return nil
+}
+
+// firstCmdError returns the error of the first failed command, if any
+func firstCmdError(cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
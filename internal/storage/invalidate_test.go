@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// seedCachedUser caches a user with credentials and MFA methods and returns
+// its cache keys
+func seedCachedUser(t *testing.T, cache *RedisCache, userID string) []string {
+	t.Helper()
+	ctx := context.Background()
+	if err := cache.SetUser(ctx, &User{ID: userID}, 0); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if err := cache.SetCredentials(ctx, userID, []*Credential{{ID: userID + "-cred", UserID: userID}}, 0); err != nil {
+		t.Fatalf("SetCredentials: %v", err)
+	}
+	if err := cache.SetMFAMethods(ctx, userID, []*MFAMethod{{ID: userID + "-mfa", UserID: userID, Type: "totp"}}, 0); err != nil {
+		t.Fatalf("SetMFAMethods: %v", err)
+	}
+	return []string{cache.keys.userKey(userID), cache.keys.credentialsKey(userID), cache.keys.mfaKey(userID)}
+}
+
+// cachedKeys returns how many of keys exist
+func cachedKeys(t *testing.T, cache *RedisCache, keys []string) int64 {
+	t.Helper()
+	n, err := cache.client.Exists(context.Background(), keys...).Result()
+	if err != nil {
+		t.Fatalf("Exists: %v", err)
+	}
+	return n
+}
+
+func TestInvalidateUsers(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+
+	keys := make(map[string][]string)
+	for _, userID := range []string{"user-1", "user-2", "user-3"} {
+		keys[userID] = seedCachedUser(t, cache, userID)
+	}
+
+	if err := cache.InvalidateUsers(ctx, nil); err != nil {
+		t.Fatalf("InvalidateUsers(nil) = %v", err)
+	}
+	if err := cache.InvalidateUsers(ctx, []string{"user-1", "user-2", "user-unknown"}); err != nil {
+		t.Fatalf("InvalidateUsers: %v", err)
+	}
+
+	for userID, want := range map[string]int64{"user-1": 0, "user-2": 0, "user-3": 3} {
+		if n := cachedKeys(t, cache, keys[userID]); n != want {
+			t.Errorf("%s has %d cached keys, want %d", userID, n, want)
+		}
+	}
+	for _, userID := range []string{"user-1", "user-2"} {
+		gen, err := cache.client.Get(ctx, cache.keys.mfaGenerationKey(userID)).Int()
+		if err != nil || gen != 1 {
+			t.Errorf("%s MFA generation = %d, %v, want 1", userID, gen, err)
+		}
+	}
+}
+
+func TestInvalidateUsersPartialFailure(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+
+	keys := make(map[string][]string)
+	for _, userID := range []string{"user-1", "user-2", "user-3"} {
+		keys[userID] = seedCachedUser(t, cache, userID)
+	}
+	// A non-numeric generation fails user-2's INCR only
+	if err := cache.client.Set(ctx, cache.keys.mfaGenerationKey("user-2"), "corrupt", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	err := cache.InvalidateUsers(ctx, []string{"user-1", "user-2", "user-3"})
+	var invalidationErr *InvalidationError
+	if !errors.As(err, &invalidationErr) {
+		t.Fatalf("InvalidateUsers() = %v, want an *InvalidationError", err)
+	}
+	if len(invalidationErr.Failed) != 1 || invalidationErr.Failed["user-2"] == nil {
+		t.Fatalf("failed users = %v, want only user-2", invalidationErr.Failed)
+	}
+	var storageErr *StorageError
+	if !errors.As(invalidationErr.Failed["user-2"], &storageErr) {
+		t.Errorf("user-2 error = %v, want a *StorageError", invalidationErr.Failed["user-2"])
+	}
+
+	// The rest of the batch still ran
+	for _, userID := range []string{"user-1", "user-3"} {
+		if n := cachedKeys(t, cache, keys[userID]); n != 0 {
+			t.Errorf("%s has %d cached keys, want 0", userID, n)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import "fmt"
+
+// keyBuilder builds Redis keys under an optional namespace so several
+// environments can share one Redis without colliding
+type keyBuilder struct {
+	namespace string
+}
+
+// newKeyBuilder creates a key builder for the given namespace
+func newKeyBuilder(namespace string) keyBuilder {
+	return keyBuilder{namespace: namespace}
+}
+
+func (b keyBuilder) build(kind string, id string) string {
+	if b.namespace == "" {
+		return fmt.Sprintf("%s:%s", kind, id)
+	}
+	return fmt.Sprintf("%s:%s:%s", b.namespace, kind, id)
+}
+
+func (b keyBuilder) userKey(userID string) string {
+	return b.build("user", userID)
+}
+
+func (b keyBuilder) credentialsKey(userID string) string {
+	return b.build("credentials", userID)
+}
+
+func (b keyBuilder) mfaKey(userID string) string {
+	return b.build("mfa", userID)
+}
+
+func (b keyBuilder) mfaGenerationKey(userID string) string {
+	return b.build("mfa-gen", userID)
+}
+
+func (b keyBuilder) mfaOwnerKey(methodID string) string {
+	return b.build("mfa-owner", methodID)
+}
+
+func (b keyBuilder) tempKey(key string) string {
+	return b.build("temp", key)
+}
+
+func (b keyBuilder) sessionKey(sessionID string) string {
+	return b.build("session", sessionID)
+}
+
+func (b keyBuilder) userSessionsKey(userID string) string {
+	return b.build("user-sessions", userID)
+}
+
+func (b keyBuilder) revocationKey() string {
+	return b.build("revoked", "tokens")
+}
+
+func (b keyBuilder) counterKey(key string) string {
+	return b.build("counter", key)
+}
+
+func (b keyBuilder) lockKey(key string) string {
+	return b.build("lock", key)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import "testing"
+
+func TestKeyBuilder(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		key       func(b keyBuilder) string
+		want      string
+	}{
+		{name: "user", key: func(b keyBuilder) string { return b.userKey("u1") }, want: "user:u1"},
+		{name: "namespaced user", namespace: "prod", key: func(b keyBuilder) string { return b.userKey("u1") }, want: "prod:user:u1"},
+		{name: "credentials", namespace: "prod", key: func(b keyBuilder) string { return b.credentialsKey("u1") }, want: "prod:credentials:u1"},
+		{name: "MFA methods", namespace: "prod", key: func(b keyBuilder) string { return b.mfaKey("u1") }, want: "prod:mfa:u1"},
+		{name: "MFA generation", namespace: "prod", key: func(b keyBuilder) string { return b.mfaGenerationKey("u1") }, want: "prod:mfa-gen:u1"},
+		{name: "MFA owner", namespace: "prod", key: func(b keyBuilder) string { return b.mfaOwnerKey("m1") }, want: "prod:mfa-owner:m1"},
+		{name: "temporary value", namespace: "prod", key: func(b keyBuilder) string { return b.tempKey("otp:u1") }, want: "prod:temp:otp:u1"},
+		{name: "session", namespace: "prod", key: func(b keyBuilder) string { return b.sessionKey("s1") }, want: "prod:session:s1"},
+		{name: "user sessions", namespace: "prod", key: func(b keyBuilder) string { return b.userSessionsKey("u1") }, want: "prod:user-sessions:u1"},
+		{name: "revocation list", namespace: "prod", key: func(b keyBuilder) string { return b.revocationKey() }, want: "prod:revoked:tokens"},
+		{name: "counter", namespace: "prod", key: func(b keyBuilder) string { return b.counterKey("login:u1") }, want: "prod:counter:login:u1"},
+		{name: "lock", namespace: "prod", key: func(b keyBuilder) string { return b.lockKey("u1") }, want: "prod:lock:u1"},
+		{name: "unnamespaced lock", key: func(b keyBuilder) string { return b.lockKey("u1") }, want: "lock:u1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key(newKeyBuilder(tt.namespace)); got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// lockRetryInterval is how often Lock retries while the lock is held
+const lockRetryInterval = 50 * time.Millisecond
+
+// releaseScript deletes the lock only if it still holds the caller's token,
+// so a holder whose lock expired can't release someone else's
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lock acquires a distributed lock on key, waiting until it is free, ttl
+// elapses, or ctx is done. The lock expires after ttl even if it is never
+// released, so ttl must exceed the critical section. The returned unlock
+// function releases the lock only if it is still owned by this caller.
+func (c *RedisCache) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to generate lock token",
+			Err:     err,
+		}
+	}
+	token := hex.EncodeToString(b)
+	lockKey := c.keys.lockKey(key)
+
+	deadline := time.Now().Add(ttl)
+	for {
+		acquired, err := c.client.SetNX(ctx, lockKey, token, ttl).Result()
+		if err != nil {
+			return nil, c.wrapError("Failed to acquire lock", err)
+		}
+		if acquired {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return nil, &StorageError{
+				Code:    ErrLocked,
+				Message: "Lock is held",
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	unlock := func() {
+		// Release even if the caller's context was cancelled
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := releaseScript.Run(releaseCtx, c.client, []string{lockKey}, token).Err(); err != nil {
+			c.logger.Warn("Failed to release lock", zap.String("key", key), zap.Error(err))
+		}
+	}
+	return unlock, nil
+}
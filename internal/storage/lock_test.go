@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockMutualExclusion(t *testing.T) {
+	cache := newTestRedisCache(t)
+	const workers = 10
+
+	var (
+		mu        sync.Mutex
+		active    int
+		maxActive int
+		completed int
+		wg        sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := cache.Lock(context.Background(), "enroll:user-1", 5*time.Second)
+			if err != nil {
+				t.Errorf("Lock: %v", err)
+				return
+			}
+			defer unlock()
+
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			active--
+			completed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("%d holders at once, want 1", maxActive)
+	}
+	if completed != workers {
+		t.Errorf("%d workers completed, want %d", completed, workers)
+	}
+}
+
+func TestLockHeld(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+
+	unlock, err := cache.Lock(ctx, "enroll:user-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer unlock()
+
+	// Another key is independent
+	other, err := cache.Lock(ctx, "enroll:user-2", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock(other key): %v", err)
+	}
+	other()
+
+	// Waiting gives up after the TTL
+	_, err = cache.Lock(ctx, "enroll:user-1", 100*time.Millisecond)
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrLocked {
+		t.Errorf("Lock() on a held lock = %v, want code %s", err, ErrLocked)
+	}
+
+	// ...or when the context is done
+	cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := cache.Lock(cancelCtx, "enroll:user-1", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Lock() with an expiring context = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestUnlockOnlyByOwner(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+	lockKey := cache.keys.lockKey("enroll:user-1")
+
+	staleUnlock, err := cache.Lock(ctx, "enroll:user-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	// The first holder's lock expires and another caller takes it
+	if err := cache.client.Del(ctx, lockKey).Err(); err != nil {
+		t.Fatalf("expire lock: %v", err)
+	}
+	unlock, err := cache.Lock(ctx, "enroll:user-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock after expiry: %v", err)
+	}
+
+	// The stale holder's release leaves the new holder's lock in place
+	staleUnlock()
+	if n, err := cache.client.Exists(ctx, lockKey).Result(); err != nil || n != 1 {
+		t.Fatalf("lock after stale release: exists = %d, %v, want 1", n, err)
+	}
+
+	unlock()
+	if n, err := cache.client.Exists(ctx, lockKey).Result(); err != nil || n != 0 {
+		t.Errorf("lock after owner release: exists = %d, %v, want 0", n, err)
+	}
+
+	// Releasing twice is harmless
+	unlock()
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// minLookupSecretBytes is the minimum MFA lookup secret length
+const minLookupSecretBytes = 32
+
+// DeriveLookupKey returns the owner key stored on MFA method records for
+// userID when NoSQLConfig.MFALookupSecret is secret. It is stable for a given
+// secret and user.
+func DeriveLookupKey(secret []byte, userID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mfaOwnerKey returns the value stored as an MFA method's user ID
+func (s *NoSQLStorage) mfaOwnerKey(userID string) string {
+	if s.mfaLookupSecret == nil {
+		return userID
+	}
+	return DeriveLookupKey(s.mfaLookupSecret, userID)
+}
+
+// putMFAMethod writes an MFA method record with its owner key in place of
+// the user ID. method itself is left unchanged.
+func (s *NoSQLStorage) putMFAMethod(ctx context.Context, method *MFAMethod) error {
+	stored := *method
+	stored.UserID = s.mfaOwnerKey(method.UserID)
+	return s.putRecord(ctx, stored.ID, &stored)
+}
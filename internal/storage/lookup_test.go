@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDeriveLookupKey(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, minLookupSecretBytes)
+	other := bytes.Repeat([]byte{2}, minLookupSecretBytes)
+	key := DeriveLookupKey(secret, "user-1")
+
+	if again := DeriveLookupKey(secret, "user-1"); again != key {
+		t.Errorf("DeriveLookupKey() = %q then %q, want stable keys", key, again)
+	}
+	if key == "user-1" {
+		t.Error("DeriveLookupKey() returned the user ID")
+	}
+	if DeriveLookupKey(secret, "user-2") == key {
+		t.Error("two users derived the same key")
+	}
+	if DeriveLookupKey(other, "user-1") == key {
+		t.Error("two secrets derived the same key")
+	}
+}
+
+func TestNoSQLMFALookupSecret(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, minLookupSecretBytes)
+
+	tests := []struct {
+		name        string
+		writeSecret []byte
+		readSecret  []byte
+		wantOwner   string
+		wantFound   bool
+	}{
+		{name: "no secret", wantOwner: "user-1", wantFound: true},
+		{name: "derived key", writeSecret: secret, readSecret: secret, wantOwner: DeriveLookupKey(secret, "user-1"), wantFound: true},
+		{name: "different secret", writeSecret: secret, readSecret: bytes.Repeat([]byte{2}, minLookupSecretBytes), wantOwner: DeriveLookupKey(secret, "user-1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := encodingClient{fakeTxClient: newFakeTxClient()}
+			writer, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid", MFALookupSecret: tt.writeSecret})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			reader, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid", MFALookupSecret: tt.readSecret})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			ctx := context.Background()
+
+			method := &MFAMethod{ID: "mfa-1", UserID: "user-1", Type: "totp"}
+			if err := writer.StoreMFAMethod(ctx, method); err != nil {
+				t.Fatalf("StoreMFAMethod: %v", err)
+			}
+			if method.UserID != "user-1" {
+				t.Errorf("StoreMFAMethod() changed the method's user ID to %q", method.UserID)
+			}
+			if owner := client.items["mfa-1"]["user_id"]; owner != tt.wantOwner {
+				t.Errorf("stored user_id = %v, want %s", owner, tt.wantOwner)
+			}
+
+			// Index the record as the backend would
+			client.indexes["mfa-1"] = "user-mfa-index"
+			methods, err := reader.GetMFAMethods(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("GetMFAMethods: %v", err)
+			}
+			if found := len(methods) == 1; found != tt.wantFound {
+				t.Fatalf("GetMFAMethods() = %d methods, want found %v", len(methods), tt.wantFound)
+			}
+			if tt.wantFound && methods[0].UserID != "user-1" {
+				t.Errorf("method user ID = %q, want user-1", methods[0].UserID)
+			}
+			if others, err := reader.GetMFAMethods(ctx, "user-2"); err != nil || len(others) != 0 {
+				t.Errorf("GetMFAMethods(user-2) = %d methods, %v, want none", len(others), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process store for temporary values and MFA methods,
+// intended for local development and tests. It is safe for concurrent use.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	temp       map[string]memoryValue
+	mfaMethods map[string]*MFAMethod
+
+	done chan struct{}
+	once sync.Once
+}
+
+type memoryValue struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates a memory store that removes expired temporary values
+// every sweepInterval. Expired values are never returned, even before they
+// are swept. Call Close to stop the sweeper.
+func NewMemoryStore(sweepInterval time.Duration) *MemoryStore {
+	m := &MemoryStore{
+		temp:       make(map[string]memoryValue),
+		mfaMethods: make(map[string]*MFAMethod),
+		done:       make(chan struct{}),
+	}
+
+	if sweepInterval > 0 {
+		go m.sweepLoop(sweepInterval)
+	}
+
+	return m
+}
+
+// Close stops the background sweeper
+func (m *MemoryStore) Close() {
+	m.once.Do(func() {
+		close(m.done)
+	})
+}
+
+// StoreTemporaryValue implements Storage.StoreTemporaryValue
+func (m *MemoryStore) StoreTemporaryValue(ctx context.Context, key string, value string, expiry time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.temp[key] = memoryValue{
+		value:     value,
+		expiresAt: time.Now().Add(expiry),
+	}
+	return nil
+}
+
+// GetTemporaryValue implements Storage.GetTemporaryValue
+func (m *MemoryStore) GetTemporaryValue(ctx context.Context, key string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.temp[key]
+	if !ok || time.Now().After(v.expiresAt) {
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Temporary value not found",
+		}
+	}
+	return v.value, nil
+}
+
+// DeleteTemporaryValue implements Storage.DeleteTemporaryValue
+func (m *MemoryStore) DeleteTemporaryValue(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.temp, key)
+	return nil
+}
+
+// ListTemporaryValues implements TempValueLister
+func (m *MemoryStore) ListTemporaryValues(ctx context.Context, prefix string) ([]TempValueInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var infos []TempValueInfo
+	for key, v := range m.temp {
+		if strings.HasPrefix(key, prefix) && !now.After(v.expiresAt) {
+			infos = append(infos, TempValueInfo{Key: key, ExpiresAt: v.expiresAt})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+	return infos, nil
+}
+
+// StoreMFAMethod implements Storage.StoreMFAMethod
+func (m *MemoryStore) StoreMFAMethod(ctx context.Context, method *MFAMethod) error {
+	if method.ID == "" || method.UserID == "" {
+		return &StorageError{
+			Code:    ErrInvalidInput,
+			Message: "MFA method ID and user ID are required",
+		}
+	}
+
+	now := time.Now()
+	stored := *method
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = now
+	}
+	stored.UpdatedAt = now
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mfaMethods[stored.ID] = &stored
+	return nil
+}
+
+// GetMFAMethods implements Storage.GetMFAMethods. Methods are returned in
+// enrollment order.
+func (m *MemoryStore) GetMFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var methods []*MFAMethod
+	for _, method := range m.mfaMethods {
+		if method.UserID == userID {
+			// Return copies so callers can't mutate stored state
+			copied := *method
+			methods = append(methods, &copied)
+		}
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].CreatedAt.Before(methods[j].CreatedAt)
+	})
+	return methods, nil
+}
+
+// DeleteMFAMethod implements Storage.DeleteMFAMethod
+func (m *MemoryStore) DeleteMFAMethod(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mfaMethods[id]; !ok {
+		return &StorageError{
+			Code:    ErrNotFound,
+			Message: "MFA method not found",
+		}
+	}
+	delete(m.mfaMethods, id)
+	return nil
+}
+
+func (m *MemoryStore) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.sweep()
+		}
+	}
+}
+
+// sweep removes expired temporary values
+func (m *MemoryStore) sweep() {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, v := range m.temp {
+		if now.After(v.expiresAt) {
+			delete(m.temp, key)
+		}
+	}
+}
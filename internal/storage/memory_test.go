@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMemoryStore(t *testing.T, sweepInterval time.Duration) *MemoryStore {
+	t.Helper()
+	m := NewMemoryStore(sweepInterval)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	m := newTestMemoryStore(t, time.Millisecond)
+	ctx := context.Background()
+	const workers = 20
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			for j := 0; j < 50; j++ {
+				if err := m.StoreTemporaryValue(ctx, key, "value", time.Minute); err != nil {
+					t.Errorf("StoreTemporaryValue: %v", err)
+					return
+				}
+				if _, err := m.GetTemporaryValue(ctx, key); err != nil {
+					t.Errorf("GetTemporaryValue: %v", err)
+					return
+				}
+				if _, err := m.ListTemporaryValues(ctx, "key-"); err != nil {
+					t.Errorf("ListTemporaryValues: %v", err)
+					return
+				}
+				method := &MFAMethod{ID: fmt.Sprintf("mfa-%d-%d", i, j), UserID: "user-1", Type: "totp"}
+				if err := m.StoreMFAMethod(ctx, method); err != nil {
+					t.Errorf("StoreMFAMethod: %v", err)
+					return
+				}
+				if _, err := m.GetMFAMethods(ctx, "user-1"); err != nil {
+					t.Errorf("GetMFAMethods: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	infos, err := m.ListTemporaryValues(ctx, "key-")
+	if err != nil {
+		t.Fatalf("ListTemporaryValues: %v", err)
+	}
+	if len(infos) != workers {
+		t.Errorf("ListTemporaryValues() returned %d values, want %d", len(infos), workers)
+	}
+	methods, err := m.GetMFAMethods(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("GetMFAMethods: %v", err)
+	}
+	if len(methods) != workers*50 {
+		t.Errorf("GetMFAMethods() returned %d methods, want %d", len(methods), workers*50)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	m := newTestMemoryStore(t, 0)
+	ctx := context.Background()
+
+	if err := m.StoreTemporaryValue(ctx, "otp:expired", "1", -time.Second); err != nil {
+		t.Fatalf("StoreTemporaryValue: %v", err)
+	}
+	if err := m.StoreTemporaryValue(ctx, "otp:live", "2", time.Minute); err != nil {
+		t.Fatalf("StoreTemporaryValue: %v", err)
+	}
+
+	// Expired values are hidden before they are swept
+	_, err := m.GetTemporaryValue(ctx, "otp:expired")
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrNotFound {
+		t.Errorf("GetTemporaryValue(expired) error = %v, want code %s", err, ErrNotFound)
+	}
+	if value, err := m.GetTemporaryValue(ctx, "otp:live"); err != nil || value != "2" {
+		t.Errorf("GetTemporaryValue(live) = %q, %v, want 2", value, err)
+	}
+	infos, err := m.ListTemporaryValues(ctx, "otp:")
+	if err != nil {
+		t.Fatalf("ListTemporaryValues: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Key != "otp:live" {
+		t.Errorf("ListTemporaryValues() = %+v, want only otp:live", infos)
+	}
+
+	m.sweep()
+	m.mu.RLock()
+	_, expiredKept := m.temp["otp:expired"]
+	_, liveKept := m.temp["otp:live"]
+	m.mu.RUnlock()
+	if expiredKept || !liveKept {
+		t.Errorf("after sweep: expired kept %v, live kept %v", expiredKept, liveKept)
+	}
+}
+
+func TestMemoryStoreSweeper(t *testing.T) {
+	m := newTestMemoryStore(t, 5*time.Millisecond)
+	if err := m.StoreTemporaryValue(context.Background(), "otp", "1", time.Millisecond); err != nil {
+		t.Fatalf("StoreTemporaryValue: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		m.mu.RLock()
+		remaining := len(m.temp)
+		m.mu.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not remove the expired value")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Closing twice is safe
+	m.Close()
+	m.Close()
+}
+
+func TestMemoryStoreMFAMethods(t *testing.T) {
+	m := newTestMemoryStore(t, 0)
+	ctx := context.Background()
+
+	if err := m.StoreMFAMethod(ctx, &MFAMethod{UserID: "user-1"}); err == nil {
+		t.Error("StoreMFAMethod() without an ID succeeded")
+	}
+
+	first := &MFAMethod{ID: "mfa-1", UserID: "user-1", Type: "totp", CreatedAt: time.Now().Add(-time.Hour)}
+	second := &MFAMethod{ID: "mfa-2", UserID: "user-1", Type: "sms"}
+	for _, method := range []*MFAMethod{second, first} {
+		if err := m.StoreMFAMethod(ctx, method); err != nil {
+			t.Fatalf("StoreMFAMethod: %v", err)
+		}
+	}
+
+	methods, err := m.GetMFAMethods(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("GetMFAMethods: %v", err)
+	}
+	if len(methods) != 2 || methods[0].ID != "mfa-1" || methods[1].ID != "mfa-2" {
+		t.Fatalf("GetMFAMethods() = %v, want mfa-1 then mfa-2", methods)
+	}
+
+	// Returned methods are copies
+	methods[0].Type = "changed"
+	if methods, _ := m.GetMFAMethods(ctx, "user-1"); methods[0].Type != "totp" {
+		t.Error("mutating a returned method changed the stored one")
+	}
+
+	if err := m.DeleteMFAMethod(ctx, "mfa-1"); err != nil {
+		t.Fatalf("DeleteMFAMethod: %v", err)
+	}
+	var storageErr *StorageError
+	if err := m.DeleteMFAMethod(ctx, "mfa-1"); !errors.As(err, &storageErr) || storageErr.Code != ErrNotFound {
+		t.Errorf("second DeleteMFAMethod() = %v, want code %s", err, ErrNotFound)
+	}
+}
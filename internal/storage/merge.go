@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MergeResult describes the records a user merge moved or dropped
+type MergeResult struct {
+	PrimaryID          string
+	SecondaryID        string
+	MovedCredentials   []string
+	DroppedCredentials []string // duplicates of a primary credential
+	MovedMFAMethods    []string
+	DroppedMFAMethods  []string // duplicates of a primary MFA method
+	RevokedSessions    int      // the secondary's sessions, which end with it
+	MergedAt           time.Time
+}
+
+// MergeNotifier is told about completed merges, typically to publish a
+// user.merged event
+type MergeNotifier interface {
+	UsersMerged(ctx context.Context, result MergeResult) error
+}
+
+// SetMergeNotifier sets the notifier called after each successful merge
+func (s *NoSQLStorage) SetMergeNotifier(notifier MergeNotifier) {
+	s.mergeNotifier = notifier
+}
+
+// MergeUsers implements Storage.MergeUsers. The secondary's credentials and
+// MFA methods are reassigned to the primary and the secondary is retired
+// with its sessions revoked, all in one transaction. Conflicts are resolved in the primary's favour: a
+// secondary credential with the same ID or public key as one of the
+// primary's, or an MFA method with the same type and value, is deleted rather
+// than moved. The notifier is called only after the transaction commits.
+func (s *NoSQLStorage) MergeUsers(ctx context.Context, primaryID string, secondaryID string) error {
+	if primaryID == "" || secondaryID == "" || primaryID == secondaryID {
+		return &StorageError{
+			Code:    ErrInvalidInput,
+			Message: "Merge requires two distinct user IDs",
+		}
+	}
+
+	var result MergeResult
+	err := s.Transaction(ctx, func(tx Storage) error {
+		var err error
+		result, err = tx.(*NoSQLStorage).mergeUsers(ctx, primaryID, secondaryID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.mergeNotifier != nil {
+		if err := s.mergeNotifier.UsersMerged(ctx, result); err != nil {
+			s.logger.Error("Failed to notify user merge",
+				zap.Error(err),
+				zap.String("primary_id", primaryID),
+				zap.String("secondary_id", secondaryID))
+		}
+	}
+
+	return nil
+}
+
+// mergeUsers performs the merge writes against a transaction-scoped storage
+func (s *NoSQLStorage) mergeUsers(ctx context.Context, primaryID string, secondaryID string) (MergeResult, error) {
+	result := MergeResult{
+		PrimaryID:   primaryID,
+		SecondaryID: secondaryID,
+		MergedAt:    time.Now(),
+	}
+
+	if _, err := s.GetUser(ctx, primaryID); err != nil {
+		return result, err
+	}
+	secondary, err := s.GetUser(ctx, secondaryID)
+	if err != nil {
+		return result, err
+	}
+	if !secondary.DeletedAt.IsZero() {
+		return result, &StorageError{
+			Code:    ErrInvalidInput,
+			Message: "Secondary user is already retired",
+		}
+	}
+
+	if err := s.mergeCredentials(ctx, &result); err != nil {
+		return result, err
+	}
+	if err := s.mergeMFAMethods(ctx, &result); err != nil {
+		return result, err
+	}
+
+	// A retired user must not stay signed in, as with DeleteUserCascade
+	sessions, err := s.userSessionKeys(ctx, secondaryID)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range sessions {
+		if err := s.client.Delete(ctx, s.tableName, key); err != nil {
+			return result, &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to revoke merged user's sessions",
+				Err:     err,
+			}
+		}
+	}
+	result.RevokedSessions = len(sessions)
+
+	secondary.DeletedAt = result.MergedAt
+	secondary.MergedInto = primaryID
+	secondary.UpdatedAt = result.MergedAt
+	if err := s.putRecord(ctx, secondary.ID, secondary); err != nil {
+		return result, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to retire merged user",
+			Err:     err,
+		}
+	}
+
+	return result, nil
+}
+
+func (s *NoSQLStorage) mergeCredentials(ctx context.Context, result *MergeResult) error {
+	primary, err := s.GetCredentials(ctx, result.PrimaryID)
+	if err != nil {
+		return err
+	}
+	secondary, err := s.GetCredentials(ctx, result.SecondaryID)
+	if err != nil {
+		return err
+	}
+	// Process in ID order so the outcome doesn't depend on query order
+	sort.Slice(secondary, func(i, j int) bool { return secondary[i].ID < secondary[j].ID })
+
+	for _, credential := range secondary {
+		if hasDuplicateCredential(primary, credential) {
+			if err := s.client.Delete(ctx, s.tableName, credential.ID); err != nil {
+				return &StorageError{
+					Code:    ErrInternal,
+					Message: "Failed to delete duplicate credential",
+					Err:     err,
+				}
+			}
+			result.DroppedCredentials = append(result.DroppedCredentials, credential.ID)
+			continue
+		}
+
+		credential.UserID = result.PrimaryID
+		if err := s.putRecord(ctx, credential.ID, credential); err != nil {
+			return &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to move credential",
+				Err:     err,
+			}
+		}
+		primary = append(primary, credential)
+		result.MovedCredentials = append(result.MovedCredentials, credential.ID)
+	}
+
+	return nil
+}
+
+func (s *NoSQLStorage) mergeMFAMethods(ctx context.Context, result *MergeResult) error {
+	primary, err := s.GetMFAMethods(ctx, result.PrimaryID)
+	if err != nil {
+		return err
+	}
+	secondary, err := s.GetMFAMethods(ctx, result.SecondaryID)
+	if err != nil {
+		return err
+	}
+	sort.Slice(secondary, func(i, j int) bool { return secondary[i].ID < secondary[j].ID })
+
+	for _, method := range secondary {
+		if hasDuplicateMFAMethod(primary, method) {
+			if err := s.client.Delete(ctx, s.tableName, method.ID); err != nil {
+				return &StorageError{
+					Code:    ErrInternal,
+					Message: "Failed to delete duplicate MFA method",
+					Err:     err,
+				}
+			}
+			result.DroppedMFAMethods = append(result.DroppedMFAMethods, method.ID)
+			continue
+		}
+
+		method.UserID = result.PrimaryID
+		method.UpdatedAt = result.MergedAt
+		if err := s.putMFAMethod(ctx, method); err != nil {
+			return &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to move MFA method",
+				Err:     err,
+			}
+		}
+		primary = append(primary, method)
+		result.MovedMFAMethods = append(result.MovedMFAMethods, method.ID)
+	}
+
+	return nil
+}
+
+func hasDuplicateCredential(credentials []*Credential, credential *Credential) bool {
+	for _, existing := range credentials {
+		if existing.ID == credential.ID || bytes.Equal(existing.PublicKey, credential.PublicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDuplicateMFAMethod compares values as stored, so encrypted values only
+// match when sealed identically
+func hasDuplicateMFAMethod(methods []*MFAMethod, method *MFAMethod) bool {
+	for _, existing := range methods {
+		if existing.Type == method.Type && existing.Value == method.Value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recordingMergeNotifier records the merges it is told about
+type recordingMergeNotifier struct {
+	results []MergeResult
+}
+
+func (n *recordingMergeNotifier) UsersMerged(ctx context.Context, result MergeResult) error {
+	n.results = append(n.results, result)
+	return nil
+}
+
+// seedMergeUsers seeds user-1 and user-2, where user-2 holds one credential
+// and one MFA method that duplicate user-1's
+func seedMergeUsers(client *fakeTxClient) {
+	client.seed("email-index", "user-1", map[string]interface{}{"id": "user-1", "email": "a@example.com"})
+	client.seed("email-index", "user-2", map[string]interface{}{"id": "user-2", "email": "b@example.com"})
+	client.seed("user-credentials-index", "cred-1", map[string]interface{}{"id": "cred-1", "user_id": "user-1", "public_key": "AQID"})
+	client.seed("user-credentials-index", "cred-2", map[string]interface{}{"id": "cred-2", "user_id": "user-2", "public_key": "BAUG"})
+	client.seed("user-credentials-index", "cred-3", map[string]interface{}{"id": "cred-3", "user_id": "user-2", "public_key": "AQID"})
+	client.seed("user-mfa-index", "mfa-1", map[string]interface{}{"id": "mfa-1", "user_id": "user-1", "type": "totp", "value": "secret-a"})
+	client.seed("user-mfa-index", "mfa-2", map[string]interface{}{"id": "mfa-2", "user_id": "user-2", "type": "sms", "value": "+15550100"})
+	client.seed("user-mfa-index", "mfa-3", map[string]interface{}{"id": "mfa-3", "user_id": "user-2", "type": "totp", "value": "secret-a"})
+	client.seed("user-sessions-index", "session:s1", map[string]interface{}{"session_id": "s1", "user_id": "user-2"})
+	client.seed("user-sessions-index", "session:s2", map[string]interface{}{"session_id": "s2", "user_id": "user-1"})
+}
+
+func TestMergeUsers(t *testing.T) {
+	client := newFakeTxClient()
+	seedMergeUsers(client)
+	s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+	notifier := &recordingMergeNotifier{}
+	s.SetMergeNotifier(notifier)
+
+	if err := s.MergeUsers(context.Background(), "user-1", "user-2"); err != nil {
+		t.Fatalf("MergeUsers: %v", err)
+	}
+
+	// Duplicates and the secondary's session are gone
+	wantKeys := []string{"cred-1", "cred-2", "mfa-1", "mfa-2", "session:s2", "user-1", "user-2"}
+	if keys := client.keys(); !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("keys = %v, want %v", keys, wantKeys)
+	}
+	for _, key := range []string{"cred-2", "mfa-2"} {
+		if owner := client.items[key]["user_id"]; owner != "user-1" {
+			t.Errorf("%s user_id = %v, want user-1", key, owner)
+		}
+	}
+
+	secondary, err := s.GetUser(context.Background(), "user-2")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if secondary.DeletedAt.IsZero() || secondary.MergedInto != "user-1" {
+		t.Errorf("secondary deleted_at = %v, merged_into = %q, want retired into user-1", secondary.DeletedAt, secondary.MergedInto)
+	}
+
+	if len(notifier.results) != 1 {
+		t.Fatalf("notifications = %d, want 1", len(notifier.results))
+	}
+	result := notifier.results[0]
+	want := MergeResult{
+		PrimaryID:          "user-1",
+		SecondaryID:        "user-2",
+		MovedCredentials:   []string{"cred-2"},
+		DroppedCredentials: []string{"cred-3"},
+		MovedMFAMethods:    []string{"mfa-2"},
+		DroppedMFAMethods:  []string{"mfa-3"},
+		RevokedSessions:    1,
+		MergedAt:           result.MergedAt,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+}
+
+func TestMergeUsersRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   string
+		secondary string
+		retired   bool
+		commitErr error
+		wantCode  string
+	}{
+		{name: "same user", primary: "user-1", secondary: "user-1", wantCode: ErrInvalidInput},
+		{name: "missing secondary ID", primary: "user-1", wantCode: ErrInvalidInput},
+		{name: "unknown secondary", primary: "user-1", secondary: "user-9", wantCode: ErrNotFound},
+		{name: "secondary already retired", primary: "user-1", secondary: "user-2", retired: true, wantCode: ErrInvalidInput},
+		{name: "failed commit", primary: "user-1", secondary: "user-2", commitErr: errors.New("transaction cancelled"), wantCode: ErrInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeTxClient()
+			seedMergeUsers(client)
+			if tt.retired {
+				client.items["user-2"]["deleted_at"] = time.Now().Add(-time.Hour).Format(time.RFC3339)
+			}
+			client.commitErr = tt.commitErr
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			notifier := &recordingMergeNotifier{}
+			s.SetMergeNotifier(notifier)
+			before := client.keys()
+
+			err = s.MergeUsers(context.Background(), tt.primary, tt.secondary)
+
+			var storageErr *StorageError
+			if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+				t.Errorf("MergeUsers() = %v, want code %s", err, tt.wantCode)
+			}
+			if after := client.keys(); !reflect.DeepEqual(after, before) {
+				t.Errorf("keys = %v, want %v", after, before)
+			}
+			if owner := client.items["cred-2"]["user_id"]; owner != "user-2" {
+				t.Errorf("cred-2 user_id = %v, want user-2", owner)
+			}
+			if len(notifier.results) != 0 {
+				t.Errorf("notifications = %d, want 0", len(notifier.results))
+			}
+		})
+	}
+}
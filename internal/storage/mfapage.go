@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"sort"
+)
+
+// MFA method page sizes
+const (
+	DefaultMFAMethodPageSize = 20
+	MaxMFAMethodPageSize     = 100
+)
+
+// MFAMethodFilter selects a page of a user's MFA methods
+type MFAMethodFilter struct {
+	// Type matches the method type when set
+	Type string
+	// Cursor resumes after the method with this ID, the last of a previous
+	// page. Pass "" for the first page.
+	Cursor string
+	// Limit caps the methods returned. Zero uses DefaultMFAMethodPageSize.
+	Limit int
+}
+
+// ListMFAMethods implements Storage.ListMFAMethods. Method IDs are
+// time-ordered, so pages run oldest first, and the cursor stays valid as
+// methods are added or removed. One method beyond the limit is queried to
+// learn whether another page follows.
+func (s *NoSQLStorage) ListMFAMethods(ctx context.Context, userID string, filter MFAMethodFilter) ([]*MFAMethod, string, error) {
+	if filter.Limit < 0 || filter.Limit > MaxMFAMethodPageSize {
+		return nil, "", &StorageError{Code: ErrInvalidInput, Message: "MFA method page size is out of range"}
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultMFAMethodPageSize
+	}
+
+	conditions := []Condition{Eq("user_id", s.mfaOwnerKey(userID))}
+	if filter.Cursor != "" {
+		conditions = append(conditions, Gt("id", filter.Cursor))
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, Eq("type", filter.Type))
+	}
+
+	results, err := s.queryLimit(ctx, "user-mfa-index", And(conditions...), limit+1)
+	if err != nil {
+		return nil, "", &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to query MFA methods",
+			Err:     err,
+		}
+	}
+
+	methods, err := s.decodeMFAMethods(ctx, userID, results)
+	if err != nil {
+		return nil, "", err
+	}
+	// Clients without limited queries return matches in no particular order
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].ID < methods[j].ID
+	})
+
+	if len(methods) <= limit {
+		return methods, "", nil
+	}
+	methods = methods[:limit]
+	return methods, methods[limit-1].ID, nil
+}
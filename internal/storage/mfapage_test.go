@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestListMFAMethods(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   MFAMethodFilter
+		wantIDs  []string
+		wantNext string
+		wantCode string
+	}{
+		{name: "every method", wantIDs: []string{"m1", "m2", "m3", "m4", "m5"}},
+		{name: "first page", filter: MFAMethodFilter{Limit: 2}, wantIDs: []string{"m1", "m2"}, wantNext: "m2"},
+		{name: "middle page", filter: MFAMethodFilter{Cursor: "m2", Limit: 2}, wantIDs: []string{"m3", "m4"}, wantNext: "m4"},
+		{name: "last page", filter: MFAMethodFilter{Cursor: "m4", Limit: 2}, wantIDs: []string{"m5"}},
+		{name: "exactly full last page", filter: MFAMethodFilter{Cursor: "m3", Limit: 2}, wantIDs: []string{"m4", "m5"}},
+		{name: "cursor of a removed method", filter: MFAMethodFilter{Cursor: "m2a", Limit: 2}, wantIDs: []string{"m3", "m4"}, wantNext: "m4"},
+		{name: "type filter", filter: MFAMethodFilter{Type: "sms", Limit: 1}, wantIDs: []string{"m2"}, wantNext: "m2"},
+		{name: "type filter after cursor", filter: MFAMethodFilter{Type: "sms", Cursor: "m2"}, wantIDs: []string{"m4"}},
+		{name: "negative limit", filter: MFAMethodFilter{Limit: -1}, wantCode: ErrInvalidInput},
+		{name: "limit too large", filter: MFAMethodFilter{Limit: MaxMFAMethodPageSize + 1}, wantCode: ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeTxClient()
+			for _, id := range []string{"m3", "m1", "m5", "m2", "m4"} {
+				methodType := "totp"
+				if id == "m2" || id == "m4" {
+					methodType = "sms"
+				}
+				client.seed("user-mfa-index", id, map[string]interface{}{"id": id, "user_id": "user-1", "type": methodType})
+			}
+			client.seed("user-mfa-index", "m0", map[string]interface{}{"id": "m0", "user_id": "user-2", "type": "totp"})
+
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+
+			methods, next, err := s.ListMFAMethods(context.Background(), "user-1", tt.filter)
+
+			if tt.wantCode != "" {
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+					t.Fatalf("ListMFAMethods() error = %v, want code %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListMFAMethods: %v", err)
+			}
+
+			ids := make([]string, 0, len(methods))
+			for _, method := range methods {
+				ids = append(ids, method.ID)
+				if method.UserID != "user-1" {
+					t.Errorf("method %s UserID = %q, want user-1", method.ID, method.UserID)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ListMFAMethods() IDs = %v, want %v", ids, tt.wantIDs)
+			}
+			if next != tt.wantNext {
+				t.Errorf("next cursor = %q, want %q", next, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// MigrateOptions configures a migration between storage backends
+type MigrateOptions struct {
+	// BatchSize is the number of users read per page
+	BatchSize int
+	// Checkpoint resumes a previous migration from the cursor it last
+	// reported. Leave empty to start from the beginning.
+	Checkpoint string
+	// Progress is called after each page is copied
+	Progress func(MigrateProgress)
+}
+
+// MigrateProgress reports how far a migration has got. Checkpoint can be
+// passed back through MigrateOptions to resume after the last copied page.
+type MigrateProgress struct {
+	Checkpoint  string
+	Users       int
+	Credentials int
+	MFAMethods  int
+	Done        bool
+}
+
+// Migrate copies users with their credentials and MFA methods from src to
+// dst. Writes are upserts, so re-running a migration (or resuming one from an
+// older checkpoint) is safe.
+func Migrate(ctx context.Context, src Storage, dst Storage, opts MigrateOptions) (MigrateProgress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	progress := MigrateProgress{Checkpoint: opts.Checkpoint}
+	cursor := opts.Checkpoint
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		users, next, err := src.ListUsers(ctx, cursor, opts.BatchSize)
+		if err != nil {
+			return progress, err
+		}
+
+		for _, user := range users {
+			if err := migrateUser(ctx, src, dst, user, &progress); err != nil {
+				return progress, err
+			}
+		}
+
+		// Only advance the checkpoint once the whole page is copied
+		progress.Checkpoint = next
+		progress.Done = next == ""
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+
+		if progress.Done {
+			return progress, nil
+		}
+		cursor = next
+	}
+}
+
+func migrateUser(ctx context.Context, src Storage, dst Storage, user *User, progress *MigrateProgress) error {
+	if err := upsertUser(ctx, dst, user); err != nil {
+		return err
+	}
+	progress.Users++
+
+	credentials, err := src.GetCredentials(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, credential := range credentials {
+		if err := dst.StoreCredential(ctx, credential); err != nil {
+			return err
+		}
+		progress.Credentials++
+	}
+
+	methods, err := src.GetMFAMethods(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, method := range methods {
+		if err := dst.StoreMFAMethod(ctx, method); err != nil {
+			return err
+		}
+		progress.MFAMethods++
+	}
+
+	return nil
+}
+
+// upsertUser creates the user, or updates it if an earlier run already
+// copied it
+func upsertUser(ctx context.Context, dst Storage, user *User) error {
+	err := dst.CreateUser(ctx, user)
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) && storageErr.Code == ErrAlreadyExists {
+		return dst.UpdateUser(ctx, user)
+	}
+	return err
+}
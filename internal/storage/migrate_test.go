@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// mapStorage is an in-memory Storage holding users, credentials, and MFA
+// methods. Users are listed in ID order, with the last ID as the cursor.
+// Other Storage methods are unimplemented.
+type mapStorage struct {
+	Storage
+	users       map[string]*User
+	credentials map[string][]*Credential
+	methods     map[string][]*MFAMethod
+	failUser    string // CreateUser fails for this user ID
+}
+
+func newMapStorage() *mapStorage {
+	return &mapStorage{
+		users:       make(map[string]*User),
+		credentials: make(map[string][]*Credential),
+		methods:     make(map[string][]*MFAMethod),
+	}
+}
+
+func (s *mapStorage) CreateUser(ctx context.Context, user *User) error {
+	if user.ID == s.failUser {
+		return &StorageError{Code: ErrUnavailable, Message: "Backend unavailable"}
+	}
+	if _, ok := s.users[user.ID]; ok {
+		return &StorageError{Code: ErrAlreadyExists, Message: "User already exists"}
+	}
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *mapStorage) UpdateUser(ctx context.Context, user *User) error {
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *mapStorage) ListUsers(ctx context.Context, cursor string, limit int) ([]*User, string, error) {
+	ids := make([]string, 0, len(s.users))
+	for id := range s.users {
+		if id > cursor {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	next := ""
+	if len(ids) > limit {
+		ids = ids[:limit]
+		next = ids[limit-1]
+	}
+	users := make([]*User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, s.users[id])
+	}
+	return users, next, nil
+}
+
+func (s *mapStorage) StoreCredential(ctx context.Context, credential *Credential) error {
+	stored := s.credentials[credential.UserID]
+	for i := range stored {
+		if stored[i].ID == credential.ID {
+			stored[i] = credential
+			return nil
+		}
+	}
+	s.credentials[credential.UserID] = append(stored, credential)
+	return nil
+}
+
+func (s *mapStorage) GetCredentials(ctx context.Context, userID string) ([]*Credential, error) {
+	return s.credentials[userID], nil
+}
+
+func (s *mapStorage) StoreMFAMethod(ctx context.Context, method *MFAMethod) error {
+	stored := s.methods[method.UserID]
+	for i := range stored {
+		if stored[i].ID == method.ID {
+			stored[i] = method
+			return nil
+		}
+	}
+	s.methods[method.UserID] = append(stored, method)
+	return nil
+}
+
+func (s *mapStorage) GetMFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error) {
+	return s.methods[userID], nil
+}
+
+// seedMigrationSource returns a store with users user-0 to user-6, each with
+// one MFA method and i%3 credentials
+func seedMigrationSource() *mapStorage {
+	src := newMapStorage()
+	for i := 0; i < 7; i++ {
+		id := fmt.Sprintf("user-%d", i)
+		src.users[id] = &User{ID: id, Email: id + "@example.com"}
+		src.methods[id] = []*MFAMethod{{ID: id + "-totp", UserID: id, Type: "totp"}}
+		for j := 0; j < i%3; j++ {
+			src.credentials[id] = append(src.credentials[id], &Credential{ID: fmt.Sprintf("%s-cred-%d", id, j), UserID: id})
+		}
+	}
+	return src
+}
+
+// checkMigrated reports any record of src missing from dst
+func checkMigrated(t *testing.T, src, dst *mapStorage) {
+	t.Helper()
+	if !reflect.DeepEqual(dst.users, src.users) {
+		t.Errorf("destination has %d users, want %d", len(dst.users), len(src.users))
+	}
+	for id := range src.users {
+		if !reflect.DeepEqual(dst.credentials[id], src.credentials[id]) {
+			t.Errorf("%s: credentials = %v, want %v", id, dst.credentials[id], src.credentials[id])
+		}
+		if !reflect.DeepEqual(dst.methods[id], src.methods[id]) {
+			t.Errorf("%s: MFA methods = %v, want %v", id, dst.methods[id], src.methods[id])
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	src := seedMigrationSource()
+	dst := newMapStorage()
+
+	var pages []MigrateProgress
+	progress, err := Migrate(context.Background(), src, dst, MigrateOptions{
+		BatchSize: 3,
+		Progress:  func(p MigrateProgress) { pages = append(pages, p) },
+	})
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	checkMigrated(t, src, dst)
+	want := MigrateProgress{Users: 7, Credentials: 6, MFAMethods: 7, Done: true}
+	if progress != want {
+		t.Errorf("Migrate() = %+v, want %+v", progress, want)
+	}
+	if len(pages) != 3 || !pages[2].Done || pages[0].Checkpoint != "user-2" {
+		t.Errorf("progress reports = %+v, want 3 pages ending done", pages)
+	}
+}
+
+func TestMigrateResume(t *testing.T) {
+	src := seedMigrationSource()
+	dst := newMapStorage()
+	dst.failUser = "user-4"
+	ctx := context.Background()
+
+	progress, err := Migrate(ctx, src, dst, MigrateOptions{BatchSize: 3})
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrUnavailable {
+		t.Fatalf("Migrate() error = %v, want code %s", err, ErrUnavailable)
+	}
+	// The failed page was partly copied; the checkpoint stays before it
+	if progress.Checkpoint != "user-2" || progress.Done {
+		t.Fatalf("Migrate() checkpoint = %q, done %v, want user-2", progress.Checkpoint, progress.Done)
+	}
+
+	dst.failUser = ""
+	progress, err = Migrate(ctx, src, dst, MigrateOptions{BatchSize: 3, Checkpoint: progress.Checkpoint})
+	if err != nil {
+		t.Fatalf("resumed Migrate: %v", err)
+	}
+	if !progress.Done || progress.Users != 4 {
+		t.Errorf("resumed Migrate() = %+v, want done after 4 users", progress)
+	}
+	checkMigrated(t, src, dst)
+
+	// Re-running from scratch only rewrites what is already there
+	if _, err := Migrate(ctx, src, dst, MigrateOptions{BatchSize: 3}); err != nil {
+		t.Fatalf("repeated Migrate: %v", err)
+	}
+	checkMigrated(t, src, dst)
+}
+
+func TestMigrateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dst := newMapStorage()
+	if _, err := Migrate(ctx, seedMigrationSource(), dst, MigrateOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Migrate() error = %v, want %v", err, context.Canceled)
+	}
+	if len(dst.users) != 0 {
+		t.Errorf("cancelled migration copied %d users", len(dst.users))
+	}
+}
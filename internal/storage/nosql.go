@@ -2,11 +2,16 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"net/mail"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/polyid/auth/internal/idgen"
 )
 
 // NoSQLStorage implements the Storage interface using a generic NoSQL database
@@ -14,6 +19,20 @@ type NoSQLStorage struct {
 	client    NoSQLClient
 	logger    *zap.Logger
 	tableName string
+	ids       idgen.Generator
+
+	// lenient skips records that fail to decode instead of failing reads
+	lenient bool
+	skipped *atomic.Uint64 // shared with transaction copies
+
+	// mfaLookupSecret derives the owner key stored on MFA method records
+	mfaLookupSecret []byte
+
+	// sessionMaxLifetime enables sliding session expiration when non-zero
+	sessionMaxLifetime time.Duration
+
+	mergeNotifier  MergeNotifier
+	deleteNotifier DeleteNotifier
 }
 
 // NoSQLClient defines the interface for NoSQL database operations
@@ -25,29 +44,86 @@ type NoSQLClient interface {
 	CreateIndex(ctx context.Context, table string, index string, fields []string) error
 }
 
+// batchQueryConcurrency bounds the concurrent queries issued by batch reads
+const batchQueryConcurrency = 8
+
+// NoSQLScanner is implemented by NoSQL clients that can page through every
+// item in a table. cursor is "" for the first page; an empty next cursor
+// means there are no more pages.
+type NoSQLScanner interface {
+	Scan(ctx context.Context, table string, cursor string, limit int) ([]map[string]interface{}, string, error)
+}
+
 // NewNoSQLStorage creates a new NoSQL storage instance
-func NewNoSQLStorage(client NoSQLClient, logger *zap.Logger, tableName string) *NoSQLStorage {
+func NewNoSQLStorage(client NoSQLClient, logger *zap.Logger, cfg NoSQLConfig) (*NoSQLStorage, error) {
+	if client == nil {
+		return nil, errors.New("NoSQL client is required")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid NoSQL config: %w", err)
+	}
+
 	return &NoSQLStorage{
 		client:    client,
 		logger:    logger,
-		tableName: tableName,
+		tableName: cfg.TableName,
+		ids:       idgen.NewUUIDv7(),
+		lenient:   cfg.Lenient,
+		skipped:   new(atomic.Uint64),
+
+		mfaLookupSecret: cfg.MFALookupSecret,
+	}, nil
+}
+
+// SkippedRecords returns how many corrupt records lenient reads have skipped
+func (s *NoSQLStorage) SkippedRecords() uint64 {
+	return s.skipped.Load()
+}
+
+// skipCorrupt reports whether a record that failed to decode should be
+// skipped, logging and counting it if so
+func (s *NoSQLStorage) skipCorrupt(kind string, record map[string]interface{}, err error) bool {
+	if !s.lenient {
+		return false
 	}
+
+	id, _ := record["id"].(string)
+	s.logger.Warn("Skipping corrupt record",
+		zap.String("kind", kind),
+		zap.String("id", id),
+		zap.Error(err))
+	s.skipped.Add(1)
+	return true
+}
+
+// SetIDGenerator overrides the generator used to assign IDs to new records
+func (s *NoSQLStorage) SetIDGenerator(ids idgen.Generator) {
+	s.ids = ids
 }
 
 // CreateUser implements Storage.CreateUser
 func (s *NoSQLStorage) CreateUser(ctx context.Context, user *User) error {
-	// Check if user already exists
-	_, err := s.client.Get(ctx, s.tableName, user.ID)
-	if err == nil {
-		return &StorageError{
-			Code:    ErrAlreadyExists,
-			Message: "User already exists",
-		}
+	if user.ID == "" {
+		user.ID = s.ids.NewID()
+	}
+
+	if err := s.ValidateUser(ctx, user); err != nil {
+		return err
+	}
+
+	// ValidateUser only checked the email; reserving it enforces uniqueness
+	// against concurrent creates and patches
+	reserved, err := s.reserveEmail(ctx, user.Email, user.ID)
+	if err != nil {
+		return err
 	}
 
 	// Create user
-	err = s.client.Put(ctx, s.tableName, user.ID, user)
+	err = s.putRecord(ctx, user.ID, user)
 	if err != nil {
+		if reserved {
+			s.releaseEmail(ctx, user.Email, user.ID)
+		}
 		return &StorageError{
 			Code:    ErrInternal,
 			Message: "Failed to create user",
@@ -58,11 +134,59 @@ func (s *NoSQLStorage) CreateUser(ctx context.Context, user *User) error {
 	return nil
 }
 
+// ValidateUser implements Storage.ValidateUser
+func (s *NoSQLStorage) ValidateUser(ctx context.Context, user *User) error {
+	if !isValidEmail(user.Email) {
+		return &StorageError{
+			Code:    ErrInvalidInput,
+			Message: "Invalid email address",
+		}
+	}
+
+	// Check if user already exists
+	if user.ID != "" {
+		result, err := s.client.Get(ctx, s.tableName, user.ID)
+		if err != nil {
+			return &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to check user",
+				Err:     err,
+			}
+		}
+		if result != nil {
+			return &StorageError{
+				Code:    ErrAlreadyExists,
+				Message: "User already exists",
+			}
+		}
+	}
+
+	_, err := s.GetUserByEmail(ctx, user.Email)
+	if err == nil {
+		return &StorageError{
+			Code:    ErrAlreadyExists,
+			Message: "User already exists",
+		}
+	}
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrNotFound {
+		return err
+	}
+
+	return nil
+}
+
 // GetUser implements Storage.GetUser
 func (s *NoSQLStorage) GetUser(ctx context.Context, id string) (*User, error) {
+	user, _, err := s.loadUser(ctx, id)
+	return user, err
+}
+
+// loadUser reads a user along with its raw stored record
+func (s *NoSQLStorage) loadUser(ctx context.Context, id string) (*User, map[string]interface{}, error) {
 	result, err := s.client.Get(ctx, s.tableName, id)
 	if err != nil {
-		return nil, &StorageError{
+		return nil, nil, &StorageError{
 			Code:    ErrInternal,
 			Message: "Failed to get user",
 			Err:     err,
@@ -70,30 +194,29 @@ func (s *NoSQLStorage) GetUser(ctx context.Context, id string) (*User, error) {
 	}
 
 	if result == nil {
-		return nil, &StorageError{
+		return nil, nil, &StorageError{
 			Code:    ErrNotFound,
 			Message: "User not found",
 		}
 	}
 
 	user := &User{}
-	err = mapToStruct(result, user)
+	err = s.mapToStruct(result, user)
 	if err != nil {
-		return nil, &StorageError{
+		return nil, nil, &StorageError{
 			Code:    ErrInternal,
 			Message: "Failed to unmarshal user",
 			Err:     err,
 		}
 	}
 
-	return user, nil
+	return user, result, nil
 }
 
-// GetUserByEmail implements Storage.GetUserByEmail
+// GetUserByEmail implements Storage.GetUserByEmail. If more than one active
+// user has the email it returns ErrDataIntegrity rather than picking one.
 func (s *NoSQLStorage) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	results, err := s.client.Query(ctx, s.tableName, "email-index", "email = :email", map[string]interface{}{
-		":email": email,
-	})
+	results, err := s.query(ctx, "email-index", Eq("email", email))
 	if err != nil {
 		return nil, &StorageError{
 			Code:    ErrInternal,
@@ -102,29 +225,137 @@ func (s *NoSQLStorage) GetUserByEmail(ctx context.Context, email string) (*User,
 		}
 	}
 
-	if len(results) == 0 {
+	var matches []*User
+	for _, result := range results {
+		user := &User{}
+		err = s.mapToStruct(result, user)
+		if err != nil {
+			return nil, &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to unmarshal user",
+				Err:     err,
+			}
+		}
+
+		// Retired users keep their email but can't be looked up by it
+		if user.DeletedAt.IsZero() {
+			matches = append(matches, user)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
 		return nil, &StorageError{
 			Code:    ErrNotFound,
 			Message: "User not found",
 		}
+	case 1:
+		return matches[0], nil
 	}
 
-	user := &User{}
-	err = mapToStruct(results[0], user)
+	// Emails are unique, so picking one would sign in as an arbitrary account
+	ids := make([]string, len(matches))
+	for i, user := range matches {
+		ids[i] = user.ID
+	}
+	s.logger.Error("Multiple users share an email", zap.Strings("user_ids", ids))
+	return nil, &StorageError{
+		Code:    ErrDataIntegrity,
+		Message: "Multiple users match email",
+	}
+}
+
+// UpdateUser implements Storage.UpdateUser
+func (s *NoSQLStorage) UpdateUser(ctx context.Context, user *User) error {
+	if _, err := s.GetUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	user.UpdatedAt = time.Now()
+	err := s.putRecord(ctx, user.ID, user)
 	if err != nil {
-		return nil, &StorageError{
+		return &StorageError{
 			Code:    ErrInternal,
-			Message: "Failed to unmarshal user",
+			Message: "Failed to update user",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// DeleteUser implements Storage.DeleteUser. The user's email reservation is
+// deleted with it; their credentials, MFA methods, and sessions are not, see
+// DeleteUserCascade.
+func (s *NoSQLStorage) DeleteUser(ctx context.Context, id string) error {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	holder, err := s.emailHolder(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{id}
+	if holder == id {
+		keys = append(keys, emailKey(user.Email))
+	}
+	return s.deleteKeys(ctx, "Failed to delete user", keys...)
+}
+
+// ListUsers implements Storage.ListUsers
+func (s *NoSQLStorage) ListUsers(ctx context.Context, cursor string, limit int) ([]*User, string, error) {
+	scanner, ok := s.client.(NoSQLScanner)
+	if !ok {
+		return nil, "", &StorageError{
+			Code:    ErrInternal,
+			Message: "Backend does not support scans",
+		}
+	}
+
+	results, next, err := scanner.Scan(ctx, s.tableName, cursor, limit)
+	if err != nil {
+		return nil, "", &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to scan users",
 			Err:     err,
 		}
 	}
 
-	return user, nil
+	users := make([]*User, 0, len(results))
+	for _, result := range results {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+
+		// The table also holds credentials, MFA methods, and temporary
+		// values; only user records have an email
+		if _, ok := result["email"]; !ok {
+			continue
+		}
+
+		user := &User{}
+		if err := s.mapToStruct(result, user); err != nil {
+			return nil, "", &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to unmarshal user",
+				Err:     err,
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users, next, nil
 }
 
 // StoreCredential implements Storage.StoreCredential
 func (s *NoSQLStorage) StoreCredential(ctx context.Context, credential *Credential) error {
-	err := s.client.Put(ctx, s.tableName, credential.ID, credential)
+	if credential.ID == "" {
+		credential.ID = s.ids.NewID()
+	}
+
+	err := s.putRecord(ctx, credential.ID, credential)
 	if err != nil {
 		return &StorageError{
 			Code:    ErrInternal,
@@ -138,9 +369,7 @@ func (s *NoSQLStorage) StoreCredential(ctx context.Context, credential *Credenti
 
 // GetCredentials implements Storage.GetCredentials
 func (s *NoSQLStorage) GetCredentials(ctx context.Context, userID string) ([]*Credential, error) {
-	results, err := s.client.Query(ctx, s.tableName, "user-credentials-index", "user_id = :user_id", map[string]interface{}{
-		":user_id": userID,
-	})
+	results, err := s.query(ctx, "user-credentials-index", Eq("user_id", userID))
 	if err != nil {
 		return nil, &StorageError{
 			Code:    ErrInternal,
@@ -151,9 +380,17 @@ func (s *NoSQLStorage) GetCredentials(ctx context.Context, userID string) ([]*Cr
 
 	credentials := make([]*Credential, 0, len(results))
 	for _, result := range results {
+		// Stop promptly if the caller gave up; partial results are discarded
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		credential := &Credential{}
-		err := mapToStruct(result, credential)
+		err := s.mapToStruct(result, credential)
 		if err != nil {
+			if s.skipCorrupt("credential", result, err) {
+				continue
+			}
 			return nil, &StorageError{
 				Code:    ErrInternal,
 				Message: "Failed to unmarshal credential",
@@ -166,10 +403,116 @@ func (s *NoSQLStorage) GetCredentials(ctx context.Context, userID string) ([]*Cr
 	return credentials, nil
 }
 
+// DeleteCredential implements Storage.DeleteCredential. Any attestation kept
+// for the credential is deleted with it.
+func (s *NoSQLStorage) DeleteCredential(ctx context.Context, id string) error {
+	return s.deleteKeys(ctx, "Failed to delete credential", id, attestationKey(id))
+}
+
+// StoreMFAMethod implements Storage.StoreMFAMethod
+func (s *NoSQLStorage) StoreMFAMethod(ctx context.Context, method *MFAMethod) error {
+	if method.ID == "" {
+		method.ID = s.ids.NewID()
+	}
+
+	err := s.putMFAMethod(ctx, method)
+	if err != nil {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to store MFA method",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// GetMFAMethods implements Storage.GetMFAMethods
+func (s *NoSQLStorage) GetMFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error) {
+	results, err := s.query(ctx, "user-mfa-index", Eq("user_id", s.mfaOwnerKey(userID)))
+	if err != nil {
+		return nil, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to query MFA methods",
+			Err:     err,
+		}
+	}
+
+	return s.decodeMFAMethods(ctx, userID, results)
+}
+
+// decodeMFAMethods decodes the user's queried MFA method records, skipping
+// corrupt ones if configured to
+func (s *NoSQLStorage) decodeMFAMethods(ctx context.Context, userID string, results []map[string]interface{}) ([]*MFAMethod, error) {
+	methods := make([]*MFAMethod, 0, len(results))
+	for _, result := range results {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		method := &MFAMethod{}
+		err := s.mapToStruct(result, method)
+		if err != nil {
+			if s.skipCorrupt("mfa_method", result, err) {
+				continue
+			}
+			return nil, &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to unmarshal MFA method",
+				Err:     err,
+			}
+		}
+		// The stored owner may be a derived key
+		method.UserID = userID
+		methods = append(methods, method)
+	}
+
+	return methods, nil
+}
+
+// DeleteMFAMethod implements Storage.DeleteMFAMethod
+func (s *NoSQLStorage) DeleteMFAMethod(ctx context.Context, id string) error {
+	return s.deleteKeys(ctx, "Failed to delete MFA method", id)
+}
+
+// GetMFAMethodsForUsers implements Storage.GetMFAMethodsForUsers. Users are
+// queried concurrently, at most batchQueryConcurrency at a time.
+func (s *NoSQLStorage) GetMFAMethodsForUsers(ctx context.Context, userIDs []string) (map[string][]*MFAMethod, error) {
+	results := make([][]*MFAMethod, len(userIDs))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(batchQueryConcurrency)
+	for i, userID := range userIDs {
+		i, userID := i, userID
+		g.Go(func() error {
+			methods, err := s.GetMFAMethods(gctx, userID)
+			if err != nil {
+				return err
+			}
+			results[i] = methods
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[string][]*MFAMethod, len(userIDs))
+	for i, userID := range userIDs {
+		methods := results[i]
+		if methods == nil {
+			methods = []*MFAMethod{}
+		}
+		byUser[userID] = methods
+	}
+	return byUser, nil
+}
+
 // StoreTemporaryValue implements Storage.StoreTemporaryValue
 func (s *NoSQLStorage) StoreTemporaryValue(ctx context.Context, key string, value string, expiry time.Duration) error {
 	tempValue := map[string]interface{}{
-		"value":     value,
+		"key":        key,
+		"value":      value,
 		"expires_at": time.Now().Add(expiry).Unix(),
 	}
 
@@ -232,11 +575,189 @@ func (s *NoSQLStorage) GetTemporaryValue(ctx context.Context, key string) (strin
 	return value, nil
 }
 
-// Helper function to convert map to struct
-func mapToStruct(m map[string]interface{}, v interface{}) error {
-	data, err := json.Marshal(m)
+// DeleteTemporaryValue implements Storage.DeleteTemporaryValue
+func (s *NoSQLStorage) DeleteTemporaryValue(ctx context.Context, key string) error {
+	err := s.client.Delete(ctx, s.tableName, fmt.Sprintf("temp:%s", key))
 	if err != nil {
-		return err
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to delete temporary value",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// ListTemporaryValues implements TempValueLister. Values stored before keys
+// were recorded on temporary records are not listed.
+func (s *NoSQLStorage) ListTemporaryValues(ctx context.Context, prefix string) ([]TempValueInfo, error) {
+	results, err := s.query(ctx, "temp-key-index", BeginsWith("key", prefix))
+	if err != nil {
+		return nil, &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to query temporary values",
+			Err:     err,
+		}
+	}
+
+	now := time.Now()
+	infos := make([]TempValueInfo, 0, len(results))
+	for _, result := range results {
+		key, _ := result["key"].(string)
+		expiresAt, _ := result["expires_at"].(float64)
+		if key == "" || now.Unix() > int64(expiresAt) {
+			continue
+		}
+		infos = append(infos, TempValueInfo{
+			Key:       key,
+			ExpiresAt: time.Unix(int64(expiresAt), 0),
+		})
+	}
+
+	return infos, nil
+}
+
+// deleteKeys deletes the records at keys. Inside a transaction the deletes
+// are buffered and commit with the transaction's other writes.
+func (s *NoSQLStorage) deleteKeys(ctx context.Context, message string, keys ...string) error {
+	for _, key := range keys {
+		if err := s.client.Delete(ctx, s.tableName, key); err != nil {
+			return &StorageError{
+				Code:    ErrInternal,
+				Message: message,
+				Err:     err,
+			}
+		}
+	}
+	return nil
+}
+
+// isValidEmail reports whether email is a bare, well-formed address
+func isValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// SetSlidingSessions enables sliding session expiration. Each GetSession
+// extends the session by its original expiry, but never beyond maxLifetime
+// from creation. Zero disables sliding.
+func (s *NoSQLStorage) SetSlidingSessions(maxLifetime time.Duration) {
+	s.sessionMaxLifetime = maxLifetime
+}
+
+// StoreSession implements Storage.StoreSession
+func (s *NoSQLStorage) StoreSession(ctx context.Context, sessionID string, userID string, expiry time.Duration) error {
+	now := time.Now()
+	session := map[string]interface{}{
+		"session_id":          sessionID,
+		"user_id":             userID,
+		"expires_at":          now.Add(expiry).Unix(),
+		"absolute_expires_at": sessionAbsoluteExpiry(now, expiry, s.sessionMaxLifetime).Unix(),
+		"ttl_seconds":         int64(expiry.Seconds()),
+	}
+
+	err := s.client.Put(ctx, s.tableName, fmt.Sprintf("session:%s", sessionID), session)
+	if err != nil {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to store session",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// GetSession implements Storage.GetSession. Sessions are extended by their
+// original expiry on access, capped at their absolute expiry. Concurrent
+// extensions are harmless: each writes a nearly identical expiry that can
+// never pass the absolute cap.
+func (s *NoSQLStorage) GetSession(ctx context.Context, sessionID string) (string, error) {
+	key := fmt.Sprintf("session:%s", sessionID)
+	result, err := s.client.Get(ctx, s.tableName, key)
+	if err != nil {
+		return "", &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to get session",
+			Err:     err,
+		}
+	}
+
+	if result == nil {
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Session not found",
+		}
+	}
+
+	userID, _ := result["user_id"].(string)
+	expiresAt, _ := result["expires_at"].(float64)
+	ttl, _ := result["ttl_seconds"].(float64)
+	absolute, ok := result["absolute_expires_at"].(float64)
+	if !ok {
+		// Sessions stored before sliding expiration have no absolute expiry;
+		// they keep their original one and aren't extended
+		absolute = expiresAt
+	}
+
+	now := time.Now().Unix()
+	if now > int64(expiresAt) || now > int64(absolute) {
+		_ = s.client.Delete(ctx, s.tableName, key)
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Session expired",
+		}
+	}
+
+	extended := now + int64(ttl)
+	if extended > int64(absolute) {
+		extended = int64(absolute)
+	}
+	if extended > int64(expiresAt) {
+		s.extendSession(ctx, key, result, extended)
+	}
+
+	return userID, nil
+}
+
+// extendSession moves a session's sliding expiry to extended. The write is
+// conditional on the expiry read, so a session deleted or extended meanwhile
+// isn't overwritten; a deleted one would otherwise be recreated. Without a
+// conditional client the session is left unextended.
+func (s *NoSQLStorage) extendSession(ctx context.Context, key string, record map[string]interface{}, extended int64) {
+	putter, ok := s.client.(NoSQLConditionalPutter)
+	if !ok {
+		return
 	}
-	return json.Unmarshal(data, v)
-} 
\ No newline at end of file
+
+	read := record["expires_at"]
+	record["expires_at"] = extended
+	if _, err := putter.PutIf(ctx, s.tableName, key, record, "expires_at", read); err != nil {
+		// The session is still valid; it just wasn't extended
+		s.logger.Warn("Failed to extend session", zap.Error(err))
+	}
+}
+
+// DeleteSession implements Storage.DeleteSession
+func (s *NoSQLStorage) DeleteSession(ctx context.Context, sessionID string) error {
+	err := s.client.Delete(ctx, s.tableName, fmt.Sprintf("session:%s", sessionID))
+	if err != nil {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to delete session",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// sessionAbsoluteExpiry returns when a session created at now must end.
+// Without sliding expiration that is simply its expiry.
+func sessionAbsoluteExpiry(now time.Time, expiry time.Duration, maxLifetime time.Duration) time.Time {
+	if maxLifetime <= 0 || maxLifetime < expiry {
+		return now.Add(expiry)
+	}
+	return now.Add(maxLifetime)
+}
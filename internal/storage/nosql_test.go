@@ -0,0 +1,492 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/idgen"
+)
+
+func TestNoSQLAssignsIDs(t *testing.T) {
+	client := newFakeTxClient()
+	s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+	s.SetIDGenerator(idgen.NewSequence("id"))
+	ctx := context.Background()
+
+	first := &MFAMethod{UserID: "user-1", Type: "totp"}
+	credential := &Credential{UserID: "user-1"}
+	existing := &MFAMethod{ID: "mfa-kept", UserID: "user-1", Type: "sms"}
+
+	// The fake client only writes in transactions, which share the generator
+	err = s.Transaction(ctx, func(tx Storage) error {
+		if err := tx.StoreMFAMethod(ctx, first); err != nil {
+			return err
+		}
+		if err := tx.StoreCredential(ctx, credential); err != nil {
+			return err
+		}
+		return tx.StoreMFAMethod(ctx, existing)
+	})
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+
+	if first.ID != "id-000001" {
+		t.Errorf("MFA method ID = %q, want id-000001", first.ID)
+	}
+	if credential.ID != "id-000002" {
+		t.Errorf("credential ID = %q, want id-000002", credential.ID)
+	}
+	if existing.ID != "mfa-kept" {
+		t.Errorf("existing ID replaced with %q", existing.ID)
+	}
+	for _, key := range []string{"id-000001", "id-000002", "mfa-kept"} {
+		if item, _ := client.Get(ctx, "polyid", key); item == nil {
+			t.Errorf("no record stored under %s", key)
+		}
+	}
+}
+
+func TestNoSQLGetSession(t *testing.T) {
+	now := time.Now()
+	later := float64(now.Add(time.Hour).Unix())
+	earlier := float64(now.Add(-time.Hour).Unix())
+
+	tests := []struct {
+		name     string
+		record   map[string]interface{}
+		wantCode string
+	}{
+		{
+			name: "active session",
+			record: map[string]interface{}{
+				"user_id": "user-1", "expires_at": later, "absolute_expires_at": later, "ttl_seconds": float64(3600),
+			},
+		},
+		{
+			name: "expired session",
+			record: map[string]interface{}{
+				"user_id": "user-1", "expires_at": earlier, "absolute_expires_at": later, "ttl_seconds": float64(3600),
+			},
+			wantCode: ErrNotFound,
+		},
+		{
+			name: "past absolute expiry",
+			record: map[string]interface{}{
+				"user_id": "user-1", "expires_at": later, "absolute_expires_at": earlier, "ttl_seconds": float64(3600),
+			},
+			wantCode: ErrNotFound,
+		},
+		{
+			name: "legacy session without absolute expiry",
+			record: map[string]interface{}{
+				"user_id": "user-1", "expires_at": later,
+			},
+		},
+		{
+			name: "expired legacy session",
+			record: map[string]interface{}{
+				"user_id": "user-1", "expires_at": earlier,
+			},
+			wantCode: ErrNotFound,
+		},
+		{
+			name:     "missing session",
+			wantCode: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeTxClient()
+			if tt.record != nil {
+				client.seed("", "session:sess-1", tt.record)
+			}
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+
+			userID, err := s.GetSession(context.Background(), "sess-1")
+
+			if tt.wantCode != "" {
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+					t.Fatalf("GetSession() error = %v, want code %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+			if userID != "user-1" {
+				t.Errorf("GetSession() = %q, want user-1", userID)
+			}
+		})
+	}
+}
+
+// conditionalTxClient adds conditional puts to fakeTxClient
+type conditionalTxClient struct {
+	*fakeTxClient
+}
+
+func (c conditionalTxClient) PutIf(ctx context.Context, table string, key string, value interface{}, field string, expected interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || item[field] != expected {
+		return false, nil
+	}
+	c.items[key] = value.(map[string]interface{})
+	return true, nil
+}
+
+func TestNoSQLGetSessionSliding(t *testing.T) {
+	now := time.Now()
+	ttl := time.Hour
+
+	tests := []struct {
+		name        string
+		expiresAt   time.Time
+		absolute    time.Time
+		conditional bool
+		want        time.Time
+	}{
+		{name: "extends by the TTL", expiresAt: now.Add(time.Minute), absolute: now.Add(24 * time.Hour), conditional: true, want: now.Add(ttl)},
+		{name: "capped at the absolute expiry", expiresAt: now.Add(time.Minute), absolute: now.Add(10 * time.Minute), conditional: true, want: now.Add(10 * time.Minute)},
+		{name: "already at the absolute expiry", expiresAt: now.Add(10 * time.Minute), absolute: now.Add(10 * time.Minute), conditional: true, want: now.Add(10 * time.Minute)},
+		{name: "unconditional client", expiresAt: now.Add(time.Minute), absolute: now.Add(24 * time.Hour), want: now.Add(time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeTxClient()
+			fake.seed("", "session:sess-1", map[string]interface{}{
+				"user_id":             "user-1",
+				"expires_at":          float64(tt.expiresAt.Unix()),
+				"absolute_expires_at": float64(tt.absolute.Unix()),
+				"ttl_seconds":         ttl.Seconds(),
+			})
+			var client NoSQLClient = fake
+			if tt.conditional {
+				client = conditionalTxClient{fake}
+			}
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+
+			if _, err := s.GetSession(context.Background(), "sess-1"); err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+
+			item, _ := fake.Get(context.Background(), "polyid", "session:sess-1")
+			var got int64
+			switch v := item["expires_at"].(type) {
+			case int64:
+				got = v
+			case float64:
+				got = int64(v)
+			}
+			if diff := got - tt.want.Unix(); diff < -1 || diff > 1 {
+				t.Errorf("expires_at = %d, want %d", got, tt.want.Unix())
+			}
+			if got > tt.absolute.Unix() {
+				t.Errorf("expires_at %d is past the absolute expiry %d", got, tt.absolute.Unix())
+			}
+		})
+	}
+}
+
+func TestNoSQLValidateUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     *User
+		wantCode string
+	}{
+		{name: "new user", user: &User{Email: "b@example.com"}},
+		{name: "new user with an ID", user: &User{ID: "user-2", Email: "b@example.com"}},
+		{name: "invalid email", user: &User{Email: "not-an-email"}, wantCode: ErrInvalidInput},
+		{name: "duplicate email", user: &User{Email: "a@example.com"}, wantCode: ErrAlreadyExists},
+		{name: "duplicate ID", user: &User{ID: "user-1", Email: "b@example.com"}, wantCode: ErrAlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeTxClient()
+			client.seed("email-index", "user-1", map[string]interface{}{"id": "user-1", "email": "a@example.com"})
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			before := client.keys()
+
+			err = s.ValidateUser(context.Background(), tt.user)
+
+			if tt.wantCode == "" && err != nil {
+				t.Errorf("ValidateUser() = %v, want nil", err)
+			}
+			if tt.wantCode != "" {
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+					t.Errorf("ValidateUser() = %v, want code %s", err, tt.wantCode)
+				}
+			}
+			if after := client.keys(); !reflect.DeepEqual(after, before) {
+				t.Errorf("ValidateUser() wrote records: keys %v, want %v", after, before)
+			}
+		})
+	}
+}
+
+// cancellingClient cancels the caller's context once a query returns, as if
+// the caller gave up while the results were being decoded
+type cancellingClient struct {
+	*fakeTxClient
+	cancel context.CancelFunc
+}
+
+func (c cancellingClient) Query(ctx context.Context, table string, index string, condition string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	results, err := c.fakeTxClient.Query(ctx, table, index, condition, params)
+	c.cancel()
+	return results, err
+}
+
+func TestNoSQLGetCredentialsCancelled(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		wantErr error
+	}{
+		{name: "not cancelled"},
+		{name: "cancelled mid-scan", cancel: true, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeTxClient()
+			for i := 0; i < 100; i++ {
+				id := fmt.Sprintf("cred-%d", i)
+				fake.seed("user-credentials-index", id, map[string]interface{}{"id": id, "user_id": "user-1"})
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var client NoSQLClient = fake
+			if tt.cancel {
+				client = cancellingClient{fakeTxClient: fake, cancel: cancel}
+			}
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+
+			credentials, err := s.GetCredentials(ctx, "user-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetCredentials() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if credentials != nil {
+					t.Errorf("GetCredentials() returned %d partial results", len(credentials))
+				}
+				return
+			}
+			if len(credentials) != 100 {
+				t.Errorf("GetCredentials() returned %d credentials, want 100", len(credentials))
+			}
+		})
+	}
+}
+
+// failingUserClient fails queries for one user
+type failingUserClient struct {
+	*fakeTxClient
+	userID string
+}
+
+func (c failingUserClient) Query(ctx context.Context, table string, index string, condition string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	if params[":user_id"] == c.userID {
+		return nil, errors.New("query failed")
+	}
+	return c.fakeTxClient.Query(ctx, table, index, condition, params)
+}
+
+func TestNoSQLGetMFAMethodsForUsers(t *testing.T) {
+	fake := newFakeTxClient()
+	for _, m := range []struct{ id, userID string }{{"mfa-1", "user-1"}, {"mfa-2", "user-1"}, {"mfa-3", "user-3"}} {
+		fake.seed("user-mfa-index", m.id, map[string]interface{}{"id": m.id, "user_id": m.userID, "type": "totp"})
+	}
+	ctx := context.Background()
+
+	s, err := NewNoSQLStorage(fake, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+	byUser, err := s.GetMFAMethodsForUsers(ctx, []string{"user-1", "user-2", "user-3"})
+	if err != nil {
+		t.Fatalf("GetMFAMethodsForUsers: %v", err)
+	}
+
+	want := map[string][]string{"user-1": {"mfa-1", "mfa-2"}, "user-2": {}, "user-3": {"mfa-3"}}
+	if len(byUser) != len(want) {
+		t.Errorf("GetMFAMethodsForUsers() returned %d users, want %d", len(byUser), len(want))
+	}
+	for userID, wantIDs := range want {
+		methods, ok := byUser[userID]
+		if !ok || methods == nil {
+			t.Errorf("%s: missing from the result, want an empty list at least", userID)
+			continue
+		}
+		ids := make([]string, 0, len(methods))
+		for _, method := range methods {
+			ids = append(ids, method.ID)
+		}
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, wantIDs) {
+			t.Errorf("%s: methods = %v, want %v", userID, ids, wantIDs)
+		}
+	}
+
+	// One failed user fails the batch
+	s, err = NewNoSQLStorage(failingUserClient{fakeTxClient: fake, userID: "user-3"}, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+	if byUser, err := s.GetMFAMethodsForUsers(ctx, []string{"user-1", "user-3"}); err == nil {
+		t.Errorf("GetMFAMethodsForUsers() = %v, want error", byUser)
+	}
+}
+
+func TestNoSQLLenientReads(t *testing.T) {
+	tests := []struct {
+		name        string
+		lenient     bool
+		wantErr     bool
+		wantSkipped uint64
+	}{
+		{name: "strict", wantErr: true},
+		{name: "lenient", lenient: true, wantSkipped: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeTxClient()
+			fake.seed("user-credentials-index", "cred-1", map[string]interface{}{"id": "cred-1", "user_id": "user-1", "public_key": "AQID"})
+			fake.seed("user-credentials-index", "cred-2", map[string]interface{}{"id": "cred-2", "user_id": "user-1", "public_key": 42})
+			fake.seed("user-credentials-index", "cred-3", map[string]interface{}{"id": "cred-3", "user_id": "user-1"})
+			fake.seed("user-mfa-index", "mfa-1", map[string]interface{}{"id": "mfa-1", "user_id": "user-1", "type": "totp"})
+			fake.seed("user-mfa-index", "mfa-2", map[string]interface{}{"id": "mfa-2", "user_id": "user-1", "drift_steps": "two"})
+			ctx := context.Background()
+
+			s, err := NewNoSQLStorage(fake, zap.NewNop(), NoSQLConfig{TableName: "polyid", Lenient: tt.lenient})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+
+			credentials, credErr := s.GetCredentials(ctx, "user-1")
+			methods, methodErr := s.GetMFAMethods(ctx, "user-1")
+			if tt.wantErr {
+				if credErr == nil || methodErr == nil {
+					t.Errorf("reads with corrupt records: credentials error %v, methods error %v, want both to fail", credErr, methodErr)
+				}
+				return
+			}
+			if credErr != nil || methodErr != nil {
+				t.Fatalf("lenient reads: credentials error %v, methods error %v", credErr, methodErr)
+			}
+
+			if len(credentials) != 2 {
+				t.Errorf("GetCredentials() returned %d credentials, want the 2 valid ones", len(credentials))
+			}
+			for _, credential := range credentials {
+				if credential.ID == "cred-2" {
+					t.Error("corrupt credential returned")
+				}
+			}
+			if len(methods) != 1 || methods[0].ID != "mfa-1" {
+				t.Errorf("GetMFAMethods() = %+v, want only mfa-1", methods)
+			}
+			if got := s.SkippedRecords(); got != tt.wantSkipped {
+				t.Errorf("SkippedRecords() = %d, want %d", got, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestNoSQLGetUserByEmailDuplicates(t *testing.T) {
+	retired := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name     string
+		users    []map[string]interface{}
+		wantID   string
+		wantCode string
+	}{
+		{
+			name:   "single match",
+			users:  []map[string]interface{}{{"id": "user-1", "email": "a@example.com"}},
+			wantID: "user-1",
+		},
+		{
+			name:     "no match",
+			wantCode: ErrNotFound,
+		},
+		{
+			name: "duplicate matches",
+			users: []map[string]interface{}{
+				{"id": "user-1", "email": "a@example.com"},
+				{"id": "user-2", "email": "a@example.com"},
+			},
+			wantCode: ErrDataIntegrity,
+		},
+		{
+			name: "duplicate of a retired user",
+			users: []map[string]interface{}{
+				{"id": "user-1", "email": "a@example.com", "deleted_at": retired, "merged_into": "user-2"},
+				{"id": "user-2", "email": "a@example.com"},
+			},
+			wantID: "user-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeTxClient()
+			for _, user := range tt.users {
+				client.seed("email-index", user["id"].(string), user)
+			}
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+
+			user, err := s.GetUserByEmail(context.Background(), "a@example.com")
+
+			if tt.wantCode != "" {
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+					t.Errorf("GetUserByEmail() = %v, %v, want code %s", user, err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserByEmail: %v", err)
+			}
+			if user.ID != tt.wantID {
+				t.Errorf("GetUserByEmail() = %s, want %s", user.ID, tt.wantID)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxPatchAttempts bounds how often PatchUser retries after a concurrent
+// update wins the conditional write
+const maxPatchAttempts = 3
+
+// NoSQLConditionalPutter is implemented by NoSQL clients that can write an
+// item only while one of its fields still holds an expected value
+type NoSQLConditionalPutter interface {
+	// PutIf writes value and reports true if the stored item's field equals
+	// expected, and otherwise writes nothing and reports false
+	PutIf(ctx context.Context, table string, key string, value interface{}, field string, expected interface{}) (bool, error)
+}
+
+// PatchUser implements Storage.PatchUser. The user's updated_at serves as
+// its version: with a client that supports conditional writes the patch is
+// only written if the user is unchanged since it was read, and is reapplied
+// to the fresh record otherwise. A new email is reserved before the write,
+// as in CreateUser, and the old one released after it. Without conditional
+// writes, a concurrent update to other fields can be lost and email
+// uniqueness is only checked.
+func (s *NoSQLStorage) PatchUser(ctx context.Context, id string, fields map[string]interface{}) (patched *User, err error) {
+	if len(fields) == 0 {
+		return nil, &StorageError{
+			Code:    ErrInvalidInput,
+			Message: "No fields to patch",
+		}
+	}
+
+	if email, ok := fields["email"].(string); ok && isValidEmail(email) {
+		reserved, err := s.reserveEmail(ctx, email, id)
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			defer func() {
+				if patched == nil {
+					s.releaseEmail(ctx, email, id)
+				}
+			}()
+		}
+	}
+
+	putter, conditional := s.client.(NoSQLConditionalPutter)
+
+	for attempt := 0; attempt < maxPatchAttempts; attempt++ {
+		user, raw, err := s.loadUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		previous := user.Email
+		if err := s.applyPatch(ctx, user, fields); err != nil {
+			return nil, err
+		}
+		user.UpdatedAt = time.Now()
+
+		if !conditional {
+			if err := s.putRecord(ctx, user.ID, user); err != nil {
+				return nil, &StorageError{
+					Code:    ErrInternal,
+					Message: "Failed to patch user",
+					Err:     err,
+				}
+			}
+			return user, nil
+		}
+
+		written, err := putter.PutIf(ctx, s.tableName, user.ID, user, "updated_at", raw["updated_at"])
+		if err != nil {
+			return nil, &StorageError{
+				Code:    ErrInternal,
+				Message: "Failed to patch user",
+				Err:     err,
+			}
+		}
+		if written {
+			if user.Email != previous {
+				s.releaseEmail(ctx, previous, id)
+			}
+			return user, nil
+		}
+	}
+
+	return nil, &StorageError{
+		Code:    ErrConflict,
+		Message: "User was concurrently modified",
+	}
+}
+
+// applyPatch validates each field and applies it to user. Only email and
+// last_login_at can be patched; the rest are managed by storage.
+func (s *NoSQLStorage) applyPatch(ctx context.Context, user *User, fields map[string]interface{}) error {
+	for name, value := range fields {
+		switch name {
+		case "email":
+			email, ok := value.(string)
+			if !ok || !isValidEmail(email) {
+				return &StorageError{
+					Code:    ErrInvalidInput,
+					Message: "Invalid email address",
+				}
+			}
+			if email != user.Email {
+				if err := s.checkEmailAvailable(ctx, email); err != nil {
+					return err
+				}
+			}
+			user.Email = email
+
+		case "last_login_at":
+			at, err := patchTime(value)
+			if err != nil {
+				return &StorageError{
+					Code:    ErrInvalidInput,
+					Message: "Invalid last login time",
+					Err:     err,
+				}
+			}
+			user.LastLoginAt = at
+
+		default:
+			return &StorageError{
+				Code:    ErrInvalidInput,
+				Message: fmt.Sprintf("Field %q cannot be patched", name),
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkEmailAvailable returns ErrAlreadyExists if another user has email.
+// It catches users whose email predates reservations; reserveEmail is what
+// keeps concurrent writers from taking the same email.
+func (s *NoSQLStorage) checkEmailAvailable(ctx context.Context, email string) error {
+	_, err := s.GetUserByEmail(ctx, email)
+	if err == nil {
+		return &StorageError{
+			Code:    ErrAlreadyExists,
+			Message: "Email already in use",
+		}
+	}
+
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) && storageErr.Code == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// patchTime accepts a time.Time or an RFC 3339 string
+func patchTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return time.Parse(time.RFC3339, v)
+	default:
+		return time.Time{}, fmt.Errorf("unsupported type %T", value)
+	}
+}
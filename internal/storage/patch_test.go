@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// patchClient adds JSON-encoded puts and conditional writes to
+// fakeTxClient. While races is positive, each PutIf first lets a concurrent
+// writer apply race to the stored item, so the conditional write loses.
+type patchClient struct {
+	*fakeTxClient
+	races int
+	race  func(item map[string]interface{})
+}
+
+func encodeItem(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var item map[string]interface{}
+	return item, json.Unmarshal(data, &item)
+}
+
+func (c *patchClient) Put(ctx context.Context, table string, key string, value interface{}) error {
+	item, err := encodeItem(value)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = item
+	return nil
+}
+
+func (c *patchClient) PutIf(ctx context.Context, table string, key string, value interface{}, field string, expected interface{}) (bool, error) {
+	item, err := encodeItem(value)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current, ok := c.items[key]
+	if ok && c.races > 0 {
+		c.races--
+		c.race(current)
+		current["updated_at"] = time.Now().Add(time.Duration(c.races+1) * time.Minute).Format(time.RFC3339Nano)
+	}
+	if !ok || current[field] != expected {
+		return false, nil
+	}
+	c.items[key] = item
+	return true, nil
+}
+
+func (c *patchClient) PutIfAbsent(ctx context.Context, table string, key string, value interface{}) (bool, error) {
+	item, err := encodeItem(value)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok {
+		return false, nil
+	}
+	c.items[key] = item
+	return true, nil
+}
+
+func (c *patchClient) DeleteIf(ctx context.Context, table string, key string, field string, expected interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[key]
+	if !ok || item[field] != expected {
+		return false, nil
+	}
+	delete(c.items, key)
+	return true, nil
+}
+
+var (
+	patchCreated   = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	patchLastLogin = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// newPatchStore seeds user-1 (a@example.com) and user-2 (b@example.com)
+// with their email reservations
+func newPatchStore(t *testing.T) (*NoSQLStorage, *patchClient) {
+	t.Helper()
+	client := &patchClient{fakeTxClient: newFakeTxClient()}
+	for id, email := range map[string]string{"user-1": "a@example.com", "user-2": "b@example.com"} {
+		client.seed("email-index", id, map[string]interface{}{
+			"id":            id,
+			"email":         email,
+			"last_login_at": patchLastLogin.Format(time.RFC3339),
+			"created_at":    patchCreated.Format(time.RFC3339),
+			"updated_at":    patchCreated.Format(time.RFC3339),
+		})
+		client.seed("", emailKey(email), map[string]interface{}{"email": email, "user_id": id})
+	}
+
+	s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+	return s, client
+}
+
+// storedUser decodes the stored record of a user
+func storedUser(t *testing.T, client *patchClient, id string) *User {
+	t.Helper()
+	item, _ := client.Get(context.Background(), "polyid", id)
+	var user User
+	data, _ := json.Marshal(item)
+	if err := json.Unmarshal(data, &user); err != nil {
+		t.Fatalf("decode %s: %v", id, err)
+	}
+	return &user
+}
+
+// reservedBy returns the user holding email's reservation, or ""
+func reservedBy(client *patchClient, email string) string {
+	item, _ := client.Get(context.Background(), "polyid", emailKey(email))
+	holder, _ := item["user_id"].(string)
+	return holder
+}
+
+func TestPatchUser(t *testing.T) {
+	newLogin := time.Date(2024, 6, 1, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		fields        map[string]interface{}
+		wantEmail     string
+		wantLastLogin time.Time
+	}{
+		{name: "email only", fields: map[string]interface{}{"email": "c@example.com"}, wantEmail: "c@example.com", wantLastLogin: patchLastLogin},
+		{name: "last login only", fields: map[string]interface{}{"last_login_at": newLogin}, wantEmail: "a@example.com", wantLastLogin: newLogin},
+		{name: "last login as a string", fields: map[string]interface{}{"last_login_at": newLogin.Format(time.RFC3339)}, wantEmail: "a@example.com", wantLastLogin: newLogin},
+		{name: "unchanged email", fields: map[string]interface{}{"email": "a@example.com"}, wantEmail: "a@example.com", wantLastLogin: patchLastLogin},
+		{
+			name:          "both fields",
+			fields:        map[string]interface{}{"email": "c@example.com", "last_login_at": newLogin},
+			wantEmail:     "c@example.com",
+			wantLastLogin: newLogin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newPatchStore(t)
+
+			patched, err := s.PatchUser(context.Background(), "user-1", tt.fields)
+			if err != nil {
+				t.Fatalf("PatchUser: %v", err)
+			}
+
+			for source, user := range map[string]*User{"returned": patched, "stored": storedUser(t, client, "user-1")} {
+				if user.ID != "user-1" || user.Email != tt.wantEmail || !user.LastLoginAt.Equal(tt.wantLastLogin) {
+					t.Errorf("%s user = %s %s %v, want user-1 %s %v", source, user.ID, user.Email, user.LastLoginAt, tt.wantEmail, tt.wantLastLogin)
+				}
+				if !user.CreatedAt.Equal(patchCreated) {
+					t.Errorf("%s created_at = %v, want %v", source, user.CreatedAt, patchCreated)
+				}
+				if !user.UpdatedAt.After(patchCreated) {
+					t.Errorf("%s updated_at = %v, want it bumped", source, user.UpdatedAt)
+				}
+			}
+
+			if holder := reservedBy(client, tt.wantEmail); holder != "user-1" {
+				t.Errorf("%s reserved by %q, want user-1", tt.wantEmail, holder)
+			}
+			if tt.wantEmail != "a@example.com" && reservedBy(client, "a@example.com") != "" {
+				t.Error("old email is still reserved")
+			}
+
+			// The other user is untouched
+			if other := storedUser(t, client, "user-2"); other.Email != "b@example.com" || !other.UpdatedAt.Equal(patchCreated) {
+				t.Errorf("user-2 = %+v, want it unchanged", other)
+			}
+		})
+	}
+}
+
+func TestPatchUserRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		fields   map[string]interface{}
+		wantCode string
+	}{
+		{name: "no fields", id: "user-1", wantCode: ErrInvalidInput},
+		{name: "unpatchable field", id: "user-1", fields: map[string]interface{}{"id": "user-3"}, wantCode: ErrInvalidInput},
+		{name: "invalid email", id: "user-1", fields: map[string]interface{}{"email": "not-an-email"}, wantCode: ErrInvalidInput},
+		{name: "invalid last login", id: "user-1", fields: map[string]interface{}{"last_login_at": "yesterday"}, wantCode: ErrInvalidInput},
+		{
+			name:     "new email with an invalid field",
+			id:       "user-1",
+			fields:   map[string]interface{}{"email": "c@example.com", "last_login_at": 42},
+			wantCode: ErrInvalidInput,
+		},
+		{name: "another user's email", id: "user-1", fields: map[string]interface{}{"email": "b@example.com"}, wantCode: ErrAlreadyExists},
+		{name: "unknown user", id: "user-3", fields: map[string]interface{}{"email": "c@example.com"}, wantCode: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newPatchStore(t)
+			before := client.keys()
+
+			_, err := s.PatchUser(context.Background(), tt.id, tt.fields)
+			var storageErr *StorageError
+			if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+				t.Fatalf("PatchUser() = %v, want code %s", err, tt.wantCode)
+			}
+
+			if user := storedUser(t, client, "user-1"); user.Email != "a@example.com" || !user.UpdatedAt.Equal(patchCreated) {
+				t.Errorf("user-1 = %+v, want it unchanged", user)
+			}
+			// A failed patch releases any email it reserved
+			if after := client.keys(); len(after) != len(before) {
+				t.Errorf("keys = %v, want %v", after, before)
+			}
+		})
+	}
+}
+
+func TestPatchUserConcurrentUpdate(t *testing.T) {
+	concurrentLogin := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	race := func(item map[string]interface{}) {
+		item["last_login_at"] = concurrentLogin.Format(time.RFC3339)
+	}
+
+	t.Run("reapplied to the fresh record", func(t *testing.T) {
+		s, client := newPatchStore(t)
+		client.races, client.race = 1, race
+
+		patched, err := s.PatchUser(context.Background(), "user-1", map[string]interface{}{"email": "c@example.com"})
+		if err != nil {
+			t.Fatalf("PatchUser: %v", err)
+		}
+		stored := storedUser(t, client, "user-1")
+		for source, user := range map[string]*User{"returned": patched, "stored": stored} {
+			if user.Email != "c@example.com" || !user.LastLoginAt.Equal(concurrentLogin) {
+				t.Errorf("%s user = %s %v, want the patch on top of the concurrent update", source, user.Email, user.LastLoginAt)
+			}
+		}
+	})
+
+	t.Run("gives up after repeated conflicts", func(t *testing.T) {
+		s, client := newPatchStore(t)
+		client.races, client.race = maxPatchAttempts, race
+
+		_, err := s.PatchUser(context.Background(), "user-1", map[string]interface{}{"email": "c@example.com"})
+		var storageErr *StorageError
+		if !errors.As(err, &storageErr) || storageErr.Code != ErrConflict {
+			t.Fatalf("PatchUser() = %v, want code %s", err, ErrConflict)
+		}
+		if user := storedUser(t, client, "user-1"); user.Email != "a@example.com" {
+			t.Errorf("email = %s, want a@example.com", user.Email)
+		}
+		if holder := reservedBy(client, "c@example.com"); holder != "" {
+			t.Errorf("new email reserved by %q after the patch failed", holder)
+		}
+	})
+}
+
+func TestPatchUserUnconditional(t *testing.T) {
+	client := encodingClient{newFakeTxClient()}
+	client.seed("email-index", "user-1", map[string]interface{}{
+		"id":         "user-1",
+		"email":      "a@example.com",
+		"created_at": patchCreated.Format(time.RFC3339),
+		"updated_at": patchCreated.Format(time.RFC3339),
+	})
+	s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+
+	if _, err := s.PatchUser(context.Background(), "user-1", map[string]interface{}{"last_login_at": patchLastLogin}); err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+	item, _ := client.Get(context.Background(), "polyid", "user-1")
+	if item["email"] != "a@example.com" || item["last_login_at"] != patchLastLogin.Format(time.RFC3339) {
+		t.Errorf("stored user = %v, want only last_login_at patched", item)
+	}
+}
+
+func TestCachedPatchUser(t *testing.T) {
+	s, _ := newPatchStore(t)
+	cache := newTestRedisCache(t)
+	cached := NewCachedStorage(s, cache, zap.NewNop(), 0)
+	ctx := context.Background()
+
+	if err := cache.SetUser(ctx, &User{ID: "user-1", Email: "a@example.com"}, 0); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if _, err := cached.PatchUser(ctx, "user-1", map[string]interface{}{"email": "c@example.com"}); err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+
+	_, err := cache.GetUser(ctx, "user-1")
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrNotFound {
+		t.Errorf("cached user after patch: %v, want it dropped", err)
+	}
+}
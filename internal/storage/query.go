@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Condition is a structured secondary-index query condition. Build one with
+// Eq, Gt, BeginsWith, Between, and And.
+type Condition interface {
+	// Expression renders the condition in the string form accepted by
+	// NoSQLClient.Query, along with its placeholder values
+	Expression() (string, map[string]interface{})
+	render(params map[string]interface{}) string
+}
+
+// NoSQLConditionQuerier is implemented by NoSQL clients that translate
+// structured conditions natively. Clients that don't implement it receive the
+// rendered string form through NoSQLClient.Query.
+type NoSQLConditionQuerier interface {
+	QueryCondition(ctx context.Context, table string, index string, condition Condition) ([]map[string]interface{}, error)
+}
+
+// NoSQLLimitQuerier is implemented by NoSQL clients that can stop a query
+// after limit items in index order. Clients that don't implement it return
+// every match, which the caller sorts and cuts.
+type NoSQLLimitQuerier interface {
+	QueryLimit(ctx context.Context, table string, index string, condition Condition, limit int) ([]map[string]interface{}, error)
+}
+
+// Eq matches items whose field equals value
+func Eq(field string, value interface{}) Condition {
+	return comparison{field: field, value: value, format: "%s = %s"}
+}
+
+// Gt matches items whose field sorts after value
+func Gt(field string, value interface{}) Condition {
+	return comparison{field: field, value: value, format: "%s > %s"}
+}
+
+// BeginsWith matches items whose string field starts with prefix
+func BeginsWith(field string, prefix string) Condition {
+	return comparison{field: field, value: prefix, format: "begins_with(%s, %s)"}
+}
+
+// Between matches items whose field is within [low, high], inclusive
+func Between(field string, low interface{}, high interface{}) Condition {
+	return between{field: field, low: low, high: high}
+}
+
+// And matches items that satisfy every condition
+func And(conditions ...Condition) Condition {
+	return and(conditions)
+}
+
+type comparison struct {
+	field  string
+	value  interface{}
+	format string
+}
+
+func (c comparison) Expression() (string, map[string]interface{}) {
+	return expression(c)
+}
+
+func (c comparison) render(params map[string]interface{}) string {
+	return fmt.Sprintf(c.format, c.field, bind(params, c.field, c.value))
+}
+
+type between struct {
+	field string
+	low   interface{}
+	high  interface{}
+}
+
+func (b between) Expression() (string, map[string]interface{}) {
+	return expression(b)
+}
+
+func (b between) render(params map[string]interface{}) string {
+	low := bind(params, b.field, b.low)
+	high := bind(params, b.field, b.high)
+	return fmt.Sprintf("%s BETWEEN %s AND %s", b.field, low, high)
+}
+
+// bind adds value to params under a placeholder named after field and
+// returns the placeholder
+func bind(params map[string]interface{}, field string, value interface{}) string {
+	placeholder := ":" + field
+	// Disambiguate when the same field appears more than once
+	for i := 2; ; i++ {
+		if _, taken := params[placeholder]; !taken {
+			break
+		}
+		placeholder = fmt.Sprintf(":%s_%d", field, i)
+	}
+
+	params[placeholder] = value
+	return placeholder
+}
+
+type and []Condition
+
+func (a and) Expression() (string, map[string]interface{}) {
+	return expression(a)
+}
+
+func (a and) render(params map[string]interface{}) string {
+	parts := make([]string, 0, len(a))
+	for _, condition := range a {
+		parts = append(parts, condition.render(params))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+func expression(c Condition) (string, map[string]interface{}) {
+	params := make(map[string]interface{})
+	return c.render(params), params
+}
+
+// query runs a structured query, translating it to the string form for
+// clients without native support
+func (s *NoSQLStorage) query(ctx context.Context, index string, condition Condition) ([]map[string]interface{}, error) {
+	if querier, ok := s.client.(NoSQLConditionQuerier); ok {
+		return querier.QueryCondition(ctx, s.tableName, index, condition)
+	}
+
+	expr, params := condition.Expression()
+	return s.client.Query(ctx, s.tableName, index, expr, params)
+}
+
+// queryLimit runs a structured query for up to limit items in index order
+// if the client supports it, and for every match otherwise
+func (s *NoSQLStorage) queryLimit(ctx context.Context, index string, condition Condition, limit int) ([]map[string]interface{}, error) {
+	if querier, ok := s.client.(NoSQLLimitQuerier); ok {
+		return querier.QueryLimit(ctx, s.tableName, index, condition, limit)
+	}
+	return s.query(ctx, index, condition)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestConditionExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		condition  Condition
+		wantExpr   string
+		wantParams map[string]interface{}
+	}{
+		{
+			name:       "equals",
+			condition:  Eq("user_id", "user-1"),
+			wantExpr:   "user_id = :user_id",
+			wantParams: map[string]interface{}{":user_id": "user-1"},
+		},
+		{
+			name:       "greater than",
+			condition:  Gt("created_at", "2024-01-01"),
+			wantExpr:   "created_at > :created_at",
+			wantParams: map[string]interface{}{":created_at": "2024-01-01"},
+		},
+		{
+			name:       "begins with",
+			condition:  BeginsWith("email", "a@"),
+			wantExpr:   "begins_with(email, :email)",
+			wantParams: map[string]interface{}{":email": "a@"},
+		},
+		{
+			name:       "between",
+			condition:  Between("expires_at", 10, 20),
+			wantExpr:   "expires_at BETWEEN :expires_at AND :expires_at_2",
+			wantParams: map[string]interface{}{":expires_at": 10, ":expires_at_2": 20},
+		},
+		{
+			name:       "and",
+			condition:  And(Eq("user_id", "user-1"), Gt("id", "cred-5")),
+			wantExpr:   "user_id = :user_id AND id > :id",
+			wantParams: map[string]interface{}{":user_id": "user-1", ":id": "cred-5"},
+		},
+		{
+			name:       "repeated field",
+			condition:  And(Gt("score", 1), Gt("score", 2), Eq("score", 3)),
+			wantExpr:   "score > :score AND score > :score_2 AND score = :score_3",
+			wantParams: map[string]interface{}{":score": 1, ":score_2": 2, ":score_3": 3},
+		},
+		{
+			name:       "nested and",
+			condition:  And(Eq("user_id", "user-1"), And(Between("n", 1, 2), Eq("type", "totp"))),
+			wantExpr:   "user_id = :user_id AND n BETWEEN :n AND :n_2 AND type = :type",
+			wantParams: map[string]interface{}{":user_id": "user-1", ":n": 1, ":n_2": 2, ":type": "totp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, params := tt.condition.Expression()
+			if expr != tt.wantExpr {
+				t.Errorf("Expression() = %q, want %q", expr, tt.wantExpr)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("Expression() params = %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+// conditionClient records the structured conditions it is queried with
+type conditionClient struct {
+	*fakeTxClient
+	conditions []Condition
+}
+
+func (c *conditionClient) QueryCondition(ctx context.Context, table string, index string, condition Condition) ([]map[string]interface{}, error) {
+	c.conditions = append(c.conditions, condition)
+	return nil, nil
+}
+
+func TestQueryUsesNativeConditions(t *testing.T) {
+	client := &conditionClient{fakeTxClient: newFakeTxClient()}
+	s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+	if err != nil {
+		t.Fatalf("NewNoSQLStorage: %v", err)
+	}
+
+	if _, err := s.GetCredentials(context.Background(), "user-1"); err != nil {
+		t.Fatalf("GetCredentials: %v", err)
+	}
+	want := []Condition{Eq("user_id", "user-1")}
+	if !reflect.DeepEqual(client.conditions, want) {
+		t.Errorf("queried with %v, want %v", client.conditions, want)
+	}
+}
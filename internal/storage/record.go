@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// putRecord writes a record struct under key. The client encodes it, so
+// records keep whatever representation the backend gives their fields.
+func (s *NoSQLStorage) putRecord(ctx context.Context, key string, v interface{}) error {
+	return s.client.Put(ctx, s.tableName, key, v)
+}
+
+// mapToStruct converts a field map read from the client into a record struct
+func (s *NoSQLStorage) mapToStruct(m map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// encodingClient stores puts as a document backend would: encoded, then
+// decoded into a field map
+type encodingClient struct {
+	*fakeTxClient
+}
+
+func (c encodingClient) Put(ctx context.Context, table string, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var item map[string]interface{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = item
+	return nil
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	usedAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		credential *Credential
+	}{
+		{
+			name: "binary public key",
+			credential: &Credential{
+				ID:           "cred-1",
+				UserID:       "user-1",
+				PublicKey:    []byte{0x00, 0xa5, 0x01, 0x02, 0xff, 0x7f, 0x80, 0x00},
+				RPID:         "example.com",
+				Transports:   []string{"usb", "nfc"},
+				LastUsedAt:   usedAt,
+				CreatedAt:    usedAt.Add(-time.Hour),
+				DeviceSerial: "04a1b2",
+			},
+		},
+		{
+			name:       "empty public key",
+			credential: &Credential{ID: "cred-2", UserID: "user-1", PublicKey: []byte{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := encodingClient{fakeTxClient: newFakeTxClient()}
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			ctx := context.Background()
+
+			if err := s.putRecord(ctx, tt.credential.ID, tt.credential); err != nil {
+				t.Fatalf("putRecord: %v", err)
+			}
+			item, err := client.Get(ctx, "polyid", tt.credential.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+
+			got := &Credential{}
+			if err := s.mapToStruct(item, got); err != nil {
+				t.Fatalf("mapToStruct: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.credential) {
+				t.Errorf("round trip = %+v, want %+v", got, tt.credential)
+			}
+		})
+	}
+}
@@ -3,25 +3,114 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 // RedisCache implements caching using Redis
 type RedisCache struct {
 	client *redis.Client
 	logger *zap.Logger
+	keys   keyBuilder
+	loads  singleflight.Group
+	ttls   CacheTTLs
+
+	// down is set by the health prober while Redis is unreachable
+	down  atomic.Bool
+	probe RedisProbeConfig
+
+	// sessionMaxLifetime enables sliding session expiration when non-zero
+	sessionMaxLifetime time.Duration
+}
+
+// RedisPoolConfig configures the Redis connection pool. Zero values keep
+// the go-redis defaults.
+type RedisPoolConfig struct {
+	PoolSize     int
+	MinIdleConns int
+	PoolTimeout  time.Duration
 }
 
 // NewRedisCache creates a new Redis cache instance
-func NewRedisCache(client *redis.Client, logger *zap.Logger) *RedisCache {
-	return &RedisCache{
-		client: client,
+func NewRedisCache(cfg RedisConfig, logger *zap.Logger) (*RedisCache, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Redis config: %w", err)
+	}
+
+	opts := *cfg.Options
+	if cfg.Pool.PoolSize > 0 {
+		opts.PoolSize = cfg.Pool.PoolSize
+	}
+	if cfg.Pool.MinIdleConns > 0 {
+		opts.MinIdleConns = cfg.Pool.MinIdleConns
+	}
+	if cfg.Pool.PoolTimeout > 0 {
+		opts.PoolTimeout = cfg.Pool.PoolTimeout
+	}
+
+	if cfg.Retry.MaxRetries != 0 {
+		opts.MaxRetries = cfg.Retry.MaxRetries
+	}
+	if cfg.Retry.MinBackoff > 0 {
+		opts.MinRetryBackoff = cfg.Retry.MinBackoff
+	}
+	if cfg.Retry.MaxBackoff > 0 {
+		opts.MaxRetryBackoff = cfg.Retry.MaxBackoff
+	}
+
+	probe := cfg.Probe
+	if probe.Interval == 0 {
+		probe.Interval = DefaultProbeInterval
+	}
+	if probe.MaxBackoff == 0 {
+		probe.MaxBackoff = DefaultMaxProbeBackoff
+	}
+
+	c := &RedisCache{
+		client: redis.NewClient(&opts),
 		logger: logger,
+		keys:   newKeyBuilder(cfg.Namespace),
+		ttls:   cfg.TTLs.withDefaults(),
+		probe:  probe,
 	}
+	c.client.AddHook(failFastHook{cache: c})
+
+	return c, nil
+}
+
+// wrapError converts a Redis client error into a StorageError. Pool
+// exhaustion and timeouts map to ErrUnavailable so callers can back off
+// instead of treating them as internal failures.
+func (c *RedisCache) wrapError(message string, err error) error {
+	code := ErrInternal
+	if isUnavailable(err) {
+		code = ErrUnavailable
+	}
+	return &StorageError{
+		Code:    code,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func isUnavailable(err error) bool {
+	if errors.Is(err, errCacheDown) ||
+		errors.Is(err, redis.ErrPoolTimeout) ||
+		errors.Is(err, redis.ErrPoolExhausted) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 // Get retrieves a value from the cache
@@ -34,11 +123,7 @@ func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
 		}
 	}
 	if err != nil {
-		return "", &StorageError{
-			Code:    ErrInternal,
-			Message: "Failed to get from cache",
-			Err:     err,
-		}
+		return "", c.wrapError("Failed to get from cache", err)
 	}
 	return val, nil
 }
@@ -47,11 +132,7 @@ func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
 func (c *RedisCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
 	err := c.client.Set(ctx, key, value, expiration).Err()
 	if err != nil {
-		return &StorageError{
-			Code:    ErrInternal,
-			Message: "Failed to set cache value",
-			Err:     err,
-		}
+		return c.wrapError("Failed to set cache value", err)
 	}
 	return nil
 }
@@ -60,18 +141,14 @@ func (c *RedisCache) Set(ctx context.Context, key string, value string, expirati
 func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	err := c.client.Del(ctx, key).Err()
 	if err != nil {
-		return &StorageError{
-			Code:    ErrInternal,
-			Message: "Failed to delete cache value",
-			Err:     err,
-		}
+		return c.wrapError("Failed to delete cache value", err)
 	}
 	return nil
 }
 
 // GetUser retrieves a user from the cache
 func (c *RedisCache) GetUser(ctx context.Context, userID string) (*User, error) {
-	key := fmt.Sprintf("user:%s", userID)
+	key := c.keys.userKey(userID)
 	data, err := c.Get(ctx, key)
 	if err != nil {
 		return nil, err
@@ -89,9 +166,10 @@ func (c *RedisCache) GetUser(ctx context.Context, userID string) (*User, error)
 	return &user, nil
 }
 
-// SetUser stores a user in the cache
+// SetUser stores a user in the cache. A zero expiration uses the configured
+// user TTL.
 func (c *RedisCache) SetUser(ctx context.Context, user *User, expiration time.Duration) error {
-	key := fmt.Sprintf("user:%s", user.ID)
+	key := c.keys.userKey(user.ID)
 	data, err := json.Marshal(user)
 	if err != nil {
 		return &StorageError{
@@ -101,12 +179,12 @@ func (c *RedisCache) SetUser(ctx context.Context, user *User, expiration time.Du
 		}
 	}
 
-	return c.Set(ctx, key, string(data), expiration)
+	return c.Set(ctx, key, string(data), ttlOrDefault(expiration, c.ttls.User))
 }
 
 // GetCredentials retrieves credentials from the cache
 func (c *RedisCache) GetCredentials(ctx context.Context, userID string) ([]*Credential, error) {
-	key := fmt.Sprintf("credentials:%s", userID)
+	key := c.keys.credentialsKey(userID)
 	data, err := c.Get(ctx, key)
 	if err != nil {
 		return nil, err
@@ -124,9 +202,10 @@ func (c *RedisCache) GetCredentials(ctx context.Context, userID string) ([]*Cred
 	return credentials, nil
 }
 
-// SetCredentials stores credentials in the cache
+// SetCredentials stores credentials in the cache. A zero expiration uses the
+// configured credentials TTL.
 func (c *RedisCache) SetCredentials(ctx context.Context, userID string, credentials []*Credential, expiration time.Duration) error {
-	key := fmt.Sprintf("credentials:%s", userID)
+	key := c.keys.credentialsKey(userID)
 	data, err := json.Marshal(credentials)
 	if err != nil {
 		return &StorageError{
@@ -136,12 +215,12 @@ func (c *RedisCache) SetCredentials(ctx context.Context, userID string, credenti
 		}
 	}
 
-	return c.Set(ctx, key, string(data), expiration)
+	return c.Set(ctx, key, string(data), ttlOrDefault(expiration, c.ttls.Credentials))
 }
 
 // GetMFAMethods retrieves MFA methods from the cache
 func (c *RedisCache) GetMFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error) {
-	key := fmt.Sprintf("mfa:%s", userID)
+	key := c.keys.mfaKey(userID)
 	data, err := c.Get(ctx, key)
 	if err != nil {
 		return nil, err
@@ -159,9 +238,147 @@ func (c *RedisCache) GetMFAMethods(ctx context.Context, userID string) ([]*MFAMe
 	return methods, nil
 }
 
-// SetMFAMethods stores MFA methods in the cache
+// mfaGenerationTTL bounds how long a user's MFA generation is kept after it
+// was last bumped. It only has to outlive any load in flight at the time.
+const mfaGenerationTTL = time.Hour
+
+// LoadMFAMethods returns a user's MFA methods from the cache, calling load on
+// a miss and caching its result. Concurrent misses for the same user share a
+// single load, which runs without the caller's cancellation so one caller
+// giving up doesn't fail the rest. Load errors are returned without caching
+// anything, and a result loaded before the user's methods were invalidated
+// isn't cached, so it can't overwrite the invalidation with a stale list.
+func (c *RedisCache) LoadMFAMethods(ctx context.Context, userID string, expiration time.Duration, load func(ctx context.Context) ([]*MFAMethod, error)) ([]*MFAMethod, error) {
+	methods, err := c.GetMFAMethods(ctx, userID)
+	if err == nil {
+		return methods, nil
+	}
+
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrNotFound {
+		// The cache is unhealthy; serve from the source without caching
+		c.logger.Warn("Failed to read MFA methods from cache", zap.Error(err))
+		return load(ctx)
+	}
+
+	v, err, _ := c.loads.Do(c.keys.mfaKey(userID), func() (interface{}, error) {
+		loadCtx := context.WithoutCancel(ctx)
+
+		gen, err := c.mfaGeneration(loadCtx, userID)
+		if err != nil {
+			// Without a generation a stale list can't be detected; serve
+			// the load without caching it
+			c.logger.Warn("Failed to read MFA methods generation", zap.Error(err))
+			return load(loadCtx)
+		}
+
+		methods, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.setMFAMethodsIfCurrent(loadCtx, userID, gen, methods, expiration); err != nil {
+			// The loaded value is still good; the next miss reloads it
+			c.logger.Warn("Failed to cache MFA methods", zap.Error(err))
+		}
+		return methods, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Waiters share the loaded slice; give each its own methods to mutate
+	return copyMFAMethods(v.([]*MFAMethod)), nil
+}
+
+// mfaGeneration returns the number of times the user's cached MFA methods
+// have been invalidated, or 0 if they haven't been recently
+func (c *RedisCache) mfaGeneration(ctx context.Context, userID string) (int64, error) {
+	gen, err := c.client.Get(ctx, c.keys.mfaGenerationKey(userID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, c.wrapError("Failed to get MFA methods generation", err)
+	}
+	return gen, nil
+}
+
+// setMFAMethodsIfCurrent caches methods loaded at generation gen, unless the
+// user's methods have been invalidated since
+func (c *RedisCache) setMFAMethodsIfCurrent(ctx context.Context, userID string, gen int64, methods []*MFAMethod, expiration time.Duration) error {
+	data, err := json.Marshal(methods)
+	if err != nil {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to marshal MFA methods for cache",
+			Err:     err,
+		}
+	}
+
+	genKey := c.keys.mfaGenerationKey(userID)
+	err = c.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, genKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current != gen {
+			return errStaleMFALoad
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			c.setMFAMethods(ctx, pipe, userID, methods, data, ttlOrDefault(expiration, c.ttls.MFAMethods))
+			return nil
+		})
+		return err
+	}, genKey)
+	if errors.Is(err, errStaleMFALoad) || errors.Is(err, redis.TxFailedErr) {
+		// Invalidated while loading; the next miss loads the new methods
+		return nil
+	}
+	if err != nil {
+		return c.wrapError("Failed to set cache value", err)
+	}
+	return nil
+}
+
+// errStaleMFALoad aborts caching MFA methods that were invalidated while
+// they were being loaded
+var errStaleMFALoad = errors.New("MFA methods invalidated during load")
+
+// InvalidateMFAMethods drops a user's cached MFA methods and bumps their
+// generation, so a load already in flight doesn't cache the old list
+func (c *RedisCache) InvalidateMFAMethods(ctx context.Context, userID string) error {
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		c.invalidateMFAMethods(ctx, pipe, userID)
+		return nil
+	})
+	if err != nil {
+		return c.wrapError("Failed to invalidate MFA methods", err)
+	}
+	return nil
+}
+
+// invalidateMFAMethods queues the commands of InvalidateMFAMethods
+func (c *RedisCache) invalidateMFAMethods(ctx context.Context, pipe redis.Pipeliner, userID string) {
+	genKey := c.keys.mfaGenerationKey(userID)
+	pipe.Incr(ctx, genKey)
+	pipe.Expire(ctx, genKey, mfaGenerationTTL)
+	pipe.Del(ctx, c.keys.mfaKey(userID))
+}
+
+// copyMFAMethods returns a deep copy of methods
+func copyMFAMethods(methods []*MFAMethod) []*MFAMethod {
+	copied := make([]*MFAMethod, len(methods))
+	for i, method := range methods {
+		m := *method
+		copied[i] = &m
+	}
+	return copied
+}
+
+// SetMFAMethods stores MFA methods in the cache. A zero expiration uses the
+// configured MFA methods TTL.
 func (c *RedisCache) SetMFAMethods(ctx context.Context, userID string, methods []*MFAMethod, expiration time.Duration) error {
-	key := fmt.Sprintf("mfa:%s", userID)
 	data, err := json.Marshal(methods)
 	if err != nil {
 		return &StorageError{
@@ -171,34 +388,160 @@ func (c *RedisCache) SetMFAMethods(ctx context.Context, userID string, methods [
 		}
 	}
 
-	return c.Set(ctx, key, string(data), expiration)
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		c.setMFAMethods(ctx, pipe, userID, methods, data, ttlOrDefault(expiration, c.ttls.MFAMethods))
+		return nil
+	})
+	if err != nil {
+		return c.wrapError("Failed to set cache value", err)
+	}
+	return nil
+}
+
+// setMFAMethods queues a user's encoded MFA methods along with an owner
+// entry per method, so a method deleted by ID can be traced to the cached
+// list holding it. Both expire together.
+func (c *RedisCache) setMFAMethods(ctx context.Context, pipe redis.Pipeliner, userID string, methods []*MFAMethod, data []byte, ttl time.Duration) {
+	pipe.Set(ctx, c.keys.mfaKey(userID), data, ttl)
+	for _, method := range methods {
+		pipe.Set(ctx, c.keys.mfaOwnerKey(method.ID), userID, ttl)
+	}
+}
+
+// MFAMethodOwner returns the user whose cached MFA methods include the
+// method, or an ErrNotFound StorageError if no cached list does
+func (c *RedisCache) MFAMethodOwner(ctx context.Context, methodID string) (string, error) {
+	return c.Get(ctx, c.keys.mfaOwnerKey(methodID))
+}
+
+// ttlOrDefault returns expiration, or def if expiration is zero
+func ttlOrDefault(expiration time.Duration, def time.Duration) time.Duration {
+	if expiration == 0 {
+		return def
+	}
+	return expiration
+}
+
+// SetSlidingSessions enables sliding session expiration. Each GetSession
+// extends the session by its original expiry, but never beyond maxLifetime
+// from creation. Zero disables sliding.
+func (c *RedisCache) SetSlidingSessions(maxLifetime time.Duration) {
+	c.sessionMaxLifetime = maxLifetime
+}
+
+// StoreSession stores a session that expires after expiry
+func (c *RedisCache) StoreSession(ctx context.Context, sessionID string, userID string, expiry time.Duration) error {
+	now := time.Now()
+	absolute := sessionAbsoluteExpiry(now, expiry, c.sessionMaxLifetime)
+	key := c.keys.sessionKey(sessionID)
+
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"user_id", userID,
+			"absolute_ms", absolute.UnixMilli(),
+			"ttl_ms", expiry.Milliseconds())
+		pipe.PExpire(ctx, key, expiry)
+		trackSessionScript.Eval(ctx, pipe, []string{c.keys.userSessionsKey(userID)},
+			sessionID, absolute.Sub(now).Milliseconds())
+		return nil
+	})
+	if err != nil {
+		return c.wrapError("Failed to store session", err)
+	}
+	return nil
+}
+
+// trackSessionScript adds a session to its user's session set, extending the
+// set's TTL to cover the session's absolute expiry but never shortening it
+var trackSessionScript = redis.NewScript(`
+redis.call('SADD', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// RevokeUserSessions deletes every session stored for a user. Members of the
+// user's session set that have already expired are simply skipped.
+func (c *RedisCache) RevokeUserSessions(ctx context.Context, userID string) error {
+	setKey := c.keys.userSessionsKey(userID)
+	sessionIDs, err := c.client.SMembers(ctx, setKey).Result()
+	if err != nil {
+		return c.wrapError("Failed to get user sessions", err)
+	}
+
+	keys := make([]string, 0, len(sessionIDs)+1)
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, c.keys.sessionKey(sessionID))
+	}
+	keys = append(keys, setKey)
+
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		return c.wrapError("Failed to revoke user sessions", err)
+	}
+	return nil
+}
+
+// getSessionScript returns the session's user ID and extends its TTL by the
+// original expiry, capped at the absolute expiry. Sessions without sliding
+// expiration have an absolute expiry equal to their original TTL, so they are
+// never extended.
+var getSessionScript = redis.NewScript(`
+local data = redis.call('HMGET', KEYS[1], 'user_id', 'absolute_ms', 'ttl_ms')
+if not data[1] then
+	return false
+end
+local remaining = tonumber(data[2]) - tonumber(ARGV[1])
+if remaining <= 0 then
+	redis.call('DEL', KEYS[1])
+	return false
+end
+redis.call('PEXPIRE', KEYS[1], math.min(tonumber(data[3]), remaining))
+return data[1]
+`)
+
+// GetSession returns the user ID for a session, extending it if sliding
+// expiration is enabled
+func (c *RedisCache) GetSession(ctx context.Context, sessionID string) (string, error) {
+	userID, err := getSessionScript.Run(ctx, c.client,
+		[]string{c.keys.sessionKey(sessionID)}, time.Now().UnixMilli()).Text()
+	if err == redis.Nil {
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Session not found",
+		}
+	}
+	if err != nil {
+		return "", c.wrapError("Failed to get session", err)
+	}
+	return userID, nil
+}
+
+// DeleteSession removes a session
+func (c *RedisCache) DeleteSession(ctx context.Context, sessionID string) error {
+	return c.Delete(ctx, c.keys.sessionKey(sessionID))
 }
 
 // InvalidateUser invalidates all user-related cache entries
 func (c *RedisCache) InvalidateUser(ctx context.Context, userID string) error {
+	if err := c.InvalidateMFAMethods(ctx, userID); err != nil {
+		return err
+	}
+
 	patterns := []string{
-		fmt.Sprintf("user:%s", userID),
-		fmt.Sprintf("credentials:%s", userID),
-		fmt.Sprintf("mfa:%s", userID),
+		c.keys.userKey(userID),
+		c.keys.credentialsKey(userID),
 	}
 
 	for _, pattern := range patterns {
 		keys, err := c.client.Keys(ctx, pattern).Result()
 		if err != nil {
-			return &StorageError{
-				Code:    ErrInternal,
-				Message: "Failed to get cache keys",
-				Err:     err,
-			}
+			return c.wrapError("Failed to get cache keys", err)
 		}
 
 		if len(keys) > 0 {
 			if err := c.client.Del(ctx, keys...).Err(); err != nil {
-				return &StorageError{
-					Code:    ErrInternal,
-					Message: "Failed to delete cache keys",
-					Err:     err,
-				}
+				return c.wrapError("Failed to delete cache keys", err)
 			}
 		}
 	}
@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// timeoutError is a net.Error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRedisWrapError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode string
+	}{
+		{name: "pool timeout", err: redis.ErrPoolTimeout, wantCode: ErrUnavailable},
+		{name: "pool exhausted", err: redis.ErrPoolExhausted, wantCode: ErrUnavailable},
+		{name: "wrapped pool timeout", err: fmt.Errorf("get: %w", redis.ErrPoolTimeout), wantCode: ErrUnavailable},
+		{name: "client closed", err: redis.ErrClosed, wantCode: ErrUnavailable},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, wantCode: ErrUnavailable},
+		{name: "network timeout", err: timeoutError{}, wantCode: ErrUnavailable},
+		{name: "other failure", err: errors.New("WRONGTYPE"), wantCode: ErrInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&RedisCache{}).wrapError("Failed to get from cache", tt.err)
+
+			var storageErr *StorageError
+			if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+				t.Fatalf("wrapError() = %v, want code %s", err, tt.wantCode)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("wrapError() = %v, want it to wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRedisPoolExhaustion(t *testing.T) {
+	server := miniredis.RunT(t)
+	cache, err := NewRedisCache(RedisConfig{
+		Options: &redis.Options{Addr: server.Addr()},
+		Pool:    RedisPoolConfig{PoolSize: 1, PoolTimeout: 50 * time.Millisecond},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	defer cache.client.Close()
+
+	// Hold the only connection in a blocking pop
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		cache.client.BLPop(context.Background(), time.Second, "never-pushed")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = cache.Get(context.Background(), "user:user-1")
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrUnavailable {
+		t.Errorf("Get() with the pool exhausted = %v, want code %s", err, ErrUnavailable)
+	}
+	<-held
+}
+
+func TestLoadMFAMethods(t *testing.T) {
+	loaded := []*MFAMethod{{ID: "mfa-1", UserID: "user-1", Type: "totp"}}
+
+	tests := []struct {
+		name string
+		// during runs inside the load, before it returns
+		during     func(ctx context.Context, c *RedisCache) error
+		cancel     bool
+		wantCached bool
+	}{
+		{name: "caches the loaded methods", wantCached: true},
+		{
+			name: "invalidated during load",
+			during: func(ctx context.Context, c *RedisCache) error {
+				return c.InvalidateMFAMethods(ctx, "user-1")
+			},
+		},
+		{
+			name: "user invalidated during load",
+			during: func(ctx context.Context, c *RedisCache) error {
+				return c.InvalidateUsers(ctx, []string{"user-1"})
+			},
+		},
+		{
+			name: "other user invalidated during load",
+			during: func(ctx context.Context, c *RedisCache) error {
+				return c.InvalidateMFAMethods(ctx, "user-2")
+			},
+			wantCached: true,
+		},
+		{name: "caller cancelled during load", cancel: true, wantCached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newTestRedisCache(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			methods, err := cache.LoadMFAMethods(ctx, "user-1", 0, func(loadCtx context.Context) ([]*MFAMethod, error) {
+				if tt.during != nil {
+					if err := tt.during(context.Background(), cache); err != nil {
+						t.Fatalf("during load: %v", err)
+					}
+				}
+				if tt.cancel {
+					cancel()
+				}
+				if err := loadCtx.Err(); err != nil {
+					return nil, err
+				}
+				return loaded, nil
+			})
+			if err != nil {
+				t.Fatalf("LoadMFAMethods: %v", err)
+			}
+			if len(methods) != 1 || methods[0].ID != "mfa-1" {
+				t.Errorf("LoadMFAMethods() = %+v", methods)
+			}
+
+			_, err = cache.GetMFAMethods(context.Background(), "user-1")
+			if cached := err == nil; cached != tt.wantCached {
+				t.Errorf("methods cached = %v (%v), want %v", cached, err, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestLoadMFAMethodsCoalesced(t *testing.T) {
+	cache := newTestRedisCache(t)
+	const callers = 20
+
+	var loads int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	load := func(ctx context.Context) ([]*MFAMethod, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return []*MFAMethod{{ID: "mfa-1", UserID: "user-1", Type: "totp"}}, nil
+	}
+
+	results := make([][]*MFAMethod, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			methods, err := cache.LoadMFAMethods(context.Background(), "user-1", 0, load)
+			if err != nil {
+				t.Errorf("LoadMFAMethods: %v", err)
+				return
+			}
+			results[i] = methods
+		}(i)
+	}
+
+	// Hold the load open long enough for every caller to miss the cache
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("loader ran %d times, want 1", n)
+	}
+	for i, methods := range results {
+		if len(methods) != 1 || methods[0].ID != "mfa-1" {
+			t.Fatalf("caller %d got %+v", i, methods)
+		}
+	}
+
+	// Each caller gets its own copy
+	results[0][0].Type = "changed"
+	if results[1][0].Type != "totp" {
+		t.Error("mutating one caller's methods changed another's")
+	}
+}
+
+func TestRedisGetSessionSliding(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxLifetime time.Duration
+		remaining   time.Duration // until the absolute expiry, if set
+		wantTTL     time.Duration
+	}{
+		{name: "sliding disabled", wantTTL: time.Minute},
+		{name: "extends by the original expiry", maxLifetime: 24 * time.Hour, wantTTL: time.Minute},
+		{name: "capped at the absolute expiry", maxLifetime: 24 * time.Hour, remaining: 20 * time.Second, wantTTL: 20 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newTestRedisCache(t)
+			cache.SetSlidingSessions(tt.maxLifetime)
+			ctx := context.Background()
+			key := cache.keys.sessionKey("sess-1")
+
+			if err := cache.StoreSession(ctx, "sess-1", "user-1", time.Minute); err != nil {
+				t.Fatalf("StoreSession: %v", err)
+			}
+			if tt.remaining > 0 {
+				absolute := time.Now().Add(tt.remaining).UnixMilli()
+				if err := cache.client.HSet(ctx, key, "absolute_ms", absolute).Err(); err != nil {
+					t.Fatalf("HSet: %v", err)
+				}
+			}
+			// Let the session age so an extension is observable
+			if err := cache.client.PExpire(ctx, key, time.Second).Err(); err != nil {
+				t.Fatalf("PExpire: %v", err)
+			}
+
+			userID, err := cache.GetSession(ctx, "sess-1")
+			if err != nil {
+				t.Fatalf("GetSession: %v", err)
+			}
+			if userID != "user-1" {
+				t.Errorf("GetSession() = %q, want user-1", userID)
+			}
+
+			ttl, err := cache.client.PTTL(ctx, key).Result()
+			if err != nil {
+				t.Fatalf("PTTL: %v", err)
+			}
+			if ttl > tt.wantTTL || ttl < tt.wantTTL-5*time.Second {
+				t.Errorf("TTL after GetSession = %v, want about %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestRedisGetSessionPastAbsoluteExpiry(t *testing.T) {
+	cache := newTestRedisCache(t)
+	cache.SetSlidingSessions(24 * time.Hour)
+	ctx := context.Background()
+	key := cache.keys.sessionKey("sess-1")
+
+	if err := cache.StoreSession(ctx, "sess-1", "user-1", time.Minute); err != nil {
+		t.Fatalf("StoreSession: %v", err)
+	}
+	if err := cache.client.HSet(ctx, key, "absolute_ms", time.Now().Add(-time.Second).UnixMilli()).Err(); err != nil {
+		t.Fatalf("HSet: %v", err)
+	}
+
+	_, err := cache.GetSession(ctx, "sess-1")
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != ErrNotFound {
+		t.Fatalf("GetSession() error = %v, want code %s", err, ErrNotFound)
+	}
+	if n, _ := cache.client.Exists(ctx, key).Result(); n != 0 {
+		t.Error("session past its absolute expiry was not deleted")
+	}
+}
+
+func TestRedisCacheTTLs(t *testing.T) {
+	tests := []struct {
+		name            string
+		ttls            CacheTTLs
+		expiration      time.Duration
+		wantUser        time.Duration
+		wantCredentials time.Duration
+		wantMFAMethods  time.Duration
+	}{
+		{
+			name:            "package defaults",
+			wantUser:        DefaultUserTTL,
+			wantCredentials: DefaultCredentialsTTL,
+			wantMFAMethods:  DefaultMFAMethodsTTL,
+		},
+		{
+			name:            "configured defaults",
+			ttls:            CacheTTLs{User: time.Hour, MFAMethods: time.Minute},
+			wantUser:        time.Hour,
+			wantCredentials: DefaultCredentialsTTL,
+			wantMFAMethods:  time.Minute,
+		},
+		{
+			name:            "explicit expiration overrides defaults",
+			ttls:            CacheTTLs{User: time.Hour},
+			expiration:      30 * time.Second,
+			wantUser:        30 * time.Second,
+			wantCredentials: 30 * time.Second,
+			wantMFAMethods:  30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			cache, err := NewRedisCache(RedisConfig{Options: &redis.Options{Addr: server.Addr()}, TTLs: tt.ttls}, zap.NewNop())
+			if err != nil {
+				t.Fatalf("NewRedisCache: %v", err)
+			}
+			t.Cleanup(func() { cache.client.Close() })
+			ctx := context.Background()
+
+			if err := cache.SetUser(ctx, &User{ID: "user-1"}, tt.expiration); err != nil {
+				t.Fatalf("SetUser: %v", err)
+			}
+			if err := cache.SetCredentials(ctx, "user-1", nil, tt.expiration); err != nil {
+				t.Fatalf("SetCredentials: %v", err)
+			}
+			if err := cache.SetMFAMethods(ctx, "user-1", nil, tt.expiration); err != nil {
+				t.Fatalf("SetMFAMethods: %v", err)
+			}
+
+			if got := server.TTL(cache.keys.userKey("user-1")); got != tt.wantUser {
+				t.Errorf("user TTL = %v, want %v", got, tt.wantUser)
+			}
+			if got := server.TTL(cache.keys.credentialsKey("user-1")); got != tt.wantCredentials {
+				t.Errorf("credentials TTL = %v, want %v", got, tt.wantCredentials)
+			}
+			if got := server.TTL(cache.keys.mfaKey("user-1")); got != tt.wantMFAMethods {
+				t.Errorf("MFA methods TTL = %v, want %v", got, tt.wantMFAMethods)
+			}
+		})
+	}
+}
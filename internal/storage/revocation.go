@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Revoked tokens are kept in a sorted set keyed by JTI and scored by the
+// token's expiry, so entries for tokens that have expired anyway can be
+// dropped cheaply.
+
+// RevokeToken adds a token to the revocation list until its expiry
+func (c *RedisCache) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	err := c.client.ZAdd(ctx, c.keys.revocationKey(), redis.Z{
+		Score:  float64(expiresAt.Unix()),
+		Member: jti,
+	}).Err()
+	if err != nil {
+		return c.wrapError("Failed to revoke token", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether a token is on the revocation list
+func (c *RedisCache) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	err := c.client.ZScore(ctx, c.keys.revocationKey(), jti).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, c.wrapError("Failed to check token revocation", err)
+	}
+	return true, nil
+}
+
+// CompactRevocations removes entries for tokens that have already expired
+// and returns how many were removed
+func (c *RedisCache) CompactRevocations(ctx context.Context) (int64, error) {
+	max := strconv.FormatInt(time.Now().Unix(), 10)
+	removed, err := c.client.ZRemRangeByScore(ctx, c.keys.revocationKey(), "-inf", max).Result()
+	if err != nil {
+		return 0, c.wrapError("Failed to compact revocation list", err)
+	}
+	return removed, nil
+}
+
+// RunRevocationCompactor compacts the revocation list every interval until
+// the context is cancelled
+func (c *RedisCache) RunRevocationCompactor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removed, err := c.CompactRevocations(ctx)
+			if err != nil {
+				c.logger.Error("Failed to compact revocation list", zap.Error(err))
+				continue
+			}
+			if removed > 0 {
+				c.logger.Debug("Compacted revocation list", zap.Int64("removed", removed))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
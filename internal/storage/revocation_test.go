@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCompactRevocations(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	revoked := map[string]time.Time{
+		"expired-1": now.Add(-time.Hour),
+		"expired-2": now.Add(-time.Minute),
+		"live-1":    now.Add(time.Minute),
+		"live-2":    now.Add(time.Hour),
+	}
+	for jti, expiresAt := range revoked {
+		if err := cache.RevokeToken(ctx, jti, expiresAt); err != nil {
+			t.Fatalf("RevokeToken(%s): %v", jti, err)
+		}
+	}
+
+	removed, err := cache.CompactRevocations(ctx)
+	if err != nil {
+		t.Fatalf("CompactRevocations: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("CompactRevocations() removed %d, want 2", removed)
+	}
+
+	for jti, want := range map[string]bool{"expired-1": false, "expired-2": false, "live-1": true, "live-2": true} {
+		got, err := cache.IsTokenRevoked(ctx, jti)
+		if err != nil {
+			t.Fatalf("IsTokenRevoked(%s): %v", jti, err)
+		}
+		if got != want {
+			t.Errorf("IsTokenRevoked(%s) = %v, want %v", jti, got, want)
+		}
+	}
+
+	// Nothing left to remove
+	if removed, err := cache.CompactRevocations(ctx); err != nil || removed != 0 {
+		t.Errorf("second CompactRevocations() = %d, %v, want 0", removed, err)
+	}
+}
+
+func TestRunRevocationCompactor(t *testing.T) {
+	cache := newTestRedisCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if err := cache.RevokeToken(ctx, "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if err := cache.RevokeToken(ctx, "live", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cache.RunRevocationCompactor(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		revoked, err := cache.IsTokenRevoked(context.Background(), "expired")
+		if err != nil {
+			t.Fatalf("IsTokenRevoked: %v", err)
+		}
+		if !revoked {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("compactor did not remove the expired entry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if revoked, err := cache.IsTokenRevoked(context.Background(), "live"); err != nil || !revoked {
+		t.Errorf("IsTokenRevoked(live) = %v, %v, want true", revoked, err)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("compactor did not stop when its context was cancelled")
+	}
+}
@@ -7,39 +7,83 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          string    `json:"id"`
+	Email       string    `json:"email"`
+	LastLoginAt time.Time `json:"last_login_at,omitempty"`
+	DeletedAt   time.Time `json:"deleted_at,omitempty"`  // set when the user is retired
+	MergedInto  string    `json:"merged_into,omitempty"` // surviving user ID after a merge
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // Credential represents a WebAuthn credential
 type Credential struct {
-	ID              string    `json:"id"`
-	UserID          string    `json:"user_id"`
-	PublicKey       []byte    `json:"public_key"`
-	AttestationType string    `json:"attestation_type"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID                 string    `json:"id"`
+	UserID             string    `json:"user_id"`
+	PublicKey          []byte    `json:"public_key"`
+	AttestationType    string    `json:"attestation_type"`
+	RPID               string    `json:"rp_id,omitempty"`
+	Attachment         string    `json:"attachment,omitempty"` // "platform" or "cross-platform"
+	Transports         []string  `json:"transports,omitempty"`
+	Discoverable       *bool     `json:"discoverable,omitempty"` // credProps "rk"; nil if not reported
+	LargeBlobSupported bool      `json:"large_blob_supported,omitempty"`
+	LastUsedAt         time.Time `json:"last_used_at,omitempty"`
+	DeviceSerial       string    `json:"device_serial,omitempty"` // from enterprise attestation only
+	CreatedAt          time.Time `json:"created_at"`
 }
 
 // MFAMethod represents a user's MFA method
 type MFAMethod struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Type      string    `json:"type"` // "totp", "sms", "app_link"
-	Value     string    `json:"value"` // secret, phone number, or device ID
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Type         string    `json:"type"`                     // "totp", "sms", "app_link"
+	Value        string    `json:"value"`                    // secret, phone number, or device ID
+	KeyID        string    `json:"key_id,omitempty"`         // encryption key for Value, if encrypted
+	DriftSteps   int       `json:"drift_steps,omitempty"`    // learned TOTP clock drift, in time steps
+	LastUsedStep int64     `json:"last_used_step,omitempty"` // last accepted TOTP time step, for replay protection
+	Algorithm    string    `json:"algorithm,omitempty"`      // TOTP HMAC algorithm; empty means SHA1
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TempValueInfo describes a stored temporary value without its contents
+type TempValueInfo struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TempValueLister is implemented by stores that can enumerate their
+// temporary values, for admin inspection of in-progress verification flows
+type TempValueLister interface {
+	// ListTemporaryValues returns the unexpired temporary values whose keys
+	// start with prefix
+	ListTemporaryValues(ctx context.Context, prefix string) ([]TempValueInfo, error)
 }
 
 // Storage defines the interface for data persistence
 type Storage interface {
 	// User operations
 	CreateUser(ctx context.Context, user *User) error
+	// ValidateUser runs every check CreateUser performs without writing,
+	// returning the same errors a real create would
+	ValidateUser(ctx context.Context, user *User) error
 	GetUser(ctx context.Context, id string) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	UpdateUser(ctx context.Context, user *User) error
+	// PatchUser applies only the given fields, keyed by their JSON names,
+	// and returns the updated user. Unknown or read-only fields are
+	// rejected with ErrInvalidInput.
+	PatchUser(ctx context.Context, id string, fields map[string]interface{}) (*User, error)
 	DeleteUser(ctx context.Context, id string) error
+	// DeleteUserCascade deletes the user along with their credentials, MFA
+	// methods, and sessions
+	DeleteUserCascade(ctx context.Context, userID string) error
+	// ListUsers pages through all users. Pass "" as the cursor for the
+	// first page; an empty next cursor means there are no more pages.
+	ListUsers(ctx context.Context, cursor string, limit int) ([]*User, string, error)
+	// MergeUsers moves the secondary user's credentials and MFA methods to
+	// the primary and retires the secondary, revoking its sessions
+	MergeUsers(ctx context.Context, primaryID string, secondaryID string) error
 
 	// Credential operations
 	StoreCredential(ctx context.Context, credential *Credential) error
@@ -49,6 +93,13 @@ type Storage interface {
 	// MFA operations
 	StoreMFAMethod(ctx context.Context, method *MFAMethod) error
 	GetMFAMethods(ctx context.Context, userID string) ([]*MFAMethod, error)
+	// ListMFAMethods returns the page of the user's methods selected by
+	// filter, in ID order, with the cursor of the next page or "" if there
+	// are no more pages
+	ListMFAMethods(ctx context.Context, userID string, filter MFAMethodFilter) ([]*MFAMethod, string, error)
+	// GetMFAMethodsForUsers returns the MFA methods of each user, with an
+	// empty slice for users that have none
+	GetMFAMethodsForUsers(ctx context.Context, userIDs []string) (map[string][]*MFAMethod, error)
 	DeleteMFAMethod(ctx context.Context, id string) error
 
 	// Temporary storage operations (for verification flows)
@@ -60,6 +111,10 @@ type Storage interface {
 	StoreSession(ctx context.Context, sessionID string, userID string, expiry time.Duration) error
 	GetSession(ctx context.Context, sessionID string) (string, error)
 	DeleteSession(ctx context.Context, sessionID string) error
+
+	// Transaction runs fn against a transaction-scoped Storage. All writes
+	// made through tx commit together if fn returns nil, or not at all.
+	Transaction(ctx context.Context, fn func(tx Storage) error) error
 }
 
 // StorageError represents a storage-specific error
@@ -78,8 +133,12 @@ func (e *StorageError) Error() string {
 
 // Common error codes
 const (
-	ErrNotFound     = "NOT_FOUND"
+	ErrNotFound      = "NOT_FOUND"
 	ErrAlreadyExists = "ALREADY_EXISTS"
-	ErrInvalidInput = "INVALID_INPUT"
-	ErrInternal     = "INTERNAL_ERROR"
-) 
\ No newline at end of file
+	ErrInvalidInput  = "INVALID_INPUT"
+	ErrInternal      = "INTERNAL_ERROR"
+	ErrUnavailable   = "UNAVAILABLE"    // backend temporarily unable to serve; safe to retry
+	ErrLocked        = "LOCKED"         // another holder owns the lock
+	ErrDataIntegrity = "DATA_INTEGRITY" // records that must be unique conflict
+	ErrConflict      = "CONFLICT"       // a concurrent write won; safe to retry
+)
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ AtomicTempStore = (*RedisCache)(nil)
+
+// StoreTemporaryValue implements Storage.StoreTemporaryValue
+func (c *RedisCache) StoreTemporaryValue(ctx context.Context, key string, value string, expiry time.Duration) error {
+	if err := c.client.Set(ctx, c.keys.tempKey(key), value, expiry).Err(); err != nil {
+		return c.wrapError("Failed to store temporary value", err)
+	}
+	return nil
+}
+
+// GetTemporaryValue implements Storage.GetTemporaryValue
+func (c *RedisCache) GetTemporaryValue(ctx context.Context, key string) (string, error) {
+	value, err := c.client.Get(ctx, c.keys.tempKey(key)).Result()
+	if err == redis.Nil {
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Temporary value not found",
+		}
+	}
+	if err != nil {
+		return "", c.wrapError("Failed to get temporary value", err)
+	}
+	return value, nil
+}
+
+// DeleteTemporaryValue implements Storage.DeleteTemporaryValue
+func (c *RedisCache) DeleteTemporaryValue(ctx context.Context, key string) error {
+	return c.Delete(ctx, c.keys.tempKey(key))
+}
+
+// StoreTemporaryValueIfAbsent implements AtomicTempStore with SET NX
+func (c *RedisCache) StoreTemporaryValueIfAbsent(ctx context.Context, key string, value string, expiry time.Duration) (bool, error) {
+	stored, err := c.client.SetNX(ctx, c.keys.tempKey(key), value, expiry).Result()
+	if err != nil {
+		return false, c.wrapError("Failed to store temporary value", err)
+	}
+	return stored, nil
+}
+
+// TakeTemporaryValue implements AtomicTempStore with GETDEL, which needs
+// Redis 6.2 or later
+func (c *RedisCache) TakeTemporaryValue(ctx context.Context, key string) (string, error) {
+	value, err := c.client.GetDel(ctx, c.keys.tempKey(key)).Result()
+	if err == redis.Nil {
+		return "", &StorageError{
+			Code:    ErrNotFound,
+			Message: "Temporary value not found",
+		}
+	}
+	if err != nil {
+		return "", c.wrapError("Failed to take temporary value", err)
+	}
+	return value, nil
+}
+
+// swapTempScript replaces or deletes a value only if it still holds the
+// expected one. A missing key holds "".
+var swapTempScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1]) or ''
+if current ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == '' then
+	redis.call('DEL', KEYS[1])
+else
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+end
+return 1
+`)
+
+// SwapTemporaryValue implements AtomicTempStore
+func (c *RedisCache) SwapTemporaryValue(ctx context.Context, key string, old string, value string, expiry time.Duration) (bool, error) {
+	swapped, err := swapTempScript.Run(ctx, c.client, []string{c.keys.tempKey(key)},
+		old, value, expiry.Milliseconds()).Int()
+	if err != nil {
+		return false, c.wrapError("Failed to swap temporary value", err)
+	}
+	return swapped == 1, nil
+}
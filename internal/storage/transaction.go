@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// WriteOp is a single write within a transaction
+type WriteOp struct {
+	Table  string
+	Key    string
+	Value  interface{}
+	Delete bool
+}
+
+// NoSQLTxClient is implemented by NoSQL clients whose backend can apply a set
+// of writes atomically
+type NoSQLTxClient interface {
+	NoSQLClient
+	TransactWrite(ctx context.Context, ops []WriteOp) error
+}
+
+// Transaction implements Storage.Transaction. Writes made through tx are
+// buffered and committed in a single transactional write when fn returns nil;
+// if fn returns an error nothing is written. Reads through tx see the
+// transaction's own buffered writes for Get, but queries only see committed
+// data.
+func (s *NoSQLStorage) Transaction(ctx context.Context, fn func(tx Storage) error) error {
+	client, ok := s.client.(NoSQLTxClient)
+	if !ok {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Backend does not support transactions",
+		}
+	}
+
+	txc := &txClient{NoSQLClient: client}
+	// The transaction shares the storage's settings but writes through txc
+	tx := *s
+	tx.client = txc
+
+	if err := fn(&tx); err != nil {
+		return err
+	}
+
+	ops := txc.writes()
+	if len(ops) == 0 {
+		return nil
+	}
+
+	if err := client.TransactWrite(ctx, ops); err != nil {
+		return &StorageError{
+			Code:    ErrInternal,
+			Message: "Failed to commit transaction",
+			Err:     err,
+		}
+	}
+
+	return nil
+}
+
+// txClient buffers writes for a transaction and passes reads through
+type txClient struct {
+	NoSQLClient
+
+	mu  sync.Mutex
+	ops []WriteOp
+}
+
+func (c *txClient) Put(ctx context.Context, table string, key string, value interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops = append(c.ops, WriteOp{Table: table, Key: key, Value: value})
+	return nil
+}
+
+func (c *txClient) Delete(ctx context.Context, table string, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops = append(c.ops, WriteOp{Table: table, Key: key, Delete: true})
+	return nil
+}
+
+func (c *txClient) Get(ctx context.Context, table string, key string) (map[string]interface{}, error) {
+	c.mu.Lock()
+	var pending *WriteOp
+	for i := len(c.ops) - 1; i >= 0; i-- {
+		if c.ops[i].Table == table && c.ops[i].Key == key {
+			pending = &c.ops[i]
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if pending == nil {
+		return c.NoSQLClient.Get(ctx, table, key)
+	}
+	if pending.Delete {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(pending.Value)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// writes returns the buffered writes, collapsed so only the last write to
+// each key is kept
+func (c *txClient) writes() []WriteOp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type opKey struct{ table, key string }
+	last := make(map[opKey]int, len(c.ops))
+	for i, op := range c.ops {
+		last[opKey{op.Table, op.Key}] = i
+	}
+
+	ops := make([]WriteOp, 0, len(last))
+	for i, op := range c.ops {
+		if last[opKey{op.Table, op.Key}] == i {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeTxClient is an in-memory NoSQLTxClient. Each item belongs to at most
+// one index, as a sparse secondary index would hold it, and queries support
+// equality and greater-than conditions on string fields joined by AND.
+type fakeTxClient struct {
+	mu        sync.Mutex
+	items     map[string]map[string]interface{}
+	indexes   map[string]string // key to index
+	commits   int
+	commitErr error
+}
+
+func newFakeTxClient() *fakeTxClient {
+	return &fakeTxClient{
+		items:   make(map[string]map[string]interface{}),
+		indexes: make(map[string]string),
+	}
+}
+
+// seed stores an item, in index if it is not ""
+func (f *fakeTxClient) seed(index string, key string, item map[string]interface{}) {
+	f.items[key] = item
+	if index != "" {
+		f.indexes[key] = index
+	}
+}
+
+func (f *fakeTxClient) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.items))
+	for key := range f.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeTxClient) Put(ctx context.Context, table string, key string, value interface{}) error {
+	return errors.New("unexpected write outside a transaction")
+}
+
+func (f *fakeTxClient) Get(ctx context.Context, table string, key string) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.items[key], nil
+}
+
+func (f *fakeTxClient) Query(ctx context.Context, table string, index string, condition string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	var matches []func(item map[string]interface{}) bool
+	for _, part := range strings.Split(condition, " AND ") {
+		if field, placeholder, ok := strings.Cut(part, " = "); ok {
+			matches = append(matches, func(item map[string]interface{}) bool {
+				return item[field] == params[placeholder]
+			})
+			continue
+		}
+		if field, placeholder, ok := strings.Cut(part, " > "); ok {
+			matches = append(matches, func(item map[string]interface{}) bool {
+				value, _ := item[field].(string)
+				return value > params[placeholder].(string)
+			})
+			continue
+		}
+		return nil, fmt.Errorf("unsupported condition %q", condition)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var results []map[string]interface{}
+	for key, item := range f.items {
+		if f.indexes[key] != index {
+			continue
+		}
+		matched := true
+		for _, match := range matches {
+			matched = matched && match(item)
+		}
+		if matched {
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+func (f *fakeTxClient) Delete(ctx context.Context, table string, key string) error {
+	return errors.New("unexpected write outside a transaction")
+}
+
+func (f *fakeTxClient) CreateIndex(ctx context.Context, table string, index string, fields []string) error {
+	return nil
+}
+
+func (f *fakeTxClient) TransactWrite(ctx context.Context, ops []WriteOp) error {
+	if f.commitErr != nil {
+		return f.commitErr
+	}
+
+	// Encode every put before applying any, so a failed commit writes nothing
+	items := make(map[string]map[string]interface{}, len(ops))
+	for _, op := range ops {
+		if op.Delete {
+			continue
+		}
+		data, err := json.Marshal(op.Value)
+		if err != nil {
+			return err
+		}
+		var item map[string]interface{}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return err
+		}
+		items[op.Key] = item
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commits++
+	for _, op := range ops {
+		if op.Delete {
+			delete(f.items, op.Key)
+			delete(f.indexes, op.Key)
+			continue
+		}
+		f.items[op.Key] = items[op.Key]
+	}
+	return nil
+}
+
+func TestTransaction(t *testing.T) {
+	errAbort := errors.New("abort")
+
+	tests := []struct {
+		name        string
+		fn          func(ctx context.Context, tx Storage) error
+		commitErr   error
+		wantErr     error
+		wantCode    string
+		wantKeys    []string
+		wantCommits int
+	}{
+		{
+			name: "commits every write at once",
+			fn: func(ctx context.Context, tx Storage) error {
+				if err := tx.StoreTemporaryValue(ctx, "a", "1", time.Hour); err != nil {
+					return err
+				}
+				if err := tx.StoreTemporaryValue(ctx, "b", "2", time.Hour); err != nil {
+					return err
+				}
+				return tx.DeleteTemporaryValue(ctx, "old")
+			},
+			wantKeys:    []string{"temp:a", "temp:b"},
+			wantCommits: 1,
+		},
+		{
+			name: "reads see the transaction's own writes",
+			fn: func(ctx context.Context, tx Storage) error {
+				if err := tx.StoreTemporaryValue(ctx, "a", "1", time.Hour); err != nil {
+					return err
+				}
+				if value, err := tx.GetTemporaryValue(ctx, "a"); err != nil || value != "1" {
+					return fmt.Errorf("buffered value = %q, %v", value, err)
+				}
+				if err := tx.DeleteTemporaryValue(ctx, "old"); err != nil {
+					return err
+				}
+				if _, err := tx.GetTemporaryValue(ctx, "old"); !isNotFound(err) {
+					return fmt.Errorf("deleted value read: %v", err)
+				}
+				return nil
+			},
+			wantKeys:    []string{"temp:a"},
+			wantCommits: 1,
+		},
+		{
+			name: "rolls back when fn fails",
+			fn: func(ctx context.Context, tx Storage) error {
+				if err := tx.StoreTemporaryValue(ctx, "a", "1", time.Hour); err != nil {
+					return err
+				}
+				return errAbort
+			},
+			wantErr:  errAbort,
+			wantKeys: []string{"temp:old"},
+		},
+		{
+			name: "failed commit writes nothing",
+			fn: func(ctx context.Context, tx Storage) error {
+				return tx.StoreTemporaryValue(ctx, "a", "1", time.Hour)
+			},
+			commitErr: errors.New("transaction cancelled"),
+			wantCode:  ErrInternal,
+			wantKeys:  []string{"temp:old"},
+		},
+		{
+			name:     "no writes skips the commit",
+			fn:       func(ctx context.Context, tx Storage) error { return nil },
+			wantKeys: []string{"temp:old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeTxClient()
+			client.seed("", "temp:old", map[string]interface{}{"key": "old", "value": "0", "expires_at": float64(time.Now().Add(time.Hour).Unix())})
+			client.commitErr = tt.commitErr
+			s, err := NewNoSQLStorage(client, zap.NewNop(), NoSQLConfig{TableName: "polyid"})
+			if err != nil {
+				t.Fatalf("NewNoSQLStorage: %v", err)
+			}
+			ctx := context.Background()
+
+			err = s.Transaction(ctx, func(tx Storage) error { return tt.fn(ctx, tx) })
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Transaction() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantCode != "":
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+					t.Fatalf("Transaction() error = %v, want code %s", err, tt.wantCode)
+				}
+			case err != nil:
+				t.Fatalf("Transaction: %v", err)
+			}
+
+			if keys := client.keys(); !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+			if client.commits != tt.wantCommits {
+				t.Errorf("commits = %d, want %d", client.commits, tt.wantCommits)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package webauthn
+
+import (
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// credentialAttachment returns how the credential's authenticator is
+// attached. Clients that don't report authenticatorAttachment leave it to be
+// inferred from the transports: "internal" means a platform authenticator,
+// and every other transport a roaming one. Conflicting or missing transports
+// leave it unknown.
+func credentialAttachment(credential *webauthn.Credential) protocol.AuthenticatorAttachment {
+	if credential.Authenticator.Attachment != "" {
+		return credential.Authenticator.Attachment
+	}
+
+	var attachment protocol.AuthenticatorAttachment
+	for _, transport := range credential.Transport {
+		inferred := protocol.CrossPlatform
+		if transport == protocol.Internal {
+			inferred = protocol.Platform
+		}
+		if attachment != "" && attachment != inferred {
+			return ""
+		}
+		attachment = inferred
+	}
+	return attachment
+}
+
+// checkAttachment rejects credentials from authenticators other than the
+// configured attachment. A credential whose attachment can't be determined
+// is rejected too, since the policy couldn't otherwise be enforced.
+func (h *Handler) checkAttachment(credential *webauthn.Credential) error {
+	if h.opts.AuthenticatorAttachment == "" {
+		return nil
+	}
+
+	attachment := credentialAttachment(credential)
+	if attachment == "" {
+		return fmt.Errorf("authenticator attachment is unknown, %s required", h.opts.AuthenticatorAttachment)
+	}
+	if attachment != h.opts.AuthenticatorAttachment {
+		return fmt.Errorf("authenticator attachment %s is not allowed, %s required", attachment, h.opts.AuthenticatorAttachment)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func TestCredentialAttachment(t *testing.T) {
+	tests := []struct {
+		name       string
+		reported   protocol.AuthenticatorAttachment
+		transports []protocol.AuthenticatorTransport
+		want       protocol.AuthenticatorAttachment
+	}{
+		{name: "reported platform", reported: protocol.Platform, want: protocol.Platform},
+		{name: "reported cross-platform", reported: protocol.CrossPlatform, want: protocol.CrossPlatform},
+		{name: "reported wins over transports", reported: protocol.CrossPlatform, transports: []protocol.AuthenticatorTransport{protocol.Internal}, want: protocol.CrossPlatform},
+		{name: "internal transport", transports: []protocol.AuthenticatorTransport{protocol.Internal}, want: protocol.Platform},
+		{name: "roaming transports", transports: []protocol.AuthenticatorTransport{protocol.USB, protocol.NFC}, want: protocol.CrossPlatform},
+		{name: "conflicting transports", transports: []protocol.AuthenticatorTransport{protocol.Internal, protocol.USB}},
+		{name: "nothing reported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credential := &webauthn.Credential{
+				Transport:     tt.transports,
+				Authenticator: webauthn.Authenticator{Attachment: tt.reported},
+			}
+			if got := credentialAttachment(credential); got != tt.want {
+				t.Errorf("credentialAttachment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// withAttachment adds the reported attachment and transports to a
+// registration response
+func withAttachment(t *testing.T, body []byte, attachment string, transports []string) []byte {
+	t.Helper()
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("decode registration: %v", err)
+	}
+	if attachment != "" {
+		response["authenticatorAttachment"] = attachment
+	}
+	if transports != nil {
+		response["response"].(map[string]interface{})["transports"] = transports
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("encode registration: %v", err)
+	}
+	return body
+}
+
+func TestAuthenticatorAttachmentPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		setting    protocol.AuthenticatorAttachment
+		reported   string
+		transports []string
+		wantStatus int
+	}{
+		{name: "any attachment allows platform", reported: "platform", wantStatus: http.StatusOK},
+		{name: "any attachment allows unknown", wantStatus: http.StatusOK},
+		{name: "security key", setting: protocol.CrossPlatform, reported: "cross-platform", wantStatus: http.StatusOK},
+		{name: "security key inferred from transports", setting: protocol.CrossPlatform, transports: []string{"usb", "nfc"}, wantStatus: http.StatusOK},
+		{name: "platform authenticator when security keys are required", setting: protocol.CrossPlatform, reported: "platform", wantStatus: http.StatusForbidden},
+		{name: "internal transport when security keys are required", setting: protocol.CrossPlatform, transports: []string{"internal"}, wantStatus: http.StatusForbidden},
+		{name: "platform", setting: protocol.Platform, reported: "platform", wantStatus: http.StatusOK},
+		{name: "platform inferred from transports", setting: protocol.Platform, transports: []string{"internal"}, wantStatus: http.StatusOK},
+		{name: "security key when platform is required", setting: protocol.Platform, reported: "cross-platform", wantStatus: http.StatusForbidden},
+		{name: "unknown attachment", setting: protocol.Platform, wantStatus: http.StatusForbidden},
+		{name: "conflicting transports", setting: protocol.CrossPlatform, transports: []string{"internal", "usb"}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{AuthenticatorAttachment: tt.setting})
+
+			if got := creationOptions(h).AuthenticatorSelection.AuthenticatorAttachment; got != tt.setting {
+				t.Errorf("requested attachment %q, want %q", got, tt.setting)
+			}
+
+			user := &testUser{id: []byte("user-1")}
+			session, ceremonyID := beginRegistration(t, h, user)
+			body := withAttachment(t, newTestAuthenticator(t).register(t, session, testRPID, testOrigin, false), tt.reported, tt.transports)
+
+			w := postCeremony(func(c *gin.Context) { h.finishRegistration(c, user) }, ceremonyID, body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
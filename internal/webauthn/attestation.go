@@ -0,0 +1,171 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/authz"
+	"github.com/polyid/auth/internal/storage"
+)
+
+// AttestationMode selects how registration attestation statements are handled
+type AttestationMode int
+
+const (
+	// AttestationVerify checks attestations against Options.Metadata when it
+	// is set, honouring Options.StrictAttestation
+	AttestationVerify AttestationMode = iota
+	// AttestationNone asks authenticators for no attestation and skips all
+	// trust-anchor checks. The authenticator data, signature counter, and
+	// public key are still validated by the library. Intended for consumer
+	// apps that don't restrict which authenticators may register.
+	AttestationNone
+)
+
+// errNoneAttestation is returned in strict mode for "none" attestations
+var errNoneAttestation = errors.New("none attestation is not accepted in strict mode")
+
+// verifyAttestation applies the configured attestation policy to a newly
+// created credential
+func (h *Handler) verifyAttestation(ctx context.Context, credential *webauthn.Credential, parsed *protocol.ParsedCredentialCreationData) error {
+	if h.opts.Attestation == AttestationNone {
+		return nil
+	}
+
+	if h.opts.StrictAttestation && credential.AttestationType == string(protocol.PreferNoAttestation) {
+		return errNoneAttestation
+	}
+
+	if h.opts.Metadata == nil {
+		return nil
+	}
+
+	return h.opts.Metadata.VerifyAttestation(ctx, credential.Authenticator.AAGUID,
+		attestationChain(parsed), h.opts.StrictAttestation)
+}
+
+// enterpriseDeviceSerial returns the device serial from an enterprise
+// attestation: the serial number of the attestation leaf certificate, which
+// enterprise attestation makes unique to the device. It returns "" if the
+// authenticator didn't return an enterprise attestation.
+func enterpriseDeviceSerial(parsed *protocol.ParsedCredentialCreationData) string {
+	var obj struct {
+		EpAtt bool `cbor:"epAtt"`
+	}
+	if err := webauthncbor.Unmarshal(parsed.Raw.AttestationResponse.AttestationObject, &obj); err != nil || !obj.EpAtt {
+		return ""
+	}
+
+	chain := attestationChain(parsed)
+	if len(chain) == 0 {
+		return ""
+	}
+
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(leaf.SerialNumber.Bytes())
+}
+
+// Sealer encrypts data at rest, typically an mfa.SecretCipher
+type Sealer interface {
+	Encrypt(plaintext string, userID string, ownerID string) (string, string, error)
+	Decrypt(ciphertext string, keyID string, userID string, ownerID string) (string, error)
+}
+
+// keepAttestation stores the attestation statement of a new credential when
+// Options.Attestations is set, with its certificate chain sealed. "none"
+// attestations carry nothing to audit and aren't kept.
+func (h *Handler) keepAttestation(ctx context.Context, user webauthn.User, stored *storage.Credential, parsed *protocol.ParsedCredentialCreationData) error {
+	if h.opts.Attestations == nil {
+		return nil
+	}
+
+	format := parsed.Response.AttestationObject.Format
+	if format == "" || format == string(protocol.PreferNoAttestation) {
+		return nil
+	}
+
+	attestation := &storage.Attestation{
+		CredentialID: stored.ID,
+		UserID:       string(user.WebAuthnID()),
+		Format:       format,
+		AAGUID:       formatAAGUID(parsed.Response.AttestationObject.AuthData.AttData.AAGUID),
+		CreatedAt:    stored.CreatedAt,
+	}
+	if chain := attestationChain(parsed); len(chain) > 0 {
+		encoded, err := json.Marshal(chain)
+		if err != nil {
+			return fmt.Errorf("failed to encode attestation chain: %w", err)
+		}
+		attestation.SealedX5C, attestation.KeyID, err = h.opts.AttestationCipher.Encrypt(string(encoded), attestation.UserID, attestation.CredentialID)
+		if err != nil {
+			return fmt.Errorf("failed to seal attestation chain: %w", err)
+		}
+	}
+
+	return h.opts.Attestations.StoreAttestation(ctx, attestation)
+}
+
+// openAttestation decrypts a kept attestation's certificate chain into X5C
+func (h *Handler) openAttestation(attestation *storage.Attestation) error {
+	if attestation.SealedX5C == "" {
+		return nil
+	}
+
+	encoded, err := h.opts.AttestationCipher.Decrypt(attestation.SealedX5C, attestation.KeyID, attestation.UserID, attestation.CredentialID)
+	if err != nil {
+		return fmt.Errorf("failed to open attestation chain: %w", err)
+	}
+	if err := json.Unmarshal([]byte(encoded), &attestation.X5C); err != nil {
+		return fmt.Errorf("failed to decode attestation chain: %w", err)
+	}
+
+	attestation.SealedX5C, attestation.KeyID = "", ""
+	return nil
+}
+
+// GetAttestation returns the kept attestation of the credential in the
+// credential_id path parameter. It is admin-only, since enterprise
+// attestations identify the individual device.
+func (h *Handler) GetAttestation(c *gin.Context) {
+	if h.opts.Scopes == nil || !h.opts.Scopes.HasScope(c.Request, authz.ScopeAdmin) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Admin access required"})
+		return
+	}
+	if h.opts.Attestations == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Attestations are not kept"})
+		return
+	}
+
+	attestation, err := h.opts.Attestations.GetAttestation(c.Request.Context(), c.Param("credential_id"))
+	var storageErr *storage.StorageError
+	if errors.As(err, &storageErr) && storageErr.Code == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Attestation not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get attestation", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get attestation"})
+		return
+	}
+	if err := h.openAttestation(attestation); err != nil {
+		h.logger.Error("Failed to open attestation", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get attestation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AttestationResponse{Attestation: attestation})
+}
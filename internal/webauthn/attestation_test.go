@@ -0,0 +1,335 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+func TestAttestationModes(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       Options
+		rpID       string
+		wantStatus int
+	}{
+		{name: "none mode accepts none", opts: Options{Attestation: AttestationNone}, rpID: testRPID, wantStatus: http.StatusOK},
+		{name: "none mode still checks authenticator data", opts: Options{Attestation: AttestationNone}, rpID: "evil.example", wantStatus: http.StatusUnauthorized},
+		{name: "verify mode accepts none", opts: Options{}, rpID: testRPID, wantStatus: http.StatusOK},
+		{name: "strict mode rejects none", opts: Options{StrictAttestation: true}, rpID: testRPID, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.opts)
+			user := &testUser{id: []byte("user-1")}
+
+			session, ceremonyID := beginRegistration(t, h, user)
+			body := newTestAuthenticator(t).register(t, session, tt.rpID, testOrigin, false)
+			w := postCeremony(func(c *gin.Context) { h.finishRegistration(c, user) }, ceremonyID, body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAttestationNoneConveyance(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want protocol.ConveyancePreference
+	}{
+		{name: "none mode", opts: Options{Attestation: AttestationNone}, want: protocol.PreferNoAttestation},
+		{name: "enterprise", opts: Options{EnterpriseAttestation: true}, want: protocol.PreferEnterpriseAttestation},
+		{name: "library default", opts: Options{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := creationOptions(&Handler{opts: tt.opts}).Attestation; got != tt.want {
+				t.Errorf("attestation conveyance = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttestationNoneValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "strict", opts: Options{Attestation: AttestationNone, StrictAttestation: true}},
+		{name: "enterprise", opts: Options{Attestation: AttestationNone, EnterpriseAttestation: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); err == nil {
+				t.Error("Validate() accepted none attestation mode combined with it")
+			}
+		})
+	}
+}
+
+// enterpriseAttestation returns registration data carrying an attestation
+// statement with the given chain, flagged as enterprise if epAtt is set
+func enterpriseAttestation(t *testing.T, epAtt bool, chain ...[]byte) *protocol.ParsedCredentialCreationData {
+	t.Helper()
+
+	x5c := make([]interface{}, 0, len(chain))
+	for _, der := range chain {
+		x5c = append(x5c, der)
+	}
+	attStmt := map[string]interface{}{"alg": -7, "sig": []byte("signature")}
+	if len(x5c) > 0 {
+		attStmt["x5c"] = x5c
+	}
+
+	object, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "packed",
+		"attStmt":  attStmt,
+		"authData": []byte("authenticator data"),
+		"epAtt":    epAtt,
+	})
+	if err != nil {
+		t.Fatalf("marshal attestation object: %v", err)
+	}
+
+	parsed := &protocol.ParsedCredentialCreationData{}
+	parsed.Raw.AttestationResponse.AttestationObject = object
+	parsed.Response.AttestationObject.Format = "packed"
+	parsed.Response.AttestationObject.AttStatement = attStmt
+	return parsed
+}
+
+func TestEnterpriseDeviceSerial(t *testing.T) {
+	_, leaf := newTestCA(t, "enterprise root").issue(t, "managed authenticator")
+
+	tests := []struct {
+		name   string
+		parsed *protocol.ParsedCredentialCreationData
+		want   string
+	}{
+		{name: "enterprise attestation", parsed: enterpriseAttestation(t, true, leaf.Raw), want: hex.EncodeToString(leaf.SerialNumber.Bytes())},
+		{name: "not enterprise", parsed: enterpriseAttestation(t, false, leaf.Raw)},
+		{name: "enterprise without a chain", parsed: enterpriseAttestation(t, true)},
+		{name: "unparseable leaf", parsed: enterpriseAttestation(t, true, []byte("not a certificate"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enterpriseDeviceSerial(tt.parsed); got != tt.want {
+				t.Errorf("enterpriseDeviceSerial() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnterpriseAttestationAcceptsNone(t *testing.T) {
+	h := newTestHandler(t, Options{EnterpriseAttestation: true})
+	user := &testUser{id: []byte("user-1")}
+
+	// An authenticator may ignore the enterprise request and return "none"
+	session, ceremonyID := beginRegistration(t, h, user)
+	body := newTestAuthenticator(t).register(t, session, testRPID, testOrigin, false)
+	w := postCeremony(func(c *gin.Context) { h.finishRegistration(c, user) }, ceremonyID, body)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+// attestationStore is an in-memory storage.AttestationStore
+type attestationStore struct {
+	mu           sync.Mutex
+	attestations map[string]storage.Attestation
+}
+
+func newAttestationStore() *attestationStore {
+	return &attestationStore{attestations: make(map[string]storage.Attestation)}
+}
+
+func (s *attestationStore) StoreAttestation(ctx context.Context, attestation *storage.Attestation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attestations[attestation.CredentialID] = *attestation
+	return nil
+}
+
+func (s *attestationStore) GetAttestation(ctx context.Context, credentialID string) (*storage.Attestation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attestation, ok := s.attestations[credentialID]
+	if !ok {
+		return nil, &storage.StorageError{Code: storage.ErrNotFound, Message: "Attestation not found"}
+	}
+	return &attestation, nil
+}
+
+// testSealer "encrypts" by encoding, binding the ciphertext to its user and
+// owner so opening it for another fails
+type testSealer struct{}
+
+func (testSealer) Encrypt(plaintext string, userID string, ownerID string) (string, string, error) {
+	return userID + "/" + ownerID + "/" + base64.StdEncoding.EncodeToString([]byte(plaintext)), "k1", nil
+}
+
+func (testSealer) Decrypt(ciphertext string, keyID string, userID string, ownerID string) (string, error) {
+	prefix := userID + "/" + ownerID + "/"
+	if keyID != "k1" || !strings.HasPrefix(ciphertext, prefix) {
+		return "", errors.New("ciphertext doesn't match")
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, prefix))
+	return string(plaintext), err
+}
+
+// staticScopes grants the same answer for every scope
+type staticScopes bool
+
+func (s staticScopes) HasScope(r *http.Request, scope string) bool {
+	return bool(s)
+}
+
+// getAttestation calls h.GetAttestation for credentialID
+func getAttestation(h *Handler, credentialID string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Params = gin.Params{{Key: "credential_id", Value: credentialID}}
+	h.GetAttestation(c)
+	return w
+}
+
+func TestKeepAttestation(t *testing.T) {
+	ca := newTestCA(t, "attestation root")
+	_, leaf := ca.issue(t, "authenticator")
+	chain := [][]byte{leaf.Raw, ca.cert.Raw}
+
+	store := newAttestationStore()
+	h := newTestHandler(t, Options{Attestations: store, AttestationCipher: testSealer{}, Scopes: staticScopes(true)})
+	user := &testUser{id: []byte("user-1")}
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stored := &storage.Credential{ID: "cred-1", UserID: "user-1", CreatedAt: createdAt}
+
+	if err := h.keepAttestation(context.Background(), user, stored, enterpriseAttestation(t, false, chain...)); err != nil {
+		t.Fatalf("keepAttestation: %v", err)
+	}
+
+	// The chain is only stored sealed
+	kept, ok := store.attestations["cred-1"]
+	if !ok {
+		t.Fatal("no attestation kept for cred-1")
+	}
+	if kept.Format != "packed" || kept.UserID != "user-1" || !kept.CreatedAt.Equal(createdAt) {
+		t.Errorf("kept attestation = %+v, want packed for user-1 created %v", kept, createdAt)
+	}
+	if len(kept.X5C) != 0 || kept.SealedX5C == "" || kept.KeyID != "k1" {
+		t.Errorf("kept chain = %d certificates, sealed %q key %q, want sealed only", len(kept.X5C), kept.SealedX5C, kept.KeyID)
+	}
+
+	w := getAttestation(h, "cred-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp AttestationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+	got := resp.Attestation
+	if got == nil || got.CredentialID != "cred-1" || got.Format != "packed" {
+		t.Fatalf("attestation = %+v, want packed attestation for cred-1", got)
+	}
+	if len(got.X5C) != len(chain) {
+		t.Fatalf("attestation chain has %d certificates, want %d", len(got.X5C), len(chain))
+	}
+	for i := range chain {
+		if !bytes.Equal(got.X5C[i], chain[i]) {
+			t.Errorf("certificate %d differs from the registered chain", i)
+		}
+	}
+	if got.SealedX5C != "" || got.KeyID != "" {
+		t.Errorf("response carries the sealed chain %q key %q", got.SealedX5C, got.KeyID)
+	}
+}
+
+func TestKeepAttestationSkipped(t *testing.T) {
+	stored := &storage.Credential{ID: "cred-1", UserID: "user-1"}
+	user := &testUser{id: []byte("user-1")}
+
+	none := enterpriseAttestation(t, false)
+	none.Response.AttestationObject.Format = string(protocol.PreferNoAttestation)
+
+	tests := []struct {
+		name   string
+		keep   bool
+		parsed *protocol.ParsedCredentialCreationData
+	}{
+		{name: "not configured", parsed: enterpriseAttestation(t, false)},
+		{name: "none attestation", keep: true, parsed: none},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newAttestationStore()
+			opts := Options{}
+			if tt.keep {
+				opts = Options{Attestations: store, AttestationCipher: testSealer{}, Scopes: staticScopes(true)}
+			}
+			h := newTestHandler(t, opts)
+
+			if err := h.keepAttestation(context.Background(), user, stored, tt.parsed); err != nil {
+				t.Fatalf("keepAttestation: %v", err)
+			}
+			if len(store.attestations) != 0 {
+				t.Errorf("kept %d attestations, want 0", len(store.attestations))
+			}
+		})
+	}
+}
+
+func TestGetAttestationErrors(t *testing.T) {
+	store := newAttestationStore()
+	store.attestations["tampered"] = storage.Attestation{CredentialID: "tampered", UserID: "user-1", Format: "packed", SealedX5C: "user-2/tampered/AA==", KeyID: "k1"}
+
+	tests := []struct {
+		name         string
+		admin        bool
+		notKept      bool
+		credentialID string
+		wantStatus   int
+	}{
+		{name: "not an admin", credentialID: "tampered", wantStatus: http.StatusForbidden},
+		{name: "attestations not kept", admin: true, notKept: true, credentialID: "cred-1", wantStatus: http.StatusNotFound},
+		{name: "unknown credential", admin: true, credentialID: "cred-1", wantStatus: http.StatusNotFound},
+		{name: "chain sealed for another credential", admin: true, credentialID: "tampered", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{Attestations: store, AttestationCipher: testSealer{}, Scopes: staticScopes(tt.admin)})
+			if tt.notKept {
+				h.opts.Attestations = nil
+			}
+
+			if w := getAttestation(h, tt.credentialID); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package webauthn
+
+import (
+	"container/list"
+	"crypto/x509"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheStats reports attestation cache effectiveness
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// trustAnchors is the parsed, immutable trust material for one AAGUID. It is
+// shared between concurrent registrations and must not be modified.
+type trustAnchors struct {
+	roots *x509.CertPool
+}
+
+// anchorCache is a size-bounded LRU of trust anchors keyed by AAGUID. It
+// holds anchors from one metadata load, its generation; anchors from an older
+// load are neither served nor stored, so a registration racing a refresh
+// can't cache stale trust material.
+type anchorCache struct {
+	mu         sync.Mutex
+	size       int
+	order      *list.List // front is most recently used
+	entries    map[string]*list.Element
+	generation uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type anchorEntry struct {
+	aaguid  string
+	anchors *trustAnchors
+}
+
+func newAnchorCache(size int) *anchorCache {
+	return &anchorCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *anchorCache) get(generation uint64, aaguid string) (*trustAnchors, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[aaguid]
+	if !ok || generation != c.generation {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	c.order.MoveToFront(elem)
+	return elem.Value.(*anchorEntry).anchors, true
+}
+
+func (c *anchorCache) add(generation uint64, aaguid string, anchors *trustAnchors) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advanceLocked(generation)
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[aaguid]; ok {
+		elem.Value.(*anchorEntry).anchors = anchors
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[aaguid] = c.order.PushFront(&anchorEntry{aaguid: aaguid, anchors: anchors})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*anchorEntry).aaguid)
+	}
+}
+
+// advance drops every entry if generation is newer than the cache's, after
+// the metadata they were parsed from is replaced. Anchors already cached for
+// generation are kept.
+func (c *anchorCache) advance(generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advanceLocked(generation)
+}
+
+// advanceLocked implements advance. The caller must hold c.mu.
+func (c *anchorCache) advanceLocked(generation uint64) {
+	if generation <= c.generation {
+		return
+	}
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.generation = generation
+}
+
+func (c *anchorCache) stats() CacheStats {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
@@ -0,0 +1,108 @@
+package webauthn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMetadataAnchorCache(t *testing.T) {
+	fidoRoot := newTestCA(t, "FIDO root")
+	authenticatorRoot := newTestCA(t, "authenticator root")
+	blob := metadataFixture(t, fidoRoot, authenticatorRoot)
+	_, leaf := authenticatorRoot.issue(t, "attestation")
+	chain := [][]byte{leaf.Raw}
+
+	store := NewMetadataStore(zap.NewNop(), "", fidoRoot.cert, time.Hour)
+	store.EnableCache(8)
+	if err := store.Load(blob); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ctx := context.Background()
+
+	// The first registration for an AAGUID parses its anchors; the second
+	// reuses them
+	for i := 0; i < 2; i++ {
+		if err := store.VerifyAttestation(ctx, trustedAAGUID, chain, true); err != nil {
+			t.Fatalf("VerifyAttestation %d: %v", i+1, err)
+		}
+	}
+	if got, want := store.CacheStats(), (CacheStats{Hits: 1, Misses: 1, Size: 1}); got != want {
+		t.Errorf("CacheStats() = %+v, want %+v", got, want)
+	}
+
+	// Reloading metadata drops anchors parsed from the old load
+	if err := store.Load(blob); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := store.VerifyAttestation(ctx, trustedAAGUID, chain, true); err != nil {
+		t.Fatalf("VerifyAttestation after reload: %v", err)
+	}
+	if got, want := store.CacheStats(), (CacheStats{Hits: 1, Misses: 2, Size: 1}); got != want {
+		t.Errorf("CacheStats() after reload = %+v, want %+v", got, want)
+	}
+}
+
+func TestMetadataAnchorCacheDisabled(t *testing.T) {
+	store, authenticatorRoot := newTestMetadataStore(t)
+	_, leaf := authenticatorRoot.issue(t, "attestation")
+
+	if err := store.VerifyAttestation(context.Background(), trustedAAGUID, [][]byte{leaf.Raw}, true); err != nil {
+		t.Fatalf("VerifyAttestation: %v", err)
+	}
+	if got := store.CacheStats(); got != (CacheStats{}) {
+		t.Errorf("CacheStats() with the cache disabled = %+v, want zero", got)
+	}
+}
+
+func TestAnchorCacheEviction(t *testing.T) {
+	c := newAnchorCache(2)
+	a, b, d := &trustAnchors{}, &trustAnchors{}, &trustAnchors{}
+
+	c.add(1, "a", a)
+	c.add(1, "b", b)
+	if _, ok := c.get(1, "a"); !ok {
+		t.Fatal("get(a) missed")
+	}
+	// b is now the least recently used
+	c.add(1, "d", d)
+
+	if _, ok := c.get(1, "b"); ok {
+		t.Error("least recently used entry was kept")
+	}
+	for _, aaguid := range []string{"a", "d"} {
+		if _, ok := c.get(1, aaguid); !ok {
+			t.Errorf("get(%s) missed", aaguid)
+		}
+	}
+	if size := c.stats().Size; size != 2 {
+		t.Errorf("size = %d, want 2", size)
+	}
+}
+
+func TestAnchorCacheGenerations(t *testing.T) {
+	c := newAnchorCache(4)
+	anchors := &trustAnchors{}
+
+	c.add(2, "a", anchors)
+	if _, ok := c.get(1, "a"); ok {
+		t.Error("entry served for an older generation")
+	}
+
+	// Anchors parsed from an older load aren't stored
+	c.add(1, "b", anchors)
+	if _, ok := c.get(2, "b"); ok {
+		t.Error("entry from an older generation was stored")
+	}
+
+	// A newer load drops every entry
+	c.advance(3)
+	if _, ok := c.get(3, "a"); ok {
+		t.Error("entry kept after the generation advanced")
+	}
+	if size := c.stats().Size; size != 0 {
+		t.Errorf("size after advance = %d, want 0", size)
+	}
+}
@@ -0,0 +1,160 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// CeremonyHeader carries the ceremony ID. Begin handlers set it on the
+// response; finish handlers require it on the request, either as this header
+// or as the ceremony_id query parameter. Keying session data by ceremony lets
+// a client run overlapping ceremonies, e.g. registering a second key while a
+// login is in progress.
+const CeremonyHeader = "X-WebAuthn-Ceremony"
+
+// CeremonyStore holds ceremony session data, typically a storage.RedisCache
+// or storage.NoSQLStorage. Taking a value must read and delete it in one
+// step, so each ceremony finishes at most once: go-webauthn doesn't track
+// used challenges itself.
+type CeremonyStore interface {
+	StoreTemporaryValue(ctx context.Context, key string, value string, expiry time.Duration) error
+	TakeTemporaryValue(ctx context.Context, key string) (string, error)
+}
+
+// Ceremony errors
+var (
+	ErrUnknownCeremony  = errors.New("unknown ceremony")
+	ErrCeremonyExpired  = errors.New("ceremony expired")
+	ErrInvalidChallenge = errors.New("invalid challenge")
+)
+
+// startCeremony stores session data under a new ceremony ID and returns it
+// to the client. It writes the error response and returns false on failure.
+func (h *Handler) startCeremony(c *gin.Context, session *webauthn.SessionData) bool {
+	ceremonyID, err := h.newCeremony(c.Request.Context(), session)
+	if err != nil {
+		h.logger.Error("Failed to start ceremony", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start ceremony"})
+		return false
+	}
+
+	c.Header(CeremonyHeader, ceremonyID)
+	return true
+}
+
+// newCeremony stores session data under a new ceremony ID
+func (h *Handler) newCeremony(ctx context.Context, session *webauthn.SessionData) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ceremony ID: %w", err)
+	}
+	ceremonyID := hex.EncodeToString(b)
+
+	// The library rejects sessions past Expires too. The record is kept for
+	// a second TTL so a late finish is told the ceremony expired rather
+	// than that it is unknown.
+	ttl := h.ceremonyTTL()
+	session.Expires = time.Now().Add(ttl)
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session data: %w", err)
+	}
+	if err := h.opts.Ceremonies.StoreTemporaryValue(ctx, ceremonyKey(ceremonyID), string(data), 2*ttl); err != nil {
+		return "", fmt.Errorf("failed to store session data: %w", err)
+	}
+
+	return ceremonyID, nil
+}
+
+// ceremonySession returns the session data for the request's ceremony and
+// removes it so it can't be replayed. It writes the error response and
+// returns false if the ceremony is missing or unknown.
+func (h *Handler) ceremonySession(c *gin.Context) (*webauthn.SessionData, bool) {
+	ceremonyID := c.GetHeader(CeremonyHeader)
+	if ceremonyID == "" {
+		ceremonyID = c.Query("ceremony_id")
+	}
+	if ceremonyID == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing ceremony ID"})
+		return nil, false
+	}
+
+	session, err := h.takeCeremony(c.Request.Context(), ceremonyID)
+	if err != nil {
+		writeCeremonyError(c, err)
+		return nil, false
+	}
+
+	return session, true
+}
+
+// takeCeremony returns the session data for a ceremony and removes it in
+// the same step, so of two finishes racing on one ceremony only one gets it
+func (h *Handler) takeCeremony(ctx context.Context, ceremonyID string) (*webauthn.SessionData, error) {
+	data, err := h.opts.Ceremonies.TakeTemporaryValue(ctx, ceremonyKey(ceremonyID))
+	var storageErr *storage.StorageError
+	if errors.As(err, &storageErr) && storageErr.Code == storage.ErrNotFound {
+		return nil, ErrUnknownCeremony
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take session data: %w", err)
+	}
+
+	session := &webauthn.SessionData{}
+	if err := json.Unmarshal([]byte(data), session); err != nil {
+		return nil, fmt.Errorf("failed to decode session data: %w", err)
+	}
+
+	if !session.Expires.IsZero() && time.Now().After(session.Expires) {
+		return nil, ErrCeremonyExpired
+	}
+
+	if err := h.checkChallenge(session); err != nil {
+		h.logger.Warn("Rejected ceremony challenge", zap.Error(err))
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChallenge, err)
+	}
+
+	return session, nil
+}
+
+func ceremonyKey(ceremonyID string) string {
+	return "webauthn_ceremony:" + ceremonyID
+}
+
+// ceremonyTTL returns how long a ceremony may take
+func (h *Handler) ceremonyTTL() time.Duration {
+	if h.opts.CeremonyTTL == 0 {
+		return DefaultCeremonyTTL
+	}
+	return h.opts.CeremonyTTL
+}
+
+// checkChallenge rejects session challenges shorter than MinChallengeBytes
+func (h *Handler) checkChallenge(session *webauthn.SessionData) error {
+	if h.opts.MinChallengeBytes == 0 {
+		return nil
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(session.Challenge)
+	if err != nil {
+		return fmt.Errorf("failed to decode challenge: %w", err)
+	}
+	if len(challenge) < h.opts.MinChallengeBytes {
+		return fmt.Errorf("challenge is %d bytes, minimum is %d", len(challenge), h.opts.MinChallengeBytes)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func TestOverlappingCeremonies(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	ctx := context.Background()
+
+	existing := newTestAuthenticator(t)
+	first, second := newTestAuthenticator(t), newTestAuthenticator(t)
+	user := &testUser{id: []byte("user-1"), credentials: []webauthn.Credential{existing.credential(t)}}
+	finish := func(c *gin.Context) { h.finishRegistration(c, user) }
+
+	// Start two registrations and a login before finishing any of them
+	firstSession, firstID := beginRegistration(t, h, user)
+	loginSession := beginLogin(t, h, user)
+	loginID, err := h.newCeremony(ctx, loginSession)
+	if err != nil {
+		t.Fatalf("newCeremony: %v", err)
+	}
+	secondSession, secondID := beginRegistration(t, h, user)
+
+	if firstID == secondID || firstID == loginID || secondID == loginID {
+		t.Fatalf("ceremony IDs are not unique: %q, %q, %q", firstID, loginID, secondID)
+	}
+
+	// Finish them in a different order than they were started
+	if w := postCeremony(finish, secondID, second.register(t, secondSession, testRPID, testOrigin, false)); w.Code != http.StatusOK {
+		t.Fatalf("second registration status = %d: %s", w.Code, w.Body.String())
+	}
+
+	session, err := h.takeCeremony(ctx, loginID)
+	if err != nil {
+		t.Fatalf("takeCeremony(login): %v", err)
+	}
+	if _, err := h.finishLogin(ctx, user, session, existing.assert(t, session, testRPID, testOrigin, false)); err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+
+	if w := postCeremony(finish, firstID, first.register(t, firstSession, testRPID, testOrigin, false)); w.Code != http.StatusOK {
+		t.Fatalf("first registration status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// Each ceremony finishes only once
+	for _, id := range []string{firstID, loginID, secondID} {
+		if _, err := h.takeCeremony(ctx, id); !errors.Is(err, ErrUnknownCeremony) {
+			t.Errorf("takeCeremony(%q) after finishing = %v, want %v", id, err, ErrUnknownCeremony)
+		}
+	}
+}
+
+func TestCeremonyResponseForOtherCeremony(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	authenticator := newTestAuthenticator(t)
+	user := &testUser{id: []byte("user-1")}
+	finish := func(c *gin.Context) { h.finishRegistration(c, user) }
+
+	_, firstID := beginRegistration(t, h, user)
+	secondSession, secondID := beginRegistration(t, h, user)
+	body := authenticator.register(t, secondSession, testRPID, testOrigin, false)
+
+	// A response answers only the ceremony whose challenge it signed
+	if w := postCeremony(finish, firstID, body); w.Code == http.StatusOK {
+		t.Fatal("response accepted for a different ceremony")
+	}
+	if w := postCeremony(finish, secondID, body); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+func TestTakeCeremony(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		expires time.Time
+		wantErr error
+	}{
+		{name: "current", expires: time.Now().Add(time.Minute)},
+		{name: "expired", expires: time.Now().Add(-time.Second), wantErr: ErrCeremonyExpired},
+		{name: "challenge too short", opts: Options{MinChallengeBytes: 64}, expires: time.Now().Add(time.Minute), wantErr: ErrInvalidChallenge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.opts)
+			ctx := context.Background()
+
+			session := beginLogin(t, h, &testUser{id: []byte("user-1"), credentials: []webauthn.Credential{newTestAuthenticator(t).credential(t)}})
+			session.Expires = tt.expires
+			data, err := json.Marshal(session)
+			if err != nil {
+				t.Fatalf("marshal session: %v", err)
+			}
+			if err := h.opts.Ceremonies.StoreTemporaryValue(ctx, ceremonyKey("ceremony-1"), string(data), time.Minute); err != nil {
+				t.Fatalf("StoreTemporaryValue: %v", err)
+			}
+
+			got, err := h.takeCeremony(ctx, "ceremony-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("takeCeremony() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.Challenge != session.Challenge {
+				t.Errorf("takeCeremony() challenge = %q, want %q", got.Challenge, session.Challenge)
+			}
+
+			if _, err := h.takeCeremony(ctx, "ceremony-1"); !errors.Is(err, ErrUnknownCeremony) {
+				t.Errorf("second takeCeremony() = %v, want %v", err, ErrUnknownCeremony)
+			}
+		})
+	}
+}
+
+func TestCeremonySessionMissingID(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	finish := func(c *gin.Context) { h.finishRegistration(c, &testUser{id: []byte("user-1")}) }
+
+	if w := postCeremony(finish, "", []byte("{}")); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCheckChallenge(t *testing.T) {
+	challenge := func(n int) string {
+		return base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{7}, n))
+	}
+
+	tests := []struct {
+		name      string
+		min       int
+		challenge string
+		wantErr   bool
+	}{
+		{name: "no minimum", challenge: challenge(8)},
+		{name: "at the minimum", min: 32, challenge: challenge(32)},
+		{name: "above the minimum", min: 32, challenge: challenge(64)},
+		{name: "below the minimum", min: 32, challenge: challenge(31), wantErr: true},
+		{name: "undecodable", min: 32, challenge: "not base64url!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{opts: Options{MinChallengeBytes: tt.min}}
+			err := h.checkChallenge(&webauthn.SessionData{Challenge: tt.challenge})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkChallenge() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLibraryChallengeMeetsMinimum(t *testing.T) {
+	// The library's own challenges pass the recommended minimum of 16 bytes
+	h := newTestHandler(t, Options{MinChallengeBytes: 16})
+	session, ceremonyID := beginRegistration(t, h, &testUser{id: []byte("user-1")})
+	if _, err := h.takeCeremony(context.Background(), ceremonyID); err != nil {
+		t.Errorf("takeCeremony() for a %d-character challenge = %v", len(session.Challenge), err)
+	}
+}
+
+func TestCeremonyTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wantTTL time.Duration
+	}{
+		{name: "default", wantTTL: DefaultCeremonyTTL},
+		{name: "configured", ttl: 2 * time.Minute, wantTTL: 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{CeremonyTTL: tt.ttl})
+
+			before := time.Now()
+			session, _ := beginRegistration(t, h, &testUser{id: []byte("user-1")})
+			after := time.Now()
+
+			if session.Expires.Before(before.Add(tt.wantTTL)) || session.Expires.After(after.Add(tt.wantTTL)) {
+				t.Errorf("Expires = %v, want %v after begin", session.Expires, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestFinishExpiredCeremony(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	ctx := context.Background()
+	user := &testUser{id: []byte("user-1")}
+	session, ceremonyID := beginRegistration(t, h, user)
+	body := newTestAuthenticator(t).register(t, session, testRPID, testOrigin, false)
+
+	// The record outlives the TTL, so a late finish finds it expired
+	session.Expires = time.Now().Add(-time.Second)
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatalf("marshal session: %v", err)
+	}
+	if err := h.opts.Ceremonies.StoreTemporaryValue(ctx, ceremonyKey(ceremonyID), string(data), time.Minute); err != nil {
+		t.Fatalf("StoreTemporaryValue: %v", err)
+	}
+
+	finish := func(c *gin.Context) { h.finishRegistration(c, user) }
+	w := postCeremony(finish, ceremonyID, body)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != CodeCeremonyExpired {
+		t.Errorf("response = %s, want code %q", w.Body.String(), CodeCeremonyExpired)
+	}
+
+	// An expired ceremony is consumed too, so retrying doesn't revive it
+	w = postCeremony(finish, ceremonyID, body)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != CodeUnknownCeremony {
+		t.Errorf("retry response = %s, want code %q", w.Body.String(), CodeUnknownCeremony)
+	}
+}
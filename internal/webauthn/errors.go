@@ -0,0 +1,94 @@
+package webauthn
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// Error codes returned in ErrorResponse.Code, so clients can tell failures
+// apart without parsing messages. These are part of the API and must not
+// change once released. Failures in the browser, such as the user
+// cancelling the prompt, never reach the server and have no code.
+const (
+	CodeMalformedResponse    = "malformed_response"
+	CodeUnknownCeremony      = "unknown_ceremony"
+	CodeCeremonyExpired      = "ceremony_expired"
+	CodeInvalidChallenge     = "invalid_challenge"
+	CodeChallengeMismatch    = "challenge_mismatch"
+	CodeInvalidSignature     = "invalid_signature"
+	CodeInvalidAttestation   = "invalid_attestation"
+	CodeUnsupportedAlgorithm = "unsupported_algorithm"
+	CodeVerificationFailed   = "verification_failed"
+)
+
+// errorClass is the client-facing classification of a ceremony error
+type errorClass struct {
+	status  int
+	code    string
+	message string
+}
+
+// classifyError classifies an error from verifying a ceremony response,
+// whether raised by the library or by the ceremony checks here. Errors it
+// doesn't recognize are reported as a generic verification failure.
+func classifyError(err error) errorClass {
+	switch {
+	case errors.Is(err, ErrUnknownCeremony):
+		return errorClass{http.StatusBadRequest, CodeUnknownCeremony, "Unknown ceremony"}
+	case errors.Is(err, ErrCeremonyExpired):
+		return errorClass{http.StatusBadRequest, CodeCeremonyExpired, "Ceremony expired"}
+	case errors.Is(err, ErrInvalidChallenge):
+		return errorClass{http.StatusBadRequest, CodeInvalidChallenge, "Invalid challenge"}
+	}
+
+	var protocolErr *protocol.Error
+	if !errors.As(err, &protocolErr) {
+		return errorClass{http.StatusBadRequest, CodeVerificationFailed, "Verification failed"}
+	}
+
+	// The library's errors are copied when details are added, so match on
+	// the type rather than the value
+	switch protocolErr.Type {
+	case protocol.ErrBadRequest.Type, protocol.ErrParsingData.Type, protocol.ErrAuthData.Type:
+		return errorClass{http.StatusBadRequest, CodeMalformedResponse, "Malformed response"}
+	case protocol.ErrChallengeMismatch.Type:
+		return errorClass{http.StatusBadRequest, CodeChallengeMismatch, "Challenge mismatch"}
+	case protocol.ErrAssertionSignature.Type:
+		return errorClass{http.StatusUnauthorized, CodeInvalidSignature, "Invalid signature"}
+	case protocol.ErrAttestation.Type, protocol.ErrInvalidAttestation.Type, protocol.ErrAttestationCertificate.Type:
+		return errorClass{http.StatusBadRequest, CodeInvalidAttestation, "Invalid attestation"}
+	case protocol.ErrUnsupportedKey.Type, protocol.ErrUnsupportedAlgorithm.Type:
+		return errorClass{http.StatusBadRequest, CodeUnsupportedAlgorithm, "Unsupported key algorithm"}
+	default:
+		return errorClass{http.StatusUnauthorized, CodeVerificationFailed, "Verification failed"}
+	}
+}
+
+// writeCeremonyError writes the classified error response for err
+func writeCeremonyError(c *gin.Context, err error) {
+	class := classifyError(err)
+	c.JSON(class.status, ErrorResponse{Error: class.message, Code: class.code})
+}
+
+// assertionError marks an error as kind while keeping the underlying error
+// available to errors.As, so callers can both test for kind and classify
+// the cause
+type assertionError struct {
+	kind error
+	err  error
+}
+
+func (e *assertionError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *assertionError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *assertionError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,80 @@
+package webauthn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "unknown ceremony", err: ErrUnknownCeremony, wantStatus: http.StatusBadRequest, wantCode: CodeUnknownCeremony},
+		{name: "wrapped expired ceremony", err: fmt.Errorf("take: %w", ErrCeremonyExpired), wantStatus: http.StatusBadRequest, wantCode: CodeCeremonyExpired},
+		{name: "invalid challenge", err: ErrInvalidChallenge, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidChallenge},
+		{name: "unparseable body", err: protocol.ErrBadRequest.WithDetails("Parse error"), wantStatus: http.StatusBadRequest, wantCode: CodeMalformedResponse},
+		{name: "bad client data", err: protocol.ErrParsingData.WithDetails("Error unmarshalling client data"), wantStatus: http.StatusBadRequest, wantCode: CodeMalformedResponse},
+		{name: "bad authenticator data", err: protocol.ErrAuthData.WithDetails("Expected data greater than 37 bytes"), wantStatus: http.StatusBadRequest, wantCode: CodeMalformedResponse},
+		{name: "challenge mismatch", err: protocol.ErrChallengeMismatch, wantStatus: http.StatusBadRequest, wantCode: CodeChallengeMismatch},
+		{name: "bad signature", err: protocol.ErrAssertionSignature.WithDetails("Error validating the assertion signature"), wantStatus: http.StatusUnauthorized, wantCode: CodeInvalidSignature},
+		{name: "bad attestation", err: protocol.ErrAttestation.WithDetails("Unsupported attestation format"), wantStatus: http.StatusBadRequest, wantCode: CodeInvalidAttestation},
+		{name: "bad attestation format", err: protocol.ErrInvalidAttestation, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidAttestation},
+		{name: "bad attestation certificate", err: protocol.ErrAttestationCertificate, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidAttestation},
+		{name: "unsupported key", err: protocol.ErrUnsupportedKey, wantStatus: http.StatusBadRequest, wantCode: CodeUnsupportedAlgorithm},
+		{name: "unsupported algorithm", err: protocol.ErrUnsupportedAlgorithm, wantStatus: http.StatusBadRequest, wantCode: CodeUnsupportedAlgorithm},
+		{name: "other protocol error", err: protocol.ErrVerification.WithDetails("RP Hash mismatch"), wantStatus: http.StatusUnauthorized, wantCode: CodeVerificationFailed},
+		{
+			name:       "protocol error inside an assertion error",
+			err:        &assertionError{kind: ErrInvalidAssertion, err: protocol.ErrAssertionSignature},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   CodeInvalidSignature,
+		},
+		{name: "unrecognized error", err: errors.New("boom"), wantStatus: http.StatusBadRequest, wantCode: CodeVerificationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := classifyError(tt.err)
+			if class.status != tt.wantStatus || class.code != tt.wantCode {
+				t.Errorf("classifyError() = %d %s, want %d %s", class.status, class.code, tt.wantStatus, tt.wantCode)
+			}
+			if class.message == "" {
+				t.Error("classifyError() has no message")
+			}
+		})
+	}
+}
+
+// TestCeremonyErrorClassification checks errors from real ceremonies
+// classify as the library and ceremony checks raise them
+func TestCeremonyErrorClassification(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	authenticator := newTestAuthenticator(t)
+	user := &testUser{id: []byte("user-1"), credentials: []webauthn.Credential{authenticator.credential(t)}}
+
+	session := beginLogin(t, h, user)
+	parsed := authenticator.assert(t, session, testRPID, testOrigin, false)
+	parsed.Response.Signature[len(parsed.Response.Signature)-1] ^= 0xff
+
+	_, err := h.finishLogin(context.Background(), user, session, parsed)
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Fatalf("finishLogin() = %v, want %v", err, ErrInvalidAssertion)
+	}
+	if class := classifyError(err); class.code != CodeInvalidSignature {
+		t.Errorf("tampered signature classified as %s, want %s", class.code, CodeInvalidSignature)
+	}
+
+	_, err = h.takeCeremony(context.Background(), "unknown")
+	if class := classifyError(err); class.code != CodeUnknownCeremony {
+		t.Errorf("unknown ceremony classified as %s, want %s", class.code, CodeUnknownCeremony)
+	}
+}
@@ -0,0 +1,54 @@
+package webauthn
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/events"
+)
+
+// EventPublisher publishes WebAuthn events, typically an events.KafkaProducer
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, topic string, event *events.Event) error
+}
+
+// SetEventPublisher enables publishing credential.used events to topic after
+// each successful login
+func (h *Handler) SetEventPublisher(publisher EventPublisher, topic string) {
+	h.publisher = publisher
+	h.eventTopic = topic
+}
+
+// publishCredentialUsed records a successful login. Publishing is
+// best-effort; failures are logged and never fail the login.
+func (h *Handler) publishCredentialUsed(ctx context.Context, user webauthn.User, credential *webauthn.Credential) {
+	if h.publisher == nil {
+		return
+	}
+
+	userID := string(user.WebAuthnID())
+	data, err := json.Marshal(events.CredentialUsedData{
+		UserID:       userID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		UsedAt:       time.Now(),
+	})
+	if err != nil {
+		h.logger.Error("Failed to encode credential.used event", zap.Error(err))
+		return
+	}
+
+	err = h.publisher.PublishEvent(ctx, h.eventTopic, &events.Event{
+		Key:       userID,
+		Type:      events.EventCredentialUsed,
+		Timestamp: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		h.logger.Error("Failed to publish credential.used event", zap.Error(err))
+	}
+}
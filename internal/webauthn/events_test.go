@@ -0,0 +1,83 @@
+package webauthn
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/polyid/auth/internal/events"
+)
+
+// recordingPublisher records published events and fails with err
+type recordingPublisher struct {
+	topics []string
+	events []*events.Event
+	err    error
+}
+
+func (p *recordingPublisher) PublishEvent(ctx context.Context, topic string, event *events.Event) error {
+	p.topics = append(p.topics, topic)
+	p.events = append(p.events, event)
+	return p.err
+}
+
+func TestLoginPublishesCredentialUsed(t *testing.T) {
+	tests := []struct {
+		name       string
+		origin     string
+		publishErr error
+		wantEvent  bool
+		wantErr    bool
+	}{
+		{name: "successful login", origin: testOrigin, wantEvent: true},
+		{name: "publish failure doesn't fail the login", origin: testOrigin, publishErr: errors.New("broker unavailable"), wantEvent: true},
+		{name: "failed login", origin: "https://evil.example", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{})
+			publisher := &recordingPublisher{err: tt.publishErr}
+			h.SetEventPublisher(publisher, "auth-events")
+			authenticator := newTestAuthenticator(t)
+			user := &testUser{id: []byte("user-1"), credentials: []webauthn.Credential{authenticator.credential(t)}}
+
+			session := beginLogin(t, h, user)
+			start := time.Now()
+			_, err := h.finishLogin(context.Background(), user, session, authenticator.assert(t, session, testRPID, tt.origin, false))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("finishLogin() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if !tt.wantEvent {
+				if len(publisher.events) != 0 {
+					t.Errorf("published %d events for a failed login", len(publisher.events))
+				}
+				return
+			}
+			if len(publisher.events) != 1 {
+				t.Fatalf("published %d events, want 1", len(publisher.events))
+			}
+			event := publisher.events[0]
+			if publisher.topics[0] != "auth-events" || event.Type != events.EventCredentialUsed || event.Key != "user-1" {
+				t.Errorf("published %s event keyed %q to %q", event.Type, event.Key, publisher.topics[0])
+			}
+
+			var data events.CredentialUsedData
+			if err := json.Unmarshal(event.Data, &data); err != nil {
+				t.Fatalf("decode event data: %v", err)
+			}
+			if data.UserID != "user-1" || data.CredentialID != base64.RawURLEncoding.EncodeToString(authenticator.credentialID) {
+				t.Errorf("event data = %+v", data)
+			}
+			if data.UsedAt.Before(start) {
+				t.Errorf("event used at %v, before the login started at %v", data.UsedAt, start)
+			}
+		})
+	}
+}
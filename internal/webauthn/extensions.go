@@ -0,0 +1,48 @@
+package webauthn
+
+import (
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// registrationExtensions returns the client extensions requested during
+// registration. credProps is always requested so we learn whether the new
+// credential is discoverable. appidExclude is sent when a legacy U2F app ID
+// is configured so authenticators already registered under it are excluded.
+func registrationExtensions(largeBlob bool, legacyAppID string) protocol.AuthenticationExtensions {
+	extensions := protocol.AuthenticationExtensions{
+		"credProps": true,
+	}
+	if largeBlob {
+		extensions["largeBlob"] = map[string]interface{}{
+			"support": "preferred",
+		}
+	}
+	if legacyAppID != "" {
+		extensions["appidExclude"] = legacyAppID
+	}
+	return extensions
+}
+
+// parseCredProps returns the credProps "rk" result, or nil if the client
+// didn't report it
+func parseCredProps(results protocol.AuthenticationExtensionsClientOutputs) *bool {
+	props, ok := results["credProps"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	rk, ok := props["rk"].(bool)
+	if !ok {
+		return nil
+	}
+	return &rk
+}
+
+// parseLargeBlobSupported reports whether the authenticator supports largeBlob
+func parseLargeBlobSupported(results protocol.AuthenticationExtensionsClientOutputs) bool {
+	largeBlob, ok := results["largeBlob"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	supported, _ := largeBlob["supported"].(bool)
+	return supported
+}
@@ -0,0 +1,140 @@
+package webauthn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// creationOptions applies the handler's registration options
+func creationOptions(h *Handler) *protocol.PublicKeyCredentialCreationOptions {
+	options := &protocol.PublicKeyCredentialCreationOptions{}
+	for _, opt := range h.registrationOptions() {
+		opt(options)
+	}
+	return options
+}
+
+func TestRegistrationExtensions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want protocol.AuthenticationExtensions
+	}{
+		{
+			name: "credProps only",
+			want: protocol.AuthenticationExtensions{"credProps": true},
+		},
+		{
+			name: "largeBlob",
+			opts: Options{LargeBlob: true},
+			want: protocol.AuthenticationExtensions{
+				"credProps": true,
+				"largeBlob": map[string]interface{}{"support": "preferred"},
+			},
+		},
+		{
+			name: "legacy app ID",
+			opts: Options{LegacyAppID: "https://example.com/appid.json"},
+			want: protocol.AuthenticationExtensions{
+				"credProps":    true,
+				"appidExclude": "https://example.com/appid.json",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := creationOptions(&Handler{opts: tt.opts})
+			if !reflect.DeepEqual(options.Extensions, tt.want) {
+				t.Errorf("requested extensions = %v, want %v", options.Extensions, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExtensionResults(t *testing.T) {
+	discoverable, notDiscoverable := true, false
+
+	tests := []struct {
+		name             string
+		results          string
+		wantDiscoverable *bool
+		wantLargeBlob    bool
+	}{
+		{name: "no results", results: `{}`},
+		{name: "discoverable", results: `{"credProps":{"rk":true}}`, wantDiscoverable: &discoverable},
+		{name: "not discoverable", results: `{"credProps":{"rk":false}}`, wantDiscoverable: &notDiscoverable},
+		{name: "credProps without rk", results: `{"credProps":{}}`},
+		{name: "largeBlob supported", results: `{"largeBlob":{"supported":true}}`, wantLargeBlob: true},
+		{name: "largeBlob unsupported", results: `{"largeBlob":{"supported":false}}`},
+		{name: "malformed results", results: `{"credProps":"yes","largeBlob":true}`},
+		{
+			name:             "both",
+			results:          `{"credProps":{"rk":true},"largeBlob":{"supported":true}}`,
+			wantDiscoverable: &discoverable,
+			wantLargeBlob:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results protocol.AuthenticationExtensionsClientOutputs
+			if err := json.Unmarshal([]byte(tt.results), &results); err != nil {
+				t.Fatalf("unmarshal results: %v", err)
+			}
+
+			if got := parseCredProps(results); !reflect.DeepEqual(got, tt.wantDiscoverable) {
+				t.Errorf("parseCredProps() = %v, want %v", got, tt.wantDiscoverable)
+			}
+			if got := parseLargeBlobSupported(results); got != tt.wantLargeBlob {
+				t.Errorf("parseLargeBlobSupported() = %v, want %v", got, tt.wantLargeBlob)
+			}
+		})
+	}
+}
+
+func TestLegacyAppIDLogin(t *testing.T) {
+	const appID = "https://example.com/u2f-app-id.json"
+
+	tests := []struct {
+		name            string
+		legacyAppID     string
+		attestationType string
+		rpID            string
+		clientAppID     bool
+		wantErr         error
+	}{
+		{name: "U2F credential via appid", legacyAppID: appID, attestationType: "fido-u2f", rpID: appID, clientAppID: true},
+		{name: "U2F credential via RP ID", legacyAppID: appID, attestationType: "fido-u2f", rpID: testRPID},
+		{name: "client didn't use appid", legacyAppID: appID, attestationType: "fido-u2f", rpID: appID, wantErr: ErrInvalidAssertion},
+		{name: "WebAuthn credential claiming appid", legacyAppID: appID, attestationType: "none", rpID: appID, clientAppID: true, wantErr: ErrInvalidAssertion},
+		{name: "no legacy app ID configured", attestationType: "fido-u2f", rpID: appID, clientAppID: true, wantErr: ErrInvalidAssertion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{LegacyAppID: tt.legacyAppID})
+			authenticator := newTestAuthenticator(t)
+			credential := authenticator.credential(t)
+			credential.AttestationType = tt.attestationType
+			user := &testUser{id: []byte("user-1"), credentials: []webauthn.Credential{credential}}
+
+			session := beginLogin(t, h, user)
+			parsed := authenticator.assert(t, session, tt.rpID, testOrigin, false)
+			if tt.clientAppID {
+				parsed.ClientExtensionResults = protocol.AuthenticationExtensionsClientOutputs{"appid": true}
+			}
+
+			_, err := h.finishLogin(context.Background(), user, session, parsed)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("finishLogin() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
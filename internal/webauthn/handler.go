@@ -1,29 +1,207 @@
 package webauthn
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/authz"
+	"github.com/polyid/auth/internal/storage"
 )
 
 type Handler struct {
-	logger   *zap.Logger
-	webauthn *webauthn.WebAuthn
+	logger     *zap.Logger
+	webauthn   *webauthn.WebAuthn
+	migration  *rpMigration
+	opts       Options
+	publisher  EventPublisher
+	eventTopic string
+}
+
+// Options configures optional WebAuthn behaviour
+type Options struct {
+	// LargeBlob requests the largeBlob extension during registration
+	LargeBlob bool
+
+	// Metadata validates attestations against FIDO MDS trust anchors when set
+	Metadata *MetadataStore
+	// StrictAttestation rejects authenticators that are unknown to the
+	// metadata or don't provide an attestation certificate chain, including
+	// "none" attestations
+	StrictAttestation bool
+	// Attestation selects how attestation statements are handled. See
+	// AttestationNone for consumer apps that don't need trust checks.
+	Attestation AttestationMode
+	// EnterpriseAttestation requests enterprise attestation, which lets
+	// managed authenticators identify the individual device. Browsers only
+	// honour it for RP IDs allowlisted by enterprise policy or the
+	// authenticator vendor.
+	EnterpriseAttestation bool
+	// Attestations keeps the attestation statement of each registered
+	// credential so audits can re-examine it later. Nil discards it once
+	// verified. Statements are large, so only enable this when audits need
+	// them. Requires AttestationCipher and Scopes.
+	Attestations storage.AttestationStore
+	// AttestationCipher encrypts kept attestation certificate chains, which
+	// can identify the individual device
+	AttestationCipher Sealer
+	// Scopes checks the caller's token on admin-only endpoints, which are
+	// denied without it
+	Scopes authz.ScopeChecker
+
+	// AllowedAlgorithms restricts the public key algorithms offered during
+	// registration and accepted when it finishes. Empty uses library defaults.
+	AllowedAlgorithms []webauthncose.COSEAlgorithmIdentifier
+
+	// LegacyRPID is a previous RP ID whose assertions are still accepted
+	// until MigrationEnds. LegacyRPOrigins defaults to the current origins.
+	LegacyRPID      string
+	LegacyRPOrigins []string
+	MigrationEnds   time.Time
+
+	// LegacyAppID is the FIDO U2F app ID credentials were registered under
+	// before the move to WebAuthn, e.g. "https://example.com/u2f-app-id.json".
+	// Logins send it in the appid extension so U2F-era keys keep working, and
+	// registrations send it in appidExclude so those keys aren't registered
+	// twice. Only credentials stored with the "fido-u2f" attestation type
+	// trigger the appid extension.
+	LegacyAppID string
+
+	// UserVerification sets the user verification requirement for both
+	// ceremonies. When required, responses without the UV flag are rejected.
+	UserVerification protocol.UserVerificationRequirement
+
+	// ResidentKey sets the resident key requirement for registration. When
+	// required, registrations whose credProps output reports a
+	// non-discoverable credential are rejected; clients that don't report
+	// credProps are trusted, since the authenticator must fail the ceremony
+	// rather than create one.
+	ResidentKey protocol.ResidentKeyRequirement
+
+	// AuthenticatorAttachment restricts registration to platform or
+	// cross-platform authenticators, e.g. for enterprises that only allow
+	// security keys. Registrations from the other kind, or whose attachment
+	// can't be determined from the response, are rejected. Empty allows both.
+	AuthenticatorAttachment protocol.AuthenticatorAttachment
+
+	// MaxBodyBytes bounds the request body of the finish handlers. Zero uses
+	// DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+
+	// MinChallengeBytes rejects ceremonies whose challenge is shorter than
+	// this many bytes. The library issues 32-byte challenges.
+	MinChallengeBytes int
+
+	// CeremonyTTL is how long a client has to finish a ceremony after
+	// beginning it. Zero uses DefaultCeremonyTTL.
+	CeremonyTTL time.Duration
+
+	// Ceremonies holds each ceremony's session data between begin and
+	// finish. Required.
+	Ceremonies CeremonyStore
+}
+
+const (
+	// DefaultMaxBodyBytes is the finish handler body limit used when
+	// Options.MaxBodyBytes is unset
+	DefaultMaxBodyBytes = 64 << 10
+
+	// DefaultCeremonyTTL is the ceremony lifetime used when
+	// Options.CeremonyTTL is unset
+	DefaultCeremonyTTL = 5 * time.Minute
+)
+
+// Validate reports the first problem with the options
+func (o Options) Validate() error {
+	if o.Attestation == AttestationNone && o.StrictAttestation {
+		return errors.New("none attestation mode can't be combined with strict attestation")
+	}
+	if o.Attestation == AttestationNone && o.EnterpriseAttestation {
+		return errors.New("none attestation mode can't be combined with enterprise attestation")
+	}
+	if o.Attestation == AttestationNone && o.Attestations != nil {
+		return errors.New("none attestation mode can't be combined with keeping attestations")
+	}
+	if o.Attestations != nil && o.AttestationCipher == nil {
+		return errors.New("attestation cipher is required to keep attestations")
+	}
+	if o.Attestations != nil && o.Scopes == nil {
+		return errors.New("scope checker is required to keep attestations")
+	}
+	if o.LegacyRPID != "" && o.MigrationEnds.IsZero() {
+		return errors.New("migration end is required with a legacy RP ID")
+	}
+	if o.LegacyAppID != "" {
+		u, err := url.Parse(o.LegacyAppID)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("legacy app ID must be an https URL")
+		}
+	}
+	switch o.UserVerification {
+	case "", protocol.VerificationRequired, protocol.VerificationPreferred, protocol.VerificationDiscouraged:
+	default:
+		return fmt.Errorf("unknown user verification requirement %q", o.UserVerification)
+	}
+	switch o.ResidentKey {
+	case "", protocol.ResidentKeyRequirementDiscouraged, protocol.ResidentKeyRequirementPreferred, protocol.ResidentKeyRequirementRequired:
+	default:
+		return fmt.Errorf("unknown resident key requirement %q", o.ResidentKey)
+	}
+	switch o.AuthenticatorAttachment {
+	case "", protocol.Platform, protocol.CrossPlatform:
+	default:
+		return fmt.Errorf("unknown authenticator attachment %q", o.AuthenticatorAttachment)
+	}
+	if o.MaxBodyBytes < 0 {
+		return errors.New("max body bytes must not be negative")
+	}
+	if o.MinChallengeBytes < 0 {
+		return errors.New("min challenge bytes must not be negative")
+	}
+	if o.CeremonyTTL < 0 {
+		return errors.New("ceremony TTL must not be negative")
+	}
+	if o.Ceremonies == nil {
+		return errors.New("ceremony store is required")
+	}
+	return nil
 }
 
 // NewHandler creates a new WebAuthn handler
-func NewHandler(logger *zap.Logger, config *webauthn.Config) (*Handler, error) {
+func NewHandler(logger *zap.Logger, config *webauthn.Config, opts Options) (*Handler, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid WebAuthn options: %w", err)
+	}
+
 	w, err := webauthn.New(config)
 	if err != nil {
 		return nil, err
 	}
 
+	migration, err := newRPMigration(config, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Handler{
-		logger:   logger,
-		webauthn: w,
+		logger:    logger,
+		webauthn:  w,
+		migration: migration,
+		opts:      opts,
 	}, nil
 }
 
@@ -31,108 +209,345 @@ func NewHandler(logger *zap.Logger, config *webauthn.Config) (*Handler, error) {
 func (h *Handler) BeginRegistration(c *gin.Context) {
 	user := getUserFromContext(c) // This would be implemented to get user from your auth system
 
-	options, session, err := h.webauthn.BeginRegistration(user)
+	options, session, err := h.webauthn.BeginRegistration(user, h.registrationOptions()...)
 	if err != nil {
 		h.logger.Error("Failed to begin registration", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin registration"})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to begin registration"})
 		return
 	}
 
-	// Store the session data
-	storeSessionData(c, session)
+	// Store the session data under a new ceremony
+	if !h.startCeremony(c, session) {
+		return
+	}
 
 	c.JSON(http.StatusOK, options)
 }
 
 // FinishRegistration completes the WebAuthn registration process
 func (h *Handler) FinishRegistration(c *gin.Context) {
-	user := getUserFromContext(c)
-	session := getSessionData(c)
+	h.finishRegistration(c, getUserFromContext(c))
+}
+
+// finishRegistration verifies a registration response and stores the new
+// credential for user
+func (h *Handler) finishRegistration(c *gin.Context, user webauthn.User) {
+	if !h.limitBody(c) {
+		return
+	}
 
-	credential, err := h.webauthn.FinishRegistration(user, session, c.Request)
+	session, ok := h.ceremonySession(c)
+	if !ok {
+		return
+	}
+
+	// Parse the response ourselves so the client extension results are available
+	parsed, err := protocol.ParseCredentialCreationResponse(c.Request)
+	if err != nil {
+		h.logger.Error("Failed to parse registration response", zap.Error(err))
+		writeCeremonyError(c, err)
+		return
+	}
+
+	credential, err := h.webauthn.CreateCredential(user, *session, parsed)
 	if err != nil {
 		h.logger.Error("Failed to finish registration", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to finish registration"})
+		writeCeremonyError(c, err)
+		return
+	}
+
+	if err := h.checkUserVerified(credential); err != nil {
+		h.logger.Warn("Rejected registration without user verification", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "User verification required"})
+		return
+	}
+
+	if err := h.checkAlgorithm(credential); err != nil {
+		h.logger.Warn("Rejected credential algorithm", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Credential algorithm not allowed"})
+		return
+	}
+
+	if err := h.checkAttachment(credential); err != nil {
+		h.logger.Warn("Rejected authenticator attachment", zap.Error(err))
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Authenticator type not allowed"})
 		return
 	}
 
+	if err := h.verifyAttestation(c.Request.Context(), credential, parsed); err != nil {
+		h.logger.Warn("Rejected authenticator attestation", zap.Error(err))
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Authenticator not allowed"})
+		return
+	}
+
+	discoverable := parseCredProps(parsed.ClientExtensionResults)
+	if h.opts.ResidentKey == protocol.ResidentKeyRequirementRequired && discoverable != nil && !*discoverable {
+		h.logger.Warn("Rejected non-discoverable credential")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Discoverable credential required"})
+		return
+	}
+
+	stored := toStoredCredential(credential, h.webauthn.Config.RPID)
+	stored.Attachment = string(credentialAttachment(credential))
+	stored.Discoverable = discoverable
+	stored.LargeBlobSupported = parseLargeBlobSupported(parsed.ClientExtensionResults)
+	if h.opts.EnterpriseAttestation {
+		stored.DeviceSerial = enterpriseDeviceSerial(parsed)
+	}
+
 	// Store the credential
-	if err := storeCredential(user, credential); err != nil {
+	if err := storeCredential(user, stored); err != nil {
 		h.logger.Error("Failed to store credential", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store credential"})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to store credential"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Registration successful"})
+	// Keep the attestation only once the credential exists, so a failed
+	// registration leaves no orphaned attestation. The credential is usable
+	// without it; a missing attestation is only an audit gap.
+	if err := h.keepAttestation(c.Request.Context(), user, stored, parsed); err != nil {
+		h.logger.Error("Failed to store attestation",
+			zap.Error(err),
+			zap.String("credential_id", stored.ID))
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "Registration successful"})
 }
 
 // BeginLogin starts the WebAuthn authentication process
 func (h *Handler) BeginLogin(c *gin.Context) {
 	user := getUserFromContext(c)
 
-	options, session, err := h.webauthn.BeginLogin(user)
+	options, session, err := h.webauthn.BeginLogin(user, h.loginOptions()...)
 	if err != nil {
 		h.logger.Error("Failed to begin login", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin login"})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to begin login"})
 		return
 	}
 
-	// Store the session data
-	storeSessionData(c, session)
+	// Store the session data under a new ceremony
+	if !h.startCeremony(c, session) {
+		return
+	}
 
 	c.JSON(http.StatusOK, options)
 }
 
 // FinishLogin completes the WebAuthn authentication process
 func (h *Handler) FinishLogin(c *gin.Context) {
+	if !h.limitBody(c) {
+		return
+	}
+
 	user := getUserFromContext(c)
-	session := getSessionData(c)
+	session, ok := h.ceremonySession(c)
+	if !ok {
+		return
+	}
 
-	credential, err := h.webauthn.FinishLogin(user, session, c.Request)
+	parsed, err := protocol.ParseCredentialRequestResponse(c.Request)
 	if err != nil {
-		h.logger.Error("Failed to finish login", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to finish login"})
+		h.logger.Error("Failed to parse login response", zap.Error(err))
+		writeCeremonyError(c, err)
 		return
 	}
 
-	// Verify the credential
-	if err := verifyCredential(user, credential); err != nil {
-		h.logger.Error("Failed to verify credential", zap.Error(err))
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credential"})
+	token, err := h.finishLogin(c.Request.Context(), user, session, parsed)
+	switch {
+	case errors.Is(err, ErrInvalidAssertion):
+		writeCeremonyError(c, err)
+		return
+	case errors.Is(err, ErrUserVerificationRequired):
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User verification required"})
+		return
+	case errors.Is(err, ErrInvalidCredential):
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid credential"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate session token"})
 		return
 	}
 
-	// Generate session token
-	token, err := generateSessionToken(user)
+	c.JSON(http.StatusOK, LoginResponse{
+		Token: token,
+		User:  user,
+	})
+}
+
+// limitBody reads the request body up to the configured limit and replaces
+// it with the buffered copy, so the library never reads an unbounded body.
+// It writes the error response and returns false if the body can't be read.
+func (h *Handler) limitBody(c *gin.Context) bool {
+	limit := h.opts.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
 	if err != nil {
-		h.logger.Error("Failed to generate session token", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate session token"})
-		return
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.logger.Warn("Rejected oversized request body", zap.Int64("limit", limit))
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: "Request body too large"})
+			return false
+		}
+		h.logger.Error("Failed to read request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+		return false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
-	})
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return true
+}
+
+// registrationOptions builds the options applied to every registration ceremony
+func (h *Handler) registrationOptions() []webauthn.RegistrationOption {
+	opts := []webauthn.RegistrationOption{
+		webauthn.WithExtensions(registrationExtensions(h.opts.LargeBlob, h.opts.LegacyAppID)),
+	}
+
+	switch {
+	case h.opts.Attestation == AttestationNone:
+		opts = append(opts, webauthn.WithConveyancePreference(protocol.PreferNoAttestation))
+	case h.opts.EnterpriseAttestation:
+		opts = append(opts, webauthn.WithConveyancePreference(protocol.PreferEnterpriseAttestation))
+	}
+
+	if len(h.opts.AllowedAlgorithms) > 0 {
+		params := make([]protocol.CredentialParameter, 0, len(h.opts.AllowedAlgorithms))
+		for _, alg := range h.opts.AllowedAlgorithms {
+			params = append(params, protocol.CredentialParameter{
+				Type:      protocol.PublicKeyCredentialType,
+				Algorithm: alg,
+			})
+		}
+		opts = append(opts, webauthn.WithCredentialParameters(params))
+	}
+
+	if h.opts.UserVerification != "" || h.opts.ResidentKey != "" || h.opts.AuthenticatorAttachment != "" {
+		selection := protocol.AuthenticatorSelection{
+			AuthenticatorAttachment: h.opts.AuthenticatorAttachment,
+			UserVerification:        h.opts.UserVerification,
+			ResidentKey:             h.opts.ResidentKey,
+		}
+		if h.opts.ResidentKey == protocol.ResidentKeyRequirementRequired {
+			// Level 1 clients only understand requireResidentKey
+			selection.RequireResidentKey = protocol.ResidentKeyRequired()
+		}
+		opts = append(opts, webauthn.WithAuthenticatorSelection(selection))
+	}
+
+	return opts
+}
+
+// loginOptions builds the options applied to every login ceremony
+func (h *Handler) loginOptions() []webauthn.LoginOption {
+	var opts []webauthn.LoginOption
+
+	if h.opts.UserVerification != "" {
+		opts = append(opts, webauthn.WithUserVerification(h.opts.UserVerification))
+	}
+
+	if h.opts.LegacyAppID != "" {
+		// The library verifies assertions against the app ID hash when the
+		// session carries the extension
+		opts = append(opts, webauthn.WithAppIdExtension(h.opts.LegacyAppID))
+	}
+
+	return opts
+}
+
+// checkUserVerified rejects credentials that didn't perform user
+// verification when it is required
+func (h *Handler) checkUserVerified(credential *webauthn.Credential) error {
+	if h.opts.UserVerification != protocol.VerificationRequired {
+		return nil
+	}
+	if !credential.Flags.UserVerified {
+		return errors.New("authenticator did not verify the user")
+	}
+	return nil
+}
+
+// checkAlgorithm rejects credentials whose public key uses an algorithm
+// outside AllowedAlgorithms
+func (h *Handler) checkAlgorithm(credential *webauthn.Credential) error {
+	if len(h.opts.AllowedAlgorithms) == 0 {
+		return nil
+	}
+
+	var key webauthncose.PublicKeyData
+	if err := webauthncbor.Unmarshal(credential.PublicKey, &key); err != nil {
+		return fmt.Errorf("failed to parse credential public key: %w", err)
+	}
+
+	alg := webauthncose.COSEAlgorithmIdentifier(key.Algorithm)
+	for _, allowed := range h.opts.AllowedAlgorithms {
+		if alg == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("algorithm %d is not allowed", alg)
+}
+
+// attestationChain returns the DER certificates of the attestation
+// statement's x5c chain, leaf first
+func attestationChain(parsed *protocol.ParsedCredentialCreationData) [][]byte {
+	x5c, ok := parsed.Response.AttestationObject.AttStatement["x5c"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	chain := make([][]byte, 0, len(x5c))
+	for _, cert := range x5c {
+		if der, ok := cert.([]byte); ok {
+			chain = append(chain, der)
+		}
+	}
+	return chain
+}
+
+// toStoredCredential converts a library credential into its storage form
+func toStoredCredential(credential *webauthn.Credential, rpID string) *storage.Credential {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return &storage.Credential{
+		ID:              base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		RPID:            rpID,
+		Attachment:      string(credential.Authenticator.Attachment),
+		Transports:      transports,
+		CreatedAt:       time.Now(),
+	}
 }
 
 // Helper functions (to be implemented based on your storage and auth system)
-func getUserFromContext(c *gin.Context) interface{} {
+func getUserFromContext(c *gin.Context) webauthn.User {
 	// TODO: Implement user retrieval from context
 	return nil
 }
 
-func storeSessionData(c *gin.Context, session *webauthn.SessionData) {
-	// TODO: Implement session storage
+func getUserByID(ctx context.Context, userID string) (webauthn.User, error) {
+	// TODO: Implement user lookup by ID
+	return nil, nil
 }
 
-func getSessionData(c *gin.Context) *webauthn.SessionData {
-	// TODO: Implement session retrieval
+func storeCredential(user webauthn.User, credential *storage.Credential) error {
+	// TODO: Implement credential storage
 	return nil
 }
 
-func storeCredential(user interface{}, credential *webauthn.Credential) error {
-	// TODO: Implement credential storage
+func getStoredCredentials(user webauthn.User) ([]*storage.Credential, error) {
+	// TODO: Implement credential retrieval
+	return nil, nil
+}
+
+func rebindCredential(user interface{}, credential *webauthn.Credential, rpID string) error {
+	// TODO: Update the stored credential's RP ID
 	return nil
 }
 
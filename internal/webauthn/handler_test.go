@@ -0,0 +1,361 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// coseKey returns a CBOR-encoded COSE public key for alg
+func coseKey(t *testing.T, alg webauthncose.COSEAlgorithmIdentifier) []byte {
+	t.Helper()
+
+	var key interface{}
+	switch alg {
+	case webauthncose.AlgES256:
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		key = webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(alg)},
+			Curve:         1, // P-256
+			XCoord:        private.X.FillBytes(make([]byte, 32)),
+			YCoord:        private.Y.FillBytes(make([]byte, 32)),
+		}
+	case webauthncose.AlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		key = webauthncose.RSAPublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.RSAKey), Algorithm: int64(alg)},
+			Modulus:       private.N.Bytes(),
+			Exponent:      big.NewInt(int64(private.E)).Bytes(),
+		}
+	case webauthncose.AlgEdDSA:
+		public, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		key = webauthncose.OKPPublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.OctetKey), Algorithm: int64(alg)},
+			Curve:         6, // Ed25519
+			XCoord:        public,
+		}
+	default:
+		t.Fatalf("no fixture key for algorithm %d", alg)
+	}
+
+	data, err := webauthncbor.Marshal(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return data
+}
+
+func TestRegistrationAlgorithms(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []webauthncose.COSEAlgorithmIdentifier
+		want    []protocol.CredentialParameter
+	}{
+		{name: "library defaults", want: nil},
+		{
+			name:    "restricted set",
+			allowed: []webauthncose.COSEAlgorithmIdentifier{webauthncose.AlgES256, webauthncose.AlgEdDSA},
+			want: []protocol.CredentialParameter{
+				{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgES256},
+				{Type: protocol.PublicKeyCredentialType, Algorithm: webauthncose.AlgEdDSA},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := creationOptions(&Handler{opts: Options{AllowedAlgorithms: tt.allowed}})
+			if !reflect.DeepEqual(options.Parameters, tt.want) {
+				t.Errorf("credential parameters = %+v, want %+v", options.Parameters, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAlgorithm(t *testing.T) {
+	restricted := []webauthncose.COSEAlgorithmIdentifier{webauthncose.AlgES256, webauthncose.AlgEdDSA}
+
+	tests := []struct {
+		name    string
+		allowed []webauthncose.COSEAlgorithmIdentifier
+		key     []byte
+		wantErr bool
+	}{
+		{name: "unrestricted", key: coseKey(t, webauthncose.AlgRS256)},
+		{name: "allowed ES256", allowed: restricted, key: coseKey(t, webauthncose.AlgES256)},
+		{name: "allowed EdDSA", allowed: restricted, key: coseKey(t, webauthncose.AlgEdDSA)},
+		{name: "off-list RS256", allowed: restricted, key: coseKey(t, webauthncose.AlgRS256), wantErr: true},
+		{name: "unparseable key", allowed: restricted, key: []byte("not cbor"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{opts: Options{AllowedAlgorithms: tt.allowed}}
+			err := h.checkAlgorithm(&webauthn.Credential{PublicKey: tt.key})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAlgorithm() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserVerificationRequirement(t *testing.T) {
+	tests := []struct {
+		name         string
+		setting      protocol.UserVerificationRequirement
+		userVerified bool
+		wantErr      bool
+	}{
+		{name: "unset without UV"},
+		{name: "preferred with UV", setting: protocol.VerificationPreferred, userVerified: true},
+		{name: "preferred without UV", setting: protocol.VerificationPreferred},
+		{name: "discouraged without UV", setting: protocol.VerificationDiscouraged},
+		{name: "required with UV", setting: protocol.VerificationRequired, userVerified: true},
+		{name: "required without UV", setting: protocol.VerificationRequired, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{UserVerification: tt.setting})
+			authenticator := newTestAuthenticator(t)
+			user := &testUser{id: []byte("user-1")}
+
+			session, ceremonyID := beginRegistration(t, h, user)
+			if tt.setting != "" && session.UserVerification != tt.setting {
+				t.Errorf("registration requested UV %q, want %q", session.UserVerification, tt.setting)
+			}
+			body := authenticator.register(t, session, testRPID, testOrigin, tt.userVerified)
+			w := postCeremony(func(c *gin.Context) { h.finishRegistration(c, user) }, ceremonyID, body)
+			if (w.Code != http.StatusOK) != tt.wantErr {
+				t.Errorf("registration status = %d, want error %v", w.Code, tt.wantErr)
+			}
+
+			user.credentials = []webauthn.Credential{authenticator.credential(t)}
+			session = beginLogin(t, h, user)
+			if tt.setting != "" && session.UserVerification != tt.setting {
+				t.Errorf("login requested UV %q, want %q", session.UserVerification, tt.setting)
+			}
+			parsed := authenticator.assert(t, session, testRPID, testOrigin, tt.userVerified)
+			if _, err := h.finishLogin(context.Background(), user, session, parsed); (err != nil) != tt.wantErr {
+				t.Errorf("finishLogin() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckUserVerified(t *testing.T) {
+	settings := []protocol.UserVerificationRequirement{
+		"", protocol.VerificationDiscouraged, protocol.VerificationPreferred, protocol.VerificationRequired,
+	}
+
+	for _, setting := range settings {
+		for _, verified := range []bool{false, true} {
+			h := &Handler{opts: Options{UserVerification: setting}}
+			credential := &webauthn.Credential{Flags: webauthn.CredentialFlags{UserVerified: verified}}
+
+			wantErr := setting == protocol.VerificationRequired && !verified
+			if err := h.checkUserVerified(credential); (err != nil) != wantErr {
+				t.Errorf("checkUserVerified() with %q and UV %v = %v, want error %v", setting, verified, err, wantErr)
+			}
+		}
+	}
+}
+
+func TestFinishBodyLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int64
+		size       int
+		wantStatus int
+	}{
+		{name: "default limit exceeded", size: DefaultMaxBodyBytes + 1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "at the default limit", size: DefaultMaxBodyBytes, wantStatus: http.StatusBadRequest},
+		{name: "custom limit exceeded", limit: 1 << 10, size: 1<<10 + 1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "at the custom limit", limit: 1 << 10, size: 1 << 10, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		h := newTestHandler(t, Options{MaxBodyBytes: tt.limit})
+		body := bytes.Repeat([]byte("a"), tt.size)
+
+		// Bodies within the limit go on to fail the missing ceremony check
+		for name, handler := range map[string]gin.HandlerFunc{"registration": h.FinishRegistration, "login": h.FinishLogin} {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				if w := postCeremony(handler, "", body); w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+			})
+		}
+	}
+}
+
+func TestFinishRegistrationBodyLimit(t *testing.T) {
+	probe := newTestHandler(t, Options{})
+	user := &testUser{id: []byte("user-1")}
+	session, _ := beginRegistration(t, probe, user)
+	size := int64(len(newTestAuthenticator(t).register(t, session, testRPID, testOrigin, false)))
+
+	tests := []struct {
+		name       string
+		limit      int64
+		wantStatus int
+	}{
+		{name: "fits", limit: size, wantStatus: http.StatusOK},
+		{name: "one byte over", limit: size - 1, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{MaxBodyBytes: tt.limit})
+			session, ceremonyID := beginRegistration(t, h, user)
+			body := newTestAuthenticator(t).register(t, session, testRPID, testOrigin, false)
+
+			w := postCeremony(func(c *gin.Context) { h.finishRegistration(c, user) }, ceremonyID, body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	ceremonies := storage.NewMemoryStore(0)
+	t.Cleanup(ceremonies.Close)
+	migrationEnds := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "minimal", opts: Options{Ceremonies: ceremonies}},
+		{
+			name: "fully configured",
+			opts: Options{
+				Ceremonies:              ceremonies,
+				LegacyRPID:              testLegacyRPID,
+				MigrationEnds:           migrationEnds,
+				LegacyAppID:             "https://example.com/u2f-app-id.json",
+				UserVerification:        protocol.VerificationRequired,
+				ResidentKey:             protocol.ResidentKeyRequirementPreferred,
+				AuthenticatorAttachment: protocol.Platform,
+				MaxBodyBytes:            64 << 10,
+				MinChallengeBytes:       32,
+				CeremonyTTL:             time.Minute,
+			},
+		},
+		{name: "legacy RP ID without a migration end", opts: Options{Ceremonies: ceremonies, LegacyRPID: testLegacyRPID}, wantErr: true},
+		{name: "legacy app ID over http", opts: Options{Ceremonies: ceremonies, LegacyAppID: "http://example.com/u2f-app-id.json"}, wantErr: true},
+		{name: "legacy app ID without a host", opts: Options{Ceremonies: ceremonies, LegacyAppID: "https:///u2f-app-id.json"}, wantErr: true},
+		{name: "unknown user verification", opts: Options{Ceremonies: ceremonies, UserVerification: "always"}, wantErr: true},
+		{name: "unknown resident key requirement", opts: Options{Ceremonies: ceremonies, ResidentKey: "always"}, wantErr: true},
+		{name: "unknown authenticator attachment", opts: Options{Ceremonies: ceremonies, AuthenticatorAttachment: "usb"}, wantErr: true},
+		{name: "negative max body bytes", opts: Options{Ceremonies: ceremonies, MaxBodyBytes: -1}, wantErr: true},
+		{name: "negative min challenge bytes", opts: Options{Ceremonies: ceremonies, MinChallengeBytes: -1}, wantErr: true},
+		{name: "negative ceremony TTL", opts: Options{Ceremonies: ceremonies, CeremonyTTL: -time.Minute}, wantErr: true},
+		{name: "keeping attestations", opts: Options{Ceremonies: ceremonies, Attestations: newAttestationStore(), AttestationCipher: testSealer{}, Scopes: staticScopes(true)}},
+		{name: "keeping attestations without a cipher", opts: Options{Ceremonies: ceremonies, Attestations: newAttestationStore(), Scopes: staticScopes(true)}, wantErr: true},
+		{name: "keeping attestations without a scope checker", opts: Options{Ceremonies: ceremonies, Attestations: newAttestationStore(), AttestationCipher: testSealer{}}, wantErr: true},
+		{name: "keeping none attestations", opts: Options{Ceremonies: ceremonies, Attestation: AttestationNone, Attestations: newAttestationStore(), AttestationCipher: testSealer{}, Scopes: staticScopes(true)}, wantErr: true},
+		{name: "no ceremony store", opts: Options{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// withCredProps adds a credProps client extension output to a registration
+// response body. A nil rk leaves the output out, as clients without
+// credProps support do.
+func withCredProps(t *testing.T, body []byte, rk *bool) []byte {
+	t.Helper()
+	if rk == nil {
+		return body
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("decode registration: %v", err)
+	}
+	response["clientExtensionResults"] = map[string]interface{}{
+		"credProps": map[string]bool{"rk": *rk},
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("encode registration: %v", err)
+	}
+	return body
+}
+
+func TestResidentKeyRequirement(t *testing.T) {
+	discoverable, notDiscoverable := true, false
+
+	tests := []struct {
+		name        string
+		setting     protocol.ResidentKeyRequirement
+		rk          *bool
+		wantRequire bool
+		wantStatus  int
+	}{
+		{name: "unset", rk: &notDiscoverable, wantStatus: http.StatusOK},
+		{name: "discouraged", setting: protocol.ResidentKeyRequirementDiscouraged, rk: &discoverable, wantStatus: http.StatusOK},
+		{name: "preferred without a discoverable credential", setting: protocol.ResidentKeyRequirementPreferred, rk: &notDiscoverable, wantStatus: http.StatusOK},
+		{name: "required with a discoverable credential", setting: protocol.ResidentKeyRequirementRequired, rk: &discoverable, wantRequire: true, wantStatus: http.StatusOK},
+		{name: "required without credProps", setting: protocol.ResidentKeyRequirementRequired, wantRequire: true, wantStatus: http.StatusOK},
+		{name: "required without a discoverable credential", setting: protocol.ResidentKeyRequirementRequired, rk: &notDiscoverable, wantRequire: true, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{ResidentKey: tt.setting})
+
+			selection := creationOptions(h).AuthenticatorSelection
+			if selection.ResidentKey != tt.setting {
+				t.Errorf("requested resident key %q, want %q", selection.ResidentKey, tt.setting)
+			}
+			if got := selection.RequireResidentKey != nil && *selection.RequireResidentKey; got != tt.wantRequire {
+				t.Errorf("requireResidentKey = %v, want %v", got, tt.wantRequire)
+			}
+
+			user := &testUser{id: []byte("user-1")}
+			session, ceremonyID := beginRegistration(t, h, user)
+			body := withCredProps(t, newTestAuthenticator(t).register(t, session, testRPID, testOrigin, false), tt.rk)
+
+			w := postCeremony(func(c *gin.Context) { h.finishRegistration(c, user) }, ceremonyID, body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package webauthn
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// CredentialHints tells clients which kinds of credentials a user has, so
+// they can choose between platform, security key, and passkey autofill UX
+type CredentialHints struct {
+	HasPlatform      bool `json:"has_platform"`
+	HasCrossPlatform bool `json:"has_cross_platform"`
+	HasDiscoverable  bool `json:"has_discoverable"`
+}
+
+// GetCredentialHints returns credential hints for the current user
+func (h *Handler) GetCredentialHints(c *gin.Context) {
+	user := getUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Authentication required"})
+		return
+	}
+
+	credentials, err := getStoredCredentials(user)
+	if err != nil {
+		h.logger.Error("Failed to get credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get credential hints"})
+		return
+	}
+
+	c.JSON(http.StatusOK, credentialHints(credentials))
+}
+
+// credentialHints derives hints from stored credential metadata. When the
+// attachment wasn't reported it is inferred from the transports.
+func credentialHints(credentials []*storage.Credential) CredentialHints {
+	var hints CredentialHints
+	for _, credential := range credentials {
+		switch attachmentOf(credential) {
+		case "platform":
+			hints.HasPlatform = true
+		case "cross-platform":
+			hints.HasCrossPlatform = true
+		}
+		if credential.Discoverable != nil && *credential.Discoverable {
+			hints.HasDiscoverable = true
+		}
+	}
+	return hints
+}
+
+func attachmentOf(credential *storage.Credential) string {
+	if credential.Attachment != "" {
+		return credential.Attachment
+	}
+	for _, transport := range credential.Transports {
+		switch transport {
+		case "internal":
+			return "platform"
+		case "usb", "nfc", "ble", "hybrid":
+			return "cross-platform"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package webauthn
+
+import (
+	"testing"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+func TestCredentialHints(t *testing.T) {
+	yes, no := true, false
+	platform := &storage.Credential{Attachment: "platform"}
+	securityKey := &storage.Credential{Attachment: "cross-platform"}
+	passkey := &storage.Credential{Attachment: "platform", Discoverable: &yes}
+
+	tests := []struct {
+		name        string
+		credentials []*storage.Credential
+		want        CredentialHints
+	}{
+		{name: "no credentials"},
+		{name: "platform only", credentials: []*storage.Credential{platform}, want: CredentialHints{HasPlatform: true}},
+		{name: "security key only", credentials: []*storage.Credential{securityKey}, want: CredentialHints{HasCrossPlatform: true}},
+		{name: "passkey", credentials: []*storage.Credential{passkey}, want: CredentialHints{HasPlatform: true, HasDiscoverable: true}},
+		{
+			name:        "mixed",
+			credentials: []*storage.Credential{securityKey, passkey},
+			want:        CredentialHints{HasPlatform: true, HasCrossPlatform: true, HasDiscoverable: true},
+		},
+		{
+			name:        "non-discoverable key",
+			credentials: []*storage.Credential{{Attachment: "cross-platform", Discoverable: &no}},
+			want:        CredentialHints{HasCrossPlatform: true},
+		},
+		{
+			name:        "attachment inferred from internal transport",
+			credentials: []*storage.Credential{{Transports: []string{"internal", "hybrid"}}},
+			want:        CredentialHints{HasPlatform: true},
+		},
+		{
+			name:        "attachment inferred from USB transport",
+			credentials: []*storage.Credential{{Transports: []string{"usb", "nfc"}}},
+			want:        CredentialHints{HasCrossPlatform: true},
+		},
+		{
+			name:        "reported attachment wins over transports",
+			credentials: []*storage.Credential{{Attachment: "cross-platform", Transports: []string{"internal"}}},
+			want:        CredentialHints{HasCrossPlatform: true},
+		},
+		{
+			name:        "unknown attachment",
+			credentials: []*storage.Credential{{Transports: []string{"smart-card"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := credentialHints(tt.credentials); got != tt.want {
+				t.Errorf("credentialHints() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+)
+
+// Login errors
+var (
+	ErrInvalidAssertion         = errors.New("invalid assertion")
+	ErrUserVerificationRequired = errors.New("user verification required")
+	ErrInvalidCredential        = errors.New("invalid credential")
+)
+
+// BeginAssertion starts a login ceremony for userID outside of HTTP, e.g.
+// for gRPC clients. It returns the JSON-encoded assertion options and the
+// ceremony ID the client must send back to FinishAssertion.
+func (h *Handler) BeginAssertion(ctx context.Context, userID string) ([]byte, string, error) {
+	user, err := getUserByID(ctx, userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	options, session, err := h.webauthn.BeginLogin(user, h.loginOptions()...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin login: %w", err)
+	}
+
+	ceremonyID, err := h.newCeremony(ctx, session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode assertion options: %w", err)
+	}
+
+	return data, ceremonyID, nil
+}
+
+// FinishAssertion completes a login ceremony started by BeginAssertion.
+// assertion is the JSON-encoded credential the browser returned, as the HTTP
+// FinishLogin endpoint accepts it. It returns a session token.
+func (h *Handler) FinishAssertion(ctx context.Context, userID string, ceremonyID string, assertion []byte) (string, error) {
+	user, err := getUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	session, err := h.takeCeremony(ctx, ceremonyID)
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(assertion))
+	if err != nil {
+		h.logger.Error("Failed to parse login response", zap.Error(err))
+		return "", &assertionError{kind: ErrInvalidAssertion, err: err}
+	}
+
+	return h.finishLogin(ctx, user, session, parsed)
+}
+
+// finishLogin verifies a parsed assertion against the ceremony session and
+// issues a session token. It is shared by the HTTP and gRPC login flows.
+func (h *Handler) finishLogin(ctx context.Context, user webauthn.User, session *webauthn.SessionData, parsed *protocol.ParsedCredentialAssertionData) (string, error) {
+	// During an RP ID migration, assertions for the old RP ID are verified
+	// against the old RP configuration
+	verifier := h.webauthn
+	legacy := h.migration.matches(parsed)
+	if legacy {
+		verifier = h.migration.webauthn
+	}
+
+	credential, err := verifier.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		h.logger.Error("Failed to finish login", zap.Error(err))
+		return "", &assertionError{kind: ErrInvalidAssertion, err: err}
+	}
+
+	if err := h.checkUserVerified(credential); err != nil {
+		h.logger.Warn("Rejected login without user verification", zap.Error(err))
+		return "", ErrUserVerificationRequired
+	}
+
+	if legacy {
+		if err := rebindCredential(user, credential, h.webauthn.Config.RPID); err != nil {
+			// The login is still valid; the credential is re-bound on its next use
+			h.logger.Error("Failed to re-bind credential RP ID", zap.Error(err))
+		}
+	}
+
+	// Verify the credential
+	if err := verifyCredential(user, credential); err != nil {
+		h.logger.Error("Failed to verify credential", zap.Error(err))
+		return "", fmt.Errorf("%w: %v", ErrInvalidCredential, err)
+	}
+
+	// Generate session token
+	token, err := generateSessionToken(user)
+	if err != nil {
+		h.logger.Error("Failed to generate session token", zap.Error(err))
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	h.publishCredentialUsed(ctx, user, credential)
+
+	return token, nil
+}
@@ -0,0 +1,412 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrUnknownAuthenticator is returned in strict mode when an
+	// authenticator's AAGUID has no FIDO metadata entry
+	ErrUnknownAuthenticator = errors.New("authenticator not found in metadata")
+	// ErrRevokedAuthenticator is returned when the metadata reports the
+	// authenticator as revoked or compromised
+	ErrRevokedAuthenticator = errors.New("authenticator is revoked")
+	// ErrUntrustedAttestation is returned when an attestation certificate
+	// chain doesn't lead to the authenticator's metadata trust anchors
+	ErrUntrustedAttestation = errors.New("attestation not trusted")
+)
+
+// revokedStatuses are FIDO status reports that disqualify an authenticator
+var revokedStatuses = map[string]bool{
+	"REVOKED":                      true,
+	"USER_VERIFICATION_BYPASS":     true,
+	"ATTESTATION_KEY_COMPROMISE":   true,
+	"USER_KEY_REMOTE_COMPROMISE":   true,
+	"USER_KEY_PHYSICAL_COMPROMISE": true,
+}
+
+// MetadataEntry holds the trust information for a single authenticator model
+type MetadataEntry struct {
+	AAGUID           string
+	Description      string
+	RootCertificates []*x509.Certificate
+	Revoked          bool
+
+	// generation is the load the entry came from, so trust anchors parsed
+	// from it aren't cached over those of a newer load
+	generation uint64
+}
+
+// MetadataStore caches the FIDO Metadata Service (MDS) blob and validates
+// attestation certificate chains against its trust anchors
+type MetadataStore struct {
+	logger  *zap.Logger
+	url     string
+	root    *x509.Certificate
+	client  *http.Client
+	refresh time.Duration
+
+	mu         sync.RWMutex
+	entries    map[string]*MetadataEntry
+	fetchedAt  time.Time
+	generation uint64
+
+	// refreshes coalesces concurrent refreshes of a stale blob
+	refreshes singleflight.Group
+
+	// anchors caches parsed trust anchors by AAGUID when enabled
+	anchors *anchorCache
+}
+
+// NewMetadataStore creates a metadata store that downloads the MDS blob from
+// url, verifies it against the FIDO root certificate, and refreshes it once
+// it is older than refresh
+func NewMetadataStore(logger *zap.Logger, url string, root *x509.Certificate, refresh time.Duration) *MetadataStore {
+	return &MetadataStore{
+		logger:  logger,
+		url:     url,
+		root:    root,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		refresh: refresh,
+		entries: make(map[string]*MetadataEntry),
+	}
+}
+
+// EnableCache caches the parsed trust anchors of up to size authenticator
+// models, so repeated registrations with the same AAGUID don't rebuild them.
+// Call it before the store is used.
+func (m *MetadataStore) EnableCache(size int) {
+	if size > 0 {
+		m.anchors = newAnchorCache(size)
+	}
+}
+
+// CacheStats returns trust anchor cache statistics. It is zero when the
+// cache is disabled.
+func (m *MetadataStore) CacheStats() CacheStats {
+	if m.anchors == nil {
+		return CacheStats{}
+	}
+	return m.anchors.stats()
+}
+
+// Refresh downloads and loads the latest MDS blob
+func (m *MetadataStore) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create metadata request: %w", err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download metadata: status %d", resp.StatusCode)
+	}
+
+	blob, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	return m.Load(blob)
+}
+
+// Load verifies and loads an MDS blob (a JWT signed by the FIDO root)
+func (m *MetadataStore) Load(blob []byte) error {
+	payload, err := m.verifyBlob(strings.TrimSpace(string(blob)))
+	if err != nil {
+		return err
+	}
+
+	var parsed struct {
+		Entries []struct {
+			AAGUID            string `json:"aaguid"`
+			MetadataStatement struct {
+				Description                 string   `json:"description"`
+				AttestationRootCertificates []string `json:"attestationRootCertificates"`
+			} `json:"metadataStatement"`
+			StatusReports []struct {
+				Status string `json:"status"`
+			} `json:"statusReports"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return fmt.Errorf("failed to parse metadata: %w", err)
+	}
+
+	m.mu.Lock()
+	m.generation++
+	generation := m.generation
+	m.mu.Unlock()
+
+	entries := make(map[string]*MetadataEntry, len(parsed.Entries))
+	for _, e := range parsed.Entries {
+		// Entries without an AAGUID describe U2F/UAF authenticators
+		if e.AAGUID == "" {
+			continue
+		}
+
+		entry := &MetadataEntry{
+			AAGUID:      strings.ToLower(e.AAGUID),
+			Description: e.MetadataStatement.Description,
+			generation:  generation,
+		}
+		for _, encoded := range e.MetadataStatement.AttestationRootCertificates {
+			der, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				continue
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				continue
+			}
+			entry.RootCertificates = append(entry.RootCertificates, cert)
+		}
+		for _, report := range e.StatusReports {
+			if revokedStatuses[report.Status] {
+				entry.Revoked = true
+			}
+		}
+		entries[entry.AAGUID] = entry
+	}
+
+	m.mu.Lock()
+	if generation < m.generation {
+		// A concurrent load started later; keep its entries
+		m.mu.Unlock()
+		return nil
+	}
+	m.entries = entries
+	m.fetchedAt = time.Now()
+	m.mu.Unlock()
+
+	if m.anchors != nil {
+		m.anchors.advance(generation)
+	}
+
+	return nil
+}
+
+// Lookup returns the metadata entry for an AAGUID, refreshing the cached blob
+// first if it is stale. Concurrent lookups share one refresh. A stale cache is
+// still used if the refresh fails.
+func (m *MetadataStore) Lookup(ctx context.Context, aaguid []byte) (*MetadataEntry, bool) {
+	if m.url != "" && m.stale() {
+		_, err, _ := m.refreshes.Do("metadata", func() (interface{}, error) {
+			// A refresh may have finished since this lookup found the
+			// blob stale
+			if !m.stale() {
+				return nil, nil
+			}
+			return nil, m.Refresh(ctx)
+		})
+		if err != nil {
+			m.logger.Warn("Failed to refresh FIDO metadata", zap.Error(err))
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.entries[formatAAGUID(aaguid)]
+	return entry, ok
+}
+
+// stale reports whether the cached blob is due for a refresh
+func (m *MetadataStore) stale() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return time.Since(m.fetchedAt) > m.refresh
+}
+
+// VerifyAttestation checks an authenticator against the metadata. Revoked
+// authenticators are always rejected. When an attestation chain is present it
+// must lead to one of the entry's root certificates. In strict mode unknown
+// authenticators and attestations without a certificate chain are rejected.
+func (m *MetadataStore) VerifyAttestation(ctx context.Context, aaguid []byte, x5c [][]byte, strict bool) error {
+	entry, ok := m.Lookup(ctx, aaguid)
+	if !ok {
+		if strict {
+			return ErrUnknownAuthenticator
+		}
+		return nil
+	}
+
+	if entry.Revoked {
+		return ErrRevokedAuthenticator
+	}
+
+	if len(x5c) == 0 {
+		if strict {
+			return ErrUntrustedAttestation
+		}
+		return nil
+	}
+
+	if err := verifyChainPool(x5c, m.trustAnchors(entry).roots); err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedAttestation, err)
+	}
+
+	return nil
+}
+
+// trustAnchors returns the parsed trust anchors for an entry, from the cache
+// when enabled
+func (m *MetadataStore) trustAnchors(entry *MetadataEntry) *trustAnchors {
+	if m.anchors != nil {
+		if anchors, ok := m.anchors.get(entry.generation, entry.AAGUID); ok {
+			return anchors
+		}
+	}
+
+	anchors := &trustAnchors{roots: certPool(entry.RootCertificates)}
+	if m.anchors != nil {
+		m.anchors.add(entry.generation, entry.AAGUID, anchors)
+	}
+	return anchors
+}
+
+// verifyBlob verifies the MDS JWT signature and certificate chain and
+// returns its payload
+func (m *MetadataStore) verifyBlob(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed metadata blob")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed metadata header: %w", err)
+	}
+	var header struct {
+		Alg string   `json:"alg"`
+		X5C []string `json:"x5c"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("malformed metadata header: %w", err)
+	}
+
+	chain := make([][]byte, 0, len(header.X5C))
+	for _, encoded := range header.X5C {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("malformed metadata certificate: %w", err)
+		}
+		chain = append(chain, der)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("metadata blob has no certificate chain")
+	}
+	if err := verifyChain(chain, []*x509.Certificate{m.root}); err != nil {
+		return nil, fmt.Errorf("untrusted metadata blob: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed metadata certificate: %w", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed metadata signature: %w", err)
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch header.Alg {
+	case "RS256":
+		algorithm = x509.SHA256WithRSA
+	case "ES256":
+		algorithm = x509.ECDSAWithSHA256
+		// JWS encodes ECDSA signatures as r||s; x509 expects ASN.1
+		if sig, err = jwsToASN1(sig); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported metadata signature algorithm %q", header.Alg)
+	}
+
+	if err := leaf.CheckSignature(algorithm, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf("invalid metadata signature: %w", err)
+	}
+
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
+
+// verifyChain verifies that the DER certificate chain (leaf first) leads to
+// one of the roots
+func verifyChain(chain [][]byte, roots []*x509.Certificate) error {
+	return verifyChainPool(chain, certPool(roots))
+}
+
+// verifyChainPool verifies that the DER certificate chain (leaf first) leads
+// to a certificate in rootPool
+func verifyChainPool(chain [][]byte, rootPool *x509.CertPool) error {
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, der := range chain[1:] {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		intermediates.AddCert(cert)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+func certPool(certs []*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool
+}
+
+func jwsToASN1(sig []byte) ([]byte, error) {
+	if len(sig) != 64 {
+		return nil, errors.New("malformed ES256 signature")
+	}
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(sig[:32]),
+		S: new(big.Int).SetBytes(sig[32:]),
+	})
+}
+
+// formatAAGUID formats a 16-byte AAGUID in canonical UUID form
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return hex.EncodeToString(aaguid)
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,238 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	trustedAAGUID = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	revokedAAGUID = []byte{0xaa, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	unknownAAGUID = []byte{0xff, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+)
+
+// testCA is a certificate authority issuing fixture certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, cert := newTestCert(t, name, nil, true)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a leaf certificate signed by the CA and its key
+func (ca *testCA) issue(t *testing.T, name string) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	return newTestCert(t, name, ca, false)
+}
+
+func newTestCert(t *testing.T, name string, parent *testCA, isCA bool) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("generate serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return key, cert
+}
+
+// signMetadataBlob returns an ES256 MDS JWT over payload signed by a leaf
+// of root
+func signMetadataBlob(t *testing.T, root *testCA, payload interface{}) []byte {
+	t.Helper()
+	key, cert := root.issue(t, "metadata signer")
+
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": "ES256",
+		"x5c": []string{base64.StdEncoding.EncodeToString(cert.Raw)},
+	})
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("sign blob: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return []byte(signed + "." + base64.RawURLEncoding.EncodeToString(sig))
+}
+
+// metadataFixture returns a blob listing trustedAAGUID under authenticatorRoot
+// and revokedAAGUID as revoked, signed under fidoRoot
+func metadataFixture(t *testing.T, fidoRoot, authenticatorRoot *testCA) []byte {
+	t.Helper()
+	rootCert := base64.StdEncoding.EncodeToString(authenticatorRoot.cert.Raw)
+	return signMetadataBlob(t, fidoRoot, map[string]interface{}{
+		"entries": []map[string]interface{}{
+			{
+				"aaguid": formatAAGUID(trustedAAGUID),
+				"metadataStatement": map[string]interface{}{
+					"description":                 "Trusted Key",
+					"attestationRootCertificates": []string{rootCert},
+				},
+				"statusReports": []map[string]interface{}{{"status": "FIDO_CERTIFIED"}},
+			},
+			{
+				"aaguid": formatAAGUID(revokedAAGUID),
+				"metadataStatement": map[string]interface{}{
+					"description":                 "Revoked Key",
+					"attestationRootCertificates": []string{rootCert},
+				},
+				"statusReports": []map[string]interface{}{{"status": "FIDO_CERTIFIED"}, {"status": "REVOKED"}},
+			},
+			{
+				"metadataStatement": map[string]interface{}{"description": "U2F key without an AAGUID"},
+			},
+		},
+	})
+}
+
+// newTestMetadataStore returns a store loaded with the fixture blob and the
+// authenticator root its trusted entries chain to
+func newTestMetadataStore(t *testing.T) (*MetadataStore, *testCA) {
+	t.Helper()
+	fidoRoot := newTestCA(t, "FIDO root")
+	authenticatorRoot := newTestCA(t, "authenticator root")
+
+	store := NewMetadataStore(zap.NewNop(), "", fidoRoot.cert, time.Hour)
+	if err := store.Load(metadataFixture(t, fidoRoot, authenticatorRoot)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return store, authenticatorRoot
+}
+
+func TestMetadataLoad(t *testing.T) {
+	fidoRoot := newTestCA(t, "FIDO root")
+	authenticatorRoot := newTestCA(t, "authenticator root")
+	blob := metadataFixture(t, fidoRoot, authenticatorRoot)
+
+	tests := []struct {
+		name    string
+		root    *x509.Certificate
+		blob    []byte
+		wantErr bool
+	}{
+		{name: "signed by the FIDO root", root: fidoRoot.cert, blob: blob},
+		{name: "signed under another root", root: newTestCA(t, "other root").cert, blob: blob, wantErr: true},
+		{name: "tampered payload", root: fidoRoot.cert, blob: tamperPayload(blob, `{"entries":[]}`), wantErr: true},
+		{name: "not a JWT", root: fidoRoot.cert, blob: []byte("garbage"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMetadataStore(zap.NewNop(), "", tt.root, time.Hour)
+			err := store.Load(tt.blob)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			entry, ok := store.Lookup(context.Background(), trustedAAGUID)
+			if !ok || entry.Description != "Trusted Key" || len(entry.RootCertificates) != 1 || entry.Revoked {
+				t.Errorf("Lookup(trusted) = %+v, %v", entry, ok)
+			}
+			if entry, ok := store.Lookup(context.Background(), revokedAAGUID); !ok || !entry.Revoked {
+				t.Errorf("Lookup(revoked) = %+v, %v", entry, ok)
+			}
+			if _, ok := store.Lookup(context.Background(), unknownAAGUID); ok {
+				t.Error("Lookup(unknown) found an entry")
+			}
+		})
+	}
+}
+
+// tamperPayload replaces a blob's payload, keeping its signature
+func tamperPayload(blob []byte, payload string) []byte {
+	parts := strings.SplitN(string(blob), ".", 3)
+	return []byte(parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + parts[2])
+}
+
+func TestMetadataVerifyAttestation(t *testing.T) {
+	store, authenticatorRoot := newTestMetadataStore(t)
+	_, trustedLeaf := authenticatorRoot.issue(t, "attestation")
+	_, untrustedLeaf := newTestCA(t, "rogue root").issue(t, "attestation")
+	trustedChain := [][]byte{trustedLeaf.Raw}
+	untrustedChain := [][]byte{untrustedLeaf.Raw}
+
+	tests := []struct {
+		name    string
+		aaguid  []byte
+		x5c     [][]byte
+		strict  bool
+		wantErr error
+	}{
+		{name: "trusted AAGUID and chain", aaguid: trustedAAGUID, x5c: trustedChain, strict: true},
+		{name: "trusted AAGUID with a foreign chain", aaguid: trustedAAGUID, x5c: untrustedChain, wantErr: ErrUntrustedAttestation},
+		{name: "trusted AAGUID without a chain", aaguid: trustedAAGUID},
+		{name: "trusted AAGUID without a chain, strict", aaguid: trustedAAGUID, strict: true, wantErr: ErrUntrustedAttestation},
+		{name: "revoked AAGUID", aaguid: revokedAAGUID, x5c: trustedChain, wantErr: ErrRevokedAuthenticator},
+		{name: "untrusted AAGUID", aaguid: unknownAAGUID, x5c: untrustedChain},
+		{name: "untrusted AAGUID, strict", aaguid: unknownAAGUID, x5c: untrustedChain, strict: true, wantErr: ErrUnknownAuthenticator},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.VerifyAttestation(context.Background(), tt.aaguid, tt.x5c, tt.strict)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyAttestation() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
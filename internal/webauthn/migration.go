@@ -0,0 +1,55 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// rpMigration accepts assertions made for a previous RP ID until the
+// migration window ends, so a domain change doesn't strand existing
+// credentials. Credentials used during the window are re-bound to the
+// current RP ID in storage.
+type rpMigration struct {
+	rpIDHash []byte
+	ends     time.Time
+	webauthn *webauthn.WebAuthn
+}
+
+// newRPMigration creates a verifier for the legacy RP ID described by opts,
+// or returns nil if no migration is configured
+func newRPMigration(config *webauthn.Config, opts Options) (*rpMigration, error) {
+	if opts.LegacyRPID == "" {
+		return nil, nil
+	}
+
+	legacyConfig := *config
+	legacyConfig.RPID = opts.LegacyRPID
+	if len(opts.LegacyRPOrigins) > 0 {
+		legacyConfig.RPOrigins = opts.LegacyRPOrigins
+	}
+
+	w, err := webauthn.New(&legacyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256([]byte(opts.LegacyRPID))
+	return &rpMigration{
+		rpIDHash: hash[:],
+		ends:     opts.MigrationEnds,
+		webauthn: w,
+	}, nil
+}
+
+// matches reports whether the assertion was made for the legacy RP ID while
+// the migration window is still open
+func (m *rpMigration) matches(parsed *protocol.ParsedCredentialAssertionData) bool {
+	if m == nil || !time.Now().Before(m.ends) {
+		return false
+	}
+	return bytes.Equal(parsed.Response.AuthenticatorData.RPIDHash, m.rpIDHash)
+}
@@ -0,0 +1,191 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+const (
+	testRPID         = "example.com"
+	testOrigin       = "https://example.com"
+	testLegacyRPID   = "old-example.com"
+	testLegacyOrigin = "https://old-example.com"
+)
+
+// testAuthenticator is a software ES256 authenticator holding one credential
+type testAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return &testAuthenticator{key: key, credentialID: []byte("test-credential")}
+}
+
+// credential returns the authenticator's credential as the RP stored it
+func (a *testAuthenticator) credential(t *testing.T) webauthn.Credential {
+	t.Helper()
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1, // P-256
+		XCoord:        a.key.X.FillBytes(make([]byte, 32)),
+		YCoord:        a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	return webauthn.Credential{ID: a.credentialID, PublicKey: publicKey, AttestationType: "none"}
+}
+
+// assert signs an assertion for the session's challenge as rpID at origin
+func (a *testAuthenticator) assert(t *testing.T, session *webauthn.SessionData, rpID, origin string, userVerified bool) *protocol.ParsedCredentialAssertionData {
+	t.Helper()
+
+	clientData, err := json.Marshal(map[string]string{
+		"type":      "webauthn.get",
+		"challenge": session.Challenge,
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatalf("marshal client data: %v", err)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := byte(protocol.FlagUserPresent)
+	if userVerified {
+		flags |= byte(protocol.FlagUserVerified)
+	}
+	a.signCount++
+	authData := append(rpIDHash[:], flags)
+	authData = binary.BigEndian.AppendUint32(authData, a.signCount)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign assertion: %v", err)
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    encode(a.credentialID),
+		"rawId": encode(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(session.UserID),
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal assertion: %v", err)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("ParseCredentialRequestResponseBody: %v", err)
+	}
+	return parsed
+}
+
+// testUser is a webauthn.User with the given credentials
+type testUser struct {
+	id          []byte
+	credentials []webauthn.Credential
+}
+
+func (u *testUser) WebAuthnID() []byte                         { return u.id }
+func (u *testUser) WebAuthnName() string                       { return "a@example.com" }
+func (u *testUser) WebAuthnDisplayName() string                { return "A" }
+func (u *testUser) WebAuthnIcon() string                       { return "" }
+func (u *testUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// newTestHandler creates a handler for testRPID at testOrigin
+func newTestHandler(t *testing.T, opts Options) *Handler {
+	t.Helper()
+	ceremonies := storage.NewMemoryStore(0)
+	t.Cleanup(ceremonies.Close)
+	opts.Ceremonies = ceremonies
+
+	h, err := NewHandler(zap.NewNop(), &webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "PolyID",
+		RPOrigins:     []string{testOrigin},
+	}, opts)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	return h
+}
+
+// beginLogin starts a login for user and returns its session
+func beginLogin(t *testing.T, h *Handler, user webauthn.User) *webauthn.SessionData {
+	t.Helper()
+	_, session, err := h.webauthn.BeginLogin(user, h.loginOptions()...)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	return session
+}
+
+func TestRPMigration(t *testing.T) {
+	tests := []struct {
+		name    string
+		ends    time.Time
+		rpID    string
+		origin  string
+		wantErr error
+	}{
+		{name: "new RP ID during migration", ends: time.Now().Add(time.Hour), rpID: testRPID, origin: testOrigin},
+		{name: "legacy RP ID during migration", ends: time.Now().Add(time.Hour), rpID: testLegacyRPID, origin: testLegacyOrigin},
+		{name: "new RP ID after migration", ends: time.Now().Add(-time.Hour), rpID: testRPID, origin: testOrigin},
+		{name: "legacy RP ID after migration", ends: time.Now().Add(-time.Hour), rpID: testLegacyRPID, origin: testLegacyOrigin, wantErr: ErrInvalidAssertion},
+		{name: "unrelated RP ID", ends: time.Now().Add(time.Hour), rpID: "evil.example", origin: testOrigin, wantErr: ErrInvalidAssertion},
+		{name: "legacy RP ID from the new origin", ends: time.Now().Add(time.Hour), rpID: testLegacyRPID, origin: testOrigin, wantErr: ErrInvalidAssertion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{
+				LegacyRPID:      testLegacyRPID,
+				LegacyRPOrigins: []string{testLegacyOrigin},
+				MigrationEnds:   tt.ends,
+			})
+			authenticator := newTestAuthenticator(t)
+			user := &testUser{id: []byte("user-1"), credentials: []webauthn.Credential{authenticator.credential(t)}}
+
+			session := beginLogin(t, h, user)
+			parsed := authenticator.assert(t, session, tt.rpID, tt.origin, false)
+
+			_, err := h.finishLogin(context.Background(), user, session, parsed)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("finishLogin() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// PublicKeyInfo describes a credential public key without exposing the key
+// material itself
+type PublicKeyInfo struct {
+	Algorithm   string `json:"algorithm"`
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"` // Hex SHA-256 of the COSE key
+}
+
+// CredentialSummary is the audit view of a stored credential
+type CredentialSummary struct {
+	ID              string         `json:"id"`
+	AttestationType string         `json:"attestation_type"`
+	RPID            string         `json:"rp_id"`
+	Attachment      string         `json:"attachment,omitempty"`
+	Transports      []string       `json:"transports,omitempty"`
+	PublicKey       *PublicKeyInfo `json:"public_key,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+}
+
+// ListCredentials returns the current user's credentials with their public
+// key metadata
+func (h *Handler) ListCredentials(c *gin.Context) {
+	user := getUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Authentication required"})
+		return
+	}
+
+	credentials, err := getStoredCredentials(user)
+	if err != nil {
+		h.logger.Error("Failed to get credentials", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to list credentials"})
+		return
+	}
+
+	summaries := make([]CredentialSummary, 0, len(credentials))
+	for _, credential := range credentials {
+		summaries = append(summaries, h.credentialSummary(credential))
+	}
+
+	c.JSON(http.StatusOK, CredentialsResponse{Credentials: summaries})
+}
+
+func (h *Handler) credentialSummary(credential *storage.Credential) CredentialSummary {
+	summary := CredentialSummary{
+		ID:              credential.ID,
+		AttestationType: credential.AttestationType,
+		RPID:            credential.RPID,
+		Attachment:      credential.Attachment,
+		Transports:      credential.Transports,
+		CreatedAt:       credential.CreatedAt,
+	}
+
+	// A key we can't parse is still listed so it can be audited and removed
+	info, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		h.logger.Warn("Failed to parse credential public key",
+			zap.String("credential_id", credential.ID), zap.Error(err))
+	} else {
+		summary.PublicKey = info
+	}
+
+	return summary
+}
+
+// parsePublicKey reads the algorithm and key type of a COSE-encoded public key
+func parsePublicKey(cose []byte) (*PublicKeyInfo, error) {
+	var key webauthncose.PublicKeyData
+	if err := webauthncbor.Unmarshal(cose, &key); err != nil {
+		return nil, fmt.Errorf("failed to decode COSE key: %w", err)
+	}
+
+	sum := sha256.Sum256(cose)
+	return &PublicKeyInfo{
+		Algorithm:   algorithmName(webauthncose.COSEAlgorithmIdentifier(key.Algorithm)),
+		KeyType:     keyTypeName(webauthncose.COSEKeyType(key.KeyType)),
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+func algorithmName(alg webauthncose.COSEAlgorithmIdentifier) string {
+	switch alg {
+	case webauthncose.AlgES256:
+		return "ES256"
+	case webauthncose.AlgES384:
+		return "ES384"
+	case webauthncose.AlgES512:
+		return "ES512"
+	case webauthncose.AlgEdDSA:
+		return "EdDSA"
+	case webauthncose.AlgRS256:
+		return "RS256"
+	case webauthncose.AlgRS384:
+		return "RS384"
+	case webauthncose.AlgRS512:
+		return "RS512"
+	case webauthncose.AlgPS256:
+		return "PS256"
+	case webauthncose.AlgPS384:
+		return "PS384"
+	case webauthncose.AlgPS512:
+		return "PS512"
+	default:
+		return fmt.Sprintf("unknown (%d)", alg)
+	}
+}
+
+func keyTypeName(kty webauthncose.COSEKeyType) string {
+	switch kty {
+	case webauthncose.OctetKey:
+		return "OKP"
+	case webauthncose.EllipticKey:
+		return "EC2"
+	case webauthncose.RSAKey:
+		return "RSA"
+	default:
+		return fmt.Sprintf("unknown (%d)", kty)
+	}
+}
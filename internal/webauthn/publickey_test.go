@@ -0,0 +1,79 @@
+package webauthn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"go.uber.org/zap"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+func TestParsePublicKey(t *testing.T) {
+	unknown, err := webauthncbor.Marshal(webauthncose.PublicKeyData{KeyType: 9, Algorithm: -999})
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      []byte
+		wantAlg  string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "ES256", key: coseKey(t, webauthncose.AlgES256), wantAlg: "ES256", wantType: "EC2"},
+		{name: "RS256", key: coseKey(t, webauthncose.AlgRS256), wantAlg: "RS256", wantType: "RSA"},
+		{name: "EdDSA", key: coseKey(t, webauthncose.AlgEdDSA), wantAlg: "EdDSA", wantType: "OKP"},
+		{name: "unknown algorithm", key: unknown, wantAlg: "unknown (-999)", wantType: "unknown (9)"},
+		{name: "not CBOR", key: []byte("not cbor"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parsePublicKey(tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsePublicKey() = %+v, want error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePublicKey: %v", err)
+			}
+
+			sum := sha256.Sum256(tt.key)
+			want := PublicKeyInfo{Algorithm: tt.wantAlg, KeyType: tt.wantType, Fingerprint: hex.EncodeToString(sum[:])}
+			if *info != want {
+				t.Errorf("parsePublicKey() = %+v, want %+v", *info, want)
+			}
+		})
+	}
+}
+
+func TestCredentialSummary(t *testing.T) {
+	h := &Handler{logger: zap.NewNop()}
+
+	summary := h.credentialSummary(&storage.Credential{
+		ID:         "cred-1",
+		PublicKey:  coseKey(t, webauthncose.AlgES256),
+		RPID:       testRPID,
+		Attachment: "platform",
+		Transports: []string{"internal"},
+	})
+	if summary.ID != "cred-1" || summary.RPID != testRPID || summary.Attachment != "platform" {
+		t.Errorf("credentialSummary() = %+v", summary)
+	}
+	if summary.PublicKey == nil || summary.PublicKey.Algorithm != "ES256" {
+		t.Errorf("credentialSummary() public key = %+v, want ES256", summary.PublicKey)
+	}
+
+	// An unparseable key is still listed, without key metadata
+	summary = h.credentialSummary(&storage.Credential{ID: "cred-2", PublicKey: []byte("not cbor")})
+	if summary.ID != "cred-2" || summary.PublicKey != nil {
+		t.Errorf("credentialSummary() for a corrupt key = %+v, want it listed without a public key", summary)
+	}
+}
@@ -0,0 +1,38 @@
+package webauthn
+
+import (
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/polyid/auth/internal/storage"
+)
+
+// Response bodies other than the ceremony options, which follow the
+// WebAuthn spec's own naming. Keys are snake_case and are part of the API.
+
+// ErrorResponse is the body returned on failure
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // see the Code constants
+}
+
+// MessageResponse is returned by endpoints that only confirm success
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// LoginResponse is returned when a login ceremony succeeds
+type LoginResponse struct {
+	Token string        `json:"token"`
+	User  webauthn.User `json:"user"`
+}
+
+// CredentialsResponse lists a user's credentials
+type CredentialsResponse struct {
+	Credentials []CredentialSummary `json:"credentials"`
+}
+
+// AttestationResponse carries a credential's kept attestation. Certificates
+// in X5C are base64-encoded DER.
+type AttestationResponse struct {
+	Attestation *storage.Attestation `json:"attestation"`
+}
@@ -0,0 +1,70 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// jsonKeys returns the sorted top-level keys v encodes to
+func jsonKeys(t *testing.T, v interface{}) []string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal %s: %v", data, err)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestResponseKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{name: "error", value: ErrorResponse{Error: "e", Code: "c"}, want: []string{"code", "error"}},
+		{name: "error without code", value: ErrorResponse{Error: "e"}, want: []string{"error"}},
+		{name: "message", value: MessageResponse{Message: "ok"}, want: []string{"message"}},
+		{name: "login", value: LoginResponse{Token: "t", User: &testUser{id: []byte("user-1")}}, want: []string{"token", "user"}},
+		{name: "credentials", value: CredentialsResponse{}, want: []string{"credentials"}},
+		{
+			name: "credential",
+			value: CredentialSummary{
+				ID:              "cred-1",
+				AttestationType: "none",
+				RPID:            testRPID,
+				Attachment:      "platform",
+				Transports:      []string{"internal"},
+				PublicKey:       &PublicKeyInfo{Algorithm: "ES256", KeyType: "EC2", Fingerprint: "ab"},
+				CreatedAt:       time.Now(),
+			},
+			want: []string{"attachment", "attestation_type", "created_at", "id", "public_key", "rp_id", "transports"},
+		},
+		{
+			name:  "credential without optional fields",
+			value: CredentialSummary{ID: "cred-1"},
+			want:  []string{"attestation_type", "created_at", "id", "rp_id"},
+		},
+		{name: "public key", value: PublicKeyInfo{}, want: []string{"algorithm", "fingerprint", "key_type"}},
+		{name: "attestation", value: AttestationResponse{}, want: []string{"attestation"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonKeys(t, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package webauthn
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"go.uber.org/zap"
+)
+
+// BeginPasskeyUpgrade starts a conditional-create ceremony that lets a user
+// who just signed in with a password silently add a passkey. The browser
+// creates the credential without a separate prompt, so this is only offered
+// to authenticated users.
+func (h *Handler) BeginPasskeyUpgrade(c *gin.Context) {
+	user := getUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Authentication required"})
+		return
+	}
+
+	options, session, err := h.webauthn.BeginRegistration(user, h.registrationOptions()...)
+	if err != nil {
+		h.logger.Error("Failed to begin passkey upgrade", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to begin passkey upgrade"})
+		return
+	}
+	options.Mediation = protocol.MediationConditional
+
+	// Store the session data under a new ceremony
+	if !h.startCeremony(c, session) {
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishPasskeyUpgrade completes a conditional-create ceremony and stores
+// the new credential
+func (h *Handler) FinishPasskeyUpgrade(c *gin.Context) {
+	user := getUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Authentication required"})
+		return
+	}
+
+	h.finishRegistration(c, user)
+}
@@ -0,0 +1,185 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// register returns a registration response body with a "none" attestation
+// for the session's challenge as rpID at origin
+func (a *testAuthenticator) register(t *testing.T, session *webauthn.SessionData, rpID, origin string, userVerified bool) []byte {
+	t.Helper()
+
+	clientData, err := json.Marshal(map[string]string{
+		"type":      "webauthn.create",
+		"challenge": session.Challenge,
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatalf("marshal client data: %v", err)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := byte(protocol.FlagUserPresent | protocol.FlagAttestedCredentialData)
+	if userVerified {
+		flags |= byte(protocol.FlagUserVerified)
+	}
+	authData := append(rpIDHash[:], flags)
+	authData = binary.BigEndian.AppendUint32(authData, a.signCount)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, a.credential(t).PublicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("marshal attestation object: %v", err)
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	body, err := json.Marshal(map[string]interface{}{
+		"id":    encode(a.credentialID),
+		"rawId": encode(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"attestationObject": encode(attestationObject),
+		},
+	})
+	if err != nil {
+		t.Fatalf("marshal registration: %v", err)
+	}
+	return body
+}
+
+// beginRegistration starts a registration for user under a new ceremony
+func beginRegistration(t *testing.T, h *Handler, user webauthn.User) (*webauthn.SessionData, string) {
+	t.Helper()
+	_, session, err := h.webauthn.BeginRegistration(user, h.registrationOptions()...)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	ceremonyID, err := h.newCeremony(context.Background(), session)
+	if err != nil {
+		t.Fatalf("newCeremony: %v", err)
+	}
+	return session, ceremonyID
+}
+
+// postCeremony calls handler with body for the given ceremony
+func postCeremony(handler gin.HandlerFunc, ceremonyID string, body []byte) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if ceremonyID != "" {
+		c.Request.Header.Set(CeremonyHeader, ceremonyID)
+	}
+	handler(c)
+	return w
+}
+
+func TestPasskeyUpgradeRequiresAuthentication(t *testing.T) {
+	h := newTestHandler(t, Options{})
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+	}{
+		{name: "begin", handler: h.BeginPasskeyUpgrade},
+		{name: "finish", handler: h.FinishPasskeyUpgrade},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postCeremony(tt.handler, "", nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestPasskeyUpgradeFinish(t *testing.T) {
+	h := newTestHandler(t, Options{})
+	authenticator := newTestAuthenticator(t)
+	user := &testUser{id: []byte("user-1")}
+
+	session, ceremonyID := beginRegistration(t, h, user)
+	body := authenticator.register(t, session, testRPID, testOrigin, false)
+	finish := func(c *gin.Context) { h.finishRegistration(c, user) }
+
+	w := postCeremony(finish, ceremonyID, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	// The credential as finishRegistration stores it
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("ParseCredentialCreationResponseBody: %v", err)
+	}
+	credential, err := h.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		t.Fatalf("CreateCredential: %v", err)
+	}
+	stored := toStoredCredential(credential, h.webauthn.Config.RPID)
+	if want := base64.RawURLEncoding.EncodeToString(authenticator.credentialID); stored.ID != want {
+		t.Errorf("stored ID = %q, want %q", stored.ID, want)
+	}
+	if !bytes.Equal(stored.PublicKey, authenticator.credential(t).PublicKey) {
+		t.Error("stored public key differs from the authenticator's")
+	}
+	if stored.RPID != testRPID {
+		t.Errorf("stored RP ID = %q, want %q", stored.RPID, testRPID)
+	}
+
+	if w := postCeremony(finish, ceremonyID, body); w.Code == http.StatusOK {
+		t.Error("replayed ceremony was accepted")
+	}
+}
+
+func TestPasskeyUpgradeFinishRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		rpID   string
+		origin string
+	}{
+		{name: "another RP ID", rpID: "evil.example", origin: testOrigin},
+		{name: "another origin", rpID: testRPID, origin: "https://evil.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, Options{})
+			user := &testUser{id: []byte("user-1")}
+			session, ceremonyID := beginRegistration(t, h, user)
+			body := newTestAuthenticator(t).register(t, session, tt.rpID, tt.origin, false)
+
+			w := postCeremony(func(c *gin.Context) { h.finishRegistration(c, user) }, ceremonyID, body)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != CodeVerificationFailed {
+				t.Errorf("response = %s, want code %q", w.Body.String(), CodeVerificationFailed)
+			}
+		})
+	}
+}